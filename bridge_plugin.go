@@ -3,15 +3,66 @@ package lazyjack
 import (
 	"fmt"
 	"io"
+	"net"
 
 	"github.com/golang/glog"
 )
 
+const (
+	// DefaultBridgeName is the bridge used by the bridge plugin, if no
+	// name is configured
+	DefaultBridgeName = "br0"
+	// maxInterfaceNameLen is the longest Linux interface name
+	maxInterfaceNameLen = 15
+)
+
 // BridgePlugin implements the actions needed for the Bridge CNI plugin.
 type BridgePlugin struct {
 	Config *Config
 }
 
+// ValidateBridge ensures that the bridge name is a valid interface name,
+// and that the MAC address, if specified, is a unicast MAC address.
+func ValidateBridge(c *Config) error {
+	if len(BridgeName(c)) > maxInterfaceNameLen {
+		return fmt.Errorf("bridge name %q is longer than %d characters", c.Pod.Bridge.Name, maxInterfaceNameLen)
+	}
+	if c.Pod.Bridge.MAC == "" {
+		return nil
+	}
+	mac, err := net.ParseMAC(c.Pod.Bridge.MAC)
+	if err != nil || len(mac) != 6 || mac[0]&0x01 != 0 {
+		return fmt.Errorf("invalid bridge MAC address %q (use a unicast MAC, like 02:00:00:00:00:01)", c.Pod.Bridge.MAC)
+	}
+	return nil
+}
+
+// BridgeName provides the name of the bridge, using the default, if not
+// configured.
+func BridgeName(c *Config) string {
+	if c.Pod.Bridge.Name == "" {
+		return DefaultBridgeName
+	}
+	return c.Pod.Bridge.Name
+}
+
+// BridgeGatewayAddresses provides the gateway address, with the prefix
+// length of the pod subnet, for each IP family of the pod network. These
+// are the same gateways that are in the CNI config.
+func BridgeGatewayAddresses(node *Node, c *Config) []string {
+	families := 1
+	if c.General.Mode == DualStackNetMode {
+		families = 2
+	}
+	var addrs []string
+	for i := 0; i < families; i++ {
+		pInfo := c.Pod.Info[i]
+		prefix, _ := BuildPodSubnetPrefix(pInfo.Mode, pInfo.Prefix, pInfo.Size, node.ID)
+		addrs = append(addrs, fmt.Sprintf("%s1/%d", prefix, pInfo.Size))
+	}
+	return addrs
+}
+
 // WriteConfigContents builds the CNI bridge plugin's config file
 // contents. The subnet will be eight bits smaller than the pod cluster
 // network size.
@@ -20,24 +71,42 @@ func (b BridgePlugin) WriteConfigContents(node *Node, w io.Writer) (err error) {
   "cniVersion": "0.3.1",
   "name": "bmbridge",
   "type": "bridge",
-  "bridge": "br0",
-  "isDefaultGateway": true,
+`
+	flags := `  "isDefaultGateway": true,
   "ipMasq": true,
   "hairpinMode": true,
 `
 
 	cw := NewConfigWriter(w)
 	cw.Write(header)
+	cw.Write("  \"bridge\": %q,\n", BridgeName(b.Config))
+	cw.Write(flags)
 	cw.Write("  \"mtu\": %d,\n", b.Config.Pod.MTU)
 	WriteConfigForIPAM(b.Config, node, cw)
 	cw.Write("}\n")
 	return cw.Flush()
 }
 
-// Setup will take Bridge plugin specific actions to setup a node.
-// Includes setting up routes between nodes.
+// Setup will take Bridge plugin specific actions to setup a node. The
+// bridge is created (rather than waiting for the CNI plugin to create it
+// for the first pod), with the gateway address(es), and routes between
+// nodes are set up.
 func (b BridgePlugin) Setup(n *Node) error {
-	err := CreateRoutesForPodNetwork(n, b.Config)
+	name := BridgeName(b.Config)
+	bridge := b.Config.Pod.Bridge
+	err := b.Config.General.NetMgr.EnsureBridge(name, b.Config.Pod.MTU, bridge.MAC, bridge.Promisc)
+	if err != nil {
+		return err
+	}
+	for _, gw := range BridgeGatewayAddresses(n, b.Config) {
+		err = b.Config.General.NetMgr.AddAddressToLink(gw, name)
+		if err != nil {
+			return fmt.Errorf("unable to add gateway address to %s bridge: %v", name, err)
+		}
+	}
+	glog.V(4).Infof("created %s bridge for CNI bridge plugin", name)
+
+	err = CreateRoutesForPodNetwork(n, b.Config)
 	if err != nil {
 		// Note: May get error, if route already exists.
 		return err
@@ -46,8 +115,37 @@ func (b BridgePlugin) Setup(n *Node) error {
 	return nil
 }
 
+// Verify checks that the bridge has the gateway address for each IP
+// family of the pod network.
+func (b BridgePlugin) Verify(n *Node) error {
+	name := BridgeName(b.Config)
+	addrs, err := b.Config.General.NetMgr.LinkAddresses(name)
+	if err != nil {
+		return fmt.Errorf("unable to verify %s bridge: %v", name, err)
+	}
+	for _, gw := range BridgeGatewayAddresses(n, b.Config) {
+		ip, gwNet, err := net.ParseCIDR(gw)
+		if err != nil {
+			return fmt.Errorf("unable to verify %s bridge, as gateway %q is invalid: %v", name, gw, err)
+		}
+		found := false
+		for _, addr := range addrs {
+			if aIP, aNet, err := net.ParseCIDR(addr); err == nil && aIP.Equal(ip) && aNet.String() == gwNet.String() {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("%s bridge is missing gateway address %s", name, gw)
+		}
+	}
+	glog.V(1).Infof("Verified %s bridge has gateway address(es)", name)
+	return nil
+}
+
 // Cleanup performs Bridge plugin actions to clean up for a node. Includes
-// deleting routes between nodes.
+// deleting routes between nodes, any veth interfaces left on the bridge,
+// and the bridge.
 func (b BridgePlugin) Cleanup(n *Node) error {
 	err := RemoveRoutesForPodNetwork(n, b.Config)
 	if err != nil {
@@ -55,9 +153,18 @@ func (b BridgePlugin) Cleanup(n *Node) error {
 	}
 	glog.V(4).Infof("removed routes for CNI bridge plugin")
 
-	err = b.Config.General.NetMgr.RemoveBridge("br0")
+	name := BridgeName(b.Config)
+	removed, err := b.Config.General.NetMgr.DeleteVethsOnBridge(name)
+	if err != nil {
+		return fmt.Errorf("unable to remove veths on %s bridge: %v", name, err)
+	}
+	if removed > 0 {
+		glog.Infof("Removed %d leftover veth(s) on %s bridge", removed, name)
+	}
+
+	err = b.Config.General.NetMgr.RemoveBridge(name)
 	if err != nil {
-		return fmt.Errorf("unable to remove br0 bridge: %v", err)
+		return fmt.Errorf("unable to remove %s bridge: %v", name, err)
 	}
 	return nil
 }
@@ -2,6 +2,7 @@ package lazyjack_test
 
 import (
 	"bytes"
+	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -9,6 +10,7 @@ import (
 	"testing"
 
 	"github.com/pmichali/lazyjack"
+	"github.com/vishvananda/netlink"
 )
 
 func TestBridgeCNIConfigContents(t *testing.T) {
@@ -213,6 +215,31 @@ func TestCreateBridgeCNIConfigFile(t *testing.T) {
 	if err != nil {
 		t.Fatalf("FAILED: Expected to be able to create CNI config file: %s", err.Error())
 	}
+	filename := filepath.Join(cniArea, lazyjack.CNIConfFile)
+	expected, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("FAILED: Unable to read created CNI config file: %s", err.Error())
+	}
+
+	// Stale config file, from a prior configuration, is replaced
+	err = ioutil.WriteFile(filename, []byte(`{"name": "stale"}`), 0755)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create stale CNI config file for test")
+	}
+	err = lazyjack.EnsureCNIAreaExists(cniArea)
+	if err == nil {
+		err = lazyjack.CreateCNIConfigFile(n, c)
+	}
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to recreate CNI config file: %s", err.Error())
+	}
+	actual, err := ioutil.ReadFile(filename)
+	if err != nil {
+		t.Fatalf("FAILED: Unable to read CNI config file: %s", err.Error())
+	}
+	if string(actual) != string(expected) {
+		t.Fatalf("FAILED: Expected stale CNI config file to be replaced.\nExpected:\n%s\nActual:\n%s\n", expected, actual)
+	}
 }
 
 func TestFailedSetupUnableToCreateBridgeCNIConfigFile(t *testing.T) {
@@ -298,7 +325,7 @@ func TestFailedBridgePluginSetup(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected to not be able to create route")
 	}
-	expected := "unable to add pod network route for fd00:40:0:0:20::/80 to minion1: mock failure adding route"
+	expected := "unable to add pod network route to fd00:40:0:0:20::/80 via fd00:100::20: mock failure adding route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
 	}
@@ -349,7 +376,7 @@ func TestFailedRemoveRoutesBridgePluginCleanup(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected to not be able to remove route")
 	}
-	expected := "unable to remove routes for bridge plugin: unable to delete pod network route for fd00:40:0:0:20::/80 to minion1: mock failure deleting route"
+	expected := "unable to remove routes for bridge plugin: unable to delete pod network route to fd00:40:0:0:20::/80 via fd00:100::20: mock failure deleting route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg to start with %q, got %q", expected, err.Error())
 	}
@@ -405,3 +432,195 @@ func TestFailedBridgeRemoveBridgePluginCleanup(t *testing.T) {
 		t.Fatalf("FAILED: Expected msg to start with %q, got %q", expected, err.Error())
 	}
 }
+
+func TestValidateBridge(t *testing.T) {
+	var testCases = []struct {
+		name   string
+		bridge lazyjack.BridgeConfig
+		valid  bool
+	}{
+		{name: "defaults", bridge: lazyjack.BridgeConfig{}, valid: true},
+		{name: "name and MAC", bridge: lazyjack.BridgeConfig{Name: "cbr0", MAC: "02:00:00:00:00:01"}, valid: true},
+		{name: "long name", bridge: lazyjack.BridgeConfig{Name: "lazyjack-bridge0"}, valid: false},
+		{name: "bad MAC", bridge: lazyjack.BridgeConfig{MAC: "02:00:00"}, valid: false},
+		{name: "multicast MAC", bridge: lazyjack.BridgeConfig{MAC: "01:00:5e:00:00:01"}, valid: false},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{Pod: lazyjack.PodNetwork{Bridge: tc.bridge}}
+		err := lazyjack.ValidateBridge(c)
+		if tc.valid && err != nil {
+			t.Errorf("FAILED: [%s] Expected bridge to be valid: %s", tc.name, err.Error())
+		} else if !tc.valid && err == nil {
+			t.Errorf("FAILED: [%s] Expected bridge to be invalid", tc.name)
+		}
+	}
+}
+
+func TestBridgeCNIConfigContentsNamedBridge(t *testing.T) {
+	c := &lazyjack.Config{
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{
+					Prefix: "fd00:40:0:0:",
+					Mode:   lazyjack.IPv6NetMode,
+					Size:   80,
+				},
+			},
+			MTU:    9000,
+			Bridge: lazyjack.BridgeConfig{Name: "cbr0"},
+		},
+		General: lazyjack.GeneralSettings{
+			Mode: "ipv6",
+		},
+	}
+	c.General.CNIPlugin = lazyjack.BridgePlugin{c}
+	actual := new(bytes.Buffer)
+	err := c.General.CNIPlugin.WriteConfigContents(&lazyjack.Node{ID: 10}, actual)
+	if err != nil {
+		t.Fatalf("FAILED! Expected to be able to write CNI configuration %s", err.Error())
+	}
+	if !strings.Contains(actual.String(), "  \"bridge\": \"cbr0\",\n") {
+		t.Fatalf("FAILED: Expected configured bridge name in CNI config, got:\n%s", actual.String())
+	}
+}
+
+func TestBridgeGatewayAddresses(t *testing.T) {
+	c := &lazyjack.Config{
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{Prefix: "10.244.0.", Mode: lazyjack.IPv4NetMode, Size: 24},
+				{Prefix: "fd00:40:0:0:", Mode: lazyjack.IPv6NetMode, Size: 80},
+			},
+		},
+		General: lazyjack.GeneralSettings{Mode: lazyjack.DualStackNetMode},
+	}
+	actual := strings.Join(lazyjack.BridgeGatewayAddresses(&lazyjack.Node{ID: 10}, c), ", ")
+	expected := "10.244.10.1/24, fd00:40:0:0:a::1/80"
+	if actual != expected {
+		t.Fatalf("FAILED: Expected gateways %q, got %q", expected, actual)
+	}
+
+	c.General.Mode = lazyjack.IPv4NetMode
+	actual = strings.Join(lazyjack.BridgeGatewayAddresses(&lazyjack.Node{ID: 10}, c), ", ")
+	if actual != "10.244.10.1/24" {
+		t.Fatalf("FAILED: Expected only IPv4 gateway, got %q", actual)
+	}
+}
+
+func TestBridgePluginSetupAndVerify(t *testing.T) {
+	nl := &mockNetLink{simNoLink: true}
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"master": {IsMaster: true, Name: "master", ID: 0x10},
+		},
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{Prefix: "fd00:40:0:0:", Mode: lazyjack.IPv6NetMode, Size: 80},
+			},
+			MTU:    9000,
+			Bridge: lazyjack.BridgeConfig{Name: "cbr0", MAC: "02:00:00:00:00:10", Promisc: true},
+		},
+		General: lazyjack.GeneralSettings{
+			Mode:   lazyjack.IPv6NetMode,
+			NetMgr: lazyjack.NetMgr{Server: nl},
+		},
+	}
+	c.General.CNIPlugin = lazyjack.BridgePlugin{c}
+	n := &lazyjack.Node{Name: "master", Interface: "eth1", IsMaster: true, ID: 0x10}
+
+	// Not set up yet
+	err := c.General.CNIPlugin.Verify(n)
+	if err == nil {
+		t.Fatalf("FAILED: Expected verify to fail, when no bridge")
+	}
+
+	err = c.General.CNIPlugin.Setup(n)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to set up bridge plugin: %s", err.Error())
+	}
+	if len(nl.links) != 1 {
+		t.Fatalf("FAILED: Expected bridge to be created, got %v", nl.links)
+	}
+	bridge := nl.links[0]
+	if bridge.Type() != "bridge" || bridge.Attrs().Name != "cbr0" || bridge.Attrs().MTU != 9000 ||
+		bridge.Attrs().HardwareAddr.String() != "02:00:00:00:00:10" || bridge.Attrs().Promisc != 1 {
+		t.Fatalf("FAILED: Bridge created with wrong settings %+v", bridge.Attrs())
+	}
+
+	err = c.General.CNIPlugin.Verify(n)
+	if err != nil {
+		t.Fatalf("FAILED: Expected bridge to have gateway address: %s", err.Error())
+	}
+
+	// Bridge from another node's setup
+	n.ID = 0x20
+	err = c.General.CNIPlugin.Verify(n)
+	if err == nil {
+		t.Fatalf("FAILED: Expected verify to fail, when bridge is missing gateway")
+	}
+	expected := "cbr0 bridge is missing gateway address fd00:40:0:0:20::1/80"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
+	}
+}
+
+func TestFailedBridgeCreateBridgePluginSetup(t *testing.T) {
+	c := &lazyjack.Config{
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{Prefix: "fd00:40:0:0:", Mode: lazyjack.IPv6NetMode, Size: 80},
+			},
+		},
+		General: lazyjack.GeneralSettings{
+			NetMgr: lazyjack.NetMgr{Server: &mockNetLink{simNoLink: true, simLinkAddFail: true}},
+		},
+	}
+	c.General.CNIPlugin = lazyjack.BridgePlugin{c}
+	err := c.General.CNIPlugin.Setup(&lazyjack.Node{Name: "master", ID: 0x10})
+	if err == nil {
+		t.Fatalf("FAILED: Expected to not be able to create bridge")
+	}
+	expected := "unable to create bridge \"br0\": mock failure to add link"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
+	}
+}
+
+func TestBridgePluginCleanupRemovesVeths(t *testing.T) {
+	nl := &mockNetLink{}
+	bridge := &netlink.Bridge{}
+	bridge.Name = "cbr0"
+	bridge.Index = 7
+	nl.links = append(nl.links, bridge)
+	for i, master := range []int{7, 7, 9} {
+		veth := &netlink.Veth{}
+		veth.Name = fmt.Sprintf("veth%d", i)
+		veth.MasterIndex = master
+		nl.links = append(nl.links, veth)
+	}
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"master": {Name: "master", ID: 0x10, IsMaster: true},
+		},
+		General: lazyjack.GeneralSettings{NetMgr: lazyjack.NetMgr{Server: nl}},
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{Prefix: "fd00:40:0:0:", Size: 80},
+			},
+			Bridge: lazyjack.BridgeConfig{Name: "cbr0"},
+		},
+	}
+	c.General.CNIPlugin = lazyjack.BridgePlugin{c}
+	err := c.General.CNIPlugin.Cleanup(&lazyjack.Node{Name: "master", ID: 0x10, IsMaster: true})
+	if err != nil {
+		t.Fatalf("FAILED: Expected to clean up bridge plugin: %s", err.Error())
+	}
+	var remaining []string
+	for _, link := range nl.links {
+		remaining = append(remaining, link.Attrs().Name)
+	}
+	expected := "veth2"
+	if strings.Join(remaining, ", ") != expected {
+		t.Fatalf("FAILED: Expected only veth on other bridge to remain, got %q", strings.Join(remaining, ", "))
+	}
+}
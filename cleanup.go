@@ -49,10 +49,10 @@ func RevertEntries(file, backup string) error {
 func RemoveDropInFile(c *Config) error {
 	glog.V(1).Info("Cleaning kubelet drop-in file")
 	file := filepath.Join(c.General.SystemdArea, KubeletDropInFile)
-	err := os.Remove(file)
+	err := FS().Remove(file)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return fmt.Errorf("no kubelet drop-in file to remove")
+			return notFoundErrorf("no kubelet drop-in file to remove")
 		}
 		return fmt.Errorf("unable to remove kubelet drop-in file (%s): %s", file, err.Error())
 	}
@@ -102,9 +102,14 @@ func RemoveRouteForDNS64(node *Node, c *Config) error {
 	var gw string
 	var ok bool
 	var err error
-	if node.IsNAT64Server {
+	if node.IsNAT64Server && UsingJool(c) {
+		return nil // No route, as Jool translates on this node
+	} else if node.IsNAT64Server {
 		gw = c.NAT64.ServerIP
 		err = c.General.NetMgr.DeleteRouteUsingSupportNetInterface(dest, gw, c.Support.V4CIDR)
+	} else if gws := FindHostIPsForNAT64(c); len(gws) > 1 {
+		gw = strings.Join(gws, ", ")
+		err = c.General.NetMgr.DeleteRoutesUsingInterfaceName(dest, gws, node.Interface, c.NAT64.Routing)
 	} else {
 		gw, ok = FindHostIPForNAT64(c)
 		if !ok {
@@ -120,24 +125,25 @@ func RemoveRouteForDNS64(node *Node, c *Config) error {
 	return nil
 }
 
-// RemoveRouteForNAT64 removes the route to the support network via the
-// NAT64 server's manage,ent IP.
+// RemoveRouteForNAT64 removes the route(s) to the support network via the
+// NAT64 server's management IP(s).
 func RemoveRouteForNAT64(node *Node, c *Config) error {
-	dest := c.Support.CIDR
-	var gw string
-	var ok bool
-	var err error
-	gw, ok = FindHostIPForNAT64(c)
-	if !ok {
-		err = fmt.Errorf("unable to find node with NAT64 server configured")
-	} else {
-		err = c.General.NetMgr.DeleteRouteUsingInterfaceName(dest, gw, node.Interface)
-	}
+	routes, err := SupportNetworkRoutes(node, c)
 	if err != nil {
-		return fmt.Errorf("unable to delete route to %s via %s: %v", dest, gw, err)
+		return fmt.Errorf("unable to determine routes to support network %s: %v", c.Support.CIDR, err)
 	}
-	glog.V(4).Infof("Deleted route to %s via %s", dest, gw)
-	return nil
+	results := &MultiError{}
+	for _, r := range routes {
+		step := fmt.Sprintf("delete route to %s via %s", r.Dest, r.GW)
+		err = c.General.NetMgr.DeleteRouteUsingInterfaceName(r.Dest, r.GW, node.Interface)
+		if err != nil {
+			results.Add(step, fmt.Errorf("unable to %s: %w", step, err))
+			continue
+		}
+		results.Add(step, nil)
+		glog.V(4).Infof("Deleted route to %s via %s", r.Dest, r.GW)
+	}
+	return results.ErrorOrNil()
 }
 
 // CleanupClusterNode removes the kubelet drop-in file, management port's
@@ -145,59 +151,37 @@ func RemoveRouteForNAT64(node *Node, c *Config) error {
 // DNS network, and removes route to NAT64 server (when the node is not
 // the node hosting the server).
 func CleanupClusterNode(node *Node, c *Config) error {
-	var all []string
-	glog.V(1).Info("Cleaning general settings")
-	err := RemoveDropInFile(c)
-	if err != nil {
-		glog.V(4).Info(err.Error())
-		all = append(all, err.Error())
-	}
-
-	err = RemoveManagementIP(node, c)
-	if err != nil {
-		glog.V(4).Info(err.Error())
-		all = append(all, err.Error())
-	}
-
-	err = RevertEtcAreaFile(c, EtcHostsFile, EtcHostsBackupFile)
-	if err != nil {
-		glog.V(4).Info(err.Error())
-		all = append(all, err.Error())
-	}
-	err = RevertEtcAreaFile(c, EtcResolvConfFile, EtcResolvConfBackupFile)
-	if err != nil {
-		glog.V(4).Info(err.Error())
-		all = append(all, err.Error())
-	}
-
-	if c.General.Mode == "ipv6" {
-		err = RemoveRouteForDNS64(node, c)
+	results := &MultiError{}
+	step := func(name string, err error) {
 		if err != nil {
 			glog.V(4).Info(err.Error())
-			all = append(all, err.Error())
 		}
+		results.Add(name, err)
+	}
+	glog.V(1).Info("Cleaning general settings")
+	step("remove kubelet drop-in file", RemoveDropInFile(c))
+	step("remove management IP", RemoveManagementIP(node, c))
+	step("revert hosts file", RevertEtcAreaFile(c, EtcHostsFile, EtcHostsBackupFile))
+	step("revert resolv.conf file", RevertEtcAreaFile(c, EtcResolvConfFile, EtcResolvConfBackupFile))
 
-		if !node.IsNAT64Server && !node.IsDNS64Server {
-			err = RemoveRouteForNAT64(node, c)
-			if err != nil {
-				glog.V(4).Info(err.Error())
-				all = append(all, err.Error())
-			}
+	if c.General.Mode == "ipv6" {
+		step("remove route to DNS64 network", RemoveRouteForDNS64(node, c))
+
+		if (!node.IsNAT64Server && !node.IsDNS64Server) || len(ServerNodes(c)) > 1 {
+			step("remove routes to support network", RemoveRouteForNAT64(node, c))
 		}
 	}
+	step("remove persistent network config", RemovePersistentNetConfig(node, c))
 
 	glog.Info("Cleaned general settings")
-	if len(all) > 0 {
-		return fmt.Errorf(strings.Join(all, ". "))
-	}
-	return nil
+	return results.ErrorOrNil()
 }
 
 // RemoveContainer checks to see if the container is present, and if so,
 // removes the container.
 func RemoveContainer(name string, c *Config) error {
 	if c.General.Hyper.ResourceState(name) == ResourceNotPresent {
-		return fmt.Errorf("skipping - No %q container exists", name)
+		return notFoundErrorf("skipping - No %q container exists", name)
 	}
 	err := c.General.Hyper.DeleteContainer(name)
 	if err != nil {
@@ -211,33 +195,27 @@ func RemoveContainer(name string, c *Config) error {
 // files. The IPv4 default route is not altered.
 func CleanupDNS64Server(c *Config) error {
 	glog.V(1).Info("Cleaning DNS64")
-	var all []string
-	var err error
-	err = RemoveContainer(DNS64Name, c)
-	if err != nil {
-		all = append(all, err.Error())
-	} else {
+	results := &MultiError{}
+	err := RemoveContainer(DNS64Name, c)
+	if err == nil {
 		glog.V(4).Info("Removed DNS64 container")
 	}
+	results.Add("remove DNS64 container", err)
 
 	if c.General.Hyper.ResourceState(DNS64Volume) == ResourceNotPresent {
-		all = append(all, fmt.Sprintf("skipping - No %q volume", DNS64Volume))
+		err = notFoundErrorf("skipping - No %q volume", DNS64Volume)
 	} else {
 		err = c.General.Hyper.DeleteVolume(DNS64Volume)
-		if err != nil {
-			all = append(all, err.Error())
-		} else {
+		if err == nil {
 			glog.V(4).Info("Removed volume used for DNS64 container")
 		}
 	}
+	results.Add("remove DNS64 volume", err)
 
 	// Will leave V4 default route
 
 	glog.Info("Cleaned DNS64")
-	if len(all) > 0 {
-		return fmt.Errorf(strings.Join(all, ". "))
-	}
-	return nil
+	return results.ErrorOrNil()
 }
 
 // CleanupNAT64Server removes the NAT64 server and route to server.
@@ -245,36 +223,30 @@ func CleanupDNS64Server(c *Config) error {
 func CleanupNAT64Server(c *Config) error {
 	glog.V(1).Info("Cleaning NAT64")
 
-	var all []string
-	var err error
-	err = c.General.NetMgr.DeleteRouteUsingSupportNetInterface(c.NAT64.V4MappingCIDR, c.NAT64.V4MappingIP, c.Support.V4CIDR)
-	if err != nil {
-		all = append(all, err.Error())
-	} else {
+	results := &MultiError{}
+	err := c.General.NetMgr.DeleteRouteUsingSupportNetInterface(c.NAT64.V4MappingCIDR, c.NAT64.V4MappingIP, c.Support.V4CIDR)
+	if err == nil {
 		glog.V(1).Info("Removed local IPv4 route to NAT64 container")
 	}
+	results.Add("remove IPv4 route to NAT64 container", err)
 
 	err = RemoveContainer(NAT64Name, c)
-	if err != nil {
-		all = append(all, err.Error())
-	} else {
+	if err == nil {
 		glog.V(4).Info("Removed NAT64 container")
 	}
+	results.Add("remove NAT64 container", err)
 
 	// Will leave default V4 route
 
 	glog.Info("Cleaned NAT64")
-	if len(all) > 0 {
-		return fmt.Errorf(strings.Join(all, ". "))
-	}
-	return nil
+	return results.ErrorOrNil()
 }
 
 // CleanupSupportNetwork checks to see if the support network exists,
 // and if so, removes the network.
 func CleanupSupportNetwork(c *Config) error {
 	if c.General.Hyper.ResourceState(SupportNetName) == ResourceNotPresent {
-		return fmt.Errorf("skipping - support network does not exists")
+		return notFoundErrorf("skipping - support network does not exists")
 	}
 
 	err := c.General.Hyper.DeleteNetwork(SupportNetName)
@@ -286,42 +258,35 @@ func CleanupSupportNetwork(c *Config) error {
 }
 
 // Cleanup is the top level method for the "clean" action, to remove/revert
-// config files, remove routes, and delete DNS64/NAT64 containers.
+// config files, remove routes, and delete DNS64/NAT64 containers. All the
+// steps are attempted, and any unsuccessful ones are reported in a
+// MultiError.
 func Cleanup(name string, c *Config) error {
 	node := c.Topology[name]
-	var all []string
-	var err error
+	results := &MultiError{}
 	glog.Infof("Cleaning %q", name)
+	if c.General.Mode == IPv6NetMode && (node.IsDNS64Server || node.IsNAT64Server) {
+		UseServerIPsForNode(&node, c)
+	}
 	if node.IsMaster || node.IsMinion {
-		err = CleanupClusterNode(&node, c)
-		if err != nil {
-			all = append(all, err.Error())
-		}
+		results.Add("clean cluster node", CleanupClusterNode(&node, c))
 	}
 	if c.General.Mode == IPv6NetMode {
-		if node.IsDNS64Server {
-			err = CleanupDNS64Server(c)
-			if err != nil {
-				all = append(all, err.Error())
-			}
+		if node.IsDNS64Server && c.DNS64.Backend == BuiltinDNS64Backend {
+			results.Add("clean builtin DNS64 server", CleanupBuiltinDNS64Server(c))
+		} else if node.IsDNS64Server {
+			results.Add("clean DNS64 server", CleanupDNS64Server(c))
 		}
-		if node.IsNAT64Server {
-			err = CleanupNAT64Server(c)
-			if err != nil {
-				all = append(all, err.Error())
-			}
+		if node.IsNAT64Server && UsingJool(c) {
+			results.Add("clean Jool NAT64", CleanupJoolNAT64(c))
+		} else if node.IsNAT64Server {
+			results.Add("clean NAT64 server", CleanupNAT64Server(c))
 		}
 		if node.IsDNS64Server || node.IsNAT64Server {
-			err = CleanupSupportNetwork(c)
-			if err != nil {
-				all = append(all, err.Error())
-			}
+			results.Add("clean support network", CleanupSupportNetwork(c))
 		}
 	}
 
 	glog.Infof("Node %q cleaned", name)
-	if len(all) > 0 {
-		return fmt.Errorf(strings.Join(all, ". "))
-	}
-	return nil
+	return results.ErrorOrNil()
 }
@@ -2,6 +2,7 @@ package lazyjack_test
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -679,7 +680,7 @@ func TestFailedNoNATRemoveRouteForNAT64(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected not to be able to remove route")
 	}
-	expected := "unable to delete route to 2001:db8::/64 via : unable to find node with NAT64 server configured"
+	expected := "unable to determine routes to support network 2001:db8::/64: unable to find node with NAT64 server configured"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected reason to be  %q, got %q", expected, err.Error())
 	}
@@ -836,6 +837,14 @@ func TestFailedCleanupClusterNode(t *testing.T) {
 			t.Errorf("FAILED: Expected reason to match pattern %q, got %q", expected[i].String(), actual[i])
 		}
 	}
+	var results *lazyjack.MultiError
+	if !errors.As(err, &results) {
+		t.Fatalf("FAILED: Expected step results, got %T", err)
+	}
+	failed := results.Failed()
+	if len(failed) != 5 || failed[0].Step != "remove management IP" {
+		t.Fatalf("FAILED: Expected five failed steps, after skipped drop-in file removal, got %+v", failed)
+	}
 }
 
 func TestRemoveContainer(t *testing.T) {
@@ -948,6 +957,16 @@ func TestSkippedDeleteVolumeCleanupDNS64Server(t *testing.T) {
 	if !strings.HasPrefix(err.Error(), expected) {
 		t.Fatalf("FAILED: Expected reason to be  %q, got %q", expected, err.Error())
 	}
+	var results *lazyjack.MultiError
+	if !errors.As(err, &results) {
+		t.Fatalf("FAILED: Expected step results, got %T", err)
+	}
+	if len(results.Results) != 2 || len(results.Failed()) != 0 {
+		t.Fatalf("FAILED: Expected two skipped steps, got %+v", results.Results)
+	}
+	if !errors.Is(err, lazyjack.ErrNotFound) {
+		t.Fatalf("FAILED: Expected skipped steps to be for missing resources")
+	}
 }
 
 func TestCleanupNAT64Server(t *testing.T) {
@@ -1,6 +1,8 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"flag"
 	"fmt"
 	"log"
@@ -44,7 +46,7 @@ func main() {
 	var err error
 
 	flag.Usage = func() {
-		fmt.Fprintf(os.Stderr, "Usage: %s [options] {init|prepare|up|down|clean|version}\n", filepath.Base(os.Args[0]))
+		fmt.Fprintf(os.Stderr, "Usage: %s [options] {init|prepare|up|down|clean|routes|sync-routes|dns64|version}\n", filepath.Base(os.Args[0]))
 		flag.PrintDefaults()
 	}
 
@@ -54,6 +56,7 @@ func main() {
 	}
 	var configFile = flag.String("config", "config.yaml", "Configurations for lazyjack")
 	var host = flag.String("host", thisHost, "Name of (this) host to apply command")
+	var root = flag.String("root", "", "Mounted root of image to provision (prepare and up only)")
 
 	InitLogs()
 	defer FlushLogs()
@@ -83,6 +86,7 @@ func main() {
 		fmt.Printf("ERROR: %s\n", err.Error())
 		os.Exit(1)
 	}
+	config.General.ConfigFile, _ = filepath.Abs(*configFile)
 	ignoreMissing := (command == "init")
 	err = lazyjack.ValidateConfigContents(config, ignoreMissing)
 	if err != nil {
@@ -97,31 +101,61 @@ func main() {
 
 	glog.V(1).Infof("Command %q on host %q", command, *host)
 
-	switch command {
-	case "init":
-		err = lazyjack.Initialize(*host, config, *configFile)
+	if command == "dns64" {
+		err = lazyjack.RunDNS64Server(*host, config)
 		if err != nil {
-			glog.Errorf(err.Error())
+			glog.Error(err)
 			os.Exit(1)
 		}
-	case "prepare":
-		err = lazyjack.Prepare(*host, config)
-		if err != nil {
-			glog.Errorf(err.Error())
+		glog.V(4).Info("Command completed")
+		return
+	}
+
+	opts := []lazyjack.Option{lazyjack.WithConfigFile(*configFile)}
+	if *root != "" {
+		if command != "prepare" && command != "up" {
+			fmt.Printf("ERROR: The -root option is only supported for prepare and up commands\n")
 			os.Exit(1)
 		}
+		opts = append(opts, lazyjack.WithImageRoot(*root))
+	}
+	runner, err := lazyjack.NewRunner(*host, config, opts...)
+	if err != nil {
+		fmt.Printf("ERROR: %s\n", err.Error())
+		os.Exit(1)
+	}
+	ctx := context.Background()
+	switch command {
+	case "init":
+		_, err = runner.Init(ctx)
+	case "prepare":
+		_, err = runner.Prepare(ctx)
 	case "up":
-		lazyjack.BringUp(*host, config)
+		_, err = runner.Up(ctx)
 	case "down":
-		lazyjack.TearDown(*host, config)
+		_, err = runner.Down(ctx)
 	case "clean":
-		err := lazyjack.Cleanup(*host, config)
-		if err != nil {
-			glog.Warning(err.Error())
-		}
+		_, err = runner.Clean(ctx)
+	case "routes":
+		_, err = runner.Routes(ctx)
+	case "sync-routes":
+		_, err = runner.SyncRoutes(ctx)
 	default:
 		fmt.Printf("Unknown command %q\n", command)
 		os.Exit(1)
 	}
+	if err != nil {
+		// Down and clean perform all their steps, before reporting the
+		// ones that failed.
+		var multi *lazyjack.MultiError
+		if errors.As(err, &multi) {
+			for _, step := range multi.Failed() {
+				glog.Errorf("%s: %v", step.Step, step.Err)
+			}
+		} else {
+			glog.Error(err)
+		}
+		os.Exit(1)
+	}
 	glog.V(4).Info("Command completed")
 }
@@ -35,16 +35,28 @@ type ManagementNetwork struct {
 
 // PodNetwork defines information for the the pod network.
 type PodNetwork struct {
-	CIDR  string     `yaml:"cidr"`
-	CIDR2 string     `yaml:"cidr2"`
-	Info  [2]NetInfo // Internal
-	MTU   int        `yaml:"mtu"`
+	CIDR   string       `yaml:"cidr"`
+	CIDR2  string       `yaml:"cidr2"`
+	Info   [2]NetInfo   // Internal
+	MTU    int          `yaml:"mtu"`
+	Bridge BridgeConfig `yaml:"bridge"`
 }
 
-// ServiceNetwork defines information for the service network.
+// BridgeConfig defines the bridge used by the bridge plugin. The name
+// defaults to br0, and the MAC address is optional.
+type BridgeConfig struct {
+	Name    string `yaml:"name"`
+	MAC     string `yaml:"mac"`
+	Promisc bool   `yaml:"promisc"`
+}
+
+// ServiceNetwork defines information for the service network. For
+// dual-stack, a second CIDR of the other IP family may be specified.
 type ServiceNetwork struct {
-	CIDR string  `yaml:"cidr"`
-	Info NetInfo // Internal
+	CIDR  string  `yaml:"cidr"`
+	CIDR2 string  `yaml:"cidr2"`
+	Info  NetInfo // Internal
+	Info2 NetInfo // Internal
 }
 
 // DNS64Config defines information for the DNS64 server configuration.
@@ -55,6 +67,17 @@ type DNS64Config struct {
 	ServerIP       string `yaml:"ip"`
 	AllowIPv6Use   bool   `yaml:"allow_ipv6_use"` // Deprecated
 	AllowAAAAUse   bool   `yaml:"allow_aaaa_use"`
+	Backend        string `yaml:"backend"`
+
+	// Settings used only by the bind9 backend
+	RemoteServers    []string    `yaml:"remote_servers"`
+	Exclude          []string    `yaml:"exclude"`
+	Clients          []string    `yaml:"clients"`
+	Mapped           []string    `yaml:"mapped"`
+	LocalZones       []DNS64Zone `yaml:"local_zones"`
+	TopologyZone     string      `yaml:"topology_zone"`
+	DNSSECValidation string      `yaml:"dnssec_validation"`
+	Recursion        string      `yaml:"recursion"`
 }
 
 // NAT64Config defines information for the NAT64 server configuration.
@@ -62,6 +85,8 @@ type NAT64Config struct {
 	V4MappingCIDR string `yaml:"v4_cidr"`
 	V4MappingIP   string `yaml:"v4_ip"`
 	ServerIP      string `yaml:"ip"`
+	Routing       string `yaml:"routing"`
+	Backend       string `yaml:"backend"`
 }
 
 // Node defines information for the node.
@@ -74,26 +99,41 @@ type Node struct {
 	IsMinion       bool
 	IsDNS64Server  bool
 	IsNAT64Server  bool
+	DNS64IP        string `yaml:"dns64_ip"`
+	NAT64IP        string `yaml:"nat64_ip"`
 }
 
 // GeneralSettings defines general settings used by the app.
 type GeneralSettings struct {
 	Mode               string     `yaml:"mode"`
 	Plugin             string     `yaml:"plugin"`
-	Token              string     `yaml:"token"`           // Internal
-	TokenCertHash      string     `yaml:"token-cert-hash"` // Internal
+	Token              string     `yaml:"token"`           // Deprecated, use secrets-file
+	TokenCertHash      string     `yaml:"token-cert-hash"` // Deprecated, use secrets-file
+	SecretsFile        string     `yaml:"secrets-file"`
+	SecretsCommand     string     `yaml:"secrets-command"`
 	WorkArea           string     `yaml:"work-area"`
+	ConfigFile         string     // Internal
 	CNIPlugin          PluginAPI  // Internal
 	SystemdArea        string     // Internal
 	EtcArea            string     // Internal
 	CNIArea            string     // Internal
 	K8sCertArea        string     // Internal
+	ImageRoot          string     // Internal
 	NetMgr             Networker  // Internal
 	Hyper              Hypervisor // Internal
 	KubeAdmVersion     string     // Internal
+	KubeAdmAPIVersion  string     // Internal
 	FullKubeAdmVersion string     // Internal
 	K8sVersion         string     `yaml:"kubernetes-version"`
 	Insecure           bool       `yaml:"insecure"`
+	Runtime            string     `yaml:"runtime"`
+	RuntimeSocket      string     `yaml:"runtime-socket"`
+	Hypervisor         string     `yaml:"hypervisor"`
+	ReadyTimeout       string     `yaml:"ready-timeout"`
+	SkipHealthChecks   bool       `yaml:"skip-health-checks"`
+	PersistentNet      string     `yaml:"persistent-net"`
+	PersistRoutes      bool       `yaml:"persist-routes"`
+	RoutesInterval     string     `yaml:"routes-interval"`
 }
 
 // Config defines the top level configuration read from YAML file.
@@ -107,6 +147,8 @@ type Config struct {
 	Service  ServiceNetwork    `yaml:"service_net"`
 	NAT64    NAT64Config       `yaml:"nat64"`
 	DNS64    DNS64Config       `yaml:"dns64"`
+	KubeAdm  KubeAdmConfig     `yaml:"kubeadm"`
+	Images   ImagesConfig      `yaml:"images"`
 }
 
 const (
@@ -166,6 +208,15 @@ const (
 	// DefaultToken used when in insecure mode
 	DefaultToken = "abcdef.abcdefghijklmnop"
 
+	// DefaultSecretsFile name of file, next to config file, holding token and hash
+	DefaultSecretsFile = "secrets.yaml"
+	// SecretsFileMode permissions for the secrets file (owner only)
+	SecretsFileMode = 0600
+	// TokenEnvVar environment variable that can supply the token
+	TokenEnvVar = "LAZYJACK_TOKEN"
+	// TokenCertHashEnvVar environment variable that can supply the token certificate hash
+	TokenCertHashEnvVar = "LAZYJACK_TOKEN_CERT_HASH"
+
 	// MinimumPodMTU is the smallest MTU for IPv6
 	MinimumPodMTU = 1280
 	// DefaultPodMTU is the default MTU to use, when not specified
@@ -195,6 +246,16 @@ type KubeAdmConfigInfo struct {
 	ServiceSubnet    string
 	UseCoreDNS       bool
 	TypeDNS          string
+	CRISocket        string
+	CgroupDriver     string
+	// Dual-stack settings, for newer templates
+	DualStack            bool
+	DualStackFeatureGate bool
+	PodSubnets           string
+	ServiceSubnets       string
+	NodeIPs              string
+	NodeCIDRMaskSizeV4   int
+	NodeCIDRMaskSizeV6   int
 }
 
 // Template_v1_10 kubeadm.conf content template for Kubernetes V1.10
@@ -300,7 +361,7 @@ kubeletConfiguration:
       webhook:
         cacheAuthorizedTTL: 5m0s
         cacheUnauthorizedTTL: 30s
-    cgroupDriver: cgroupfs
+    cgroupDriver: {{.CgroupDriver}}
     cgroupsPerQOS: true
     clusterDNS:
     - "{{.DNS_ServiceIP}}"
@@ -378,7 +439,7 @@ bootstrapTokens:
   - authentication
 kind: InitConfiguration
 nodeRegistration:
-  criSocket: /var/run/dockershim.sock
+  criSocket: {{.CRISocket}}
   name: {{.KubeMasterName}}
   taints:
   - effect: NoSchedule
@@ -424,7 +485,7 @@ bootstrapTokens:
   - authentication
 kind: InitConfiguration
 nodeRegistration:
-  criSocket: /var/run/dockershim.sock
+  criSocket: {{.CRISocket}}
   name: {{.KubeMasterName}}
   taints:
   - effect: NoSchedule
@@ -509,7 +570,7 @@ authorization:
   webhook:
     cacheAuthorizedTTL: 5m0s
     cacheUnauthorizedTTL: 30s
-cgroupDriver: cgroupfs
+cgroupDriver: {{.CgroupDriver}}
 cgroupsPerQOS: true
 clusterDNS:
 - "{{.DNS_ServiceIP}}"
@@ -0,0 +1,520 @@
+package lazyjack
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// Bind9DNS64Backend runs the DNS64 server as a bind9 container
+	Bind9DNS64Backend = "bind9"
+	// BuiltinDNS64Backend runs the DNS64 server as part of lazyjack, under systemd
+	BuiltinDNS64Backend = "builtin"
+	// DefaultDNS64Backend used, when not specified
+	DefaultDNS64Backend = Bind9DNS64Backend
+
+	// DNS64ServiceFile name of the systemd unit for the builtin DNS64 server
+	DNS64ServiceFile = "lazyjack-dns64.service"
+	// DNS64ForwardTimeout is the time limit for queries to the remote server
+	DNS64ForwardTimeout = 5 * time.Second
+	// DNS64MaxWorkers limits the UDP queries, and the TCP connections, that
+	// are handled at once
+	DNS64MaxWorkers = 64
+
+	dnsPort       = 53
+	minUDPSize    = 512
+	maxDNSMessage = 65535
+)
+
+// ValidateDNS64Backend ensures that the DNS64 backend is supported. The
+// default is the bind9 container.
+func ValidateDNS64Backend(c *Config) error {
+	if c.DNS64.Backend == "" {
+		c.DNS64.Backend = DefaultDNS64Backend
+	}
+	c.DNS64.Backend = strings.ToLower(c.DNS64.Backend)
+	switch c.DNS64.Backend {
+	case Bind9DNS64Backend, BuiltinDNS64Backend:
+		return nil
+	default:
+		return fmt.Errorf("unsupported DNS64 backend %q (use %s or %s)", c.DNS64.Backend, Bind9DNS64Backend, BuiltinDNS64Backend)
+	}
+}
+
+// DNS64Server is a DNS64 resolver (RFC 6147), which forwards queries to
+// a remote server, and synthesizes AAAA records from A records, using the
+// DNS64 prefix. The defaults are used for a zero timeout or worker limit.
+type DNS64Server struct {
+	Listen     string
+	Upstream   string
+	Prefix     net.IP
+	AllowAAAA  bool
+	Timeout    time.Duration
+	MaxWorkers int
+}
+
+// timeout provides the time limit for I/O with the remote server and the
+// clients.
+func (s *DNS64Server) timeout() time.Duration {
+	if s.Timeout <= 0 {
+		return DNS64ForwardTimeout
+	}
+	return s.Timeout
+}
+
+// newWorkers creates a semaphore that limits the requests that are handled
+// at once.
+func (s *DNS64Server) newWorkers() chan struct{} {
+	if s.MaxWorkers <= 0 {
+		return make(chan struct{}, DNS64MaxWorkers)
+	}
+	return make(chan struct{}, s.MaxWorkers)
+}
+
+// NewDNS64Server creates a DNS64 server that listens on the DNS64 server
+// IP and forwards to the remote (IPv4) server. The DNS64 CIDR must have a
+// /96 prefix.
+func NewDNS64Server(c *Config) (*DNS64Server, error) {
+	ip, ipnet, err := net.ParseCIDR(c.DNS64.CIDR)
+	if err != nil || ip.To4() != nil {
+		return nil, fmt.Errorf("invalid DNS64 CIDR %q", c.DNS64.CIDR)
+	}
+	if size, _ := ipnet.Mask.Size(); size != 96 {
+		return nil, fmt.Errorf("DNS64 CIDR %q must have a /96 prefix for the builtin DNS64 server", c.DNS64.CIDR)
+	}
+	return &DNS64Server{
+		Listen:     net.JoinHostPort(c.DNS64.ServerIP, fmt.Sprintf("%d", dnsPort)),
+		Upstream:   net.JoinHostPort(c.DNS64.RemoteV4Server, fmt.Sprintf("%d", dnsPort)),
+		Prefix:     ipnet.IP,
+		AllowAAAA:  c.DNS64.AllowAAAAUse,
+		Timeout:    DNS64ForwardTimeout,
+		MaxWorkers: DNS64MaxWorkers,
+	}, nil
+}
+
+// Synthesize forms the IPv6 address from the DNS64 prefix and IPv4 address.
+func (s *DNS64Server) Synthesize(v4 [4]byte) [16]byte {
+	var v6 [16]byte
+	copy(v6[:12], s.Prefix.To16())
+	copy(v6[12:], v4[:])
+	return v6
+}
+
+// readTCPMessage reads a length prefixed DNS message from a stream.
+func readTCPMessage(r io.Reader) ([]byte, error) {
+	var length uint16
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, length)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeTCPMessage writes a length prefixed DNS message to a stream.
+func writeTCPMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	_, err := w.Write(append(buf, msg...))
+	return err
+}
+
+// Forward sends the query to the remote server, and returns the response.
+// If the UDP response is truncated, the query is retried using TCP.
+func (s *DNS64Server) Forward(query []byte) ([]byte, error) {
+	response, err := s.exchange("udp", query)
+	if err != nil {
+		return nil, err
+	}
+	var h dnsmessage.Parser
+	header, err := h.Start(response)
+	if err == nil && header.Truncated {
+		glog.V(4).Infof("Truncated response from %s, retrying with TCP", s.Upstream)
+		return s.exchange("tcp", query)
+	}
+	return response, nil
+}
+
+func (s *DNS64Server) exchange(network string, query []byte) ([]byte, error) {
+	conn, err := net.DialTimeout(network, s.Upstream, s.timeout())
+	if err != nil {
+		return nil, fmt.Errorf("unable to reach DNS server %s: %v", s.Upstream, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(s.timeout()))
+
+	var response []byte
+	if network == "tcp" {
+		if err = writeTCPMessage(conn, query); err == nil {
+			response, err = readTCPMessage(conn)
+		}
+	} else if _, err = conn.Write(query); err == nil {
+		buf := make([]byte, maxDNSMessage)
+		var n int
+		n, err = conn.Read(buf)
+		response = buf[:n]
+	}
+	if err != nil {
+		return nil, fmt.Errorf("no response from DNS server %s: %v", s.Upstream, err)
+	}
+	if len(response) < 2 || len(query) < 2 || !bytes.Equal(response[:2], query[:2]) {
+		return nil, fmt.Errorf("mismatched response from DNS server %s", s.Upstream)
+	}
+	return response, nil
+}
+
+// forwardMessage packs and forwards the message, returning the unpacked
+// response.
+func (s *DNS64Server) forwardMessage(m *dnsmessage.Message) (*dnsmessage.Message, error) {
+	query, err := m.Pack()
+	if err != nil {
+		return nil, fmt.Errorf("unable to build DNS query: %v", err)
+	}
+	raw, err := s.Forward(query)
+	if err != nil {
+		return nil, err
+	}
+	response := &dnsmessage.Message{}
+	if err = response.Unpack(raw); err != nil {
+		return nil, fmt.Errorf("malformed response from DNS server %s: %v", s.Upstream, err)
+	}
+	return response, nil
+}
+
+func hasAAAA(answers []dnsmessage.Resource) bool {
+	for _, a := range answers {
+		if a.Header.Type == dnsmessage.TypeAAAA {
+			return true
+		}
+	}
+	return false
+}
+
+// Resolve handles a DNS query. Anything other than an AAAA query is
+// forwarded as-is. For AAAA queries, if there are no AAAA records (or the
+// use of AAAA records is not allowed), the A records are obtained, and
+// AAAA records are synthesized from them.
+func (s *DNS64Server) Resolve(query []byte) ([]byte, error) {
+	var q dnsmessage.Message
+	if err := q.Unpack(query); err != nil {
+		return nil, fmt.Errorf("malformed DNS query: %v", err)
+	}
+	if len(q.Questions) != 1 || q.Questions[0].Type != dnsmessage.TypeAAAA || q.Questions[0].Class != dnsmessage.ClassINET {
+		return s.Forward(query)
+	}
+
+	raw, err := s.Forward(query)
+	if err != nil {
+		return nil, err
+	}
+	var r dnsmessage.Message
+	if err = r.Unpack(raw); err != nil {
+		return nil, fmt.Errorf("malformed response from DNS server %s: %v", s.Upstream, err)
+	}
+	if r.RCode != dnsmessage.RCodeSuccess || (s.AllowAAAA && hasAAAA(r.Answers)) {
+		return raw, nil
+	}
+
+	aQuery := q
+	aQuery.Questions = []dnsmessage.Question{q.Questions[0]}
+	aQuery.Questions[0].Type = dnsmessage.TypeA
+	a, err := s.forwardMessage(&aQuery)
+	if err != nil {
+		return nil, err
+	}
+
+	result := dnsmessage.Message{Header: r.Header, Questions: q.Questions}
+	for _, answer := range a.Answers {
+		switch body := answer.Body.(type) {
+		case *dnsmessage.AResource:
+			aaaa := &dnsmessage.AAAAResource{AAAA: s.Synthesize(body.A)}
+			header := answer.Header
+			header.Type = dnsmessage.TypeAAAA
+			result.Answers = append(result.Answers, dnsmessage.Resource{Header: header, Body: aaaa})
+		case *dnsmessage.CNAMEResource:
+			result.Answers = append(result.Answers, answer)
+		}
+	}
+	if len(result.Answers) == 0 {
+		if a.RCode == dnsmessage.RCodeNameError {
+			result.RCode = a.RCode
+		}
+		result.Authorities = a.Authorities
+	}
+	for _, additional := range r.Additionals {
+		if additional.Header.Type == dnsmessage.TypeOPT {
+			result.Additionals = append(result.Additionals, additional)
+		}
+	}
+	glog.V(4).Infof("Synthesized %d AAAA records for %s", len(result.Answers), q.Questions[0].Name)
+	return result.Pack()
+}
+
+// ServerFailure builds a SERVFAIL response for the query.
+func ServerFailure(query []byte) []byte {
+	var p dnsmessage.Parser
+	header, err := p.Start(query)
+	if err != nil {
+		return nil
+	}
+	question, _ := p.Question()
+	m := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:               header.ID,
+			Response:         true,
+			OpCode:           header.OpCode,
+			RecursionDesired: header.RecursionDesired,
+			RCode:            dnsmessage.RCodeServerFailure,
+		},
+	}
+	if question.Name.Length > 0 {
+		m.Questions = []dnsmessage.Question{question}
+	}
+	response, _ := m.Pack()
+	return response
+}
+
+// udpSizeFor determines the maximum UDP response size the client accepts.
+func udpSizeFor(query []byte) int {
+	var q dnsmessage.Message
+	if q.Unpack(query) == nil {
+		for _, additional := range q.Additionals {
+			if additional.Header.Type == dnsmessage.TypeOPT && int(additional.Header.Class) > minUDPSize {
+				return int(additional.Header.Class)
+			}
+		}
+	}
+	return minUDPSize
+}
+
+// truncate builds a truncated response, so that the client will retry
+// using TCP.
+func truncate(response []byte) []byte {
+	var m dnsmessage.Message
+	if m.Unpack(response) != nil {
+		return response
+	}
+	m.Truncated = true
+	m.Answers, m.Authorities, m.Additionals = nil, nil, nil
+	truncated, err := m.Pack()
+	if err != nil {
+		return response
+	}
+	return truncated
+}
+
+func (s *DNS64Server) handle(query []byte) []byte {
+	response, err := s.Resolve(query)
+	if err != nil {
+		glog.Warningf("Unable to resolve DNS query: %v", err)
+		return ServerFailure(query)
+	}
+	return response
+}
+
+// ServeUDP handles DNS queries received on the connection, until it is
+// closed. When the limit of queries being handled is reached, further
+// queries wait in the socket's buffer.
+func (s *DNS64Server) ServeUDP(conn net.PacketConn) error {
+	workers := s.newWorkers()
+	buf := make([]byte, maxDNSMessage)
+	for {
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return err
+		}
+		query := make([]byte, n)
+		copy(query, buf[:n])
+		workers <- struct{}{}
+		go func() {
+			defer func() { <-workers }()
+			response := s.handle(query)
+			if response == nil {
+				return
+			}
+			if len(response) > udpSizeFor(query) {
+				response = truncate(response)
+			}
+			conn.WriteTo(response, addr)
+		}()
+	}
+}
+
+// ServeTCP handles DNS queries on connections accepted from the listener,
+// until it is closed. When the limit of connections being handled is
+// reached, further connections wait to be accepted. Idle connections are
+// closed, after the timeout.
+func (s *DNS64Server) ServeTCP(l net.Listener) error {
+	workers := s.newWorkers()
+	for {
+		workers <- struct{}{}
+		conn, err := l.Accept()
+		if err != nil {
+			<-workers
+			return err
+		}
+		go func() {
+			defer func() { <-workers }()
+			defer conn.Close()
+			for {
+				conn.SetReadDeadline(time.Now().Add(s.timeout()))
+				query, err := readTCPMessage(conn)
+				if err != nil {
+					return
+				}
+				response := s.handle(query)
+				if response == nil {
+					return
+				}
+				conn.SetWriteDeadline(time.Now().Add(s.timeout()))
+				if writeTCPMessage(conn, response) != nil {
+					return
+				}
+			}
+		}()
+	}
+}
+
+// ListenAndServe handles DNS queries, using UDP and TCP, on the listen
+// address.
+func (s *DNS64Server) ListenAndServe() error {
+	conn, err := net.ListenPacket("udp", s.Listen)
+	if err != nil {
+		return fmt.Errorf("unable to listen for DNS requests on %s: %v", s.Listen, err)
+	}
+	defer conn.Close()
+	l, err := net.Listen("tcp", s.Listen)
+	if err != nil {
+		return fmt.Errorf("unable to listen for DNS requests on %s: %v", s.Listen, err)
+	}
+	defer l.Close()
+
+	glog.Infof("DNS64 server listening on %s, using %s/96, forwarding to %s", s.Listen, s.Prefix, s.Upstream)
+	errs := make(chan error, 2)
+	go func() { errs <- s.ServeUDP(conn) }()
+	go func() { errs <- s.ServeTCP(l) }()
+	return <-errs
+}
+
+// RunDNS64Server runs the builtin DNS64 server, which is invoked by the
+// systemd service. The DNS64 server IP (for the host) is added to the
+// loopback interface, so that the other nodes (which route to the support
+// network via this node) can reach it.
+func RunDNS64Server(host string, c *Config) error {
+	node, ok := c.Topology[host]
+	if !ok || !node.IsDNS64Server {
+		return fmt.Errorf("node %q is not configured as a DNS64 server", host)
+	}
+	UseServerIPsForNode(&node, c)
+	server, err := NewDNS64Server(c)
+	if err != nil {
+		return err
+	}
+	err = c.General.NetMgr.AddAddressToLink(c.DNS64.ServerIP+"/128", "lo")
+	if err != nil {
+		return err
+	}
+	return server.ListenAndServe()
+}
+
+// SystemdUnitArea is the area for systemd unit files, which is where the
+// kubelet drop-in area is located.
+func SystemdUnitArea(c *Config) string {
+	return filepath.Dir(c.General.SystemdArea)
+}
+
+// CreateDNS64ServiceContents constructs the contents of the systemd unit
+// file, which runs the builtin DNS64 server, using the lazyjack executable
+// and config file specified.
+func CreateDNS64ServiceContents(exe, host string, c *Config) *bytes.Buffer {
+	contents := bytes.NewBufferString(`[Unit]
+Description=lazyjack DNS64 server
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+`)
+	fmt.Fprintf(contents, "ExecStart=%s --config %s --host %s dns64\n", exe, c.General.ConfigFile, host)
+	fmt.Fprintf(contents, `Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`)
+	return contents
+}
+
+// CreateDNS64ServiceFile creates the systemd unit file for the builtin
+// DNS64 server. The config file must be known, as the service uses it.
+func CreateDNS64ServiceFile(host string, c *Config) error {
+	if c.General.ConfigFile == "" {
+		return fmt.Errorf("config file must be specified for the builtin DNS64 service")
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to determine lazyjack executable for DNS64 service: %v", err)
+	}
+	contents := CreateDNS64ServiceContents(exe, host, c)
+	unit := filepath.Join(SystemdUnitArea(c), DNS64ServiceFile)
+	err = FS().WriteFile(unit, contents.Bytes(), 0644)
+	if err != nil {
+		return fmt.Errorf("unable to create systemd unit %s for DNS64: %v", unit, err)
+	}
+	glog.V(1).Infof("Created %s", unit)
+	return nil
+}
+
+// PrepareBuiltinDNS64Server sets up the systemd service for the builtin
+// DNS64 server, and (re)starts it.
+func PrepareBuiltinDNS64Server(host string, c *Config) error {
+	err := CreateDNS64ServiceFile(host, c)
+	if err != nil {
+		return err
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", DNS64ServiceFile}, {"restart", DNS64ServiceFile}} {
+		_, err = DoExecCommand("systemctl", args)
+		if err != nil {
+			return fmt.Errorf("unable to start builtin DNS64 server: %v", err)
+		}
+	}
+	glog.Info("Prepared builtin DNS64 server")
+	return nil
+}
+
+// CleanupBuiltinDNS64Server stops the builtin DNS64 server, removes the
+// systemd service, and removes the DNS64 server IP from the loopback
+// interface.
+func CleanupBuiltinDNS64Server(c *Config) error {
+	glog.V(1).Info("Cleaning builtin DNS64")
+	results := &MultiError{}
+	_, err := DoExecCommand("systemctl", []string{"disable", "--now", DNS64ServiceFile})
+	if err != nil {
+		err = fmt.Errorf("unable to stop builtin DNS64 server: %w", err)
+	}
+	results.Add("stop builtin DNS64 server", err)
+	unit := filepath.Join(SystemdUnitArea(c), DNS64ServiceFile)
+	err = FS().Remove(unit)
+	if os.IsNotExist(err) {
+		err = notFoundErrorf("unable to remove systemd unit %s for DNS64: %v", unit, err)
+	} else if err != nil {
+		err = fmt.Errorf("unable to remove systemd unit %s for DNS64: %w", unit, err)
+	} else {
+		DoExecCommand("systemctl", []string{"daemon-reload"})
+	}
+	results.Add("remove DNS64 systemd unit", err)
+	results.Add("remove DNS64 server IP", c.General.NetMgr.RemoveAddressFromLink(c.DNS64.ServerIP+"/128", "lo"))
+	glog.Info("Cleaned builtin DNS64")
+	return results.ErrorOrNil()
+}
@@ -0,0 +1,569 @@
+package lazyjack_test
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmichali/lazyjack"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// dnsStub is a stand-in for the remote DNS server, which replies to
+// queries over UDP and TCP with canned answers, keyed by name and type.
+type dnsStub struct {
+	udp       net.PacketConn
+	tcp       net.Listener
+	answers   map[string][]dnsmessage.Resource
+	rcodes    map[string]dnsmessage.RCode
+	truncated map[string]bool
+	queries   []string
+}
+
+func (s *dnsStub) reply(query []byte, overTCP bool) []byte {
+	var q dnsmessage.Message
+	if q.Unpack(query) != nil || len(q.Questions) != 1 {
+		return nil
+	}
+	key := q.Questions[0].Name.String() + " " + q.Questions[0].Type.String()
+	if overTCP {
+		s.queries = append(s.queries, key+" (TCP)")
+	} else {
+		s.queries = append(s.queries, key)
+	}
+	r := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: q.ID, Response: true, RecursionAvailable: true, RCode: s.rcodes[key]},
+		Questions: q.Questions,
+	}
+	if s.truncated[key] && !overTCP {
+		r.Truncated = true
+	} else {
+		r.Answers = s.answers[key]
+	}
+	if len(r.Answers) == 0 {
+		r.Authorities = []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("example.com."), Class: dnsmessage.ClassINET, TTL: 300},
+				Body: &dnsmessage.SOAResource{
+					NS: dnsmessage.MustNewName("ns.example.com."), MBox: dnsmessage.MustNewName("admin.example.com."),
+					Serial: 1, Refresh: 7200, Retry: 3600, Expire: 1209600, MinTTL: 300,
+				},
+			},
+		}
+	}
+	response, _ := r.Pack()
+	return response
+}
+
+// HelperDNSStub starts a DNS server stub on the loopback interface, using
+// the same port for UDP and TCP.
+func HelperDNSStub(t *testing.T) *dnsStub {
+	s := &dnsStub{
+		answers:   map[string][]dnsmessage.Resource{},
+		rcodes:    map[string]dnsmessage.RCode{},
+		truncated: map[string]bool{},
+	}
+	var err error
+	s.tcp, err = net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS stub for test: %s", err.Error())
+	}
+	s.udp, err = net.ListenPacket("udp", s.tcp.Addr().String())
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS stub for test: %s", err.Error())
+	}
+	go func() {
+		buf := make([]byte, 65535)
+		for {
+			n, addr, err := s.udp.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			s.udp.WriteTo(s.reply(buf[:n], false), addr)
+		}
+	}()
+	go func() {
+		for {
+			conn, err := s.tcp.Accept()
+			if err != nil {
+				return
+			}
+			var length uint16
+			binary.Read(conn, binary.BigEndian, &length)
+			query := make([]byte, length)
+			io.ReadFull(conn, query)
+			response := s.reply(query, true)
+			binary.Write(conn, binary.BigEndian, uint16(len(response)))
+			conn.Write(response)
+			conn.Close()
+		}
+	}()
+	return s
+}
+
+func (s *dnsStub) Close() {
+	s.udp.Close()
+	s.tcp.Close()
+}
+
+func aRecord(name string, ip string) dnsmessage.Resource {
+	var a [4]byte
+	copy(a[:], net.ParseIP(ip).To4())
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 60},
+		Body:   &dnsmessage.AResource{A: a},
+	}
+}
+
+func aaaaRecord(name string, ip string) dnsmessage.Resource {
+	var aaaa [16]byte
+	copy(aaaa[:], net.ParseIP(ip))
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 60},
+		Body:   &dnsmessage.AAAAResource{AAAA: aaaa},
+	}
+}
+
+func cnameRecord(name string, target string) dnsmessage.Resource {
+	return dnsmessage.Resource{
+		Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name), Class: dnsmessage.ClassINET, TTL: 60},
+		Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(target)},
+	}
+}
+
+func buildQuery(name string, qtype dnsmessage.Type) []byte {
+	q := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: 0x1234, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: dnsmessage.MustNewName(name), Type: qtype, Class: dnsmessage.ClassINET},
+		},
+	}
+	query, _ := q.Pack()
+	return query
+}
+
+// answersFor summarizes the answers in the response, for comparison.
+func answersFor(response []byte, t *testing.T) (dnsmessage.RCode, string) {
+	var r dnsmessage.Message
+	if err := r.Unpack(response); err != nil {
+		t.Fatalf("FAILED: Unable to parse response: %s", err.Error())
+	}
+	if r.ID != 0x1234 {
+		t.Fatalf("FAILED: Response has wrong ID %x", r.ID)
+	}
+	var answers []string
+	for _, a := range r.Answers {
+		switch body := a.Body.(type) {
+		case *dnsmessage.AResource:
+			answers = append(answers, net.IP(body.A[:]).String())
+		case *dnsmessage.AAAAResource:
+			answers = append(answers, net.IP(body.AAAA[:]).String())
+		case *dnsmessage.CNAMEResource:
+			answers = append(answers, "CNAME "+body.CNAME.String())
+		default:
+			answers = append(answers, a.Header.Type.String())
+		}
+	}
+	return r.RCode, strings.Join(answers, ",")
+}
+
+func TestValidateDNS64Backend(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		backend     string
+		expected    string
+		expectedStr string
+	}{
+		{name: "default", backend: "", expected: lazyjack.Bind9DNS64Backend},
+		{name: "bind9", backend: "bind9", expected: lazyjack.Bind9DNS64Backend},
+		{name: "builtin", backend: "Builtin", expected: lazyjack.BuiltinDNS64Backend},
+		{name: "unsupported", backend: "unbound", expectedStr: "unsupported DNS64 backend \"unbound\" (use bind9 or builtin)"},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{DNS64: lazyjack.DNS64Config{Backend: tc.backend}}
+		err := lazyjack.ValidateDNS64Backend(c)
+		if tc.expectedStr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected backend to be valid: %s", tc.name, err.Error())
+			} else if c.DNS64.Backend != tc.expected {
+				t.Errorf("FAILED: [%s] Expected backend %q, got %q", tc.name, tc.expected, c.DNS64.Backend)
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected backend to be invalid", tc.name)
+		} else if err.Error() != tc.expectedStr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedStr, err.Error())
+		}
+	}
+}
+
+func TestNewDNS64Server(t *testing.T) {
+	c := &lazyjack.Config{
+		DNS64: lazyjack.DNS64Config{
+			CIDR:           "fd00:10:64:ff9b::/96",
+			ServerIP:       "fd00:10::100",
+			RemoteV4Server: "8.8.8.8",
+		},
+	}
+	s, err := lazyjack.NewDNS64Server(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create DNS64 server: %s", err.Error())
+	}
+	if s.Listen != "[fd00:10::100]:53" || s.Upstream != "8.8.8.8:53" {
+		t.Fatalf("FAILED: Expected server on [fd00:10::100]:53 forwarding to 8.8.8.8:53, got %s and %s", s.Listen, s.Upstream)
+	}
+	v6 := s.Synthesize([4]byte{93, 184, 216, 34})
+	actual := net.IP(v6[:]).String()
+	if actual != "fd00:10:64:ff9b::5db8:d822" {
+		t.Fatalf("FAILED: Expected synthesized address fd00:10:64:ff9b::5db8:d822, got %s", actual)
+	}
+
+	c.DNS64.CIDR = "fd00:10:64::/64"
+	_, err = lazyjack.NewDNS64Server(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure with non /96 prefix")
+	}
+	expected := "DNS64 CIDR \"fd00:10:64::/64\" must have a /96 prefix for the builtin DNS64 server"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestDNS64Resolve(t *testing.T) {
+	stub := HelperDNSStub(t)
+	defer stub.Close()
+	stub.answers["v4only.example.com. TypeA"] = []dnsmessage.Resource{aRecord("v4only.example.com.", "93.184.216.34")}
+	stub.answers["alias.example.com. TypeA"] = []dnsmessage.Resource{
+		cnameRecord("alias.example.com.", "v4only.example.com."),
+		aRecord("v4only.example.com.", "93.184.216.34"),
+	}
+	stub.answers["dual.example.com. TypeA"] = []dnsmessage.Resource{aRecord("dual.example.com.", "10.1.2.3")}
+	stub.answers["dual.example.com. TypeAAAA"] = []dnsmessage.Resource{aaaaRecord("dual.example.com.", "2001:db8::5")}
+	stub.rcodes["missing.example.com. TypeAAAA"] = dnsmessage.RCodeNameError
+	stub.answers["many.example.com. TypeA"] = []dnsmessage.Resource{aRecord("many.example.com.", "10.0.0.1"), aRecord("many.example.com.", "10.0.0.2")}
+	stub.truncated["many.example.com. TypeA"] = true
+	stub.answers["v4only.example.com. TypeMX"] = []dnsmessage.Resource{
+		{
+			Header: dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName("v4only.example.com."), Class: dnsmessage.ClassINET, TTL: 60},
+			Body:   &dnsmessage.MXResource{Pref: 10, MX: dnsmessage.MustNewName("mail.example.com.")},
+		},
+	}
+
+	var testCases = []struct {
+		name     string
+		query    string
+		qtype    dnsmessage.Type
+		allow    bool
+		rcode    dnsmessage.RCode
+		expected string
+		queries  string
+	}{
+		{
+			name:     "synthesize from A",
+			query:    "v4only.example.com.",
+			qtype:    dnsmessage.TypeAAAA,
+			expected: "fd00:10:64:ff9b::5db8:d822",
+			queries:  "v4only.example.com. TypeAAAA,v4only.example.com. TypeA",
+		},
+		{
+			name:     "synthesize keeping CNAME",
+			query:    "alias.example.com.",
+			qtype:    dnsmessage.TypeAAAA,
+			expected: "CNAME v4only.example.com.,fd00:10:64:ff9b::5db8:d822",
+			queries:  "alias.example.com. TypeAAAA,alias.example.com. TypeA",
+		},
+		{
+			name:     "AAAA allowed",
+			query:    "dual.example.com.",
+			qtype:    dnsmessage.TypeAAAA,
+			allow:    true,
+			expected: "2001:db8::5",
+			queries:  "dual.example.com. TypeAAAA",
+		},
+		{
+			name:     "AAAA excluded",
+			query:    "dual.example.com.",
+			qtype:    dnsmessage.TypeAAAA,
+			expected: "fd00:10:64:ff9b::a01:203",
+			queries:  "dual.example.com. TypeAAAA,dual.example.com. TypeA",
+		},
+		{
+			name:     "no such domain",
+			query:    "missing.example.com.",
+			qtype:    dnsmessage.TypeAAAA,
+			rcode:    dnsmessage.RCodeNameError,
+			expected: "",
+			queries:  "missing.example.com. TypeAAAA",
+		},
+		{
+			name:     "no A records",
+			query:    "empty.example.com.",
+			qtype:    dnsmessage.TypeAAAA,
+			expected: "",
+			queries:  "empty.example.com. TypeAAAA,empty.example.com. TypeA",
+		},
+		{
+			name:     "truncated retried with TCP",
+			query:    "many.example.com.",
+			qtype:    dnsmessage.TypeAAAA,
+			expected: "fd00:10:64:ff9b::a00:1,fd00:10:64:ff9b::a00:2",
+			queries:  "many.example.com. TypeAAAA,many.example.com. TypeA,many.example.com. TypeA (TCP)",
+		},
+		{
+			name:     "other types forwarded",
+			query:    "v4only.example.com.",
+			qtype:    dnsmessage.TypeMX,
+			expected: "TypeMX",
+			queries:  "v4only.example.com. TypeMX",
+		},
+	}
+	for _, tc := range testCases {
+		s := &lazyjack.DNS64Server{
+			Upstream:  stub.tcp.Addr().String(),
+			Prefix:    net.ParseIP("fd00:10:64:ff9b::"),
+			AllowAAAA: tc.allow,
+			Timeout:   time.Second,
+		}
+		stub.queries = nil
+		response, err := s.Resolve(buildQuery(tc.query, tc.qtype))
+		if err != nil {
+			t.Errorf("FAILED: [%s] Expected to resolve: %s", tc.name, err.Error())
+			continue
+		}
+		rcode, answers := answersFor(response, t)
+		if rcode != tc.rcode {
+			t.Errorf("FAILED: [%s] Expected rcode %v, got %v", tc.name, tc.rcode, rcode)
+		}
+		if answers != tc.expected {
+			t.Errorf("FAILED: [%s] Expected answers %q, got %q", tc.name, tc.expected, answers)
+		}
+		if strings.Join(stub.queries, ",") != tc.queries {
+			t.Errorf("FAILED: [%s] Expected queries %q, got %q", tc.name, tc.queries, strings.Join(stub.queries, ","))
+		}
+	}
+}
+
+func TestDNS64ServeUDP(t *testing.T) {
+	stub := HelperDNSStub(t)
+	defer stub.Close()
+	stub.answers["v4only.example.com. TypeA"] = []dnsmessage.Resource{aRecord("v4only.example.com.", "93.184.216.34")}
+
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS64 server socket for test: %s", err.Error())
+	}
+	defer conn.Close()
+	s := &lazyjack.DNS64Server{
+		Upstream: stub.tcp.Addr().String(),
+		Prefix:   net.ParseIP("fd00:10:64:ff9b::"),
+		Timeout:  time.Second,
+	}
+	go s.ServeUDP(conn)
+
+	client, err := net.Dial("udp", conn.LocalAddr().String())
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS client for test: %s", err.Error())
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	_, err = client.Write(buildQuery("v4only.example.com.", dnsmessage.TypeAAAA))
+	if err != nil {
+		t.Fatalf("FAILED: Unable to send query: %s", err.Error())
+	}
+	buf := make([]byte, 512)
+	n, err := client.Read(buf)
+	if err != nil {
+		t.Fatalf("FAILED: No response from DNS64 server: %s", err.Error())
+	}
+	_, answers := answersFor(buf[:n], t)
+	if answers != "fd00:10:64:ff9b::5db8:d822" {
+		t.Fatalf("FAILED: Expected synthesized answer, got %q", answers)
+	}
+
+	// Remote server not reachable
+	stub.Close()
+	_, err = client.Write(buildQuery("v4only.example.com.", dnsmessage.TypeAAAA))
+	if err != nil {
+		t.Fatalf("FAILED: Unable to send query: %s", err.Error())
+	}
+	n, err = client.Read(buf)
+	if err != nil {
+		t.Fatalf("FAILED: No response from DNS64 server: %s", err.Error())
+	}
+	rcode, _ := answersFor(buf[:n], t)
+	if rcode != dnsmessage.RCodeServerFailure {
+		t.Fatalf("FAILED: Expected server failure, got %v", rcode)
+	}
+}
+
+func TestDNS64ServeTCPLimits(t *testing.T) {
+	stub := HelperDNSStub(t)
+	defer stub.Close()
+	stub.answers["v4only.example.com. TypeA"] = []dnsmessage.Resource{aRecord("v4only.example.com.", "93.184.216.34")}
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS64 server listener for test: %s", err.Error())
+	}
+	defer l.Close()
+	s := &lazyjack.DNS64Server{
+		Upstream:   stub.tcp.Addr().String(),
+		Prefix:     net.ParseIP("fd00:10:64:ff9b::"),
+		Timeout:    200 * time.Millisecond,
+		MaxWorkers: 1,
+	}
+	go s.ServeTCP(l)
+
+	// Idle connection uses the only worker, until it times out
+	idle, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS client for test: %s", err.Error())
+	}
+	defer idle.Close()
+	time.Sleep(50 * time.Millisecond)
+
+	client, err := net.Dial("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS client for test: %s", err.Error())
+	}
+	defer client.Close()
+	client.SetDeadline(time.Now().Add(2 * time.Second))
+	start := time.Now()
+	query := buildQuery("v4only.example.com.", dnsmessage.TypeAAAA)
+	binary.Write(client, binary.BigEndian, uint16(len(query)))
+	client.Write(query)
+	var length uint16
+	if err := binary.Read(client, binary.BigEndian, &length); err != nil {
+		t.Fatalf("FAILED: No response from DNS64 server: %s", err.Error())
+	}
+	if time.Since(start) < 100*time.Millisecond {
+		t.Fatalf("FAILED: Expected query to wait for idle connection to time out")
+	}
+	response := make([]byte, length)
+	if _, err := io.ReadFull(client, response); err != nil {
+		t.Fatalf("FAILED: Unable to read response: %s", err.Error())
+	}
+	_, answers := answersFor(response, t)
+	if answers != "fd00:10:64:ff9b::5db8:d822" {
+		t.Fatalf("FAILED: Expected synthesized answer, got %q", answers)
+	}
+
+	idle.SetDeadline(time.Now().Add(time.Second))
+	if _, err := idle.Read(make([]byte, 1)); err != io.EOF {
+		t.Fatalf("FAILED: Expected idle connection to be closed, got %v", err)
+	}
+}
+
+func TestCreateDNS64ServiceContents(t *testing.T) {
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			ConfigFile: "/root/config.yaml",
+		},
+	}
+	expected := `[Unit]
+Description=lazyjack DNS64 server
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+ExecStart=/usr/local/bin/lazyjack --config /root/config.yaml --host master dns64
+Restart=on-failure
+RestartSec=5
+
+[Install]
+WantedBy=multi-user.target
+`
+	actual := lazyjack.CreateDNS64ServiceContents("/usr/local/bin/lazyjack", "master", c)
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Service file contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+}
+
+// HelperDNS64SystemctlExecCommand mocks OS command requests for systemctl,
+// when managing the DNS64 service
+func HelperDNS64SystemctlExecCommand(cmd string, args []string) (string, error) {
+	if cmd != "systemctl" {
+		return "", fmt.Errorf("Test setup error - expected to be mocking systemctl command only")
+	}
+	if len(args) == 0 || args[len(args)-1] != lazyjack.DNS64ServiceFile && args[0] != "daemon-reload" {
+		return "", fmt.Errorf("Wrong args for systemctl command: %v", args)
+	}
+	return "", nil
+}
+
+func TestPrepareAndCleanupBuiltinDNS64Server(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	lazyjack.RegisterExecCommand(HelperDNS64SystemctlExecCommand)
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			SystemdArea: filepath.Join(basePath, "kubelet.service.d"),
+			ConfigFile:  "/root/config.yaml",
+			NetMgr:      lazyjack.NetMgr{Server: &mockNetLink{}},
+		},
+		DNS64: lazyjack.DNS64Config{
+			ServerIP: "fd00:10::100",
+			Backend:  lazyjack.BuiltinDNS64Backend,
+		},
+	}
+	err := lazyjack.PrepareBuiltinDNS64Server("master", c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to prepare builtin DNS64 server: %s", err.Error())
+	}
+	unit := filepath.Join(basePath, lazyjack.DNS64ServiceFile)
+	contents, err := ioutil.ReadFile(unit)
+	if err != nil {
+		t.Fatalf("FAILED: Expected service file to be created: %s", err.Error())
+	}
+	if !strings.Contains(string(contents), "--config /root/config.yaml --host master dns64\n") {
+		t.Fatalf("FAILED: Expected service to run DNS64 command:\n%s", contents)
+	}
+
+	err = lazyjack.CleanupBuiltinDNS64Server(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected mock to indicate no address on loopback to remove")
+	}
+	expected := "skipping - address \"fd00:10::100/128\" does not exist on interface \"lo\""
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+	if _, err = os.Stat(unit); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected service file to be removed")
+	}
+}
+
+func TestFailedPrepareBuiltinDNS64ServerNoConfigFile(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	lazyjack.RegisterExecCommand(HelperDNS64SystemctlExecCommand)
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			SystemdArea: filepath.Join(basePath, "kubelet.service.d"),
+		},
+	}
+	err := lazyjack.PrepareBuiltinDNS64Server("master", c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected builtin DNS64 server prepare to fail, without config file")
+	}
+	expected := "config file must be specified for the builtin DNS64 service"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(basePath, lazyjack.DNS64ServiceFile)); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected service file to not be created")
+	}
+}
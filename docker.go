@@ -39,14 +39,23 @@ func (d *Docker) ResourceState(r string) string {
 }
 
 // DoCommand performs a docker command, collecting and returning output.
-// TODO: Perform in a separate go-routine with a timeout, and abort handling.
 func (d *Docker) DoCommand(name string, args []string) (string, error) {
+	return d.DoCommandWithInput(name, args, "")
+}
+
+// DoCommandWithInput performs a docker command, providing the input (if
+// any) on stdin, and collecting and returning output.
+// TODO: Perform in a separate go-routine with a timeout, and abort handling.
+func (d *Docker) DoCommandWithInput(name string, args []string, input string) (string, error) {
 	glog.V(4).Infof("Invoking: docker %s", strings.Join(args, " "))
 	cmd := args[0]
 	c := exec.Command(d.Command, args...)
+	if input != "" {
+		c.Stdin = strings.NewReader(input)
+	}
 	output, err := c.Output()
 	if err != nil {
-		return "", fmt.Errorf("docker %q failed for %q: %v (%s)", cmd, name, err, output)
+		return "", newCommandError(err, "docker %q failed for %q: %v (%s)", cmd, name, err, output)
 	}
 	glog.V(4).Infof("Docker %q operation successful", name)
 	return string(output), nil
@@ -60,9 +69,10 @@ func BuildRunArgsForDNS64(c *Config) []string {
 		"--privileged=true", "--ip6", c.DNS64.ServerIP, "--dns", c.DNS64.ServerIP,
 		"--sysctl", "net.ipv6.conf.all.disable_ipv6=0",
 		"--sysctl", "net.ipv6.conf.all.forwarding=1",
-		"-v", volumeMap, "--net", SupportNetName, "diverdane/bind9:latest",
+		"-v", volumeMap, "--net", SupportNetName,
 	}
-	return cmdList
+	cmdList = append(cmdList, c.Images.DNS64.ExtraArgs...)
+	return append(cmdList, c.Images.DNS64.Ref(DefaultDNS64Image))
 }
 
 // BuildGetInterfaceArgs constructs arguments for obtaining list of IPs
@@ -103,7 +113,7 @@ func BuildAddRouteArgs(container, dest, via string) []string {
 func (d *Docker) AddV6Route(container, dest, via string) error {
 	args := BuildAddRouteArgs(container, dest, via)
 	_, err := d.DoCommand("Add IPv6 route", args)
-	return err
+	return classifyCommandError(err, ErrAlreadyExists)
 }
 
 // BuildDeleteContainerArgs create arguments for the docker command to delete container
@@ -115,7 +125,7 @@ func BuildDeleteContainerArgs(name string) []string {
 func (d *Docker) DeleteContainer(name string) error {
 	args := BuildDeleteContainerArgs(name)
 	_, err := d.DoCommand("Delete container", args)
-	return err
+	return classifyCommandError(err, ErrNotFound)
 }
 
 // BuildRunArgsForNAT64 constructs arguments to start a NAT64 container.
@@ -130,9 +140,10 @@ func BuildRunArgsForNAT64(c *Config) []string {
 		"--sysctl", "net.ipv6.conf.all.disable_ipv6=0",
 		"--sysctl", "net.ipv6.conf.all.forwarding=1",
 		"-e", confPrefix, "-e", confV4Addr, "-e", confV4Pool,
-		"--net", SupportNetName, "danehans/tayga:latest",
+		"--net", SupportNetName,
 	}
-	return cmdList
+	cmdList = append(cmdList, c.Images.NAT64.ExtraArgs...)
+	return append(cmdList, c.Images.NAT64.Ref(DefaultNAT64Image))
 }
 
 // RunContainer performs docker command to run a container.
@@ -167,7 +178,7 @@ func BuildDeleteNetArgsFor(name string) []string {
 func (d *Docker) DeleteNetwork(name string) error {
 	args := BuildDeleteNetArgsFor(name)
 	_, err := d.DoCommand("Delete network", args)
-	return err
+	return classifyCommandError(err, ErrNotFound)
 }
 
 // BuildCreateVolumeArgs constructs arguments to create a volume
@@ -191,7 +202,7 @@ func BuildDeleteVolumeArgs(name string) []string {
 func (d *Docker) DeleteVolume(name string) error {
 	args := BuildDeleteVolumeArgs(name)
 	_, err := d.DoCommand("Volume delete", args)
-	return err
+	return classifyCommandError(err, ErrNotFound)
 }
 
 // BuildCreateVolumeArgs constructs arguments to create a volume
@@ -208,3 +219,68 @@ func (d *Docker) GetVolumeMountPoint(name string) (string, error) {
 	}
 	return strings.Trim(mountPoint, "\"\n"), nil
 }
+
+// BuildPullImageArgs constructs arguments to pull an image.
+func BuildPullImageArgs(image string) []string {
+	return []string{"pull", image}
+}
+
+// PullImage pulls the image from the registry.
+func (d *Docker) PullImage(image string) error {
+	args := BuildPullImageArgs(image)
+	_, err := d.DoCommand("Pull image", args)
+	return err
+}
+
+// BuildLoadImageArgs constructs arguments to load an image from a tarball.
+func BuildLoadImageArgs(tarball string) []string {
+	return []string{"load", "-i", tarball}
+}
+
+// LoadImage loads an image from a tarball.
+func (d *Docker) LoadImage(tarball string) error {
+	args := BuildLoadImageArgs(tarball)
+	_, err := d.DoCommand("Load image", args)
+	return err
+}
+
+// BuildLoginArgs constructs arguments to log in to a registry, with the
+// password provided on stdin. If no server is specified, the default
+// registry is used.
+func BuildLoginArgs(server, username string) []string {
+	args := []string{"login", "--username", username, "--password-stdin"}
+	if server != "" {
+		args = append(args, server)
+	}
+	return args
+}
+
+// Login logs in to the registry, so that private images can be pulled.
+func (d *Docker) Login(server, username, password string) error {
+	args := BuildLoginArgs(server, username)
+	_, err := d.DoCommandWithInput("Registry login", args, password)
+	return err
+}
+
+// BuildContainerLogsArgs constructs arguments to obtain the most recent
+// log lines from a container.
+func BuildContainerLogsArgs(name string) []string {
+	return []string{"logs", "--tail", fmt.Sprintf("%d", ContainerLogLines), name}
+}
+
+// containerLogs runs the logs command for the container. Containers log
+// to both stdout and stderr, so the combined output is collected.
+func containerLogs(command, name string) (string, error) {
+	args := BuildContainerLogsArgs(name)
+	glog.V(4).Infof("Invoking: %s %s", command, strings.Join(args, " "))
+	output, err := exec.Command(command, args...).CombinedOutput()
+	if err != nil {
+		return "", fmt.Errorf("%s \"logs\" failed for %q: %v (%s)", command, name, err, output)
+	}
+	return string(output), nil
+}
+
+// ContainerLogs obtains the most recent log lines from the container.
+func (d *Docker) ContainerLogs(name string) (string, error) {
+	return containerLogs(d.Command, name)
+}
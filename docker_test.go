@@ -281,3 +281,70 @@ func TestFailedGetVolumeMountPoint(t *testing.T) {
 		t.Fatalf("FAILED: Expected reason to be  %q, got %q", expected, err.Error())
 	}
 }
+
+func TestBuildImageArgs(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		list     []string
+		expected string
+	}{
+		{
+			name:     "pull",
+			list:     lazyjack.BuildPullImageArgs("diverdane/bind9:latest"),
+			expected: "pull diverdane/bind9:latest",
+		},
+		{
+			name:     "load",
+			list:     lazyjack.BuildLoadImageArgs("/tmp/lazyjack/bind9.tar"),
+			expected: "load -i /tmp/lazyjack/bind9.tar",
+		},
+		{
+			name:     "login",
+			list:     lazyjack.BuildLoginArgs("registry.example.com", "jack"),
+			expected: "login --username jack --password-stdin registry.example.com",
+		},
+		{
+			name:     "login default registry",
+			list:     lazyjack.BuildLoginArgs("", "jack"),
+			expected: "login --username jack --password-stdin",
+		},
+	}
+	for _, tc := range testCases {
+		actual := strings.Join(tc.list, " ")
+		if actual != tc.expected {
+			t.Errorf("FAILED: [%s] Building image args. Expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestImageCommands(t *testing.T) {
+	d := lazyjack.Docker{Command: "echo"}
+	if err := d.PullImage("diverdane/bind9:latest"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to pull image: %s", err.Error())
+	}
+	if err := d.LoadImage("/tmp/lazyjack/bind9.tar"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to load image: %s", err.Error())
+	}
+	if err := d.Login("registry.example.com", "jack", "secret"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to log in to registry: %s", err.Error())
+	}
+}
+
+func TestDoCommandWithInput(t *testing.T) {
+	d := lazyjack.Docker{Command: "cat"}
+	actual, err := d.DoCommandWithInput("Echo input", []string{"-"}, "secret")
+	if err != nil {
+		t.Fatalf("FAILED: Expected command to succeed: %s", err.Error())
+	}
+	if actual != "secret" {
+		t.Fatalf("FAILED: Expected input to be provided on stdin, got %q", actual)
+	}
+}
+
+func TestBuildContainerLogsArgs(t *testing.T) {
+	actual := strings.Join(lazyjack.BuildContainerLogsArgs("bind9"), " ")
+	expected := "logs --tail 20 bind9"
+	if actual != expected {
+		t.Fatalf("FAILED: Building container logs args. Expected %q, got %q", expected, actual)
+	}
+}
@@ -0,0 +1,844 @@
+package lazyjack
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// DockerAPIVersion is the Docker Engine API version used for requests
+	DockerAPIVersion = "v1.25"
+	// DefaultDockerAPITimeout is the time limit for each API call
+	DefaultDockerAPITimeout = 30 * time.Second
+	// DefaultDockerAPIPullTimeout is the time limit for pulling an image
+	DefaultDockerAPIPullTimeout = 5 * time.Minute
+)
+
+// DockerAPI represents a concrete hypervisor implementation, which uses
+// the Docker Engine REST API over the daemon's unix socket, instead of
+// parsing the output of docker CLI commands.
+type DockerAPI struct {
+	Socket      string
+	Timeout     time.Duration
+	PullTimeout time.Duration
+	client      *http.Client
+	ctx         context.Context
+	auth        *string
+}
+
+// DockerAPIError is a failure status returned from the Docker Engine API.
+type DockerAPIError struct {
+	Name       string
+	StatusCode int
+	Message    string
+}
+
+func (e *DockerAPIError) Error() string {
+	return fmt.Sprintf("docker API failed for %q: %s (status %d)", e.Name, e.Message, e.StatusCode)
+}
+
+// Is allows errors.Is() to check for a missing (not found) or existing
+// (conflict) resource.
+func (e *DockerAPIError) Is(target error) bool {
+	switch target {
+	case ErrNotFound:
+		return e.StatusCode == http.StatusNotFound
+	case ErrAlreadyExists:
+		return e.StatusCode == http.StatusConflict
+	}
+	return false
+}
+
+// IsDockerAPINotFound indicates if the error is because the requested
+// resource does not exist.
+func IsDockerAPINotFound(err error) bool {
+	var apiErr *DockerAPIError
+	return errors.As(err, &apiErr) && apiErr.StatusCode == http.StatusNotFound
+}
+
+// NewDockerAPI creates a Docker Engine API client that uses the socket
+// specified.
+func NewDockerAPI(socket string) *DockerAPI {
+	return &DockerAPI{
+		Socket:      socket,
+		Timeout:     DefaultDockerAPITimeout,
+		PullTimeout: DefaultDockerAPIPullTimeout,
+		client: &http.Client{
+			Transport: &http.Transport{
+				DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+					var d net.Dialer
+					return d.DialContext(ctx, "unix", socket)
+				},
+			},
+		},
+		ctx:  context.Background(),
+		auth: new(string),
+	}
+}
+
+// WithContext returns a copy of the client, whose API calls will be
+// aborted, when the context is canceled. The copy shares the registry
+// credentials saved by Login.
+func (d *DockerAPI) WithContext(ctx context.Context) *DockerAPI {
+	clone := *d
+	clone.ctx = ctx
+	return &clone
+}
+
+// callContext provides the context for an API call, limited by the
+// timeout, if one is set.
+func (d *DockerAPI) callContext(timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(d.ctx)
+	}
+	return context.WithTimeout(d.ctx, timeout)
+}
+
+// request issues an API request, with an optional body, and returns the
+// response, if successful. The body is encoded as JSON, unless it is a
+// reader, which is sent as a tar archive. Caller must close the response
+// body.
+func (d *DockerAPI) request(ctx context.Context, name, method, path string, query url.Values, in interface{}) (*http.Response, error) {
+	var body io.Reader
+	contentType := "application/json"
+	if r, ok := in.(io.Reader); ok {
+		body = r
+		contentType = "application/x-tar"
+	} else if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, fmt.Errorf("unable to encode docker API request for %q: %v", name, err)
+		}
+		body = bytes.NewReader(data)
+	}
+	u := url.URL{Scheme: "http", Host: "docker", Path: "/" + DockerAPIVersion + path, RawQuery: query.Encode()}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create docker API request for %q: %v", name, err)
+	}
+	req = req.WithContext(ctx)
+	if in != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if d.auth != nil && *d.auth != "" && path == "/images/create" {
+		req.Header.Set("X-Registry-Auth", *d.auth)
+	}
+	glog.V(4).Infof("Invoking: docker API %s %s", method, u.RequestURI())
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("docker API %s %s failed for %q: %v", method, path, name, err)
+	}
+	if resp.StatusCode >= http.StatusMultipleChoices {
+		defer resp.Body.Close()
+		data, _ := ioutil.ReadAll(resp.Body)
+		var failure struct {
+			Message string `json:"message"`
+		}
+		if json.Unmarshal(data, &failure) != nil || failure.Message == "" {
+			failure.Message = strings.TrimSpace(string(data))
+		}
+		return nil, &DockerAPIError{Name: name, StatusCode: resp.StatusCode, Message: failure.Message}
+	}
+	return resp, nil
+}
+
+// do performs an API request, decoding the JSON response, if a result is
+// provided.
+func (d *DockerAPI) do(ctx context.Context, name, method, path string, query url.Values, in, out interface{}) error {
+	resp, err := d.request(ctx, name, method, path, query, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		io.Copy(ioutil.Discard, resp.Body)
+	} else if err = json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("unable to decode docker API response for %q: %v", name, err)
+	}
+	glog.V(4).Infof("Docker API %q operation successful", name)
+	return nil
+}
+
+// ResourceState method obtains the state of the resource, which can be
+// not present, existing, or running (for container resources).
+func (d *DockerAPI) ResourceState(r string) string {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+
+	var container struct {
+		State struct {
+			Running bool
+		}
+	}
+	err := d.do(ctx, "Resource State", "GET", "/containers/"+r+"/json", nil, nil, &container)
+	if err == nil {
+		if container.State.Running {
+			glog.V(4).Infof("Resource %q is running", r)
+			return ResourceRunning
+		}
+		glog.V(4).Infof("Resource %q exists", r)
+		return ResourceExists
+	}
+	for _, path := range []string{"/networks/" + r, "/volumes/" + r, "/images/" + r + "/json"} {
+		if d.do(ctx, "Resource State", "GET", path, nil, nil, nil) == nil {
+			glog.V(4).Infof("Resource %q exists", r)
+			return ResourceExists
+		}
+	}
+	glog.V(4).Infof("No %q resource", r)
+	return ResourceNotPresent
+}
+
+// DemuxDockerStream splits the multiplexed output stream from an exec (or
+// attach) into stdout and stderr. Each frame has an eight byte header with
+// the stream type, and the big-endian size of the payload that follows.
+func DemuxDockerStream(r io.Reader, stdout, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		_, err := io.ReadFull(r, header)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to read docker stream header: %v", err)
+		}
+		var w io.Writer
+		switch header[0] {
+		case 0, 1:
+			w = stdout
+		case 2:
+			w = stderr
+		default:
+			return fmt.Errorf("unknown docker stream type %d", header[0])
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err = io.CopyN(w, r, size); err != nil {
+			return fmt.Errorf("unable to read docker stream: %v", err)
+		}
+	}
+}
+
+// Exec runs a command in the container, returning stdout. An error
+// occurs, if the command exits with a non-zero status.
+func (d *DockerAPI) Exec(name, container string, cmd []string) (string, error) {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+
+	execConfig := struct {
+		AttachStdout bool
+		AttachStderr bool
+		Cmd          []string
+	}{true, true, cmd}
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := d.do(ctx, name, "POST", "/containers/"+container+"/exec", nil, execConfig, &created)
+	if err != nil {
+		return "", err
+	}
+
+	startConfig := struct {
+		Detach bool
+		Tty    bool
+	}{false, false}
+	resp, err := d.request(ctx, name, "POST", "/exec/"+created.ID+"/start", nil, startConfig)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var stdout, stderr bytes.Buffer
+	err = DemuxDockerStream(resp.Body, &stdout, &stderr)
+	if err != nil {
+		return "", fmt.Errorf("docker API exec failed for %q: %v", name, err)
+	}
+
+	var result struct {
+		ExitCode int
+	}
+	err = d.do(ctx, name, "GET", "/exec/"+created.ID+"/json", nil, nil, &result)
+	if err != nil {
+		return "", err
+	}
+	if result.ExitCode != 0 {
+		msg := fmt.Sprintf("docker API exec failed for %q: exit status %d (%s)", name, result.ExitCode, strings.TrimSpace(stderr.String()))
+		return "", &CommandError{Msg: msg, Stderr: stderr.String()}
+	}
+	glog.V(4).Infof("Docker API %q exec successful", name)
+	return stdout.String(), nil
+}
+
+// GetInterfaceConfig obtains an interface's IP addresses, using exec.
+func (d *DockerAPI) GetInterfaceConfig(name, ifName string) (string, error) {
+	args := BuildGetInterfaceArgs(name, ifName)
+	return d.Exec("Get I/F config", args[1], args[2:])
+}
+
+// DeleteV4Address removes the IPv4 address from the container's eth0
+// interface, using exec.
+func (d *DockerAPI) DeleteV4Address(container, ip string) error {
+	args := BuildV4AddrDelArgs(container, ip)
+	_, err := d.Exec("Delete IPv4 addr", args[1], args[2:])
+	return err
+}
+
+// AddV6Route adds an IPv6 route to the container, using exec.
+func (d *DockerAPI) AddV6Route(container, dest, via string) error {
+	args := BuildAddRouteArgs(container, dest, via)
+	_, err := d.Exec("Add IPv6 route", args[1], args[2:])
+	return classifyCommandError(err, ErrAlreadyExists)
+}
+
+// DeleteContainer force removes a container.
+func (d *DockerAPI) DeleteContainer(name string) error {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+	return d.do(ctx, "Delete container", "DELETE", "/containers/"+name, url.Values{"force": {"1"}}, nil, nil)
+}
+
+// DockerEndpointIPAMConfig holds the static IPs for a container on a network.
+type DockerEndpointIPAMConfig struct {
+	IPv4Address string `json:",omitempty"`
+	IPv6Address string `json:",omitempty"`
+}
+
+// DockerEndpointSettings holds the settings for a container on a network.
+type DockerEndpointSettings struct {
+	IPAMConfig *DockerEndpointIPAMConfig `json:",omitempty"`
+}
+
+// DockerRestartPolicy is the restart policy for a container.
+type DockerRestartPolicy struct {
+	Name              string
+	MaximumRetryCount int `json:",omitempty"`
+}
+
+// DockerPortBinding is the host IP and port for a published port.
+type DockerPortBinding struct {
+	HostIP   string `json:"HostIp,omitempty"`
+	HostPort string `json:",omitempty"`
+}
+
+// DockerHostConfig holds the host specific settings for a container.
+type DockerHostConfig struct {
+	Binds         []string                       `json:",omitempty"`
+	NetworkMode   string                         `json:",omitempty"`
+	Privileged    bool                           `json:",omitempty"`
+	DNS           []string                       `json:"Dns,omitempty"`
+	Sysctls       map[string]string              `json:",omitempty"`
+	AutoRemove    bool                           `json:",omitempty"`
+	Init          *bool                          `json:",omitempty"`
+	RestartPolicy *DockerRestartPolicy           `json:",omitempty"`
+	CapAdd        []string                       `json:",omitempty"`
+	CapDrop       []string                       `json:",omitempty"`
+	PortBindings  map[string][]DockerPortBinding `json:",omitempty"`
+	Memory        int64                          `json:",omitempty"`
+	NanoCPUs      int64                          `json:"NanoCpus,omitempty"`
+}
+
+// DockerNetworkingConfig holds the network settings for a container.
+type DockerNetworkingConfig struct {
+	EndpointsConfig map[string]*DockerEndpointSettings `json:",omitempty"`
+}
+
+// DockerContainerConfig is the request to create a container.
+type DockerContainerConfig struct {
+	Hostname         string   `json:",omitempty"`
+	Env              []string `json:",omitempty"`
+	Cmd              []string `json:",omitempty"`
+	Image            string
+	Labels           map[string]string   `json:",omitempty"`
+	ExposedPorts     map[string]struct{} `json:",omitempty"`
+	HostConfig       DockerHostConfig
+	NetworkingConfig DockerNetworkingConfig
+}
+
+// dockerRunFlags are the boolean docker run options that are supported.
+var dockerRunFlags = map[string]bool{
+	"-d": true, "--detach": true, "--privileged": true, "--rm": true, "--init": true,
+}
+
+// parseDockerRestartPolicy converts a --restart value (e.g. on-failure:3).
+func parseDockerRestartPolicy(value string) (*DockerRestartPolicy, error) {
+	parts := strings.SplitN(value, ":", 2)
+	policy := &DockerRestartPolicy{Name: parts[0]}
+	switch policy.Name {
+	case "no", "always", "unless-stopped":
+		if len(parts) == 1 {
+			return policy, nil
+		}
+	case "on-failure":
+		if len(parts) == 1 {
+			return policy, nil
+		}
+		count, err := strconv.Atoi(parts[1])
+		if err == nil && count >= 0 {
+			policy.MaximumRetryCount = count
+			return policy, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid restart policy %q for docker run", value)
+}
+
+// parseDockerPort converts a --publish value ([[ip:]host-port:]port[/proto])
+// into the container port and host binding.
+func parseDockerPort(value string) (string, DockerPortBinding, error) {
+	binding := DockerPortBinding{}
+	port := value
+	if i := strings.LastIndex(value, ":"); i != -1 {
+		port = value[i+1:]
+		host := value[:i]
+		if j := strings.LastIndex(host, ":"); j != -1 && !strings.HasSuffix(host, "]") {
+			binding.HostIP = strings.Trim(host[:j], "[]")
+			host = host[j+1:]
+		} else if strings.HasSuffix(host, "]") {
+			return "", binding, fmt.Errorf("invalid published port %q for docker run", value)
+		}
+		binding.HostPort = host
+	}
+	proto := "tcp"
+	if parts := strings.SplitN(port, "/", 2); len(parts) == 2 {
+		port, proto = parts[0], parts[1]
+	}
+	if _, err := strconv.ParseUint(port, 10, 16); err != nil {
+		return "", binding, fmt.Errorf("invalid published port %q for docker run", value)
+	}
+	if binding.HostPort != "" {
+		if _, err := strconv.ParseUint(binding.HostPort, 10, 16); err != nil {
+			return "", binding, fmt.Errorf("invalid published port %q for docker run", value)
+		}
+	}
+	return port + "/" + proto, binding, nil
+}
+
+// parseDockerMemory converts a --memory value (e.g. 256m) into bytes.
+func parseDockerMemory(value string) (int64, error) {
+	units := map[byte]int64{'b': 1, 'k': 1 << 10, 'm': 1 << 20, 'g': 1 << 30}
+	number, scale := strings.ToLower(value), int64(1)
+	if n := len(number); n > 0 {
+		if unit, ok := units[number[n-1]]; ok {
+			number, scale = number[:n-1], unit
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 {
+		return 0, fmt.Errorf("invalid memory limit %q for docker run", value)
+	}
+	return size * scale, nil
+}
+
+// ParseDockerRunArgs converts the arguments for a docker run command into
+// the container name and the request to create the container. Only the
+// options used by lazyjack, and common options for extra-args, are
+// supported.
+func ParseDockerRunArgs(args []string) (string, *DockerContainerConfig, error) {
+	if len(args) == 0 || args[0] != "run" {
+		return "", nil, fmt.Errorf("expected docker run arguments, got %q", strings.Join(args, " "))
+	}
+	var name, ipv4, ipv6 string
+	config := &DockerContainerConfig{}
+	i := 1
+	for ; i < len(args) && strings.HasPrefix(args[i], "-"); i++ {
+		option, value := args[i], ""
+		hasValue := false
+		if parts := strings.SplitN(option, "=", 2); len(parts) == 2 {
+			option, value, hasValue = parts[0], parts[1], true
+		}
+		if dockerRunFlags[option] {
+			enabled := true
+			if hasValue {
+				var err error
+				enabled, err = strconv.ParseBool(value)
+				if err != nil {
+					return "", nil, fmt.Errorf("invalid value %q for docker run option %s", value, option)
+				}
+			}
+			switch option {
+			case "--privileged":
+				config.HostConfig.Privileged = enabled
+			case "--rm":
+				config.HostConfig.AutoRemove = enabled
+			case "--init":
+				config.HostConfig.Init = &enabled
+			}
+			continue
+		}
+		if !hasValue {
+			i++
+			if i == len(args) {
+				return "", nil, fmt.Errorf("missing value for docker run option %s", option)
+			}
+			value = args[i]
+		}
+		switch option {
+		case "--name":
+			name = value
+		case "--hostname", "-h":
+			config.Hostname = value
+		case "--label", "-l":
+			if config.Labels == nil {
+				config.Labels = map[string]string{}
+			}
+			parts := strings.SplitN(value, "=", 2)
+			config.Labels[parts[0]] = ""
+			if len(parts) == 2 {
+				config.Labels[parts[0]] = parts[1]
+			}
+		case "--ip":
+			ipv4 = value
+		case "--ip6":
+			ipv6 = value
+		case "--dns":
+			config.HostConfig.DNS = append(config.HostConfig.DNS, value)
+		case "--sysctl":
+			parts := strings.SplitN(value, "=", 2)
+			if len(parts) != 2 {
+				return "", nil, fmt.Errorf("invalid sysctl %q for docker run", value)
+			}
+			if config.HostConfig.Sysctls == nil {
+				config.HostConfig.Sysctls = map[string]string{}
+			}
+			config.HostConfig.Sysctls[parts[0]] = parts[1]
+		case "-e", "--env":
+			config.Env = append(config.Env, value)
+		case "-v", "--volume":
+			config.HostConfig.Binds = append(config.HostConfig.Binds, value)
+		case "--net", "--network":
+			config.HostConfig.NetworkMode = value
+		case "--restart":
+			policy, err := parseDockerRestartPolicy(value)
+			if err != nil {
+				return "", nil, err
+			}
+			config.HostConfig.RestartPolicy = policy
+		case "--cap-add":
+			config.HostConfig.CapAdd = append(config.HostConfig.CapAdd, value)
+		case "--cap-drop":
+			config.HostConfig.CapDrop = append(config.HostConfig.CapDrop, value)
+		case "-p", "--publish":
+			port, binding, err := parseDockerPort(value)
+			if err != nil {
+				return "", nil, err
+			}
+			if config.ExposedPorts == nil {
+				config.ExposedPorts = map[string]struct{}{}
+				config.HostConfig.PortBindings = map[string][]DockerPortBinding{}
+			}
+			config.ExposedPorts[port] = struct{}{}
+			config.HostConfig.PortBindings[port] = append(config.HostConfig.PortBindings[port], binding)
+		case "-m", "--memory":
+			memory, err := parseDockerMemory(value)
+			if err != nil {
+				return "", nil, err
+			}
+			config.HostConfig.Memory = memory
+		case "--cpus":
+			cpus, err := strconv.ParseFloat(value, 64)
+			if err != nil || cpus <= 0 {
+				return "", nil, fmt.Errorf("invalid CPU limit %q for docker run", value)
+			}
+			config.HostConfig.NanoCPUs = int64(cpus * 1e9)
+		default:
+			return "", nil, fmt.Errorf("unsupported docker run option %s", option)
+		}
+	}
+	if i == len(args) {
+		return "", nil, fmt.Errorf("missing image for docker run")
+	}
+	config.Image = args[i]
+	config.Cmd = args[i+1:]
+	if config.HostConfig.AutoRemove && config.HostConfig.RestartPolicy != nil && config.HostConfig.RestartPolicy.Name != "no" {
+		return "", nil, fmt.Errorf("docker run options --rm and --restart cannot be used together")
+	}
+	if ipv4 != "" || ipv6 != "" {
+		if config.HostConfig.NetworkMode == "" {
+			return "", nil, fmt.Errorf("docker run option --ip or --ip6 requires --net")
+		}
+		config.NetworkingConfig.EndpointsConfig = map[string]*DockerEndpointSettings{
+			config.HostConfig.NetworkMode: {
+				IPAMConfig: &DockerEndpointIPAMConfig{IPv4Address: ipv4, IPv6Address: ipv6},
+			},
+		}
+	}
+	return name, config, nil
+}
+
+// ValidateDockerRunExtraArgs checks that the extra arguments for a
+// container are options that can be converted into the request to create
+// the container, so that they are not found to be unsupported after the
+// network and volume have been created.
+func ValidateDockerRunExtraArgs(role string, extraArgs []string) error {
+	if len(extraArgs) == 0 {
+		return nil
+	}
+	const placeholder = "image"
+	args := append(append([]string{"run"}, extraArgs...), placeholder)
+	_, config, err := ParseDockerRunArgs(args)
+	if err == nil && (config.Image != placeholder || len(config.Cmd) != 0) {
+		err = fmt.Errorf("arguments that are not options (%s)", strings.Join(extraArgs, " "))
+	}
+	if err != nil {
+		return fmt.Errorf("unsupported %s extra-args for %s hypervisor: %v", role, DockerAPIHypervisor, err)
+	}
+	return nil
+}
+
+// SplitImageReference separates the image reference into the image and
+// tag (or digest), as needed for a pull. The tag defaults to latest.
+func SplitImageReference(image string) (string, string) {
+	if strings.Contains(image, "@") {
+		return image, ""
+	}
+	slash := strings.LastIndex(image, "/")
+	if colon := strings.LastIndex(image, ":"); colon > slash {
+		return image[:colon], image[colon+1:]
+	}
+	return image, "latest"
+}
+
+// PullImage pulls the image from the registry. Progress is streamed back
+// as JSON messages, with failures reported in the stream.
+func (d *DockerAPI) PullImage(image string) error {
+	ctx, cancel := d.callContext(d.PullTimeout)
+	defer cancel()
+
+	name := "Pull image"
+	from, tag := SplitImageReference(image)
+	query := url.Values{"fromImage": {from}}
+	if tag != "" {
+		query.Set("tag", tag)
+	}
+	resp, err := d.request(ctx, name, "POST", "/images/create", query, nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err = checkDockerProgress(name, resp.Body); err != nil {
+		return fmt.Errorf("unable to pull image %s: %v", image, err)
+	}
+	glog.V(4).Infof("Pulled image %s", image)
+	return nil
+}
+
+// checkDockerProgress reads the stream of JSON progress messages, returning
+// the first failure reported.
+func checkDockerProgress(name string, r io.Reader) error {
+	decoder := json.NewDecoder(r)
+	for {
+		var progress struct {
+			Error string `json:"error"`
+		}
+		err := decoder.Decode(&progress)
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("unable to decode docker API response for %q: %v", name, err)
+		}
+		if progress.Error != "" {
+			return fmt.Errorf("%s", progress.Error)
+		}
+	}
+}
+
+// LoadImage loads the image(s) from a tarball, as created by "docker save".
+func (d *DockerAPI) LoadImage(tarball string) error {
+	f, err := FS().Open(tarball)
+	if err != nil {
+		return fmt.Errorf("unable to open image tarball %s: %v", tarball, err)
+	}
+	defer f.Close()
+
+	ctx, cancel := d.callContext(d.PullTimeout)
+	defer cancel()
+
+	name := "Load image"
+	resp, err := d.request(ctx, name, "POST", "/images/load", url.Values{"quiet": {"1"}}, f)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err = checkDockerProgress(name, resp.Body); err != nil {
+		return fmt.Errorf("unable to load image from %s: %v", tarball, err)
+	}
+	glog.V(4).Infof("Loaded image from %s", tarball)
+	return nil
+}
+
+// DockerAuthConfig holds the registry credentials.
+type DockerAuthConfig struct {
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	ServerAddress string `json:"serveraddress,omitempty"`
+}
+
+// Login checks the credentials with the registry, and saves them, so that
+// they are provided when pulling images.
+func (d *DockerAPI) Login(server, username, password string) error {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+
+	auth := DockerAuthConfig{Username: username, Password: password, ServerAddress: server}
+	err := d.do(ctx, "Registry login", "POST", "/auth", nil, auth, nil)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(auth)
+	if err != nil {
+		return fmt.Errorf("unable to encode registry credentials: %v", err)
+	}
+	if d.auth == nil {
+		d.auth = new(string)
+	}
+	*d.auth = base64.URLEncoding.EncodeToString(data)
+	glog.V(4).Infof("Logged in to registry %q as %s", server, username)
+	return nil
+}
+
+// createContainer creates the container, returning the container ID.
+func (d *DockerAPI) createContainer(name, container string, config *DockerContainerConfig) (string, error) {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+
+	var created struct {
+		ID string `json:"Id"`
+	}
+	err := d.do(ctx, name, "POST", "/containers/create", url.Values{"name": {container}}, config, &created)
+	return created.ID, err
+}
+
+// RunContainer creates and starts a container, using the arguments for
+// the docker run command. Like the CLI, the image is pulled, if needed.
+func (d *DockerAPI) RunContainer(name string, args []string) error {
+	container, config, err := ParseDockerRunArgs(args)
+	if err != nil {
+		return fmt.Errorf("unable to run %s: %v", name, err)
+	}
+	id, err := d.createContainer(name, container, config)
+	if IsDockerAPINotFound(err) {
+		glog.V(1).Infof("Image %s not present, pulling", config.Image)
+		if err = d.PullImage(config.Image); err != nil {
+			return err
+		}
+		id, err = d.createContainer(name, container, config)
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+	return d.do(ctx, name, "POST", "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// DockerIPAMConfig is a subnet for a network.
+type DockerIPAMConfig struct {
+	Subnet  string
+	Gateway string `json:",omitempty"`
+}
+
+// DockerNetworkConfig is the request to create a network.
+type DockerNetworkConfig struct {
+	Name           string
+	CheckDuplicate bool
+	EnableIPv6     bool
+	IPAM           struct {
+		Config []DockerIPAMConfig
+	}
+}
+
+// BuildDockerNetworkConfig constructs the request to create a network,
+// with IPv6 and IPv4 subnets.
+func BuildDockerNetworkConfig(name, cidr, v4cidr, gwPrefix string) *DockerNetworkConfig {
+	config := &DockerNetworkConfig{Name: name, CheckDuplicate: true, EnableIPv6: true}
+	config.IPAM.Config = []DockerIPAMConfig{
+		{Subnet: cidr, Gateway: gwPrefix + "1"},
+		{Subnet: v4cidr},
+	}
+	return config
+}
+
+// CreateNetwork creates a network.
+func (d *DockerAPI) CreateNetwork(name, cidr, v4cidr, gw string) error {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+	config := BuildDockerNetworkConfig(name, cidr, v4cidr, gw)
+	return d.do(ctx, "Create network", "POST", "/networks/create", nil, config, nil)
+}
+
+// DeleteNetwork deletes a network.
+func (d *DockerAPI) DeleteNetwork(name string) error {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+	return d.do(ctx, "Delete network", "DELETE", "/networks/"+name, nil, nil, nil)
+}
+
+// CreateVolume creates a new volume.
+func (d *DockerAPI) CreateVolume(name string) error {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+	volume := struct {
+		Name string
+	}{name}
+	return d.do(ctx, "Volume create", "POST", "/volumes/create", nil, volume, nil)
+}
+
+// DeleteVolume force deletes a volume. No error occurs, if volume doesn't exist.
+func (d *DockerAPI) DeleteVolume(name string) error {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+	err := d.do(ctx, "Volume delete", "DELETE", "/volumes/"+name, url.Values{"force": {"1"}}, nil, nil)
+	if IsDockerAPINotFound(err) {
+		glog.V(4).Infof("No %q volume to delete", name)
+		return nil
+	}
+	return err
+}
+
+// GetVolumeMountPoint obtains the mount point so that files can be deposited from host.
+func (d *DockerAPI) GetVolumeMountPoint(name string) (string, error) {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+	var volume struct {
+		Mountpoint string
+	}
+	err := d.do(ctx, "Volume inspect", "GET", "/volumes/"+name, nil, nil, &volume)
+	if err != nil {
+		return "", err
+	}
+	return volume.Mountpoint, nil
+}
+
+// ContainerLogs obtains the most recent log lines from the container,
+// with stdout and stderr interleaved.
+func (d *DockerAPI) ContainerLogs(name string) (string, error) {
+	ctx, cancel := d.callContext(d.Timeout)
+	defer cancel()
+
+	query := url.Values{"stdout": {"1"}, "stderr": {"1"}, "tail": {fmt.Sprintf("%d", ContainerLogLines)}}
+	resp, err := d.request(ctx, "Container logs", "GET", "/containers/"+name+"/logs", query, nil)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	var logs bytes.Buffer
+	err = DemuxDockerStream(resp.Body, &logs, &logs)
+	if err != nil {
+		return "", fmt.Errorf("docker API logs failed for %q: %v", name, err)
+	}
+	return logs.String(), nil
+}
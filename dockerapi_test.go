@@ -0,0 +1,667 @@
+package lazyjack_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmichali/lazyjack"
+)
+
+// fakeEngine is a stand-in for the Docker Engine API, which records the
+// requests and replies with canned responses, keyed by method and path.
+type fakeEngine struct {
+	responses map[string]string
+	status    map[string]int
+	requests  []string
+	bodies    map[string]string
+	headers   map[string]http.Header
+	delay     time.Duration
+}
+
+func (f *fakeEngine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	key := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/"+lazyjack.DockerAPIVersion)
+	if r.URL.RawQuery != "" {
+		key += "?" + r.URL.RawQuery
+	}
+	f.requests = append(f.requests, key)
+	body, _ := ioutil.ReadAll(r.Body)
+	f.bodies[key] = string(body)
+	f.headers[key] = r.Header
+	if f.delay > 0 {
+		select {
+		case <-time.After(f.delay):
+		case <-r.Context().Done():
+			return
+		}
+	}
+	status, ok := f.status[key]
+	if !ok {
+		status = http.StatusOK
+	}
+	response, ok := f.responses[key]
+	if !ok && status == http.StatusOK {
+		status = http.StatusNotFound
+		response = fmt.Sprintf(`{"message": "no such resource for %s"}`, key)
+	}
+	w.WriteHeader(status)
+	w.Write([]byte(response))
+}
+
+// HelperDockerEngine starts a fake Docker Engine on a unix socket in the
+// area, returning the server and a client that uses it.
+func HelperDockerEngine(basePath string, engine *fakeEngine, t *testing.T) (*httptest.Server, *lazyjack.DockerAPI) {
+	socket := filepath.Join(basePath, "docker.sock")
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create docker socket for test: %s", err.Error())
+	}
+	if engine.bodies == nil {
+		engine.bodies = map[string]string{}
+	}
+	if engine.headers == nil {
+		engine.headers = map[string]http.Header{}
+	}
+	server := httptest.NewUnstartedServer(engine)
+	server.Listener = l
+	server.Start()
+	return server, lazyjack.NewDockerAPI(socket)
+}
+
+func muxFrame(stream byte, data string) string {
+	header := make([]byte, 8)
+	header[0] = stream
+	binary.BigEndian.PutUint32(header[4:], uint32(len(data)))
+	return string(header) + data
+}
+
+func TestDockerAPIResourceState(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"GET /containers/bind9/json":              `{"Id": "1234", "State": {"Status": "running", "Running": true}}`,
+			"GET /containers/tayga/json":              `{"Id": "5678", "State": {"Status": "exited", "Running": false}}`,
+			"GET /networks/support_net":               `{"Name": "support_net"}`,
+			"GET /volumes/volume-bind9":               `{"Name": "volume-bind9", "Mountpoint": "/var/lib/docker/volumes/volume-bind9/_data"}`,
+			"GET /images/diverdane/bind9:latest/json": `{"Id": "sha256:1234"}`,
+		},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	var testCases = []struct {
+		name     string
+		resource string
+		expected string
+	}{
+		{name: "running container", resource: "bind9", expected: lazyjack.ResourceRunning},
+		{name: "stopped container", resource: "tayga", expected: lazyjack.ResourceExists},
+		{name: "network", resource: "support_net", expected: lazyjack.ResourceExists},
+		{name: "volume", resource: "volume-bind9", expected: lazyjack.ResourceExists},
+		{name: "image", resource: "diverdane/bind9:latest", expected: lazyjack.ResourceExists},
+		{name: "not present", resource: "no-such-resource", expected: lazyjack.ResourceNotPresent},
+	}
+	for _, tc := range testCases {
+		actual := d.ResourceState(tc.resource)
+		if actual != tc.expected {
+			t.Errorf("FAILED: [%s] resource state mismatch. Expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestParseDockerRunArgs(t *testing.T) {
+	c := &lazyjack.Config{
+		DNS64: lazyjack.DNS64Config{
+			CIDR:           "fd00:10:64:ff9b::/96",
+			RemoteV4Server: "8.8.8.8",
+			ServerIP:       "fd00:10::100",
+		},
+		NAT64: lazyjack.NAT64Config{
+			V4MappingCIDR: "172.18.0.128/25",
+			V4MappingIP:   "172.18.0.200",
+			ServerIP:      "fd00:10::200",
+		},
+	}
+	name, config, err := lazyjack.ParseDockerRunArgs(lazyjack.BuildRunArgsForNAT64(c))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to parse NAT64 run args: %s", err.Error())
+	}
+	if name != lazyjack.NAT64Name {
+		t.Fatalf("FAILED: Expected container name %q, got %q", lazyjack.NAT64Name, name)
+	}
+	actual, _ := json.Marshal(config)
+	expected := `{"Hostname":"tayga",` +
+		`"Env":["TAYGA_CONF_PREFIX=fd00:10:64:ff9b::/96","TAYGA_CONF_IPV4_ADDR=172.18.0.200","TAYGA_CONF_DYNAMIC_POOL=172.18.0.128/25"],` +
+		`"Image":"danehans/tayga:latest","Labels":{"lazyjack":""},` +
+		`"HostConfig":{"NetworkMode":"support_net","Privileged":true,"Dns":["8.8.8.8","fd00:10::100"],` +
+		`"Sysctls":{"net.ipv6.conf.all.disable_ipv6":"0","net.ipv6.conf.all.forwarding":"1"}},` +
+		`"NetworkingConfig":{"EndpointsConfig":{"support_net":{"IPAMConfig":{"IPv4Address":"172.18.0.200","IPv6Address":"fd00:10::200"}}}}}`
+	if string(actual) != expected {
+		t.Fatalf("FAILED: NAT64 container config wrong\nExpected: %s\n  Actual: %s", expected, actual)
+	}
+
+	_, config, err = lazyjack.ParseDockerRunArgs(lazyjack.BuildRunArgsForDNS64(c))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to parse DNS64 run args: %s", err.Error())
+	}
+	if len(config.HostConfig.Binds) != 1 || config.HostConfig.Binds[0] != "volume-bind9:/etc/bind/" {
+		t.Fatalf("FAILED: Expected volume bind for DNS64, got %v", config.HostConfig.Binds)
+	}
+}
+
+func TestParseDockerRunArgsCommonOptions(t *testing.T) {
+	args := strings.Fields("run --rm --init=false --cap-add NET_ADMIN --cap-drop MKNOD " +
+		"-p 53:53/udp --publish [::1]:8053:53 -m 256m --cpus 0.5 busybox sleep 60")
+	_, config, err := lazyjack.ParseDockerRunArgs(args)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to parse run args: %s", err.Error())
+	}
+	actual, _ := json.Marshal(config)
+	expected := `{"Cmd":["sleep","60"],"Image":"busybox",` +
+		`"ExposedPorts":{"53/tcp":{},"53/udp":{}},` +
+		`"HostConfig":{"AutoRemove":true,"Init":false,"CapAdd":["NET_ADMIN"],"CapDrop":["MKNOD"],` +
+		`"PortBindings":{"53/tcp":[{"HostIp":"::1","HostPort":"8053"}],"53/udp":[{"HostPort":"53"}]},` +
+		`"Memory":268435456,"NanoCpus":500000000},` +
+		`"NetworkingConfig":{}}`
+	if string(actual) != expected {
+		t.Fatalf("FAILED: Container config wrong\nExpected: %s\n  Actual: %s", expected, actual)
+	}
+
+	_, config, err = lazyjack.ParseDockerRunArgs(strings.Fields("run --restart on-failure:3 busybox"))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to parse restart policy: %s", err.Error())
+	}
+	policy := config.HostConfig.RestartPolicy
+	if policy == nil || policy.Name != "on-failure" || policy.MaximumRetryCount != 3 {
+		t.Fatalf("FAILED: Expected on-failure restart policy with 3 retries, got %+v", policy)
+	}
+}
+
+func TestFailedParseDockerRunArgs(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		args     string
+		expected string
+	}{
+		{name: "not run", args: "exec bind9 ip a", expected: "expected docker run arguments, got \"exec bind9 ip a\""},
+		{name: "unsupported option", args: "run --pid host busybox", expected: "unsupported docker run option --pid"},
+		{name: "bad remove", args: "run --rm=sometimes busybox", expected: "invalid value \"sometimes\" for docker run option --rm"},
+		{name: "bad restart", args: "run --restart on-failure:x busybox", expected: "invalid restart policy \"on-failure:x\" for docker run"},
+		{name: "remove with restart", args: "run --rm --restart always busybox", expected: "docker run options --rm and --restart cannot be used together"},
+		{name: "bad port", args: "run -p 53:dns busybox", expected: "invalid published port \"53:dns\" for docker run"},
+		{name: "bad memory", args: "run --memory lots busybox", expected: "invalid memory limit \"lots\" for docker run"},
+		{name: "bad cpus", args: "run --cpus none busybox", expected: "invalid CPU limit \"none\" for docker run"},
+		{name: "missing value", args: "run --name", expected: "missing value for docker run option --name"},
+		{name: "missing image", args: "run -d --name foo", expected: "missing image for docker run"},
+		{name: "bad privileged", args: "run --privileged=maybe busybox", expected: "invalid value \"maybe\" for docker run option --privileged"},
+		{name: "bad sysctl", args: "run --sysctl forwarding busybox", expected: "invalid sysctl \"forwarding\" for docker run"},
+		{name: "IP without network", args: "run --ip6 fd00::1 busybox", expected: "docker run option --ip or --ip6 requires --net"},
+	}
+	for _, tc := range testCases {
+		_, _, err := lazyjack.ParseDockerRunArgs(strings.Fields(tc.args))
+		if err == nil {
+			t.Errorf("FAILED: [%s] Expected parse to fail", tc.name)
+		} else if err.Error() != tc.expected {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expected, err.Error())
+		}
+	}
+}
+
+func TestSplitImageReference(t *testing.T) {
+	var testCases = []struct {
+		image string
+		from  string
+		tag   string
+	}{
+		{image: "busybox", from: "busybox", tag: "latest"},
+		{image: "danehans/tayga:latest", from: "danehans/tayga", tag: "latest"},
+		{image: "localhost:5000/bind9", from: "localhost:5000/bind9", tag: "latest"},
+		{image: "localhost:5000/bind9:9.11", from: "localhost:5000/bind9", tag: "9.11"},
+		{image: "bind9@sha256:abcd", from: "bind9@sha256:abcd", tag: ""},
+	}
+	for _, tc := range testCases {
+		from, tag := lazyjack.SplitImageReference(tc.image)
+		if from != tc.from || tag != tc.tag {
+			t.Errorf("FAILED: Expected %q to split into %q and %q, got %q and %q", tc.image, tc.from, tc.tag, from, tag)
+		}
+	}
+}
+
+func TestDockerAPIRunContainer(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /containers/create?name=bind9": `{"Id": "1234", "Warnings": []}`,
+			"POST /containers/1234/start":        "",
+		},
+		status: map[string]int{
+			"POST /containers/1234/start": http.StatusNoContent,
+		},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	err := d.RunContainer("DNS64 container", []string{"run", "-d", "--name", "bind9", "--net", "support_net", "diverdane/bind9:latest"})
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to run container: %s", err.Error())
+	}
+	expected := "POST /containers/create?name=bind9,POST /containers/1234/start"
+	if strings.Join(engine.requests, ",") != expected {
+		t.Fatalf("FAILED: Expected requests %q, got %q", expected, strings.Join(engine.requests, ","))
+	}
+	body := engine.bodies["POST /containers/create?name=bind9"]
+	if !strings.Contains(body, `"Image":"diverdane/bind9:latest"`) {
+		t.Fatalf("FAILED: Expected image in create request, got %s", body)
+	}
+}
+
+func TestDockerAPIRunContainerPullsImage(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /images/create?fromImage=danehans%2Ftayga&tag=latest": `{"status": "Pulling from danehans/tayga"}
+{"status": "Status: Downloaded newer image for danehans/tayga:latest"}
+`,
+		},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	// Create will always fail with not found, so image will be pulled and create retried
+	err := d.RunContainer("NAT64 container", []string{"run", "--name", "tayga", "danehans/tayga:latest"})
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure to run container")
+	}
+	expected := "POST /containers/create?name=tayga,POST /images/create?fromImage=danehans%2Ftayga&tag=latest,POST /containers/create?name=tayga"
+	if strings.Join(engine.requests, ",") != expected {
+		t.Fatalf("FAILED: Expected requests %q, got %q", expected, strings.Join(engine.requests, ","))
+	}
+
+	engine.responses["POST /images/create?fromImage=danehans%2Ftayga&tag=latest"] = `{"status": "Pulling from danehans/tayga"}
+{"error": "manifest unknown", "errorDetail": {"message": "manifest unknown"}}
+`
+	err = d.PullImage("danehans/tayga")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure pulling image")
+	}
+	expectedErr := "unable to pull image danehans/tayga: manifest unknown"
+	if err.Error() != expectedErr {
+		t.Fatalf("FAILED: Expected error %q, got %q", expectedErr, err.Error())
+	}
+}
+
+func TestDockerAPILoginAndPull(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /auth": `{"Status": "Login Succeeded"}`,
+			"POST /images/create?fromImage=registry.example.com%2Fbind9&tag=9.11": `{"status": "Downloaded"}`,
+		},
+		status: map[string]int{},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	err := d.Login("registry.example.com", "jack", "secret")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to log in: %s", err.Error())
+	}
+	body := engine.bodies["POST /auth"]
+	expected := `{"username":"jack","password":"secret","serveraddress":"registry.example.com"}`
+	if body != expected {
+		t.Fatalf("FAILED: Login request. Expected %s, got %s", expected, body)
+	}
+
+	err = d.PullImage("registry.example.com/bind9:9.11")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to pull image: %s", err.Error())
+	}
+	header := engine.headers["POST /images/create?fromImage=registry.example.com%2Fbind9&tag=9.11"]
+	auth, err := base64.URLEncoding.DecodeString(header.Get("X-Registry-Auth"))
+	if err != nil || string(auth) != expected {
+		t.Fatalf("FAILED: Expected registry auth %s, got %q", expected, header.Get("X-Registry-Auth"))
+	}
+
+	engine.status["POST /auth"] = http.StatusUnauthorized
+	engine.responses["POST /auth"] = `{"message": "incorrect username or password"}`
+	err = d.Login("registry.example.com", "jack", "wrong")
+	if err == nil {
+		t.Fatalf("FAILED: Expected login to fail")
+	}
+	expectedErr := "docker API failed for \"Registry login\": incorrect username or password (status 401)"
+	if err.Error() != expectedErr {
+		t.Fatalf("FAILED: Expected error %q, got %q", expectedErr, err.Error())
+	}
+}
+
+func TestDockerAPILoginWithContext(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /auth": `{"Status": "Login Succeeded"}`,
+			"POST /images/create?fromImage=registry.example.com%2Fbind9&tag=9.11": `{"status": "Downloaded"}`,
+		},
+		status: map[string]int{},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	// Credentials saved by a copy, are used by the original client
+	err := d.WithContext(context.Background()).Login("registry.example.com", "jack", "secret")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to log in: %s", err.Error())
+	}
+	err = d.PullImage("registry.example.com/bind9:9.11")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to pull image: %s", err.Error())
+	}
+	header := engine.headers["POST /images/create?fromImage=registry.example.com%2Fbind9&tag=9.11"]
+	if header.Get("X-Registry-Auth") == "" {
+		t.Fatalf("FAILED: Expected registry auth to be provided on pull")
+	}
+}
+
+func TestDockerAPILoadImage(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /images/load?quiet=1": `{"stream": "Loaded image: diverdane/bind9:latest\n"}`,
+		},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	tarball := filepath.Join(basePath, "bind9.tar")
+	err := ioutil.WriteFile(tarball, []byte("dummy image archive"), 0644)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create tarball for test: %s", err.Error())
+	}
+	err = d.LoadImage(tarball)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load image: %s", err.Error())
+	}
+	if engine.bodies["POST /images/load?quiet=1"] != "dummy image archive" {
+		t.Fatalf("FAILED: Expected tarball to be sent, got %q", engine.bodies["POST /images/load?quiet=1"])
+	}
+	contentType := engine.headers["POST /images/load?quiet=1"].Get("Content-Type")
+	if contentType != "application/x-tar" {
+		t.Fatalf("FAILED: Expected tar content type, got %q", contentType)
+	}
+
+	// Tarball is read using the filesystem
+	fs := lazyjack.NewMemFS()
+	fs.MkdirAll("/images", 0755)
+	fs.WriteFile("/images/bind9.tar", []byte("in memory image archive"), 0644)
+	lazyjack.RegisterFileSystem(fs)
+	err = d.LoadImage("/images/bind9.tar")
+	lazyjack.RegisterFileSystem(lazyjack.OsFS{})
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load image from filesystem: %s", err.Error())
+	}
+	if engine.bodies["POST /images/load?quiet=1"] != "in memory image archive" {
+		t.Fatalf("FAILED: Expected tarball from filesystem to be sent, got %q", engine.bodies["POST /images/load?quiet=1"])
+	}
+
+	engine.responses["POST /images/load?quiet=1"] = `{"error": "unexpected EOF"}`
+	err = d.LoadImage(tarball)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure loading image")
+	}
+	expectedErr := "unable to load image from " + tarball + ": unexpected EOF"
+	if err.Error() != expectedErr {
+		t.Fatalf("FAILED: Expected error %q, got %q", expectedErr, err.Error())
+	}
+
+	err = d.LoadImage(filepath.Join(basePath, "no-such.tar"))
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure loading missing tarball")
+	}
+}
+
+func TestDockerAPIExec(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	ifConfig := "45: eth0@if46: <BROADCAST,MULTICAST,UP,LOWER_UP,M-DOWN> mtu 1500\n    inet 172.18.0.2/16 scope global eth0\n"
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /containers/bind9/exec": `{"Id": "e1"}`,
+			"POST /exec/e1/start":         muxFrame(1, ifConfig[:20]) + muxFrame(2, "warning\n") + muxFrame(1, ifConfig[20:]),
+			"GET /exec/e1/json":           `{"ExitCode": 0, "Running": false}`,
+		},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	actual, err := d.GetInterfaceConfig("bind9", "eth0")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to get interface config: %s", err.Error())
+	}
+	if actual != ifConfig {
+		t.Fatalf("FAILED: Get I/F config. Expected %q, got %q", ifConfig, actual)
+	}
+	body := engine.bodies["POST /containers/bind9/exec"]
+	expected := `{"AttachStdout":true,"AttachStderr":true,"Cmd":["ip","addr","list","eth0"]}`
+	if body != expected {
+		t.Fatalf("FAILED: Exec request. Expected %s, got %s", expected, body)
+	}
+
+	engine.responses["POST /exec/e1/start"] = muxFrame(2, "RTNETLINK answers: File exists\n")
+	engine.responses["GET /exec/e1/json"] = `{"ExitCode": 2, "Running": false}`
+	err = d.AddV6Route("bind9", "fd00:10:64:ff9b::/96", "fd00:10::200")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure adding route")
+	}
+	expected = "docker API exec failed for \"Add IPv6 route\": exit status 2 (RTNETLINK answers: File exists)"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+	if !errors.Is(err, lazyjack.ErrAlreadyExists) {
+		t.Fatalf("FAILED: Expected existing route to be classified as already exists")
+	}
+}
+
+func TestDemuxDockerStream(t *testing.T) {
+	var stdout, stderr bytes.Buffer
+	stream := muxFrame(1, "out1 ") + muxFrame(2, "err") + muxFrame(1, "out2")
+	err := lazyjack.DemuxDockerStream(strings.NewReader(stream), &stdout, &stderr)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to demux stream: %s", err.Error())
+	}
+	if stdout.String() != "out1 out2" || stderr.String() != "err" {
+		t.Fatalf("FAILED: Demux stream wrong, stdout %q, stderr %q", stdout.String(), stderr.String())
+	}
+
+	err = lazyjack.DemuxDockerStream(strings.NewReader(muxFrame(1, "truncated")[:12]), &stdout, &stderr)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure with truncated stream")
+	}
+	err = lazyjack.DemuxDockerStream(strings.NewReader(muxFrame(7, "bogus")), &stdout, &stderr)
+	if err == nil || err.Error() != "unknown docker stream type 7" {
+		t.Fatalf("FAILED: Expected failure with unknown stream type, got %v", err)
+	}
+}
+
+func TestDockerAPINetworkAndVolumes(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /networks/create":                `{"Id": "n1", "Warning": ""}`,
+			"DELETE /networks/support_net":         "",
+			"POST /volumes/create":                 `{"Name": "volume-bind9"}`,
+			"DELETE /volumes/volume-bind9?force=1": "",
+			"GET /volumes/volume-bind9":            `{"Name": "volume-bind9", "Mountpoint": "/var/lib/docker/volumes/volume-bind9/_data"}`,
+			"DELETE /containers/bind9?force=1":     "",
+		},
+		status: map[string]int{
+			"POST /networks/create":                http.StatusCreated,
+			"DELETE /networks/support_net":         http.StatusNoContent,
+			"POST /volumes/create":                 http.StatusCreated,
+			"DELETE /volumes/volume-bind9?force=1": http.StatusNoContent,
+			"DELETE /containers/bind9?force=1":     http.StatusNoContent,
+		},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	err := d.CreateNetwork("support_net", "fd00:10::/64", "172.18.0.0/16", "fd00:10::")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create network: %s", err.Error())
+	}
+	expected := `{"Name":"support_net","CheckDuplicate":true,"EnableIPv6":true,"IPAM":{"Config":[{"Subnet":"fd00:10::/64","Gateway":"fd00:10::1"},{"Subnet":"172.18.0.0/16"}]}}`
+	if engine.bodies["POST /networks/create"] != expected {
+		t.Fatalf("FAILED: Create network request. Expected %s, got %s", expected, engine.bodies["POST /networks/create"])
+	}
+	err = d.DeleteNetwork("support_net")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete network: %s", err.Error())
+	}
+	err = d.CreateVolume("volume-bind9")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create volume: %s", err.Error())
+	}
+	mountPoint, err := d.GetVolumeMountPoint("volume-bind9")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to get volume mount point: %s", err.Error())
+	}
+	if mountPoint != "/var/lib/docker/volumes/volume-bind9/_data" {
+		t.Fatalf("FAILED: Volume mount point wrong, got %q", mountPoint)
+	}
+	err = d.DeleteVolume("volume-bind9")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete volume: %s", err.Error())
+	}
+	err = d.DeleteVolume("no-such-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected no error deleting non-existent volume: %s", err.Error())
+	}
+	err = d.DeleteContainer("bind9")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete container: %s", err.Error())
+	}
+
+	err = d.DeleteNetwork("no-such-net")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure deleting non-existent network")
+	}
+	if !lazyjack.IsDockerAPINotFound(err) {
+		t.Fatalf("FAILED: Expected not found error, got %v", err)
+	}
+	expected = "docker API failed for \"Delete network\": no such resource for DELETE /networks/no-such-net (status 404)"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestDockerAPITimeoutAndCancel(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"POST /volumes/create": `{"Name": "volume-bind9"}`,
+		},
+		delay: 5 * time.Second,
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	d.Timeout = 50 * time.Millisecond
+	err := d.CreateVolume("volume-bind9")
+	if err == nil {
+		t.Fatalf("FAILED: Expected API call to time out")
+	}
+	if !strings.Contains(err.Error(), "context deadline exceeded") {
+		t.Fatalf("FAILED: Expected deadline exceeded error, got %q", err.Error())
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	d.Timeout = 0
+	err = d.WithContext(ctx).CreateVolume("volume-bind9")
+	if err == nil {
+		t.Fatalf("FAILED: Expected API call to be canceled")
+	}
+	if !strings.Contains(err.Error(), "context canceled") {
+		t.Fatalf("FAILED: Expected canceled error, got %q", err.Error())
+	}
+}
+
+func TestDockerAPINoDaemon(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	d := lazyjack.NewDockerAPI(filepath.Join(basePath, "missing.sock"))
+	if d.ResourceState("bind9") != lazyjack.ResourceNotPresent {
+		t.Fatalf("FAILED: Expected no resource, when daemon is not running")
+	}
+	err := d.CreateVolume("volume-bind9")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure, when daemon is not running")
+	}
+}
+
+func TestDockerAPIContainerLogs(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	engine := &fakeEngine{
+		responses: map[string]string{
+			"GET /containers/bind9/logs?stderr=1&stdout=1&tail=20": muxFrame(1, "starting BIND\n") + muxFrame(2, "loading configuration\n"),
+		},
+	}
+	server, d := HelperDockerEngine(basePath, engine, t)
+	defer server.Close()
+
+	actual, err := d.ContainerLogs("bind9")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to get container logs: %s", err.Error())
+	}
+	expected := "starting BIND\nloading configuration\n"
+	if actual != expected {
+		t.Fatalf("FAILED: Container logs. Expected %q, got %q", expected, actual)
+	}
+
+	_, err = d.ContainerLogs("tayga")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure getting logs for missing container")
+	}
+}
@@ -2,7 +2,6 @@ package lazyjack
 
 import (
 	"fmt"
-	"os"
 
 	"github.com/golang/glog"
 )
@@ -18,7 +17,7 @@ func CleanupForPlugin(node *Node, c *Config) error {
 	}
 
 	// Note: CNI config file will be removed, when "kubeadm reset" performed
-	err = os.RemoveAll(c.General.CNIArea)
+	err = FS().RemoveAll(c.General.CNIArea)
 	if err != nil {
 		return fmt.Errorf("unable to remove CNI config file and area: %v", err)
 	}
@@ -42,8 +41,9 @@ func StopKubernetes() error {
 
 // TearDown performs the "down" operations of bringing down the cluster,
 // removing static routes, removing the Bridge plugin config file, and
-// removing the bridge.
-func TearDown(name string, c *Config) {
+// removing the bridge. All the steps are attempted, and any unsuccessful
+// ones are reported in a MultiError.
+func TearDown(name string, c *Config) error {
 	node := c.Topology[name]
 	var asType string
 	switch {
@@ -52,22 +52,34 @@ func TearDown(name string, c *Config) {
 	case node.IsMinion:
 		asType = "minion"
 	default:
-		glog.Infof("Skipping - node %q role is not master or minion", name)
-		return
+		return notApplicableErrorf("skipping - node %q role is not master or minion", name)
 	}
 	glog.Infof("Tearing down %q as %s", name, asType)
 
+	results := &MultiError{}
+	if c.General.PersistRoutes {
+		err := RemoveRoutesUnit(c)
+		if err != nil {
+			glog.Warning(err.Error())
+		}
+		results.Add("remove routes unit", err)
+	}
+
 	err := StopKubernetes()
 	if err != nil {
-		glog.Warningf("unable to reset cluster: %v", err)
+		err = fmt.Errorf("unable to reset cluster: %w", err)
+		glog.Warning(err.Error())
 	}
+	results.Add("reset cluster", err)
 
 	// Leave kubeadm.conf, in case user customized it.
 
 	err = CleanupForPlugin(&node, c)
 	if err != nil {
-		glog.Warningf(err.Error())
+		glog.Warning(err.Error())
 	}
+	results.Add("clean plugin", err)
 
 	glog.Infof("Node %q tore down", name)
+	return results.ErrorOrNil()
 }
@@ -131,7 +131,7 @@ func TestFailedRemovingRouteCleanupForPlugin(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected to not be able to remove route")
 	}
-	expected := "unable to remove routes for bridge plugin: unable to delete pod network route for fd00:40:0:0:20::/80 to minion1: mock failure deleting route"
+	expected := "unable to remove routes for bridge plugin: unable to delete pod network route to fd00:40:0:0:20::/80 via fd00:100::20: mock failure deleting route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg to start with %q, got %q", expected, err.Error())
 	}
@@ -0,0 +1,218 @@
+package lazyjack
+
+import (
+	"errors"
+	"fmt"
+	"os/exec"
+	"strings"
+	"syscall"
+)
+
+var (
+	// ErrAlreadyExists indicates that a resource being created is
+	// already present
+	ErrAlreadyExists = errors.New("already exists")
+	// ErrNotFound indicates that a resource being removed is not present
+	ErrNotFound = errors.New("not found")
+	// ErrNotApplicable indicates that the operation does not apply to the
+	// node (e.g. bringing up a node that is not a master or minion)
+	ErrNotApplicable = errors.New("not applicable")
+)
+
+// SkipError reports that a step was skipped, because the resource is
+// already in (or absent from) the desired state, or the step does not
+// apply to the node. The reason is ErrAlreadyExists, ErrNotFound, or
+// ErrNotApplicable, so that callers can use errors.Is() to check the
+// condition, and errors.As() to check for any skipped step.
+type SkipError struct {
+	Msg    string
+	Reason error
+}
+
+func (e *SkipError) Error() string {
+	return e.Msg
+}
+
+func (e *SkipError) Unwrap() error {
+	return e.Reason
+}
+
+// IsSkipped indicates if the error is from a skipped step.
+func IsSkipped(err error) bool {
+	var skip *SkipError
+	return errors.As(err, &skip)
+}
+
+// existsErrorf creates a skip error, indicating that the resource already
+// exists.
+func existsErrorf(format string, args ...interface{}) error {
+	return &SkipError{Msg: fmt.Sprintf(format, args...), Reason: ErrAlreadyExists}
+}
+
+// notFoundErrorf creates a skip error, indicating that the resource does
+// not exist.
+func notFoundErrorf(format string, args ...interface{}) error {
+	return &SkipError{Msg: fmt.Sprintf(format, args...), Reason: ErrNotFound}
+}
+
+// notApplicableErrorf creates a skip error, indicating that the operation
+// does not apply to the node.
+func notApplicableErrorf(format string, args ...interface{}) error {
+	return &SkipError{Msg: fmt.Sprintf(format, args...), Reason: ErrNotApplicable}
+}
+
+// classifyNetlinkError converts the errno from netlink for an existing
+// entry (EEXIST), or a missing entry (ESRCH), into the corresponding skip
+// error. The message is unchanged.
+func classifyNetlinkError(err error) error {
+	switch {
+	case err == nil:
+		return nil
+	case errors.Is(err, syscall.EEXIST):
+		return &SkipError{Msg: err.Error(), Reason: ErrAlreadyExists}
+	case errors.Is(err, syscall.ESRCH):
+		return &SkipError{Msg: err.Error(), Reason: ErrNotFound}
+	}
+	return err
+}
+
+// CommandError is a failed container runtime command, with the error
+// output from the command, so that idempotent operations can check for the
+// condition they expect.
+type CommandError struct {
+	Msg    string
+	Stderr string
+}
+
+func (e *CommandError) Error() string {
+	return e.Msg
+}
+
+// newCommandError creates the (formatted) error for a failed command,
+// keeping the error output, if the command ran.
+func newCommandError(err error, format string, args ...interface{}) error {
+	failure := &CommandError{Msg: fmt.Sprintf(format, args...)}
+	if exitErr, ok := err.(*exec.ExitError); ok {
+		failure.Stderr = string(exitErr.Stderr)
+	}
+	return failure
+}
+
+// commandConditions are the error output for each skip reason. A command
+// run in a container (e.g. ip) reports an existing entry as "File exists".
+var commandConditions = map[error][]string{
+	ErrNotFound:      {"no such", "not found"},
+	ErrAlreadyExists: {"already exists", "already in use", "file exists"},
+}
+
+// classifyCommandError checks the error output from a failed command for
+// the condition that the (idempotent) operation expects, such as a missing
+// resource for a delete, and if found, makes the failure a skip error with
+// that reason. Other failures are returned as is, so operations that create
+// resources (e.g. run, where "not found" is a missing image) must not use
+// this.
+func classifyCommandError(err, reason error) error {
+	var cmdErr *CommandError
+	if !errors.As(err, &cmdErr) {
+		return err
+	}
+	stderr := strings.ToLower(cmdErr.Stderr)
+	for _, condition := range commandConditions[reason] {
+		if strings.Contains(stderr, condition) {
+			return &SkipError{Msg: err.Error(), Reason: reason}
+		}
+	}
+	return err
+}
+
+// StepResult is the outcome of one step of an operation. The error is nil,
+// if the step succeeded.
+type StepResult struct {
+	Step string
+	Err  error
+}
+
+// MultiError collects the results of the steps of an operation that keeps
+// going, when steps fail or are skipped. The message has the errors from
+// each of the unsuccessful steps.
+type MultiError struct {
+	Results []StepResult
+}
+
+// Add records the result of a step.
+func (m *MultiError) Add(step string, err error) {
+	m.Results = append(m.Results, StepResult{Step: step, Err: err})
+}
+
+// Errors provides the errors from the steps that failed or were skipped.
+func (m *MultiError) Errors() []error {
+	var errs []error
+	for _, r := range m.Results {
+		if r.Err != nil {
+			errs = append(errs, r.Err)
+		}
+	}
+	return errs
+}
+
+// Failed provides the results for steps that failed (and were not just
+// skipped). A step with its own step results fails, if any of those
+// failed.
+func (m *MultiError) Failed() []StepResult {
+	var failed []StepResult
+	for _, r := range m.Results {
+		if stepFailed(r.Err) {
+			failed = append(failed, r)
+		}
+	}
+	return failed
+}
+
+// stepFailed indicates if the error is from a failed step, instead of a
+// successful or skipped one.
+func stepFailed(err error) bool {
+	var multi *MultiError
+	if errors.As(err, &multi) {
+		return len(multi.Failed()) > 0
+	}
+	return err != nil && !IsSkipped(err)
+}
+
+func (m *MultiError) Error() string {
+	var msgs []string
+	for _, err := range m.Errors() {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ". ")
+}
+
+// Is allows errors.Is() to check each of the step errors. This is used,
+// instead of an Unwrap() that returns all the errors, so that older Go
+// versions (before 1.20) check the steps too.
+func (m *MultiError) Is(target error) bool {
+	for _, err := range m.Errors() {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// As allows errors.As() to find the first step error that matches the
+// target.
+func (m *MultiError) As(target interface{}) bool {
+	for _, err := range m.Errors() {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrorOrNil returns the multi-error, if any step was unsuccessful.
+func (m *MultiError) ErrorOrNil() error {
+	if len(m.Errors()) == 0 {
+		return nil
+	}
+	return m
+}
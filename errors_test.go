@@ -0,0 +1,84 @@
+package lazyjack_test
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func TestSkipError(t *testing.T) {
+	var err error = &lazyjack.SkipError{Msg: "skipping - route exists", Reason: lazyjack.ErrAlreadyExists}
+	wrapped := fmt.Errorf("unable to add route: %w", err)
+	if !errors.Is(wrapped, lazyjack.ErrAlreadyExists) {
+		t.Fatalf("FAILED: Expected wrapped error to be for an existing resource")
+	}
+	if errors.Is(wrapped, lazyjack.ErrNotFound) {
+		t.Fatalf("FAILED: Expected wrapped error to not be for a missing resource")
+	}
+	if !lazyjack.IsSkipped(wrapped) {
+		t.Fatalf("FAILED: Expected wrapped error to be for a skipped step")
+	}
+	if lazyjack.IsSkipped(fmt.Errorf("mock failure")) {
+		t.Fatalf("FAILED: Expected plain error to not be for a skipped step")
+	}
+	if err.Error() != "skipping - route exists" {
+		t.Fatalf("FAILED: Expected message to be kept, got %q", err.Error())
+	}
+}
+
+func TestMultiError(t *testing.T) {
+	results := &lazyjack.MultiError{}
+	if results.ErrorOrNil() != nil {
+		t.Fatalf("FAILED: Expected no error, when there are no steps")
+	}
+	results.Add("first", nil)
+	if results.ErrorOrNil() != nil {
+		t.Fatalf("FAILED: Expected no error, when all steps succeed")
+	}
+	results.Add("second", &lazyjack.SkipError{Msg: "skipping - no file", Reason: lazyjack.ErrNotFound})
+	results.Add("third", fmt.Errorf("mock failure"))
+
+	err := results.ErrorOrNil()
+	if err == nil {
+		t.Fatalf("FAILED: Expected error, when steps are unsuccessful")
+	}
+	expected := "skipping - no file. mock failure"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected message %q, got %q", expected, err.Error())
+	}
+	if len(results.Results) != 3 {
+		t.Fatalf("FAILED: Expected results for all steps, got %d", len(results.Results))
+	}
+	failed := results.Failed()
+	if len(failed) != 1 || failed[0].Step != "third" {
+		t.Fatalf("FAILED: Expected only third step to fail, got %+v", failed)
+	}
+	if !errors.Is(err, lazyjack.ErrNotFound) || !lazyjack.IsSkipped(err) {
+		t.Fatalf("FAILED: Expected to find skipped step error")
+	}
+	if errors.Is(err, lazyjack.ErrAlreadyExists) {
+		t.Fatalf("FAILED: Expected to not find error that is not from a step")
+	}
+	var skip *lazyjack.SkipError
+	if !errors.As(err, &skip) || skip.Msg != "skipping - no file" {
+		t.Fatalf("FAILED: Expected to get skipped step error, got %v", skip)
+	}
+}
+
+func TestDockerAPIErrorIs(t *testing.T) {
+	var err error = &lazyjack.DockerAPIError{Name: "Delete container", StatusCode: http.StatusNotFound}
+	if !errors.Is(err, lazyjack.ErrNotFound) || errors.Is(err, lazyjack.ErrAlreadyExists) {
+		t.Fatalf("FAILED: Expected not found status to be a missing resource")
+	}
+	err = fmt.Errorf("unable to create network: %w", &lazyjack.DockerAPIError{Name: "Create network", StatusCode: http.StatusConflict})
+	if !errors.Is(err, lazyjack.ErrAlreadyExists) || errors.Is(err, lazyjack.ErrNotFound) {
+		t.Fatalf("FAILED: Expected conflict status to be an existing resource")
+	}
+	err = &lazyjack.DockerAPIError{Name: "Run container", StatusCode: http.StatusInternalServerError}
+	if errors.Is(err, lazyjack.ErrAlreadyExists) || errors.Is(err, lazyjack.ErrNotFound) {
+		t.Fatalf("FAILED: Expected server error to not be classified")
+	}
+}
@@ -2,7 +2,6 @@ package lazyjack
 
 import (
 	"fmt"
-	"io/ioutil"
 	"os"
 
 	"github.com/golang/glog"
@@ -11,7 +10,7 @@ import (
 // GetFileContents reads the contents of the specified file.
 func GetFileContents(file string) ([]byte, error) {
 	glog.V(4).Infof("Reading %s contents", file)
-	contents, err := ioutil.ReadFile(file)
+	contents, err := FS().ReadFile(file)
 	if err != nil {
 		err = fmt.Errorf("unable to read %s: %v", file, err)
 	}
@@ -23,19 +22,19 @@ func GetFileContents(file string) ([]byte, error) {
 // attempts to restore the backup.
 func SaveFileContents(contents []byte, file, backup string) error {
 	glog.V(4).Infof("Saving updated %s", file)
-	_, err := os.Stat(file)
+	_, err := FS().Stat(file)
 	exists := true
 	if os.IsNotExist(err) {
 		exists = false
 	}
 	if exists {
-		err = os.Rename(file, backup)
+		err = FS().Rename(file, backup)
 		if err != nil {
 			return fmt.Errorf("unable to backup existing file %s to %s: %v", file, backup, err)
 		}
 		glog.V(4).Infof("Backed up existing %s to %s", file, backup)
 	}
-	err = ioutil.WriteFile(file, contents, 0755)
+	err = FS().WriteFile(file, contents, 0755)
 	if err != nil {
 		if exists {
 			return RecoverFile(file, backup, err.Error())
@@ -48,7 +47,7 @@ func SaveFileContents(contents []byte, file, backup string) error {
 
 // RecoverFile attempts to restore the backup of a file to the original.
 func RecoverFile(file, backup, saveErr string) error {
-	err := os.Rename(backup, file)
+	err := FS().Rename(backup, file)
 	if err != nil {
 		return fmt.Errorf("unable to save updated %s (%s) AND unable to restore backup file %s (%v)",
 			file, saveErr, backup, err)
@@ -0,0 +1,435 @@
+package lazyjack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// FileSystem interface defines the file operations used to create, update,
+// and remove the files managed by lazyjack.
+type FileSystem interface {
+	ReadFile(name string) ([]byte, error)
+	Open(name string) (io.ReadCloser, error)
+	WriteFile(name string, data []byte, perm os.FileMode) error
+	Stat(name string) (os.FileInfo, error)
+	ReadDir(name string) ([]os.FileInfo, error)
+	Rename(oldName, newName string) error
+	Remove(name string) error
+	RemoveAll(name string) error
+	MkdirAll(name string, perm os.FileMode) error
+	Chmod(name string, mode os.FileMode) error
+	Chown(name string, uid, gid int) error
+}
+
+var fileSystem FileSystem = OsFS{}
+
+// RegisterFileSystem will register the filesystem used for file operations.
+func RegisterFileSystem(fs FileSystem) {
+	fileSystem = fs
+}
+
+// FS provides the filesystem used for file operations.
+func FS() FileSystem {
+	return fileSystem
+}
+
+// OsFS performs file operations on the host's filesystem.
+type OsFS struct{}
+
+func (OsFS) ReadFile(name string) ([]byte, error) {
+	return ioutil.ReadFile(name)
+}
+
+func (OsFS) Open(name string) (io.ReadCloser, error) {
+	return os.Open(name)
+}
+
+func (OsFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	return ioutil.WriteFile(name, data, perm)
+}
+
+func (OsFS) Stat(name string) (os.FileInfo, error) {
+	return os.Stat(name)
+}
+
+func (OsFS) ReadDir(name string) ([]os.FileInfo, error) {
+	return ioutil.ReadDir(name)
+}
+
+func (OsFS) Rename(oldName, newName string) error {
+	return os.Rename(oldName, newName)
+}
+
+func (OsFS) Remove(name string) error {
+	return os.Remove(name)
+}
+
+func (OsFS) RemoveAll(name string) error {
+	return os.RemoveAll(name)
+}
+
+func (OsFS) MkdirAll(name string, perm os.FileMode) error {
+	return os.MkdirAll(name, perm)
+}
+
+func (OsFS) Chmod(name string, mode os.FileMode) error {
+	return os.Chmod(name, mode)
+}
+
+func (OsFS) Chown(name string, uid, gid int) error {
+	return os.Chown(name, uid, gid)
+}
+
+// RootFS performs file operations on the host's filesystem, under the root
+// directory, so that (for example) an image root can be provisioned.
+type RootFS struct {
+	Root string
+}
+
+// path provides the location of the file under the root directory. A name
+// that would be outside of the root (e.g. /../etc/hosts) is rejected.
+func (r RootFS) path(op, name string) (string, error) {
+	root := filepath.Clean(r.Root)
+	p := filepath.Join(root, name)
+	rel, err := filepath.Rel(root, p)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", &os.PathError{Op: op, Path: name, Err: fmt.Errorf("outside of root %s", r.Root)}
+	}
+	return p, nil
+}
+
+func (r RootFS) ReadFile(name string) ([]byte, error) {
+	p, err := r.path("read", name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadFile(p)
+}
+
+func (r RootFS) Open(name string) (io.ReadCloser, error) {
+	p, err := r.path("open", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(p)
+}
+
+func (r RootFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	p, err := r.path("write", name)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(p, data, perm)
+}
+
+func (r RootFS) Stat(name string) (os.FileInfo, error) {
+	p, err := r.path("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	return os.Stat(p)
+}
+
+func (r RootFS) ReadDir(name string) ([]os.FileInfo, error) {
+	p, err := r.path("readdir", name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.ReadDir(p)
+}
+
+func (r RootFS) Rename(oldName, newName string) error {
+	oldPath, err := r.path("rename", oldName)
+	if err != nil {
+		return err
+	}
+	newPath, err := r.path("rename", newName)
+	if err != nil {
+		return err
+	}
+	return os.Rename(oldPath, newPath)
+}
+
+func (r RootFS) Remove(name string) error {
+	p, err := r.path("remove", name)
+	if err != nil {
+		return err
+	}
+	return os.Remove(p)
+}
+
+func (r RootFS) RemoveAll(name string) error {
+	p, err := r.path("removeall", name)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(p)
+}
+
+func (r RootFS) MkdirAll(name string, perm os.FileMode) error {
+	p, err := r.path("mkdir", name)
+	if err != nil {
+		return err
+	}
+	return os.MkdirAll(p, perm)
+}
+
+func (r RootFS) Chmod(name string, mode os.FileMode) error {
+	p, err := r.path("chmod", name)
+	if err != nil {
+		return err
+	}
+	return os.Chmod(p, mode)
+}
+
+func (r RootFS) Chown(name string, uid, gid int) error {
+	p, err := r.path("chown", name)
+	if err != nil {
+		return err
+	}
+	return os.Chown(p, uid, gid)
+}
+
+// memFile is a file or directory in a MemFS.
+type memFile struct {
+	name    string
+	data    []byte
+	mode    os.FileMode
+	modTime time.Time
+	uid     int
+	gid     int
+}
+
+func (f *memFile) Name() string       { return path.Base(f.name) }
+func (f *memFile) Size() int64        { return int64(len(f.data)) }
+func (f *memFile) Mode() os.FileMode  { return f.mode }
+func (f *memFile) ModTime() time.Time { return f.modTime }
+func (f *memFile) IsDir() bool        { return f.mode.IsDir() }
+func (f *memFile) Sys() interface{}   { return nil }
+
+// MemFS is an in-memory filesystem, for dry runs and unit tests. Parent
+// directories must exist, when writing files, as with the OS.
+type MemFS struct {
+	lock  sync.Mutex
+	files map[string]*memFile
+}
+
+// NewMemFS creates an empty in-memory filesystem, with only the root
+// directory.
+func NewMemFS() *MemFS {
+	return &MemFS{files: map[string]*memFile{"/": {name: "/", mode: os.ModeDir | 0755}}}
+}
+
+func memPath(name string) string {
+	return path.Clean("/" + filepath.ToSlash(name))
+}
+
+func (m *MemFS) lookup(op, name string) (*memFile, error) {
+	f, ok := m.files[memPath(name)]
+	if !ok {
+		return nil, &os.PathError{Op: op, Path: name, Err: os.ErrNotExist}
+	}
+	return f, nil
+}
+
+func (m *MemFS) ReadFile(name string) ([]byte, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if f.IsDir() {
+		return nil, &os.PathError{Op: "read", Path: name, Err: syscall.EISDIR}
+	}
+	return append([]byte(nil), f.data...), nil
+}
+
+func (m *MemFS) Open(name string) (io.ReadCloser, error) {
+	data, err := m.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioutil.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (m *MemFS) WriteFile(name string, data []byte, perm os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p := memPath(name)
+	parent, err := m.lookup("open", path.Dir(p))
+	if err != nil || !parent.IsDir() {
+		return &os.PathError{Op: "open", Path: name, Err: os.ErrNotExist}
+	}
+	if f, ok := m.files[p]; ok {
+		if f.IsDir() {
+			return &os.PathError{Op: "open", Path: name, Err: syscall.EISDIR}
+		}
+		f.data = append([]byte(nil), data...)
+		f.modTime = time.Now()
+		return nil
+	}
+	m.files[p] = &memFile{name: p, data: append([]byte(nil), data...), mode: perm.Perm(), modTime: time.Now()}
+	return nil
+}
+
+func (m *MemFS) Stat(name string) (os.FileInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, err := m.lookup("stat", name)
+	if err != nil {
+		return nil, err
+	}
+	info := *f
+	return &info, nil
+}
+
+func (m *MemFS) ReadDir(name string) ([]os.FileInfo, error) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, err := m.lookup("open", name)
+	if err != nil {
+		return nil, err
+	}
+	if !f.IsDir() {
+		return nil, &os.PathError{Op: "readdirent", Path: name, Err: syscall.ENOTDIR}
+	}
+	p := memPath(name)
+	var infos []os.FileInfo
+	for _, child := range m.children(p) {
+		if path.Dir(child) == p {
+			info := *m.files[child]
+			infos = append(infos, &info)
+		}
+	}
+	return infos, nil
+}
+
+// children provides the paths under the directory, in order.
+func (m *MemFS) children(dir string) []string {
+	var names []string
+	prefix := strings.TrimSuffix(dir, "/") + "/"
+	for p := range m.files {
+		if strings.HasPrefix(p, prefix) {
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (m *MemFS) Rename(oldName, newName string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	oldPath, newPath := memPath(oldName), memPath(newName)
+	f, err := m.lookup("rename", oldName)
+	if err != nil {
+		return err
+	}
+	if _, err := m.lookup("rename", path.Dir(newPath)); err != nil {
+		return &os.LinkError{Op: "rename", Old: oldName, New: newName, Err: os.ErrNotExist}
+	}
+	for _, child := range m.children(oldPath) {
+		moved := m.files[child]
+		delete(m.files, child)
+		moved.name = newPath + strings.TrimPrefix(child, oldPath)
+		m.files[moved.name] = moved
+	}
+	delete(m.files, oldPath)
+	f.name = newPath
+	m.files[newPath] = f
+	return nil
+}
+
+func (m *MemFS) Remove(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p := memPath(name)
+	if _, err := m.lookup("remove", name); err != nil {
+		return err
+	}
+	if len(m.children(p)) > 0 {
+		return &os.PathError{Op: "remove", Path: name, Err: syscall.ENOTEMPTY}
+	}
+	delete(m.files, p)
+	return nil
+}
+
+func (m *MemFS) RemoveAll(name string) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p := memPath(name)
+	for _, child := range m.children(p) {
+		delete(m.files, child)
+	}
+	if p != "/" {
+		delete(m.files, p)
+	}
+	return nil
+}
+
+func (m *MemFS) MkdirAll(name string, perm os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	p := memPath(name)
+	var dirs []string
+	for dir := p; ; dir = path.Dir(dir) {
+		if f, ok := m.files[dir]; ok {
+			if !f.IsDir() {
+				return &os.PathError{Op: "mkdir", Path: dir, Err: syscall.ENOTDIR}
+			}
+			break
+		}
+		dirs = append(dirs, dir)
+	}
+	for _, dir := range dirs {
+		m.files[dir] = &memFile{name: dir, mode: os.ModeDir | perm.Perm(), modTime: time.Now()}
+	}
+	return nil
+}
+
+func (m *MemFS) Chmod(name string, mode os.FileMode) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, err := m.lookup("chmod", name)
+	if err != nil {
+		return err
+	}
+	f.mode = f.mode&os.ModeType | mode.Perm()
+	return nil
+}
+
+func (m *MemFS) Chown(name string, uid, gid int) error {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	f, err := m.lookup("chown", name)
+	if err != nil {
+		return err
+	}
+	f.uid, f.gid = uid, gid
+	return nil
+}
+
+// Files provides the names of the (non-directory) files, in order.
+func (m *MemFS) Files() []string {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	var names []string
+	for p, f := range m.files {
+		if !f.IsDir() {
+			names = append(names, p)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,128 @@
+package lazyjack_test
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func TestMemFS(t *testing.T) {
+	fs := lazyjack.NewMemFS()
+	err := fs.WriteFile("/etc/hosts", []byte("data"), 0644)
+	if !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected write to fail, without parent area, got %v", err)
+	}
+	err = fs.MkdirAll("/etc/systemd/system", 0755)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create area: %s", err.Error())
+	}
+	err = fs.WriteFile("/etc/hosts", []byte("data"), 0644)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to write file: %s", err.Error())
+	}
+	contents, err := fs.ReadFile("/etc/hosts")
+	if err != nil || string(contents) != "data" {
+		t.Fatalf("FAILED: Expected to read file contents, got %q (%v)", contents, err)
+	}
+	err = fs.Chmod("/etc/hosts", 0600)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to change mode: %s", err.Error())
+	}
+	info, err := fs.Stat("/etc/hosts")
+	if err != nil || info.Mode().Perm() != 0600 || info.Size() != 4 || info.IsDir() {
+		t.Fatalf("FAILED: Unexpected file info %+v (%v)", info, err)
+	}
+
+	err = fs.Rename("/etc/hosts", "/etc/hosts.bak")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to rename file: %s", err.Error())
+	}
+	expected := "/etc/hosts.bak"
+	if strings.Join(fs.Files(), ", ") != expected {
+		t.Fatalf("FAILED: Expected files %q, got %q", expected, strings.Join(fs.Files(), ", "))
+	}
+	infos, err := fs.ReadDir("/etc")
+	if err != nil || len(infos) != 2 || infos[0].Name() != "hosts.bak" || !infos[1].IsDir() {
+		t.Fatalf("FAILED: Expected file and area in directory, got %+v (%v)", infos, err)
+	}
+	err = fs.Remove("/etc")
+	if err == nil {
+		t.Fatalf("FAILED: Expected remove of non-empty area to fail")
+	}
+	err = fs.RemoveAll("/etc")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to remove area: %s", err.Error())
+	}
+	_, err = fs.ReadFile("/etc/hosts.bak")
+	if !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected file to be removed, got %v", err)
+	}
+	err = fs.Remove("/etc")
+	if !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected area to be removed, got %v", err)
+	}
+}
+
+func TestSaveFileContentsWithMemFS(t *testing.T) {
+	fs := lazyjack.NewMemFS()
+	lazyjack.RegisterFileSystem(fs)
+	defer lazyjack.RegisterFileSystem(lazyjack.OsFS{})
+
+	fs.MkdirAll("/etc", 0755)
+	fs.WriteFile("/etc/resolv.conf", []byte("nameserver 8.8.8.8\n"), 0644)
+	err := lazyjack.SaveFileContents([]byte("nameserver fd00:10::100\n"), "/etc/resolv.conf", "/etc/resolv.conf.bak")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to save file: %s", err.Error())
+	}
+	contents, _ := lazyjack.GetFileContents("/etc/resolv.conf")
+	if string(contents) != "nameserver fd00:10::100\n" {
+		t.Fatalf("FAILED: Expected updated contents, got %q", contents)
+	}
+	backup, _ := fs.ReadFile("/etc/resolv.conf.bak")
+	if string(backup) != "nameserver 8.8.8.8\n" {
+		t.Fatalf("FAILED: Expected backup of original contents, got %q", backup)
+	}
+}
+
+func TestRootFS(t *testing.T) {
+	root := TempFileName(os.TempDir(), "-root")
+	HelperSetupArea(root, t)
+	defer HelperCleanupArea(root, t)
+
+	fs := lazyjack.RootFS{Root: root}
+	err := fs.MkdirAll("/etc/systemd/system", 0755)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create area under root: %s", err.Error())
+	}
+	err = fs.WriteFile("/etc/systemd/system/unit.service", []byte("[Unit]\n"), 0644)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to write file under root: %s", err.Error())
+	}
+	contents, err := ioutil.ReadFile(filepath.Join(root, "etc/systemd/system/unit.service"))
+	if err != nil || string(contents) != "[Unit]\n" {
+		t.Fatalf("FAILED: Expected file to be under root, got %q (%v)", contents, err)
+	}
+	err = fs.Rename("/etc/systemd/system/unit.service", "/etc/unit.service")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to rename file under root: %s", err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(root, "etc/unit.service")); err != nil {
+		t.Fatalf("FAILED: Expected renamed file to be under root: %s", err.Error())
+	}
+	for _, name := range []string{"/../etc/hosts", "../hosts", "/etc/../../hosts"} {
+		err = fs.WriteFile(name, []byte("# hosts\n"), 0644)
+		if err == nil {
+			t.Fatalf("FAILED: Expected %s to be rejected, as outside of root", name)
+		}
+		if _, err = fs.Stat(name); err == nil || os.IsNotExist(err) {
+			t.Fatalf("FAILED: Expected stat of %s to be rejected, as outside of root, got %v", name, err)
+		}
+	}
+	if _, err = fs.Stat("/etc/../etc/unit.service"); err != nil {
+		t.Fatalf("FAILED: Expected path within root to be allowed: %s", err.Error())
+	}
+}
@@ -0,0 +1,219 @@
+package lazyjack
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/golang/glog"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+const (
+	// DefaultReadyTimeout is the time allowed for the DNS64 and NAT64
+	// servers to start running and become healthy
+	DefaultReadyTimeout = 60 * time.Second
+	// ReadyPollInterval is the time between readiness checks
+	ReadyPollInterval = time.Second
+	// HealthProbeTimeout is the time limit for a single health probe
+	HealthProbeTimeout = 2 * time.Second
+	// HealthProbeName is queried to check DNS64. It only has A records
+	// (RFC 7050), so a AAAA answer must have been synthesized.
+	HealthProbeName = "ipv4only.arpa."
+	// ContainerLogLines is the number of log lines shown, when a container
+	// does not become ready
+	ContainerLogLines = 20
+
+	healthProbeID = 0x4c4a
+)
+
+// ValidateHealthChecks checks the timeout for the DNS64 and NAT64 servers
+// to become ready.
+func ValidateHealthChecks(c *Config) error {
+	if c.General.ReadyTimeout == "" {
+		return nil
+	}
+	timeout, err := time.ParseDuration(c.General.ReadyTimeout)
+	if err != nil || timeout <= 0 {
+		return fmt.Errorf("invalid ready-timeout %q (use a positive duration, like 90s)", c.General.ReadyTimeout)
+	}
+	return nil
+}
+
+// HealthCheckTimeout provides the time allowed for the servers to become
+// ready, using the default, if not configured.
+func HealthCheckTimeout(c *Config) time.Duration {
+	timeout, err := time.ParseDuration(c.General.ReadyTimeout)
+	if err != nil || timeout <= 0 {
+		return DefaultReadyTimeout
+	}
+	return timeout
+}
+
+// WaitFor repeatedly performs the check, until it succeeds, or the timeout
+// expires. On timeout, the error from the last check is reported.
+func WaitFor(what string, timeout time.Duration, check func() error) error {
+	deadline := time.Now().Add(timeout)
+	for {
+		err := check()
+		if err == nil {
+			return nil
+		}
+		remaining := time.Until(deadline)
+		if remaining <= 0 {
+			return fmt.Errorf("%s not ready after %v: %v", what, timeout, err)
+		}
+		glog.V(4).Infof("Waiting for %s: %v", what, err)
+		if remaining > ReadyPollInterval {
+			remaining = ReadyPollInterval
+		}
+		time.Sleep(remaining)
+	}
+}
+
+// AddContainerDiagnostics adds the last log lines from the container to the
+// error, to help determine why the container is not working.
+func AddContainerDiagnostics(name string, err error, c *Config) error {
+	logs, logErr := c.General.Hyper.ContainerLogs(name)
+	if logErr != nil {
+		return fmt.Errorf("%v (unable to get %s container logs: %v)", err, name, logErr)
+	}
+	logs = strings.TrimRight(logs, "\n")
+	if logs == "" {
+		return fmt.Errorf("%v (no %s container logs)", err, name)
+	}
+	return fmt.Errorf("%v\nlast log lines from %s container:\n%s", err, name, logs)
+}
+
+// WaitForContainer waits for the container to be running, so that it can
+// be configured.
+func WaitForContainer(name string, c *Config) error {
+	err := WaitFor(name+" container", HealthCheckTimeout(c), func() error {
+		state := c.General.Hyper.ResourceState(name)
+		if state != ResourceRunning {
+			return fmt.Errorf("container state is %q", state)
+		}
+		return nil
+	})
+	if err != nil {
+		return AddContainerDiagnostics(name, err, c)
+	}
+	glog.V(1).Infof("Container %s is running", name)
+	return nil
+}
+
+// BuildDNS64ProbeQuery constructs the query for the AAAA record of the
+// health probe name.
+func BuildDNS64ProbeQuery() ([]byte, error) {
+	name, err := dnsmessage.NewName(HealthProbeName)
+	if err != nil {
+		return nil, err
+	}
+	query := dnsmessage.Message{
+		Header: dnsmessage.Header{ID: healthProbeID, RecursionDesired: true},
+		Questions: []dnsmessage.Question{
+			{Name: name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET},
+		},
+	}
+	return query.Pack()
+}
+
+// ProbeDNS64 queries the DNS64 server for the AAAA record of a name that
+// only has A records, and checks that the answer is within the DNS64
+// prefix. This verifies both the DNS64 server and the path, via NAT64, to
+// the remote DNS server.
+func ProbeDNS64(server string, c *Config) error {
+	_, prefix, err := net.ParseCIDR(c.DNS64.CIDR)
+	if err != nil {
+		return fmt.Errorf("DNS64 CIDR (%s) is invalid: %v", c.DNS64.CIDR, err)
+	}
+	query, err := BuildDNS64ProbeQuery()
+	if err != nil {
+		return fmt.Errorf("unable to build DNS64 probe query: %v", err)
+	}
+	conn, err := net.DialTimeout("udp", server, HealthProbeTimeout)
+	if err != nil {
+		return fmt.Errorf("unable to reach DNS64 server %s: %v", server, err)
+	}
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(HealthProbeTimeout))
+	if _, err = conn.Write(query); err != nil {
+		return fmt.Errorf("unable to query DNS64 server %s: %v", server, err)
+	}
+	buf := make([]byte, maxDNSMessage)
+	n, err := conn.Read(buf)
+	if err != nil {
+		return fmt.Errorf("no response from DNS64 server %s: %v", server, err)
+	}
+
+	var response dnsmessage.Message
+	if err = response.Unpack(buf[:n]); err != nil {
+		return fmt.Errorf("invalid response from DNS64 server %s: %v", server, err)
+	}
+	if response.ID != healthProbeID {
+		return fmt.Errorf("mismatched response ID from DNS64 server %s", server)
+	}
+	if response.RCode != dnsmessage.RCodeSuccess {
+		return fmt.Errorf("DNS64 server %s failed query for %s: %v", server, HealthProbeName, response.RCode)
+	}
+	for _, answer := range response.Answers {
+		if aaaa, ok := answer.Body.(*dnsmessage.AAAAResource); ok && prefix.Contains(net.IP(aaaa.AAAA[:])) {
+			glog.V(4).Infof("DNS64 server %s synthesized %s for %s", server, net.IP(aaaa.AAAA[:]), HealthProbeName)
+			return nil
+		}
+	}
+	return fmt.Errorf("DNS64 server %s did not synthesize a AAAA record within %s for %s", server, c.DNS64.CIDR, HealthProbeName)
+}
+
+// BuildPingArgs constructs arguments to send a single ping to the address.
+func BuildPingArgs(addr string) []string {
+	return []string{"-6", "-c", "1", "-W", fmt.Sprintf("%d", int(HealthProbeTimeout/time.Second)), addr}
+}
+
+// ProbeNAT64 pings the remote DNS server, using its synthesized address,
+// to verify that traffic is translated by the NAT64 server.
+func ProbeNAT64(c *Config) error {
+	addr := c.DNS64.CIDRPrefix + c.DNS64.RemoteV4Server
+	_, err := DoExecCommand("ping", BuildPingArgs(addr))
+	if err != nil {
+		return fmt.Errorf("unable to ping %s via NAT64: %v", addr, err)
+	}
+	glog.V(4).Infof("Pinged %s via NAT64", addr)
+	return nil
+}
+
+// CheckServerHealth waits for the DNS64 and NAT64 servers on the node to
+// handle traffic. The NAT64 probe is done from the host, so it needs the
+// route to the DNS64 prefix, that is only created on cluster nodes, and
+// is not done with Jool, which only translates forwarded traffic.
+func CheckServerHealth(node *Node, c *Config) error {
+	if c.General.SkipHealthChecks {
+		glog.V(1).Info("Skipping DNS64 and NAT64 health checks")
+		return nil
+	}
+	timeout := HealthCheckTimeout(c)
+	if node.IsNAT64Server {
+		if UsingJool(c) || !(node.IsMaster || node.IsMinion) {
+			glog.V(1).Info("Skipping NAT64 health check, as host traffic is not routed through NAT64")
+		} else {
+			err := WaitFor("NAT64 server", timeout, func() error { return ProbeNAT64(c) })
+			if err != nil {
+				return AddContainerDiagnostics(NAT64Name, err, c)
+			}
+			glog.V(1).Info("NAT64 server is healthy")
+		}
+	}
+	if node.IsDNS64Server {
+		server := net.JoinHostPort(c.DNS64.ServerIP, fmt.Sprintf("%d", dnsPort))
+		err := WaitFor("DNS64 server", timeout, func() error { return ProbeDNS64(server, c) })
+		if err != nil {
+			if c.DNS64.Backend == BuiltinDNS64Backend {
+				return fmt.Errorf("%v (see: journalctl -u %s)", err, DNS64ServiceFile)
+			}
+			return AddContainerDiagnostics(DNS64Name, err, c)
+		}
+		glog.V(1).Info("DNS64 server is healthy")
+	}
+	return nil
+}
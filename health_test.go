@@ -0,0 +1,185 @@
+package lazyjack_test
+
+import (
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// HelperDNS64Responder answers one query with a AAAA record for the IP
+// specified, returning the address it is listening on.
+func HelperDNS64Responder(ip string, t *testing.T) string {
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create DNS responder for test: %s", err.Error())
+	}
+	go func() {
+		defer conn.Close()
+		buf := make([]byte, 512)
+		n, addr, err := conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		var m dnsmessage.Message
+		if m.Unpack(buf[:n]) != nil || len(m.Questions) != 1 {
+			return
+		}
+		m.Header.Response = true
+		aaaa := &dnsmessage.AAAAResource{}
+		copy(aaaa.AAAA[:], net.ParseIP(ip))
+		m.Answers = []dnsmessage.Resource{
+			{
+				Header: dnsmessage.ResourceHeader{Name: m.Questions[0].Name, Type: dnsmessage.TypeAAAA, Class: dnsmessage.ClassINET},
+				Body:   aaaa,
+			},
+		}
+		response, _ := m.Pack()
+		conn.WriteTo(response, addr)
+	}()
+	return conn.LocalAddr().String()
+}
+
+func TestValidateHealthChecks(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		timeout     string
+		expectedErr string
+	}{
+		{name: "default", timeout: ""},
+		{name: "custom", timeout: "2m30s"},
+		{name: "no units", timeout: "90", expectedErr: "invalid ready-timeout \"90\" (use a positive duration, like 90s)"},
+		{name: "negative", timeout: "-5s", expectedErr: "invalid ready-timeout \"-5s\" (use a positive duration, like 90s)"},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{General: lazyjack.GeneralSettings{ReadyTimeout: tc.timeout}}
+		err := lazyjack.ValidateHealthChecks(c)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected timeout to be valid: %s", tc.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected error %q", tc.name, tc.expectedErr)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedErr, err.Error())
+		}
+	}
+	c := &lazyjack.Config{}
+	if lazyjack.HealthCheckTimeout(c) != lazyjack.DefaultReadyTimeout {
+		t.Fatalf("FAILED: Expected default timeout, got %v", lazyjack.HealthCheckTimeout(c))
+	}
+}
+
+func TestWaitForContainer(t *testing.T) {
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Hyper:        &MockHypervisor{simRunning: true},
+			ReadyTimeout: "10ms",
+		},
+	}
+	err := lazyjack.WaitForContainer(lazyjack.DNS64Name, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected container to be running: %s", err.Error())
+	}
+
+	c.General.Hyper = &MockHypervisor{}
+	err = lazyjack.WaitForContainer(lazyjack.DNS64Name, c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected container to not become ready")
+	}
+	expected := "bind9 container not ready after 10ms: container state is \"exists\"\nlast log lines from bind9 container:\nmock logs for bind9"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestProbeDNS64(t *testing.T) {
+	c := &lazyjack.Config{DNS64: lazyjack.DNS64Config{CIDR: "fd00:10:64:ff9b::/96"}}
+	server := HelperDNS64Responder("fd00:10:64:ff9b::c000:aa", t)
+	err := lazyjack.ProbeDNS64(server, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected DNS64 probe to succeed: %s", err.Error())
+	}
+
+	server = HelperDNS64Responder("2001:db8::1", t)
+	err = lazyjack.ProbeDNS64(server, c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected DNS64 probe to fail, with unsynthesized address")
+	}
+	expected := "DNS64 server " + server + " did not synthesize a AAAA record within fd00:10:64:ff9b::/96 for ipv4only.arpa."
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestProbeNAT64(t *testing.T) {
+	cmds := &joolCommands{}
+	lazyjack.RegisterExecCommand(cmds.Exec)
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+
+	c := &lazyjack.Config{
+		DNS64: lazyjack.DNS64Config{CIDRPrefix: "fd00:10:64:ff9b::", RemoteV4Server: "8.8.8.8"},
+	}
+	err := lazyjack.ProbeNAT64(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected NAT64 probe to succeed: %s", err.Error())
+	}
+	expected := "ping -6 -c 1 -W 2 fd00:10:64:ff9b::8.8.8.8"
+	if strings.Join(cmds.invoked, ", ") != expected {
+		t.Fatalf("FAILED: Expected command %q, got %q", expected, strings.Join(cmds.invoked, ", "))
+	}
+
+	cmds.failCommand = "ping"
+	err = lazyjack.ProbeNAT64(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected NAT64 probe to fail")
+	}
+	expected = "unable to ping fd00:10:64:ff9b::8.8.8.8 via NAT64: mock failure of ping"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestFailedNAT64CheckServerHealth(t *testing.T) {
+	cmds := &joolCommands{failCommand: "ping"}
+	lazyjack.RegisterExecCommand(cmds.Exec)
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{Hyper: &MockHypervisor{}, ReadyTimeout: "10ms"},
+		DNS64:   lazyjack.DNS64Config{CIDRPrefix: "fd00:10:64:ff9b::", RemoteV4Server: "8.8.8.8"},
+	}
+	node := &lazyjack.Node{Name: "master", IsMaster: true, IsNAT64Server: true}
+	err := lazyjack.CheckServerHealth(node, c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected NAT64 health check to fail")
+	}
+	expected := "NAT64 server not ready after 10ms: unable to ping fd00:10:64:ff9b::8.8.8.8 via NAT64: mock failure of ping\nlast log lines from tayga container:\nmock logs for tayga"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+
+	// Not probed, when host traffic does not go through NAT64
+	c.NAT64.Backend = lazyjack.JoolNAT64Backend
+	err = lazyjack.CheckServerHealth(node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected NAT64 health check to be skipped with Jool: %s", err.Error())
+	}
+	c.NAT64.Backend = lazyjack.TaygaNAT64Backend
+	node.IsMaster = false
+	err = lazyjack.CheckServerHealth(node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected NAT64 health check to be skipped on non-cluster node: %s", err.Error())
+	}
+}
+
+func TestSkipCheckServerHealth(t *testing.T) {
+	c := &lazyjack.Config{General: lazyjack.GeneralSettings{SkipHealthChecks: true}}
+	node := &lazyjack.Node{Name: "master", IsMaster: true, IsDNS64Server: true, IsNAT64Server: true}
+	err := lazyjack.CheckServerHealth(node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected health checks to be skipped: %s", err.Error())
+	}
+}
@@ -1,5 +1,23 @@
 package lazyjack
 
+import (
+	"fmt"
+	"strings"
+)
+
+const (
+	// DockerHypervisor uses dockerd, via the docker CLI
+	DockerHypervisor = "docker"
+	// DockerAPIHypervisor uses dockerd, via the Docker Engine REST API
+	DockerAPIHypervisor = "docker-api"
+	// ContainerdHypervisor uses containerd, via the nerdctl CLI
+	ContainerdHypervisor = "containerd"
+	// PodmanHypervisor uses podman
+	PodmanHypervisor = "podman"
+	// DefaultHypervisor used, when not specified
+	DefaultHypervisor = DockerHypervisor
+)
+
 // Hypervisor interface indicates the general API for hypervisor operations.
 type Hypervisor interface {
 	ResourceState(r string) string
@@ -13,4 +31,43 @@ type Hypervisor interface {
 	CreateVolume(string) error
 	DeleteVolume(string) error
 	GetVolumeMountPoint(string) (string, error)
+	PullImage(string) error
+	LoadImage(string) error
+	Login(string, string, string) error
+	ContainerLogs(string) (string, error)
+}
+
+// ValidateHypervisor ensures that the hypervisor, used for the DNS64 and
+// NAT64 containers, is supported. The default is docker.
+func ValidateHypervisor(c *Config) error {
+	if c.General.Hypervisor == "" {
+		c.General.Hypervisor = DefaultHypervisor
+	}
+	c.General.Hypervisor = strings.ToLower(c.General.Hypervisor)
+	if c.General.Hypervisor == "nerdctl" {
+		c.General.Hypervisor = ContainerdHypervisor
+	}
+	switch c.General.Hypervisor {
+	case DockerHypervisor, DockerAPIHypervisor, ContainerdHypervisor, PodmanHypervisor:
+		return nil
+	default:
+		return fmt.Errorf("unsupported hypervisor %q (use %s, %s, %s, or %s)", c.General.Hypervisor,
+			DockerHypervisor, DockerAPIHypervisor, ContainerdHypervisor, PodmanHypervisor)
+	}
+}
+
+// NewHypervisor creates the hypervisor implementation selected in the config.
+func NewHypervisor(c *Config) (Hypervisor, error) {
+	switch c.General.Hypervisor {
+	case "", DockerHypervisor:
+		return &Docker{Command: DefaultDockerCommand}, nil
+	case DockerAPIHypervisor:
+		return NewDockerAPI(DockerSocket), nil
+	case ContainerdHypervisor:
+		return &Nerdctl{Command: DefaultNerdctlCommand}, nil
+	case PodmanHypervisor:
+		return &Podman{Command: DefaultPodmanCommand}, nil
+	default:
+		return nil, fmt.Errorf("unsupported hypervisor %q", c.General.Hypervisor)
+	}
 }
@@ -2,6 +2,7 @@ package lazyjack_test
 
 import (
 	"fmt"
+	"testing"
 
 	"github.com/pmichali/lazyjack"
 )
@@ -18,14 +19,25 @@ type MockHypervisor struct {
 	simAddRouteFail        bool
 	simRouteExists         bool
 	simCreateNetFail       bool
+	simCreateNetExists     bool
 	simCreateVolumeFail    bool
 	simDeleteVolumeFail    bool
 	simInspectVolumeFail   bool
 	simBadVolumeInfo       bool
+	simPullFail            bool
+	simLoadFail            bool
+	simLoginFail           bool
 	mountPoint             string
+	pulled                 []string
+	loaded                 []string
+	logins                 int
+	started                bool
 }
 
 func (mh *MockHypervisor) ResourceState(r string) string {
+	if mh.started {
+		return lazyjack.ResourceRunning
+	}
 	if mh.simNotExists {
 		return lazyjack.ResourceNotPresent
 	}
@@ -53,6 +65,7 @@ func (mh *MockHypervisor) RunContainer(name string, args []string) error {
 	if mh.simRunFailed {
 		return fmt.Errorf("mock fail to run container")
 	}
+	mh.started = true
 	return nil
 }
 
@@ -91,7 +104,7 @@ func (mh *MockHypervisor) AddV6Route(container, dest, via string) error {
 		return fmt.Errorf("mock fail add route")
 	}
 	if mh.simRouteExists {
-		return fmt.Errorf("exit status 2")
+		return &lazyjack.SkipError{Msg: "RTNETLINK answers: File exists", Reason: lazyjack.ErrAlreadyExists}
 	}
 	return nil
 }
@@ -100,6 +113,9 @@ func (mh *MockHypervisor) CreateNetwork(name, cidr, v4cidr, gw string) error {
 	if mh.simCreateNetFail {
 		return fmt.Errorf("mock fail create of network")
 	}
+	if mh.simCreateNetExists {
+		return &lazyjack.SkipError{Msg: "mock network already exists", Reason: lazyjack.ErrAlreadyExists}
+	}
 	return nil
 }
 
@@ -126,3 +142,111 @@ func (mh *MockHypervisor) GetVolumeMountPoint(name string) (string, error) {
 	}
 	return mh.mountPoint, nil
 }
+
+func (mh *MockHypervisor) PullImage(image string) error {
+	if mh.simPullFail {
+		return fmt.Errorf("mock fail pull of image")
+	}
+	mh.pulled = append(mh.pulled, image)
+	return nil
+}
+
+func (mh *MockHypervisor) LoadImage(tarball string) error {
+	if mh.simLoadFail {
+		return fmt.Errorf("mock fail load of image")
+	}
+	mh.loaded = append(mh.loaded, tarball)
+	return nil
+}
+
+func (mh *MockHypervisor) Login(server, username, password string) error {
+	if mh.simLoginFail {
+		return fmt.Errorf("mock fail login to registry")
+	}
+	mh.logins++
+	return nil
+}
+
+func (mh *MockHypervisor) ContainerLogs(name string) (string, error) {
+	return "mock logs for " + name + "\n", nil
+}
+
+func TestValidateHypervisor(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		hypervisor  string
+		expected    string
+		expectedStr string
+	}{
+		{name: "default", hypervisor: "", expected: lazyjack.DockerHypervisor},
+		{name: "docker", hypervisor: "Docker", expected: lazyjack.DockerHypervisor},
+		{name: "docker API", hypervisor: "docker-api", expected: lazyjack.DockerAPIHypervisor},
+		{name: "containerd", hypervisor: "containerd", expected: lazyjack.ContainerdHypervisor},
+		{name: "nerdctl alias", hypervisor: "nerdctl", expected: lazyjack.ContainerdHypervisor},
+		{name: "podman", hypervisor: "podman", expected: lazyjack.PodmanHypervisor},
+		{name: "unsupported", hypervisor: "lxd", expectedStr: "unsupported hypervisor \"lxd\" (use docker, docker-api, containerd, or podman)"},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{
+			General: lazyjack.GeneralSettings{
+				Hypervisor: tc.hypervisor,
+			},
+		}
+		err := lazyjack.ValidateHypervisor(c)
+		if tc.expectedStr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected hypervisor to be valid: %s", tc.name, err.Error())
+			} else if c.General.Hypervisor != tc.expected {
+				t.Errorf("FAILED: [%s] Expected hypervisor %q, got %q", tc.name, tc.expected, c.General.Hypervisor)
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected hypervisor to be invalid", tc.name)
+		} else if err.Error() != tc.expectedStr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedStr, err.Error())
+		}
+	}
+}
+
+func TestNewHypervisor(t *testing.T) {
+	c := &lazyjack.Config{}
+	h, err := lazyjack.NewHypervisor(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create default hypervisor: %s", err.Error())
+	}
+	if _, ok := h.(*lazyjack.Docker); !ok {
+		t.Fatalf("FAILED: Expected default hypervisor to be docker, got %T", h)
+	}
+
+	c.General.Hypervisor = lazyjack.ContainerdHypervisor
+	h, err = lazyjack.NewHypervisor(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create containerd hypervisor: %s", err.Error())
+	}
+	if _, ok := h.(*lazyjack.Nerdctl); !ok {
+		t.Fatalf("FAILED: Expected containerd hypervisor to use nerdctl, got %T", h)
+	}
+
+	c.General.Hypervisor = lazyjack.DockerAPIHypervisor
+	h, err = lazyjack.NewHypervisor(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create docker API hypervisor: %s", err.Error())
+	}
+	if _, ok := h.(*lazyjack.DockerAPI); !ok {
+		t.Fatalf("FAILED: Expected docker API hypervisor, got %T", h)
+	}
+
+	c.General.Hypervisor = lazyjack.PodmanHypervisor
+	h, err = lazyjack.NewHypervisor(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create podman hypervisor: %s", err.Error())
+	}
+	if _, ok := h.(*lazyjack.Podman); !ok {
+		t.Fatalf("FAILED: Expected podman hypervisor, got %T", h)
+	}
+
+	c.General.Hypervisor = "lxd"
+	_, err = lazyjack.NewHypervisor(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure creating unsupported hypervisor")
+	}
+}
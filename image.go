@@ -0,0 +1,256 @@
+package lazyjack
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// FirstBootServiceFile is the systemd unit that performs the runtime
+	// parts of prepare and up, on the first boot of an image
+	FirstBootServiceFile = "lazyjack-firstboot.service"
+	// FirstBootScript is the script run by the first boot unit
+	FirstBootScript = "/usr/local/sbin/lazyjack-firstboot.sh"
+)
+
+// SetupImageRoot places the system areas (systemd, /etc, CNI config, and
+// Kubernetes certificates) and the work area under the mounted root
+// directory of an image, so that the file-level parts of prepare and up
+// are applied to the image, instead of the host.
+func SetupImageRoot(root string, c *Config) error {
+	abs, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Errorf("unable to determine path for image root %s: %v", root, err)
+	}
+	info, err := FS().Stat(abs)
+	if err != nil {
+		return fmt.Errorf("unable to access image root %s: %v", abs, err)
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("image root %s is not a directory", abs)
+	}
+	c.General.ImageRoot = abs
+	c.General.WorkArea = filepath.Join(abs, c.General.WorkArea)
+	SetupBaseAreas(c.General.WorkArea,
+		filepath.Join(abs, c.General.SystemdArea),
+		filepath.Join(abs, c.General.EtcArea),
+		filepath.Join(abs, c.General.CNIArea),
+		filepath.Join(abs, c.General.K8sCertArea), c)
+	glog.V(1).Infof("Using image root %s", abs)
+	return nil
+}
+
+// ImagePath provides the path of the file, as seen when the image is
+// booted.
+func ImagePath(file string, c *Config) string {
+	if c.General.ImageRoot == "" {
+		return file
+	}
+	return filepath.Join("/", strings.TrimPrefix(file, c.General.ImageRoot))
+}
+
+// RootPath provides the path, under the image root, for a file that is
+// specified as seen when the image is booted.
+func RootPath(file string, c *Config) string {
+	return filepath.Join(c.General.ImageRoot, file)
+}
+
+// CreateFirstBootScriptContents constructs the script that performs the
+// prepare (which only makes the changes that are missing) and, for nodes
+// in the cluster, up commands, and then disables the first boot unit.
+func CreateFirstBootScriptContents(exe, host string, node *Node, c *Config) *bytes.Buffer {
+	contents := bytes.NewBufferString("#!/bin/sh\n")
+	fmt.Fprintf(contents, "# Generated by lazyjack, for the first boot of node %q\n", host)
+	contents.WriteString("set -e\n")
+	fmt.Fprintf(contents, "%s --config %s --host %s prepare\n", exe, ImagePath(c.General.ConfigFile, c), host)
+	if node.IsMaster || node.IsMinion {
+		fmt.Fprintf(contents, "%s --config %s --host %s up\n", exe, ImagePath(c.General.ConfigFile, c), host)
+	}
+	fmt.Fprintf(contents, "systemctl disable %s\n", FirstBootServiceFile)
+	return contents
+}
+
+// CreateFirstBootServiceContents constructs the systemd unit file, which
+// runs the first boot script, once the network and container runtime are
+// up.
+func CreateFirstBootServiceContents(host string) *bytes.Buffer {
+	contents := bytes.NewBufferString("[Unit]\n")
+	fmt.Fprintf(contents, "Description=lazyjack first boot setup of node %q\n", host)
+	contents.WriteString(`Wants=network-online.target
+After=network-online.target containerd.service docker.service crio.service
+`)
+	fmt.Fprintf(contents, "ConditionPathExists=%s\n", FirstBootScript)
+	contents.WriteString(`
+[Service]
+Type=oneshot
+`)
+	fmt.Fprintf(contents, "ExecStart=%s\n", FirstBootScript)
+	contents.WriteString(`RemainAfterExit=yes
+
+[Install]
+WantedBy=multi-user.target
+`)
+	return contents
+}
+
+// copyIntoImage copies the host file to the same location in the image,
+// keeping the permissions, unless the file is already there.
+func copyIntoImage(file string, c *Config) error {
+	dest := RootPath(file, c)
+	if _, err := FS().Stat(dest); err == nil {
+		glog.V(4).Infof("Skipping - %s already in image", file)
+		return nil
+	}
+	info, err := FS().Stat(file)
+	if err != nil {
+		return fmt.Errorf("unable to access %s to place in image: %v", file, err)
+	}
+	contents, err := FS().ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("unable to read %s to place in image: %v", file, err)
+	}
+	err = FS().MkdirAll(filepath.Dir(dest), 0755)
+	if err == nil {
+		err = FS().WriteFile(dest, contents, info.Mode().Perm())
+	}
+	if err != nil {
+		return fmt.Errorf("unable to place %s in image: %v", file, err)
+	}
+	glog.V(4).Infof("Placed %s in image", file)
+	return nil
+}
+
+// CreateFirstBootUnit places the lazyjack executable, config, and secrets
+// file in the image, creates the first boot script and systemd unit, and
+// enables the unit in the image.
+func CreateFirstBootUnit(host string, c *Config) error {
+	node := c.Topology[host]
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to determine lazyjack executable for first boot: %v", err)
+	}
+	configFile := ImagePath(c.General.ConfigFile, c)
+	files := []string{exe, configFile}
+	secretsFile, err := SecretsFileFor(c, configFile)
+	if err != nil {
+		return err
+	}
+	if _, err := FS().Stat(secretsFile); err == nil {
+		files = append(files, secretsFile)
+	}
+	for _, file := range files {
+		err = copyIntoImage(file, c)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = Reconcile(
+		FileResource{
+			Path:     RootPath(FirstBootScript, c),
+			Contents: CreateFirstBootScriptContents(exe, host, &node, c).Bytes(),
+			Mode:     0755,
+		},
+		FileResource{
+			Path:     filepath.Join(SystemdUnitArea(c), FirstBootServiceFile),
+			Contents: CreateFirstBootServiceContents(host).Bytes(),
+			Mode:     0644,
+		},
+	)
+	if err != nil {
+		return fmt.Errorf("unable to create first boot unit: %v", err)
+	}
+	_, err = DoExecCommand("systemctl", []string{"--root", c.General.ImageRoot, "enable", FirstBootServiceFile})
+	if err != nil {
+		return fmt.Errorf("unable to enable %s in image: %v", FirstBootServiceFile, err)
+	}
+	glog.Infof("Created first boot unit in image")
+	return nil
+}
+
+// PrepareImage applies the file-level parts of prepare (hosts and
+// resolv.conf entries, kubelet drop-in, kubeadm.conf, and persistent
+// network config) to the image, and creates the first boot unit for the
+// runtime parts (addresses, routes, and containers).
+func PrepareImage(name string, c *Config) error {
+	node := c.Topology[name]
+	glog.Infof("Preparing image for %q", name)
+	if node.IsMaster || node.IsMinion {
+		err := AddHostEntries(c)
+		if err != nil {
+			return err
+		}
+		err = AddResolvConfEntry(&node, c)
+		if err != nil {
+			return err
+		}
+		err = CreateKubeletDropInFile(&node, c)
+		if err != nil {
+			return err
+		}
+		err = CreatePersistentNetConfig(&node, c)
+		if err != nil {
+			return err
+		}
+		if node.IsMaster {
+			err = FS().MkdirAll(c.General.WorkArea, 0700)
+			if err != nil {
+				return fmt.Errorf("unable to create work area in image: %v", err)
+			}
+			err = CreateKubeAdmConfigFile(&node, c)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	err := CreateFirstBootUnit(name, c)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Prepared image for %q", name)
+	return nil
+}
+
+// UpImage applies the file-level parts of up (CNI config file, and on the
+// master, the CA certificate and key, in the Kubernetes and work areas) to
+// the image. The cluster is brought up by the first boot unit.
+func UpImage(name string, c *Config) error {
+	node := c.Topology[name]
+	if !node.IsMaster && !node.IsMinion {
+		return notApplicableErrorf("skipping node %q as role is not master or minion", name)
+	}
+	glog.Infof("Setting up image for %q", name)
+	err := EnsureCNIAreaExists(c.General.CNIArea)
+	if err != nil {
+		return err
+	}
+	err = CreateCNIConfigFile(&node, c)
+	if err != nil {
+		return err
+	}
+	if node.IsMaster {
+		// Certificates were created in the host's work area, by init. They
+		// are also placed in the image's work area, as up (on first boot)
+		// copies them from there.
+		hostWorkArea := ImagePath(c.General.WorkArea, c)
+		err = PlaceCertificateAndKeyForCA(hostWorkArea, c.General.K8sCertArea)
+		if err != nil {
+			return err
+		}
+		err = PlaceCertificateAndKeyForCA(hostWorkArea, filepath.Join(c.General.WorkArea, CertArea))
+		if err != nil {
+			return err
+		}
+	}
+	err = CreateFirstBootUnit(name, c)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Set up image for %q", name)
+	return nil
+}
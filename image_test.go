@@ -0,0 +1,268 @@
+package lazyjack_test
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+// HelperImageRoot creates an image root with the lazyjack executable (so
+// that it is not copied in), and the files that prepare updates.
+func HelperImageRoot(t *testing.T) string {
+	root := TempFileName(os.TempDir(), "-root")
+	HelperSetupArea(filepath.Join(root, lazyjack.EtcArea), t)
+	for _, file := range []string{lazyjack.EtcHostsFile, lazyjack.EtcResolvConfFile} {
+		err := ioutil.WriteFile(filepath.Join(root, lazyjack.EtcArea, file), []byte("# empty file\n"), 0644)
+		if err != nil {
+			t.Fatalf("ERROR: Unable to create %s file for test", file)
+		}
+	}
+	exe, err := os.Executable()
+	if err != nil {
+		t.Fatalf("ERROR: Unable to determine test executable: %s", err.Error())
+	}
+	HelperSetupArea(filepath.Join(root, filepath.Dir(exe)), t)
+	err = ioutil.WriteFile(filepath.Join(root, exe), []byte("# placeholder"), 0755)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create executable in image for test")
+	}
+	return root
+}
+
+func HelperImageConfig(configArea string, t *testing.T) *lazyjack.Config {
+	c := HelperRunnerConfig("")
+	c.General.Mode = lazyjack.IPv6NetMode
+	c.General.WorkArea = filepath.Join(configArea, "work")
+	c.General.ConfigFile = filepath.Join(configArea, "config.yaml")
+	lazyjack.SetupBaseAreas(c.General.WorkArea, lazyjack.KubeletSystemdArea, lazyjack.EtcArea,
+		lazyjack.CNIConfArea, lazyjack.KubernetesCertArea, c)
+	err := ioutil.WriteFile(c.General.ConfigFile, []byte("# config\n"), 0600)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create config file for test")
+	}
+	return c
+}
+
+func TestSetupImageRoot(t *testing.T) {
+	root := TempFileName(os.TempDir(), "-root")
+	HelperSetupArea(root, t)
+	defer HelperCleanupArea(root, t)
+
+	c := &lazyjack.Config{General: lazyjack.GeneralSettings{WorkArea: "/tmp/lazyjack"}}
+	lazyjack.SetupBaseAreas(lazyjack.WorkArea, lazyjack.KubeletSystemdArea, lazyjack.EtcArea,
+		lazyjack.CNIConfArea, lazyjack.KubernetesCertArea, c)
+	err := lazyjack.SetupImageRoot(root, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to set up image root: %s", err.Error())
+	}
+	if c.General.EtcArea != filepath.Join(root, "/etc") {
+		t.Fatalf("FAILED: Expected etc area under image root, got %q", c.General.EtcArea)
+	}
+	if c.General.CNIArea != filepath.Join(root, lazyjack.CNIConfArea) {
+		t.Fatalf("FAILED: Expected CNI area under image root, got %q", c.General.CNIArea)
+	}
+	if lazyjack.ImagePath(c.General.SystemdArea, c) != lazyjack.KubeletSystemdArea {
+		t.Fatalf("FAILED: Expected image path of systemd area to be %q, got %q",
+			lazyjack.KubeletSystemdArea, lazyjack.ImagePath(c.General.SystemdArea, c))
+	}
+
+	file := filepath.Join(root, "file")
+	err = ioutil.WriteFile(file, []byte("# empty file"), 0644)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create file for test")
+	}
+	err = lazyjack.SetupImageRoot(file, &lazyjack.Config{})
+	if err == nil {
+		t.Fatalf("FAILED: Expected image root that is not a directory to fail")
+	}
+	expected := "is not a directory"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("FAILED: Expected error to contain %q, got %q", expected, err.Error())
+	}
+}
+
+func TestCreateFirstBootScriptContents(t *testing.T) {
+	c := &lazyjack.Config{General: lazyjack.GeneralSettings{ConfigFile: "/root/config.yaml"}}
+	n := &lazyjack.Node{IsMinion: true}
+	actual := lazyjack.CreateFirstBootScriptContents("/usr/bin/lazyjack", "minion1", n, c)
+	expected := `#!/bin/sh
+# Generated by lazyjack, for the first boot of node "minion1"
+set -e
+/usr/bin/lazyjack --config /root/config.yaml --host minion1 prepare
+/usr/bin/lazyjack --config /root/config.yaml --host minion1 up
+systemctl disable lazyjack-firstboot.service
+`
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Script contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+
+	n = &lazyjack.Node{IsDNS64Server: true}
+	actual = lazyjack.CreateFirstBootScriptContents("/usr/bin/lazyjack", "bastion", n, c)
+	if strings.Contains(actual.String(), " up\n") {
+		t.Fatalf("FAILED: Expected only prepare, for node that is not in cluster, got:\n%s", actual.String())
+	}
+}
+
+func TestRunnersForImageShareConfig(t *testing.T) {
+	root := HelperImageRoot(t)
+	defer HelperCleanupArea(root, t)
+	configArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(configArea, t)
+	defer HelperCleanupArea(configArea, t)
+
+	c := HelperImageConfig(configArea, t)
+	workArea := c.General.WorkArea
+	for i := 0; i < 2; i++ {
+		r, err := lazyjack.NewRunner("master", c, lazyjack.WithImageRoot(root))
+		if err != nil {
+			t.Fatalf("FAILED: Expected to create runner %d: %s", i+1, err.Error())
+		}
+		expected := filepath.Join(root, workArea)
+		if r.Config().General.WorkArea != expected {
+			t.Fatalf("FAILED: Runner %d work area. Expected %q, got %q", i+1, expected, r.Config().General.WorkArea)
+		}
+	}
+	if c.General.WorkArea != workArea || c.General.ImageRoot != "" {
+		t.Fatalf("FAILED: Expected caller's config to not be changed, got work area %q and image root %q",
+			c.General.WorkArea, c.General.ImageRoot)
+	}
+}
+
+func TestPrepareImage(t *testing.T) {
+	root := HelperImageRoot(t)
+	defer HelperCleanupArea(root, t)
+	configArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(configArea, t)
+	defer HelperCleanupArea(configArea, t)
+
+	cmds := &joolCommands{}
+	c := HelperImageConfig(configArea, t)
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithImageRoot(root),
+		lazyjack.WithExecCommand(cmds.Exec), lazyjack.WithLogger(&recordingLogger{}))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	_, err = r.Prepare(context.Background())
+	if err != nil {
+		t.Fatalf("FAILED: Expected to prepare image: %s", err.Error())
+	}
+
+	for _, file := range []string{
+		filepath.Join(lazyjack.KubeletSystemdArea, lazyjack.KubeletDropInFile),
+		filepath.Join(configArea, "work", lazyjack.KubeAdmConfFile),
+		filepath.Join("/etc/systemd/system", lazyjack.FirstBootServiceFile),
+		lazyjack.FirstBootScript,
+		filepath.Join(configArea, "config.yaml"),
+	} {
+		if _, err := os.Stat(filepath.Join(root, file)); err != nil {
+			t.Fatalf("FAILED: Expected %s to be in image: %s", file, err.Error())
+		}
+	}
+	if _, err := os.Stat(filepath.Join(configArea, "work", lazyjack.KubeAdmConfFile)); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected host work area to be unchanged")
+	}
+	hosts, err := ioutil.ReadFile(filepath.Join(root, lazyjack.EtcArea, lazyjack.EtcHostsFile))
+	if err != nil || !strings.Contains(string(hosts), "master") {
+		t.Fatalf("FAILED: Expected hosts file in image to have entries, got %q (%v)", string(hosts), err)
+	}
+	expected := "systemctl --root " + root + " enable " + lazyjack.FirstBootServiceFile
+	if strings.Join(cmds.invoked, ", ") != expected {
+		t.Fatalf("FAILED: Expected commands %q, got %q", expected, strings.Join(cmds.invoked, ", "))
+	}
+}
+
+func TestUpImage(t *testing.T) {
+	root := HelperImageRoot(t)
+	defer HelperCleanupArea(root, t)
+	configArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(configArea, t)
+	defer HelperCleanupArea(configArea, t)
+
+	c := HelperImageConfig(configArea, t)
+	certArea := filepath.Join(c.General.WorkArea, lazyjack.CertArea)
+	HelperSetupArea(certArea, t)
+	for _, file := range []string{"ca.crt", "ca.key"} {
+		err := ioutil.WriteFile(filepath.Join(certArea, file), []byte("# "+file), 0600)
+		if err != nil {
+			t.Fatalf("ERROR: Unable to create %s for test", file)
+		}
+	}
+
+	cmds := &joolCommands{}
+	nm := lazyjack.NetMgr{Server: &mockNetLink{}}
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithImageRoot(root), lazyjack.WithNetworker(nm),
+		lazyjack.WithExecCommand(cmds.Exec), lazyjack.WithLogger(&recordingLogger{}))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	_, err = r.Up(context.Background())
+	if err != nil {
+		t.Fatalf("FAILED: Expected to set up image: %s", err.Error())
+	}
+	for _, file := range []string{
+		filepath.Join(lazyjack.CNIConfArea, lazyjack.CNIConfFile),
+		filepath.Join(lazyjack.KubernetesCertArea, "ca.crt"),
+		filepath.Join(lazyjack.KubernetesCertArea, "ca.key"),
+	} {
+		if _, err := os.Stat(filepath.Join(root, file)); err != nil {
+			t.Fatalf("FAILED: Expected %s to be in image: %s", file, err.Error())
+		}
+	}
+	if strings.Contains(strings.Join(cmds.invoked, ", "), "kubeadm") {
+		t.Fatalf("FAILED: Expected cluster to not be started, got commands %q", strings.Join(cmds.invoked, ", "))
+	}
+}
+
+func TestFirstBootUpFromImage(t *testing.T) {
+	root := HelperImageRoot(t)
+	defer HelperCleanupArea(root, t)
+	configArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(configArea, t)
+	defer HelperCleanupArea(configArea, t)
+
+	c := HelperImageConfig(configArea, t)
+	certArea := filepath.Join(c.General.WorkArea, lazyjack.CertArea)
+	HelperSetupArea(certArea, t)
+	for _, file := range []string{"ca.crt", "ca.key"} {
+		err := ioutil.WriteFile(filepath.Join(certArea, file), []byte("# "+file), 0600)
+		if err != nil {
+			t.Fatalf("ERROR: Unable to create %s for test", file)
+		}
+	}
+	cmds := &joolCommands{}
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithImageRoot(root),
+		lazyjack.WithNetworker(lazyjack.NetMgr{Server: &mockNetLink{}}),
+		lazyjack.WithExecCommand(cmds.Exec), lazyjack.WithLogger(&recordingLogger{}))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	_, err = r.Up(context.Background())
+	if err != nil {
+		t.Fatalf("FAILED: Expected to set up image: %s", err.Error())
+	}
+
+	// On first boot, up runs in the image with the same config, so use the
+	// image tree for the areas, and no certificates in the host work area.
+	HelperCleanupArea(certArea, t)
+	booted := HelperImageConfig(configArea, t)
+	err = lazyjack.SetupImageRoot(root, booted)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to set up areas in image for test: %s", err.Error())
+	}
+	booted.General.ImageRoot = ""
+	booted.General.NetMgr = lazyjack.NetMgr{Server: &mockNetLink{}}
+	lazyjack.RegisterExecCommand(cmds.Exec)
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+	err = lazyjack.BringUp("master", booted)
+	if err != nil {
+		t.Fatalf("FAILED: Expected first boot up to use certificates in image: %s", err.Error())
+	}
+	if !strings.Contains(strings.Join(cmds.invoked, ", "), "kubeadm init") {
+		t.Fatalf("FAILED: Expected cluster to be started, got commands %q", strings.Join(cmds.invoked, ", "))
+	}
+}
@@ -0,0 +1,191 @@
+package lazyjack
+
+import (
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// DefaultDNS64Image is the bind9 image used for the DNS64 server
+	DefaultDNS64Image = "diverdane/bind9:latest"
+	// DefaultNAT64Image is the tayga image used for the NAT64 server
+	DefaultNAT64Image = "danehans/tayga:latest"
+
+	// PullAlways pulls the image, every time the container is started
+	PullAlways = "always"
+	// PullIfNotPresent pulls the image, only if it is not already present
+	PullIfNotPresent = "if-not-present"
+	// PullNever never pulls the image, which must already be present
+	PullNever = "never"
+	// DefaultPullPolicy used, when not specified
+	DefaultPullPolicy = PullIfNotPresent
+
+	// RegistryPasswordEnvVar environment variable that can supply the registry password
+	RegistryPasswordEnvVar = "LAZYJACK_REGISTRY_PASSWORD"
+)
+
+var digestRE = regexp.MustCompile("^sha256:[0-9a-f]{64}$")
+
+// ImageConfig defines the container image used for the DNS64 or NAT64
+// server. The image can be pinned by digest, and extra arguments can be
+// added to the run command. For offline mode, the image is loaded from the
+// tarball (relative to the work area, if not an absolute path).
+type ImageConfig struct {
+	Image     string   `yaml:"image"`
+	Digest    string   `yaml:"digest"`
+	ExtraArgs []string `yaml:"extra-args"`
+	Tarball   string   `yaml:"tarball"`
+}
+
+// RegistryConfig defines the credentials for a private registry. The
+// password comes from the secrets, and is rejected in the config file.
+type RegistryConfig struct {
+	Server   string `yaml:"server"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"` // From secrets
+	LoggedIn bool   // Internal
+}
+
+// ImagesConfig defines the container images for the DNS64 and NAT64
+// servers, and how they are obtained.
+type ImagesConfig struct {
+	DNS64      ImageConfig    `yaml:"dns64"`
+	NAT64      ImageConfig    `yaml:"nat64"`
+	PullPolicy string         `yaml:"pull-policy"`
+	Registry   RegistryConfig `yaml:"registry"`
+	Offline    bool           `yaml:"offline"`
+}
+
+// Ref provides the image reference, using the default image, if none is
+// specified. If a digest is specified, it is used to pin the image.
+func (i ImageConfig) Ref(defaultImage string) string {
+	image := i.Image
+	if image == "" {
+		image = defaultImage
+	}
+	if i.Digest != "" {
+		return image + "@" + i.Digest
+	}
+	return image
+}
+
+// TarballPath provides the path to the tarball for the image, which is in
+// the work area, unless an absolute path is specified. The default file
+// is named after the container.
+func (i ImageConfig) TarballPath(container string, c *Config) string {
+	tarball := i.Tarball
+	if tarball == "" {
+		tarball = container + ".tar"
+	}
+	if filepath.IsAbs(tarball) {
+		return tarball
+	}
+	return filepath.Join(c.General.WorkArea, tarball)
+}
+
+// ValidateImageConfig checks the image settings for a server.
+func ValidateImageConfig(role string, i ImageConfig, offline bool) error {
+	if strings.ContainsAny(i.Image, " \t") {
+		return fmt.Errorf("invalid %s image %q", role, i.Image)
+	}
+	if i.Digest == "" {
+		return nil
+	}
+	if strings.Contains(i.Image, "@") {
+		return fmt.Errorf("%s image %q already has a digest, so digest %q cannot be used", role, i.Image, i.Digest)
+	}
+	if offline {
+		return fmt.Errorf("%s image digest cannot be used in offline mode, as loaded images are referenced by tag", role)
+	}
+	if !digestRE.MatchString(i.Digest) {
+		return fmt.Errorf("invalid %s image digest %q (expected sha256:<64 hex digits>)", role, i.Digest)
+	}
+	return nil
+}
+
+// ValidateImages checks the image settings, and applies defaults. The
+// registry password must already be loaded from the secrets.
+func ValidateImages(c *Config) error {
+	images := &c.Images
+	if images.PullPolicy == "" {
+		images.PullPolicy = DefaultPullPolicy
+	}
+	images.PullPolicy = strings.ToLower(images.PullPolicy)
+	switch images.PullPolicy {
+	case PullAlways, PullIfNotPresent, PullNever:
+	default:
+		return fmt.Errorf("unsupported image pull policy %q (use %s, %s, or %s)", images.PullPolicy, PullAlways, PullIfNotPresent, PullNever)
+	}
+	if images.Offline && images.PullPolicy == PullAlways {
+		return fmt.Errorf("image pull policy %q cannot be used in offline mode", PullAlways)
+	}
+
+	if err := ValidateImageConfig("DNS64", images.DNS64, images.Offline); err != nil {
+		return err
+	}
+	if err := ValidateImageConfig("NAT64", images.NAT64, images.Offline); err != nil {
+		return err
+	}
+	if c.General.Hypervisor == DockerAPIHypervisor {
+		if err := ValidateDockerRunExtraArgs("DNS64", images.DNS64.ExtraArgs); err != nil {
+			return err
+		}
+		if err := ValidateDockerRunExtraArgs("NAT64", images.NAT64.ExtraArgs); err != nil {
+			return err
+		}
+	}
+
+	if images.Registry.Username != "" && images.Registry.Password == "" {
+		return fmt.Errorf("missing password for registry user %q", images.Registry.Username)
+	}
+	if images.Registry.Username == "" && images.Registry.Password != "" {
+		return fmt.Errorf("missing username for registry password")
+	}
+	return nil
+}
+
+// EnsureImage makes sure the image is present, before the container is
+// started. In offline mode, the image is loaded from the tarball, otherwise
+// the image is pulled, based on the pull policy. The registry login is done
+// before the first pull.
+func EnsureImage(container string, i ImageConfig, defaultImage string, c *Config) error {
+	ref := i.Ref(defaultImage)
+	if c.Images.Offline {
+		tarball := i.TarballPath(container, c)
+		err := c.General.Hyper.LoadImage(tarball)
+		if err != nil {
+			return fmt.Errorf("unable to load %s image from %s: %v", container, tarball, err)
+		}
+		glog.V(1).Infof("Loaded image %s from %s", ref, tarball)
+	}
+
+	if c.Images.Offline || c.Images.PullPolicy == PullNever {
+		if c.General.Hyper.ResourceState(ref) == ResourceNotPresent {
+			return fmt.Errorf("image %s for %s is not present, and will not be pulled", ref, container)
+		}
+		return nil
+	}
+	if c.Images.PullPolicy != PullAlways && c.General.Hyper.ResourceState(ref) != ResourceNotPresent {
+		glog.V(4).Infof("Image %s already present", ref)
+		return nil
+	}
+
+	r := &c.Images.Registry
+	if r.Username != "" && !r.LoggedIn {
+		err := c.General.Hyper.Login(r.Server, r.Username, r.Password)
+		if err != nil {
+			return fmt.Errorf("unable to log in to registry %q: %v", r.Server, err)
+		}
+		r.LoggedIn = true
+	}
+	err := c.General.Hyper.PullImage(ref)
+	if err != nil {
+		return fmt.Errorf("unable to pull %s image: %v", container, err)
+	}
+	glog.V(1).Infof("Pulled image %s", ref)
+	return nil
+}
@@ -0,0 +1,333 @@
+package lazyjack_test
+
+import (
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+const testDigest = "sha256:0123456789abcdef0123456789abcdef0123456789abcdef0123456789abcdef"
+
+func TestImageRef(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		image    lazyjack.ImageConfig
+		expected string
+	}{
+		{
+			name:     "default image",
+			image:    lazyjack.ImageConfig{},
+			expected: lazyjack.DefaultDNS64Image,
+		},
+		{
+			name:     "custom image",
+			image:    lazyjack.ImageConfig{Image: "registry.example.com/bind9:9.11"},
+			expected: "registry.example.com/bind9:9.11",
+		},
+		{
+			name:     "pinned default image",
+			image:    lazyjack.ImageConfig{Digest: testDigest},
+			expected: lazyjack.DefaultDNS64Image + "@" + testDigest,
+		},
+	}
+	for _, tc := range testCases {
+		actual := tc.image.Ref(lazyjack.DefaultDNS64Image)
+		if actual != tc.expected {
+			t.Errorf("FAILED: [%s] Expected image ref %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestTarballPath(t *testing.T) {
+	c := &lazyjack.Config{General: lazyjack.GeneralSettings{WorkArea: "/tmp/lazyjack"}}
+	var testCases = []struct {
+		name     string
+		image    lazyjack.ImageConfig
+		expected string
+	}{
+		{name: "default", image: lazyjack.ImageConfig{}, expected: "/tmp/lazyjack/tayga.tar"},
+		{name: "relative", image: lazyjack.ImageConfig{Tarball: "images/nat64.tar"}, expected: "/tmp/lazyjack/images/nat64.tar"},
+		{name: "absolute", image: lazyjack.ImageConfig{Tarball: "/opt/images/nat64.tar"}, expected: "/opt/images/nat64.tar"},
+	}
+	for _, tc := range testCases {
+		actual := tc.image.TarballPath(lazyjack.NAT64Name, c)
+		if actual != tc.expected {
+			t.Errorf("FAILED: [%s] Expected tarball %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestValidateImages(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		hypervisor  string
+		images      lazyjack.ImagesConfig
+		expectedErr string
+	}{
+		{
+			name:   "defaults",
+			images: lazyjack.ImagesConfig{},
+		},
+		{
+			name: "pinned images",
+			images: lazyjack.ImagesConfig{
+				DNS64:      lazyjack.ImageConfig{Image: "registry.example.com/bind9", Digest: testDigest},
+				NAT64:      lazyjack.ImageConfig{Digest: testDigest},
+				PullPolicy: "Always",
+			},
+		},
+		{
+			name:        "unknown pull policy",
+			images:      lazyjack.ImagesConfig{PullPolicy: "sometimes"},
+			expectedErr: "unsupported image pull policy \"sometimes\" (use always, if-not-present, or never)",
+		},
+		{
+			name:        "always pull when offline",
+			images:      lazyjack.ImagesConfig{PullPolicy: lazyjack.PullAlways, Offline: true},
+			expectedErr: "image pull policy \"always\" cannot be used in offline mode",
+		},
+		{
+			name:        "bad digest",
+			images:      lazyjack.ImagesConfig{NAT64: lazyjack.ImageConfig{Digest: "sha256:1234"}},
+			expectedErr: "invalid NAT64 image digest \"sha256:1234\" (expected sha256:<64 hex digits>)",
+		},
+		{
+			name:        "image with digest",
+			images:      lazyjack.ImagesConfig{DNS64: lazyjack.ImageConfig{Image: "bind9@" + testDigest, Digest: testDigest}},
+			expectedErr: "DNS64 image \"bind9@" + testDigest + "\" already has a digest, so digest \"" + testDigest + "\" cannot be used",
+		},
+		{
+			name:        "digest when offline",
+			images:      lazyjack.ImagesConfig{DNS64: lazyjack.ImageConfig{Digest: testDigest}, Offline: true},
+			expectedErr: "DNS64 image digest cannot be used in offline mode, as loaded images are referenced by tag",
+		},
+		{
+			name:        "bad image",
+			images:      lazyjack.ImagesConfig{DNS64: lazyjack.ImageConfig{Image: "bind9 latest"}},
+			expectedErr: "invalid DNS64 image \"bind9 latest\"",
+		},
+		{
+			name:        "missing password",
+			images:      lazyjack.ImagesConfig{Registry: lazyjack.RegistryConfig{Username: "jack"}},
+			expectedErr: "missing password for registry user \"jack\"",
+		},
+		{
+			name:        "missing username",
+			images:      lazyjack.ImagesConfig{Registry: lazyjack.RegistryConfig{Password: "secret"}},
+			expectedErr: "missing username for registry password",
+		},
+		{
+			name:       "extra args for docker API",
+			hypervisor: lazyjack.DockerAPIHypervisor,
+			images: lazyjack.ImagesConfig{
+				DNS64: lazyjack.ImageConfig{ExtraArgs: []string{"--restart", "unless-stopped", "-p", "53:53/udp", "--memory", "256m"}},
+				NAT64: lazyjack.ImageConfig{ExtraArgs: []string{"--cap-add", "NET_ADMIN", "--init"}},
+			},
+		},
+		{
+			name:        "unsupported extra args for docker API",
+			hypervisor:  lazyjack.DockerAPIHypervisor,
+			images:      lazyjack.ImagesConfig{NAT64: lazyjack.ImageConfig{ExtraArgs: []string{"--pid", "host"}}},
+			expectedErr: "unsupported NAT64 extra-args for docker-api hypervisor: unsupported docker run option --pid",
+		},
+		{
+			name:        "positional extra args for docker API",
+			hypervisor:  lazyjack.DockerAPIHypervisor,
+			images:      lazyjack.ImagesConfig{DNS64: lazyjack.ImageConfig{ExtraArgs: []string{"--rm", "true"}}},
+			expectedErr: "unsupported DNS64 extra-args for docker-api hypervisor: arguments that are not options (--rm true)",
+		},
+		{
+			name:       "any extra args for docker CLI",
+			hypervisor: lazyjack.DockerHypervisor,
+			images:     lazyjack.ImagesConfig{NAT64: lazyjack.ImageConfig{ExtraArgs: []string{"--pid", "host"}}},
+		},
+	}
+	os.Unsetenv(lazyjack.RegistryPasswordEnvVar)
+	for _, tc := range testCases {
+		c := &lazyjack.Config{General: lazyjack.GeneralSettings{Hypervisor: tc.hypervisor}, Images: tc.images}
+		err := lazyjack.ValidateImages(c)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected images to be valid: %s", tc.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected error %q", tc.name, tc.expectedErr)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedErr, err.Error())
+		}
+	}
+}
+
+func TestValidateImagesDefaults(t *testing.T) {
+	// Password from environment is loaded with the secrets
+	os.Setenv(lazyjack.RegistryPasswordEnvVar, "from-env")
+	defer os.Unsetenv(lazyjack.RegistryPasswordEnvVar)
+
+	c := &lazyjack.Config{
+		Images: lazyjack.ImagesConfig{
+			PullPolicy: "Never",
+			Registry:   lazyjack.RegistryConfig{Username: "jack"},
+		},
+	}
+	err := lazyjack.ValidateImages(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected images to be invalid, before secrets are loaded")
+	}
+	err = lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to load secrets: %s", err.Error())
+	}
+	err = lazyjack.ValidateImages(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected images to be valid: %s", err.Error())
+	}
+	if c.Images.PullPolicy != lazyjack.PullNever {
+		t.Fatalf("FAILED: Expected pull policy %q, got %q", lazyjack.PullNever, c.Images.PullPolicy)
+	}
+	if c.Images.Registry.Password != "from-env" {
+		t.Fatalf("FAILED: Expected password from environment, got %q", c.Images.Registry.Password)
+	}
+
+	c = &lazyjack.Config{}
+	lazyjack.ValidateImages(c)
+	if c.Images.PullPolicy != lazyjack.DefaultPullPolicy {
+		t.Fatalf("FAILED: Expected default pull policy %q, got %q", lazyjack.DefaultPullPolicy, c.Images.PullPolicy)
+	}
+}
+
+func TestEnsureImage(t *testing.T) {
+	var testCases = []struct {
+		name         string
+		images       lazyjack.ImagesConfig
+		hyper        *MockHypervisor
+		expectedErr  string
+		expectPulled bool
+		expectLoaded bool
+	}{
+		{
+			name:         "pull when not present",
+			images:       lazyjack.ImagesConfig{PullPolicy: lazyjack.PullIfNotPresent},
+			hyper:        &MockHypervisor{simNotExists: true},
+			expectPulled: true,
+		},
+		{
+			name:   "present image not pulled",
+			images: lazyjack.ImagesConfig{PullPolicy: lazyjack.PullIfNotPresent},
+			hyper:  &MockHypervisor{},
+		},
+		{
+			name:         "always pulled",
+			images:       lazyjack.ImagesConfig{PullPolicy: lazyjack.PullAlways},
+			hyper:        &MockHypervisor{},
+			expectPulled: true,
+		},
+		{
+			name:   "never pulled",
+			images: lazyjack.ImagesConfig{PullPolicy: lazyjack.PullNever},
+			hyper:  &MockHypervisor{},
+		},
+		{
+			name:        "never pulled and missing",
+			images:      lazyjack.ImagesConfig{PullPolicy: lazyjack.PullNever},
+			hyper:       &MockHypervisor{simNotExists: true},
+			expectedErr: "image diverdane/bind9:latest for bind9 is not present, and will not be pulled",
+		},
+		{
+			name:        "pull fails",
+			images:      lazyjack.ImagesConfig{PullPolicy: lazyjack.PullAlways},
+			hyper:       &MockHypervisor{simPullFail: true},
+			expectedErr: "unable to pull bind9 image: mock fail pull of image",
+		},
+		{
+			name: "login fails",
+			images: lazyjack.ImagesConfig{
+				PullPolicy: lazyjack.PullAlways,
+				Registry:   lazyjack.RegistryConfig{Server: "registry.example.com", Username: "jack", Password: "secret"},
+			},
+			hyper:       &MockHypervisor{simLoginFail: true},
+			expectedErr: "unable to log in to registry \"registry.example.com\": mock fail login to registry",
+		},
+		{
+			name:         "offline load",
+			images:       lazyjack.ImagesConfig{PullPolicy: lazyjack.PullIfNotPresent, Offline: true},
+			hyper:        &MockHypervisor{},
+			expectLoaded: true,
+		},
+		{
+			name:        "offline load fails",
+			images:      lazyjack.ImagesConfig{PullPolicy: lazyjack.PullIfNotPresent, Offline: true},
+			hyper:       &MockHypervisor{simLoadFail: true},
+			expectedErr: "unable to load bind9 image from /tmp/lazyjack/bind9.tar: mock fail load of image",
+		},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{
+			General: lazyjack.GeneralSettings{Hyper: tc.hyper, WorkArea: "/tmp/lazyjack"},
+			Images:  tc.images,
+		}
+		err := lazyjack.EnsureImage(lazyjack.DNS64Name, c.Images.DNS64, lazyjack.DefaultDNS64Image, c)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected to ensure image: %s", tc.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected error %q", tc.name, tc.expectedErr)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedErr, err.Error())
+		}
+		if (len(tc.hyper.pulled) > 0) != tc.expectPulled {
+			t.Errorf("FAILED: [%s] Expected pulled to be %v, got %v", tc.name, tc.expectPulled, tc.hyper.pulled)
+		}
+		if (len(tc.hyper.loaded) > 0) != tc.expectLoaded {
+			t.Errorf("FAILED: [%s] Expected loaded to be %v, got %v", tc.name, tc.expectLoaded, tc.hyper.loaded)
+		}
+	}
+}
+
+func TestEnsureImageLogsInOnce(t *testing.T) {
+	hyper := &MockHypervisor{simNotExists: true}
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{Hyper: hyper},
+		Images: lazyjack.ImagesConfig{
+			DNS64:      lazyjack.ImageConfig{Image: "registry.example.com/bind9", Digest: testDigest},
+			PullPolicy: lazyjack.PullIfNotPresent,
+			Registry:   lazyjack.RegistryConfig{Server: "registry.example.com", Username: "jack", Password: "secret"},
+		},
+	}
+	err := lazyjack.EnsureImage(lazyjack.DNS64Name, c.Images.DNS64, lazyjack.DefaultDNS64Image, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to ensure DNS64 image: %s", err.Error())
+	}
+	err = lazyjack.EnsureImage(lazyjack.NAT64Name, c.Images.NAT64, lazyjack.DefaultNAT64Image, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to ensure NAT64 image: %s", err.Error())
+	}
+	if hyper.logins != 1 {
+		t.Fatalf("FAILED: Expected one registry login, got %d", hyper.logins)
+	}
+	expected := "registry.example.com/bind9@" + testDigest + " " + lazyjack.DefaultNAT64Image
+	actual := strings.Join(hyper.pulled, " ")
+	if actual != expected {
+		t.Fatalf("FAILED: Expected pulled images %q, got %q", expected, actual)
+	}
+}
+
+func TestBuildRunArgsWithImageConfig(t *testing.T) {
+	c := &lazyjack.Config{
+		DNS64: lazyjack.DNS64Config{ServerIP: "2001:db8::100"},
+		Images: lazyjack.ImagesConfig{
+			DNS64: lazyjack.ImageConfig{
+				Image:     "registry.example.com/bind9",
+				Digest:    testDigest,
+				ExtraArgs: []string{"--memory", "256m"},
+			},
+		},
+	}
+	actual := strings.Join(lazyjack.BuildRunArgsForDNS64(c), " ")
+	expected := "--net support_net --memory 256m registry.example.com/bind9@" + testDigest
+	if !strings.HasSuffix(actual, expected) {
+		t.Fatalf("FAILED: Building DNS64 run args.\nExpected suffix: %q\n         Actual: %q", expected, actual)
+	}
+}
@@ -3,23 +3,22 @@ package lazyjack
 import (
 	"bytes"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 	"strings"
 
 	"github.com/golang/glog"
+	"gopkg.in/yaml.v3"
 )
 
 // CreateCertKeyArea creates the area used to hold certificates used
 // by KubeAdm.
 func CreateCertKeyArea(base string) error {
 	area := filepath.Join(base, CertArea)
-	err := os.RemoveAll(area)
+	err := FS().RemoveAll(area)
 	if err != nil {
 		return fmt.Errorf("unable to clear out certificate area: %v", err)
 	}
-	err = os.MkdirAll(area, 0700)
+	err = FS().MkdirAll(area, 0700)
 	if err != nil {
 		return fmt.Errorf("unable to create area for certificates (%s): %v", area, err)
 	}
@@ -84,7 +83,7 @@ func CreateX509CertForCA(base string) error {
 	if err != nil || len(output) == 0 {
 		return fmt.Errorf("unable to create X509 cert: %v", err)
 	}
-	err = ioutil.WriteFile(filepath.Join(base, CertArea, "ca.x509"), []byte(output), 0644)
+	err = FS().WriteFile(filepath.Join(base, CertArea, "ca.x509"), []byte(output), 0644)
 	if err != nil {
 		return fmt.Errorf("unable to save X509 cert for CA: %v", err)
 	}
@@ -172,67 +171,265 @@ func CreateToken() (string, error) {
 	return ExtractToken(token)
 }
 
-// UpdateConfigYAMLContents will parse through the provided config file contents
-// and add the token and token certificate hash entries. Old values, if present,
-// will be removed. The new fields will be placed inside of the general section.
-func UpdateConfigYAMLContents(contents []byte, file, token, hash string) []byte {
-	glog.V(4).Infof("Updating %s contents", file)
-	lines := bytes.Split(bytes.TrimRight(contents, "\n"), []byte("\n"))
+// DefaultConfigIndent is the indentation used, when it cannot be
+// determined from the config file contents.
+const DefaultConfigIndent = 4
+
+// FindMappingKey locates the key in a YAML mapping node, returning the
+// index of the key node (the value follows), or -1, if not present.
+func FindMappingKey(m *yaml.Node, key string) int {
+	for i := 0; i+1 < len(m.Content); i += 2 {
+		if m.Content[i].Value == key {
+			return i
+		}
+	}
+	return -1
+}
+
+// RemoveMappingKey deletes the key and value from a YAML mapping node,
+// if present. Any comment above the key is kept, by moving it to the
+// following key (or below the preceding entry, if last).
+func RemoveMappingKey(m *yaml.Node, key string) {
+	i := FindMappingKey(m, key)
+	if i < 0 {
+		return
+	}
+	comment := m.Content[i].HeadComment
+	m.Content = append(m.Content[:i], m.Content[i+2:]...)
+	if comment == "" {
+		return
+	}
+	if i < len(m.Content) {
+		m.Content[i].HeadComment = joinComments(comment, m.Content[i].HeadComment)
+	} else if i > 0 {
+		m.Content[i-2].FootComment = joinComments(m.Content[i-2].FootComment, comment)
+	} else {
+		m.FootComment = joinComments(m.FootComment, comment)
+	}
+}
+
+func joinComments(first, second string) string {
+	if first == "" {
+		return second
+	}
+	if second == "" {
+		return first
+	}
+	return first + "\n" + second
+}
+
+// DetermineIndent finds the indentation used for nested mappings in the
+// top level mapping, so that it can be preserved when writing.
+func DetermineIndent(top *yaml.Node) int {
+	for i := 0; i+1 < len(top.Content); i += 2 {
+		value := top.Content[i+1]
+		if value.Kind == yaml.MappingNode && len(value.Content) > 0 {
+			indent := value.Content[0].Column - top.Content[i].Column
+			if indent >= 2 && indent <= 9 {
+				return indent
+			}
+		}
+	}
+	return DefaultConfigIndent
+}
+
+// configLineEdits holds the changes to the lines of a config file, by line
+// number (starting at 1). Lines can be removed, replaced, and have lines
+// inserted after them (line 0 is before the first line).
+type configLineEdits struct {
+	remove  map[int]bool
+	replace map[int]string
+	insert  map[int][]string
+}
+
+// apply makes the changes to the lines, using the line ending provided.
+func (e *configLineEdits) apply(lines []string, eol string) []byte {
 	var output bytes.Buffer
-	notHandled := true
-	for _, line := range lines {
-		if bytes.HasPrefix(bytes.TrimLeft(line, " "), []byte("token:")) {
-			continue
+	add := func(line string) {
+		output.WriteString(line)
+		output.WriteString(eol)
+	}
+	for _, line := range e.insert[0] {
+		add(line)
+	}
+	for i, line := range lines {
+		n := i + 1
+		if !e.remove[n] {
+			if replacement, ok := e.replace[n]; ok {
+				line = replacement
+			}
+			add(line)
 		}
-		if bytes.HasPrefix(bytes.TrimLeft(line, " "), []byte("token-cert-hash:")) {
-			continue
+		for _, line := range e.insert[n] {
+			add(line)
+		}
+	}
+	return output.Bytes()
+}
+
+// singleLineEntry returns the line of the key and the value, making sure
+// that the value is a scalar that is on a single line, so that the entry
+// can be edited in place.
+func singleLineEntry(key, value *yaml.Node, file string) (int, error) {
+	if value.Kind != yaml.ScalarNode || value.Style&(yaml.LiteralStyle|yaml.FoldedStyle) != 0 ||
+		strings.Contains(value.Value, "\n") || value.Line-key.Line > 1 {
+		return 0, fmt.Errorf("unable to update %s, as %s is not a single line value", file, key.Value)
+	}
+	return value.Line, nil
+}
+
+// UpdateConfigYAMLContents will edit the provided config file contents,
+// referencing the secrets file in the general section, and removing the
+// token and token certificate hash entries from that section. The YAML is
+// only parsed to locate the entries, and the lines are edited in place, so
+// everything else (comments, blank lines, ordering, quoting, and
+// indentation) is kept. An error is returned, if the contents cannot be
+// parsed, or if the updated contents no longer parse as a valid
+// configuration.
+func UpdateConfigYAMLContents(contents []byte, file, secretsFile string) ([]byte, error) {
+	glog.V(4).Infof("Updating %s contents", file)
+	var doc yaml.Node
+	err := yaml.Unmarshal(contents, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse %s: %v", file, err)
+	}
+	eol := "\n"
+	if bytes.Contains(contents, []byte("\r\n")) {
+		eol = "\r\n"
+	}
+	text := string(contents)
+	if text != "" && !strings.HasSuffix(text, eol) {
+		text += eol
+	}
+	lines := strings.Split(strings.TrimSuffix(text, eol), eol)
+	if text == "" {
+		lines = nil
+	}
+	edits := &configLineEdits{remove: map[int]bool{}, replace: map[int]string{}, insert: map[int][]string{}}
+	entry := fmt.Sprintf("secrets-file: %q", secretsFile)
+
+	if doc.Kind == 0 { // Empty file
+		edits.insert[len(lines)] = []string{"general:", strings.Repeat(" ", DefaultConfigIndent) + entry}
+		return checkUpdatedConfig(edits.apply(lines, eol), file, secretsFile)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) != 1 || doc.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("unable to update %s, as top level is not a mapping", file)
+	}
+	top := doc.Content[0]
+	if top.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("unable to update %s, as top level is a flow mapping", file)
+	}
+	indent := strings.Repeat(" ", DetermineIndent(top))
+
+	i := FindMappingKey(top, "general")
+	if i < 0 {
+		edits.insert[len(lines)] = []string{"general:", indent + entry}
+		return checkUpdatedConfig(edits.apply(lines, eol), file, secretsFile)
+	}
+	generalKey, general := top.Content[i], top.Content[i+1]
+	if general.Kind == yaml.ScalarNode && general.Tag == "!!null" {
+		// Drop any explicit null (e.g. "general: ~"), keeping a comment
+		line := lines[generalKey.Line-1][:generalKey.Column-1] + "general:"
+		if comment := generalKey.LineComment + general.LineComment; comment != "" {
+			line += " " + comment
 		}
-		if bytes.HasPrefix(line, []byte("general:")) {
-			output.WriteString(fmt.Sprintf("general:\n"))
-			output.WriteString(fmt.Sprintf("    token: %q\n", token))
-			output.WriteString(fmt.Sprintf("    token-cert-hash: %q\n", hash))
-			notHandled = false
+		edits.replace[generalKey.Line] = line
+		edits.insert[generalKey.Line] = []string{lines[generalKey.Line-1][:generalKey.Column-1] + indent + entry}
+		return checkUpdatedConfig(edits.apply(lines, eol), file, secretsFile)
+	}
+	if general.Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("unable to update %s, as general section is not a mapping", file)
+	}
+	if general.Style&yaml.FlowStyle != 0 {
+		return nil, fmt.Errorf("unable to update %s, as general section is a flow mapping", file)
+	}
+
+	for _, name := range []string{"token", "token-cert-hash"} {
+		j := FindMappingKey(general, name)
+		if j < 0 {
 			continue
 		}
-		output.WriteString(fmt.Sprintf("%s\n", line))
+		last, err := singleLineEntry(general.Content[j], general.Content[j+1], file)
+		if err != nil {
+			return nil, err
+		}
+		for n := general.Content[j].Line; n <= last; n++ {
+			edits.remove[n] = true
+		}
 	}
-	// Should have general section, so that this is not required, but being rigorous
-	if notHandled {
-		output.WriteString(fmt.Sprintf("general:\n"))
-		output.WriteString(fmt.Sprintf("    token: %q\n", token))
-		output.WriteString(fmt.Sprintf("    token-cert-hash: %q\n", hash))
+	j := FindMappingKey(general, "secrets-file")
+	if j >= 0 {
+		// Replace just the value, keeping any comment
+		value := general.Content[j+1]
+		n, err := singleLineEntry(general.Content[j], value, file)
+		if err != nil {
+			return nil, err
+		}
+		line := lines[n-1][:value.Column-1] + fmt.Sprintf("%q", secretsFile)
+		if value.LineComment != "" {
+			line += " " + value.LineComment
+		}
+		edits.replace[n] = line
+	} else {
+		first := general.Content[0]
+		edits.insert[generalKey.Line] = []string{lines[first.Line-1][:first.Column-1] + entry}
 	}
-	return output.Bytes()
+	return checkUpdatedConfig(edits.apply(lines, eol), file, secretsFile)
 }
 
-// OpenPermissions helper makes the directory read/write.
-func OpenPermissions(name string) error {
-	err := os.Chmod(name, 0777)
+// checkUpdatedConfig makes sure the updated config contents are still
+// usable, before they replace the original.
+func checkUpdatedConfig(contents []byte, file, secretsFile string) ([]byte, error) {
+	c, err := ParseConfig(bytes.NewReader(contents))
 	if err != nil {
-		return fmt.Errorf("unable to open permissions on %q: %v", name, err)
+		return nil, fmt.Errorf("refusing to update %s, as result is invalid: %v", file, err)
 	}
-	return nil
+	if c.General.SecretsFile != secretsFile {
+		return nil, fmt.Errorf("refusing to update %s, as result has secrets file %q, instead of %q", file, c.General.SecretsFile, secretsFile)
+	}
+	if c.General.Token != "" || c.General.TokenCertHash != "" {
+		return nil, fmt.Errorf("refusing to update %s, as result still has token info", file)
+	}
+	return contents, nil
 }
 
-// UpdateConfigYAML adds the access token and hash to the configuration YAML
-// file, replacing any existing entries.
-func UpdateConfigYAML(file, token, hash string) error {
+// UpdateConfigYAML references the secrets file from the configuration YAML
+// file, replacing any existing token and hash entries. The file keeps its
+// original permissions. The backup, which may have the (legacy) token and
+// hash, is restricted like the secrets file, and owned by the invoking
+// (sudo) user.
+func UpdateConfigYAML(file, secretsFile string) error {
 	glog.V(1).Infof("Updating %s file", file)
+	info, err := FS().Stat(file)
+	if err != nil {
+		return fmt.Errorf("unable to access %s: %v", file, err)
+	}
 	contents, err := GetFileContents(file)
 	if err != nil {
 		return err
 	}
-	contents = UpdateConfigYAMLContents(contents, file, token, hash)
+	contents, err = UpdateConfigYAMLContents(contents, file, secretsFile)
+	if err != nil {
+		return err
+	}
 	backup := fmt.Sprintf("%s.bak", file)
 	err = SaveFileContents(contents, file, backup)
 	if err != nil {
 		return err
 	}
-	err = OpenPermissions(file)
+	err = FS().Chmod(file, info.Mode().Perm())
+	if err != nil {
+		return fmt.Errorf("unable to restore permissions on %q: %v", file, err)
+	}
+	err = FS().Chmod(backup, SecretsFileMode)
+	if err != nil {
+		return fmt.Errorf("unable to restrict permissions on %q: %v", backup, err)
+	}
+	err = ChownToInvokingUser(file)
 	if err != nil {
 		return err
 	}
-	err = OpenPermissions(backup)
+	err = ChownToInvokingUser(backup)
 	if err != nil {
 		return err
 	}
@@ -241,9 +438,9 @@ func UpdateConfigYAML(file, token, hash string) error {
 }
 
 // Initialize performs steps for the "init" operation, creating
-// certificate, key, token, and hash, and then updates the configuration
-// YAML file with the token and hash, so that KubeAdm operations can be
-// performed.
+// certificate, key, token, and hash, saving the token and hash in a
+// secrets file, and then updates the configuration YAML file to reference
+// the secrets file, so that KubeAdm operations can be performed.
 func Initialize(name string, c *Config, configFile string) error {
 	node := c.Topology[name]
 
@@ -280,7 +477,15 @@ func Initialize(name string, c *Config, configFile string) error {
 	if err != nil {
 		return err
 	}
-	err = UpdateConfigYAML(configFile, token, hash)
+	secretsFile, err := SecretsFileFor(c, configFile)
+	if err != nil {
+		return err
+	}
+	err = SaveSecretsFile(secretsFile, token, hash)
+	if err != nil {
+		return err
+	}
+	err = UpdateConfigYAML(configFile, secretsFile)
 	if err != nil {
 		return err
 	}
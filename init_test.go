@@ -513,8 +513,33 @@ func TestInitializeMaster(t *testing.T) {
 	if err != nil {
 		t.Fatalf("FAILED: Unable to read config file, after processing: %s", err.Error())
 	}
-	if !bytes.Contains(contents, []byte("token:")) || !bytes.Contains(contents, []byte("token-cert-hash:")) {
-		t.Fatalf("FAILED: Expected config file to have token and cert")
+	secretsFile := filepath.Join(basePath, lazyjack.DefaultSecretsFile)
+	if !bytes.Contains(contents, []byte(fmt.Sprintf("secrets-file: %q", secretsFile))) {
+		t.Fatalf("FAILED: Expected config file to reference secrets file")
+	}
+	if bytes.Contains(contents, []byte("token:")) || bytes.Contains(contents, []byte("token-cert-hash:")) {
+		t.Fatalf("FAILED: Expected config file to not have token and cert")
+	}
+	info, err := os.Stat(secretsFile)
+	if err != nil {
+		t.Fatalf("FAILED: Expected secrets file to be created: %s", err.Error())
+	}
+	if info.Mode().Perm() != lazyjack.SecretsFileMode {
+		t.Fatalf("FAILED: Expected secrets file permissions %#o, got %#o", lazyjack.SecretsFileMode, info.Mode().Perm())
+	}
+	secrets, err := lazyjack.LoadSecretsFile(secretsFile)
+	if err != nil {
+		t.Fatalf("FAILED: Unable to read secrets file: %s", err.Error())
+	}
+	if secrets.Token != "zs6do0.rlyf5fbz9abknbc4" || secrets.TokenCertHash == "" {
+		t.Fatalf("FAILED: Expected secrets file to have token and cert, got %+v", secrets)
+	}
+	info, err = os.Stat(configFile)
+	if err != nil {
+		t.Fatalf("FAILED: Unable to access config file: %s", err.Error())
+	}
+	if info.Mode().Perm()&0002 != 0 {
+		t.Fatalf("FAILED: Expected config file to not be world writable, have %#o", info.Mode().Perm())
 	}
 }
 
@@ -569,8 +594,7 @@ func TestUpdateConfigYAMLContents(t *testing.T) {
 	var testCases = []struct {
 		name     string
 		input    []byte
-		token    string
-		hash     string
+		secrets  string
 		expected string
 	}{
 		{
@@ -584,12 +608,10 @@ topology:
         opmodes: "master dns64 nat64"
         id: 2
 `).Bytes(),
-			token: "1a46e0.4623b882f4f887a2",
-			hash:  "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef",
+			secrets: "/etc/lazyjack/secrets.yaml",
 			expected: `# Adding new
 general:
-    token: "1a46e0.4623b882f4f887a2"
-    token-cert-hash: "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef"
+    secrets-file: "/etc/lazyjack/secrets.yaml"
     plugin: bridge
 topology:
     bxb-c2-77:
@@ -611,12 +633,10 @@ topology:
         opmodes: "master dns64 nat64"
         id: 2
 `).Bytes(),
-			token: "1a46e0.4623b882f4f887a2",
-			hash:  "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef",
+			secrets: "/etc/lazyjack/secrets.yaml",
 			expected: `# Replacing
 general:
-    token: "1a46e0.4623b882f4f887a2"
-    token-cert-hash: "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef"
+    secrets-file: "/etc/lazyjack/secrets.yaml"
     plugin: bridge
 topology:
     bxb-c2-77:
@@ -626,8 +646,8 @@ topology:
 `,
 		},
 		{
-			name: "replacing when duplicates (legacy)",
-			input: bytes.NewBufferString(`# Duplicates
+			name: "only general section altered",
+			input: bytes.NewBufferString(`# Other sections
 general:
     plugin: bridge
     token: "<provide-token-here>"
@@ -637,43 +657,42 @@ topology:
         interface: "enp10s0"
         opmodes: "master dns64 nat64"
         id: 2
-token: "b362b2.665c96095a76fb5c"
+extra:
+    token: "b362b2.665c96095a76fb5c"
 token-cert-hash: "35f932d559ec963388046a690cdeaaced2408a16a2d3da529622c9dfb790fbe4"
 `).Bytes(),
-			token: "1a46e0.4623b882f4f887a2",
-			hash:  "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef",
-			expected: `# Duplicates
+			secrets: "/etc/lazyjack/secrets.yaml",
+			expected: `# Other sections
 general:
-    token: "1a46e0.4623b882f4f887a2"
-    token-cert-hash: "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef"
+    secrets-file: "/etc/lazyjack/secrets.yaml"
     plugin: bridge
 topology:
     bxb-c2-77:
         interface: "enp10s0"
         opmodes: "master dns64 nat64"
         id: 2
+extra:
+    token: "b362b2.665c96095a76fb5c"
+token-cert-hash: "35f932d559ec963388046a690cdeaaced2408a16a2d3da529622c9dfb790fbe4"
 `,
 		},
 		{
-			name: "replacing when order diff",
-			input: bytes.NewBufferString(`# Replacing diff order
+			name: "replacing secrets file in place",
+			input: bytes.NewBufferString(`# Replacing secrets file
 general:
     plugin: bridge
-    token-cert-hash: "<provide-cert-hash-here>"
-    token: "<provide-token-here>"
+    secrets-file: "/old/secrets.yaml"
 topology:
     bxb-c2-77:
         interface: "enp10s0"
         opmodes: "master dns64 nat64"
         id: 2
 `).Bytes(),
-			token: "1a46e0.4623b882f4f887a2",
-			hash:  "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef",
-			expected: `# Replacing diff order
+			secrets: "/etc/lazyjack/secrets.yaml",
+			expected: `# Replacing secrets file
 general:
-    token: "1a46e0.4623b882f4f887a2"
-    token-cert-hash: "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef"
     plugin: bridge
+    secrets-file: "/etc/lazyjack/secrets.yaml"
 topology:
     bxb-c2-77:
         interface: "enp10s0"
@@ -682,34 +701,37 @@ topology:
 `,
 		},
 		{
-			name: "replacing when first (legacy)",
-			input: bytes.NewBufferString(`# Replacing first
-token: "b362b2.665c96095a76fb5c"
-token-cert-hash: "35f932d559ec963388046a690cdeaaced2408a16a2d3da529622c9dfb790fbe4"
+			name: "preserves comments and indentation",
+			input: bytes.NewBufferString(`# Comments
 general:
-    plugin: bridge
+  plugin: bridge # can be ptp
+  # work-area: "/path/to/area"
+  token: "<provide-token-here>"
+  mode: ipv6
+# The nodes
 topology:
-    bxb-c2-77:
-        interface: "enp10s0"
-        opmodes: "master dns64 nat64"
-        id: 2
+  bxb-c2-77:
+    interface: "enp10s0"
+    opmodes: "master dns64 nat64"
+    id: 2
 `).Bytes(),
-			token: "1a46e0.4623b882f4f887a2",
-			hash:  "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef",
-			expected: `# Replacing first
+			secrets: "/etc/lazyjack/secrets.yaml",
+			expected: `# Comments
 general:
-    token: "1a46e0.4623b882f4f887a2"
-    token-cert-hash: "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef"
-    plugin: bridge
+  secrets-file: "/etc/lazyjack/secrets.yaml"
+  plugin: bridge # can be ptp
+  # work-area: "/path/to/area"
+  mode: ipv6
+# The nodes
 topology:
-    bxb-c2-77:
-        interface: "enp10s0"
-        opmodes: "master dns64 nat64"
-        id: 2
+  bxb-c2-77:
+    interface: "enp10s0"
+    opmodes: "master dns64 nat64"
+    id: 2
 `,
 		},
 		{
-			name: "missing general line",
+			name: "missing general section",
 			input: bytes.NewBufferString(`# Adding new
 topology:
     bxb-c2-77:
@@ -717,8 +739,7 @@ topology:
         opmodes: "master dns64 nat64"
         id: 2
 `).Bytes(),
-			token: "1a46e0.4623b882f4f887a2",
-			hash:  "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef",
+			secrets: "/etc/lazyjack/secrets.yaml",
 			expected: `# Adding new
 topology:
     bxb-c2-77:
@@ -726,29 +747,142 @@ topology:
         opmodes: "master dns64 nat64"
         id: 2
 general:
-    token: "1a46e0.4623b882f4f887a2"
-    token-cert-hash: "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef"
+    secrets-file: "/etc/lazyjack/secrets.yaml"
 `,
 		},
 		{
-			name:  "empty file (invalid though)",
-			input: bytes.NewBufferString("").Bytes(),
-			token: "1a46e0.4623b882f4f887a2",
-			hash:  "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef",
-			expected: `
-general:
-    token: "1a46e0.4623b882f4f887a2"
-    token-cert-hash: "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef"
+			name: "preserves blank lines and quoting",
+			input: bytes.NewBufferString(`general:
+    plugin: 'bridge'
+    token: "<provide-token-here>"
+
+    # Secrets
+    secrets-file: /old/secrets.yaml   # moved
+
+topology:
+    bxb-c2-77: {interface: "enp10s0", opmodes: "master dns64 nat64", id: 2}
+`).Bytes(),
+			secrets: "/etc/lazyjack/secrets.yaml",
+			expected: `general:
+    plugin: 'bridge'
+
+    # Secrets
+    secrets-file: "/etc/lazyjack/secrets.yaml" # moved
+
+topology:
+    bxb-c2-77: {interface: "enp10s0", opmodes: "master dns64 nat64", id: 2}
+`,
+		},
+		{
+			name:     "explicit null general section",
+			input:    bytes.NewBufferString("general: ~ # nothing yet\n\ntopology:\n  bxb-c2-77:\n    id: 2\n").Bytes(),
+			secrets:  "/etc/lazyjack/secrets.yaml",
+			expected: "general: # nothing yet\n  secrets-file: \"/etc/lazyjack/secrets.yaml\"\n\ntopology:\n  bxb-c2-77:\n    id: 2\n",
+		},
+		{
+			name:    "empty general section",
+			input:   bytes.NewBufferString("general:\n").Bytes(),
+			secrets: "/etc/lazyjack/secrets.yaml",
+			expected: `general:
+    secrets-file: "/etc/lazyjack/secrets.yaml"
+`,
+		},
+		{
+			name:    "empty file (invalid though)",
+			input:   bytes.NewBufferString("").Bytes(),
+			secrets: "/etc/lazyjack/secrets.yaml",
+			expected: `general:
+    secrets-file: "/etc/lazyjack/secrets.yaml"
 `,
 		},
 	}
 	for _, tc := range testCases {
-		actual := lazyjack.UpdateConfigYAMLContents(tc.input, "my-config.yaml", tc.token, tc.hash)
-		if string(actual) != tc.expected {
+		actual, err := lazyjack.UpdateConfigYAMLContents(tc.input, "my-config.yaml", tc.secrets)
+		if err != nil {
+			t.Errorf("FAILED: [%s] Unexpected error: %s", tc.name, err.Error())
+		} else if string(actual) != tc.expected {
 			t.Errorf("FAILED: [%s] Incorrect contents.\nExpected:\n%s\nActual:\n%s\n", tc.name, tc.expected, actual)
 		}
 	}
+}
+
+func TestUpdateConfigYAMLBackup(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	file := filepath.Join(basePath, "config.yaml")
+	contents := "general:\n    token: \"7aee33.05f81856d78346bd\"\n    token-cert-hash: \"35f932d559ec963388046a690cdeaaced2408a16a2d3da529622c9dfb790fbe4\"\n"
+	err := ioutil.WriteFile(file, []byte(contents), 0644)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create config file for test: %s", err.Error())
+	}
+
+	err = lazyjack.UpdateConfigYAML(file, lazyjack.DefaultSecretsFile)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to update config file: %s", err.Error())
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected config file to exist: %s", err.Error())
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Fatalf("FAILED: Expected config file to keep permissions 0644, got %#o", info.Mode().Perm())
+	}
+	info, err = os.Stat(file + ".bak")
+	if err != nil {
+		t.Fatalf("FAILED: Expected backup file to exist: %s", err.Error())
+	}
+	if info.Mode().Perm() != lazyjack.SecretsFileMode {
+		t.Fatalf("FAILED: Expected backup with token to have permissions %#o, got %#o", lazyjack.SecretsFileMode, info.Mode().Perm())
+	}
+}
 
+func TestFailedUpdateConfigYAMLContents(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		input    string
+		expected string
+	}{
+		{
+			name:     "unparseable",
+			input:    "general: [bridge\n",
+			expected: "unable to parse my-config.yaml: yaml: line 1: did not find expected ',' or ']'",
+		},
+		{
+			name:     "top level not a mapping",
+			input:    "- general\n",
+			expected: "unable to update my-config.yaml, as top level is not a mapping",
+		},
+		{
+			name:     "general not a mapping",
+			input:    "general: bridge\n",
+			expected: "unable to update my-config.yaml, as general section is not a mapping",
+		},
+		{
+			name:     "general is a flow mapping",
+			input:    "general: {plugin: bridge}\n",
+			expected: "unable to update my-config.yaml, as general section is a flow mapping",
+		},
+		{
+			name:     "token is not a single line",
+			input:    "general:\n    token: |\n        7aee33.05f81856d78346bd\n",
+			expected: "unable to update my-config.yaml, as token is not a single line value",
+		},
+		{
+			name:     "result does not parse as config",
+			input:    "general:\n    plugin: bridge\ntopology: 5\n",
+			expected: "refusing to update my-config.yaml, as result is invalid: Failed to parse config: yaml: unmarshal errors:\n  line 4: cannot unmarshal !!int `5` into map[string]lazyjack.Node",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := lazyjack.UpdateConfigYAMLContents([]byte(tc.input), "my-config.yaml", "/etc/lazyjack/secrets.yaml")
+		if err == nil {
+			t.Errorf("FAILED: [%s] Expected error, but was successful", tc.name)
+		} else if err.Error() != tc.expected {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expected, err.Error())
+		}
+	}
 }
 
 // HelperKubeAdmTokenGenExecCommand mosks OS command requests for kubeadm token
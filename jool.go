@@ -0,0 +1,136 @@
+package lazyjack
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// TaygaNAT64Backend runs the tayga (userspace) NAT64 server in a container
+	TaygaNAT64Backend = "tayga"
+	// JoolNAT64Backend uses the Jool (kernel) stateful NAT64 on the host
+	JoolNAT64Backend = "jool"
+	// DefaultNAT64Backend used, when not specified
+	DefaultNAT64Backend = TaygaNAT64Backend
+
+	// JoolInstance is the name of the Jool instance used for NAT64
+	JoolInstance = "lazyjack"
+	// JoolModule is the kernel module for stateful NAT64
+	JoolModule = "jool"
+)
+
+// ValidateNAT64Backend checks the NAT64 backend, applying the default, if
+// not specified. For Jool, the DNS64 prefix (used as pool6) must have one
+// of the prefix lengths from RFC 6052.
+func ValidateNAT64Backend(c *Config) error {
+	if c.NAT64.Backend == "" {
+		c.NAT64.Backend = DefaultNAT64Backend
+	}
+	c.NAT64.Backend = strings.ToLower(c.NAT64.Backend)
+	switch c.NAT64.Backend {
+	case TaygaNAT64Backend:
+		return nil
+	case JoolNAT64Backend:
+		_, pool6, err := net.ParseCIDR(c.DNS64.CIDR)
+		if err != nil {
+			return fmt.Errorf("DNS64 CIDR (%s) is invalid: %v", c.DNS64.CIDR, err)
+		}
+		switch size, _ := pool6.Mask.Size(); size {
+		case 32, 40, 48, 56, 64, 96:
+			return nil
+		default:
+			return fmt.Errorf("DNS64 CIDR %q must have a /32, /40, /48, /56, /64, or /96 prefix for the %s NAT64 backend", c.DNS64.CIDR, JoolNAT64Backend)
+		}
+	default:
+		return fmt.Errorf("unsupported NAT64 backend %q (use %s or %s)", c.NAT64.Backend, TaygaNAT64Backend, JoolNAT64Backend)
+	}
+}
+
+// UsingJool indicates if the Jool NAT64 backend is used.
+func UsingJool(c *Config) bool {
+	return c.NAT64.Backend == JoolNAT64Backend
+}
+
+// BuildJoolInstanceAddArgs constructs arguments to create the Jool
+// instance, using the DNS64 prefix for pool6.
+func BuildJoolInstanceAddArgs(c *Config) []string {
+	return []string{"instance", "add", JoolInstance, "--netfilter", "--pool6", c.DNS64.CIDR}
+}
+
+// BuildJoolPool4AddArgs constructs arguments to add the IPv4 mapping
+// addresses to pool4, for the protocol specified.
+func BuildJoolPool4AddArgs(protocol string, c *Config) []string {
+	return []string{"--instance", JoolInstance, "pool4", "add", "--" + protocol, c.NAT64.V4MappingCIDR}
+}
+
+// BuildJoolInstanceRemoveArgs constructs arguments to remove the Jool
+// instance.
+func BuildJoolInstanceRemoveArgs() []string {
+	return []string{"instance", "remove", JoolInstance}
+}
+
+// JoolInstanceExists checks if the Jool instance has already been created.
+func JoolInstanceExists() bool {
+	output, err := DoExecCommand("jool", []string{"instance", "display"})
+	if err != nil {
+		return false
+	}
+	for _, field := range strings.Fields(output) {
+		if strings.Trim(field, "|") == JoolInstance {
+			return true
+		}
+	}
+	return false
+}
+
+// PrepareJoolNAT64 sets up stateful NAT64 in the kernel, instead of running
+// the tayga container. The Jool module is loaded, forwarding is enabled, and
+// an instance is created with pool6 from the DNS64 prefix, and pool4 from
+// the IPv4 mapping CIDR. If the instance exists, no action is taken.
+func PrepareJoolNAT64(c *Config) error {
+	glog.V(1).Info("Preparing Jool NAT64")
+	_, err := DoExecCommand("modprobe", []string{JoolModule})
+	if err != nil {
+		return fmt.Errorf("unable to load %s kernel module: %v", JoolModule, err)
+	}
+	_, err = DoExecCommand("sysctl", []string{"-w", "net.ipv4.conf.all.forwarding=1", "net.ipv6.conf.all.forwarding=1"})
+	if err != nil {
+		return fmt.Errorf("unable to enable forwarding for Jool NAT64: %v", err)
+	}
+
+	if JoolInstanceExists() {
+		glog.V(1).Infof("Skipping - Jool instance %q already exists", JoolInstance)
+		glog.Info("Prepared Jool NAT64")
+		return nil
+	}
+	_, err = DoExecCommand("jool", BuildJoolInstanceAddArgs(c))
+	if err != nil {
+		return fmt.Errorf("unable to create Jool instance %q: %v", JoolInstance, err)
+	}
+	for _, protocol := range []string{"tcp", "udp", "icmp"} {
+		_, err = DoExecCommand("jool", BuildJoolPool4AddArgs(protocol, c))
+		if err != nil {
+			return fmt.Errorf("unable to add %s to Jool pool4 for %s: %v", c.NAT64.V4MappingCIDR, protocol, err)
+		}
+	}
+	glog.Info("Prepared Jool NAT64")
+	return nil
+}
+
+// CleanupJoolNAT64 removes the Jool instance. The kernel module is left
+// loaded, as it may be in use by others.
+func CleanupJoolNAT64(c *Config) error {
+	glog.V(1).Info("Cleaning Jool NAT64")
+	if !JoolInstanceExists() {
+		return notFoundErrorf("skipping - No %q Jool instance exists", JoolInstance)
+	}
+	_, err := DoExecCommand("jool", BuildJoolInstanceRemoveArgs())
+	if err != nil {
+		return fmt.Errorf("unable to remove Jool instance %q: %v", JoolInstance, err)
+	}
+	glog.Info("Cleaned Jool NAT64")
+	return nil
+}
@@ -0,0 +1,211 @@
+package lazyjack_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+// joolCommands records the OS commands invoked, and simulates the output
+// of displaying the Jool instances.
+type joolCommands struct {
+	invoked        []string
+	instanceExists bool
+	failCommand    string
+}
+
+func (j *joolCommands) Exec(cmd string, args []string) (string, error) {
+	full := cmd + " " + strings.Join(args, " ")
+	if j.failCommand != "" && strings.HasPrefix(full, j.failCommand) {
+		return "", fmt.Errorf("mock failure of %s", cmd)
+	}
+	if full == "jool instance display" {
+		if j.instanceExists {
+			return "+--------------------+-----------------+-----------+\n|          Namespace |            Name | Framework |\n+--------------------+-----------------+-----------+\n|           8bb1f280 |        lazyjack | netfilter |\n", nil
+		}
+		return "", nil
+	}
+	j.invoked = append(j.invoked, full)
+	return "", nil
+}
+
+func HelperJoolConfig() *lazyjack.Config {
+	return &lazyjack.Config{
+		General: lazyjack.GeneralSettings{Mode: lazyjack.IPv6NetMode},
+		DNS64:   lazyjack.DNS64Config{CIDR: "fd00:10:64:ff9b::/96"},
+		NAT64: lazyjack.NAT64Config{
+			Backend:       lazyjack.JoolNAT64Backend,
+			V4MappingCIDR: "172.18.0.128/25",
+			V4MappingIP:   "172.18.0.200",
+		},
+		Support: lazyjack.SupportNetwork{V4CIDR: "172.18.0.0/16"},
+	}
+}
+
+func TestValidateNAT64Backend(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		backend     string
+		cidr        string
+		expected    string
+		expectedErr string
+	}{
+		{name: "default", backend: "", expected: lazyjack.TaygaNAT64Backend},
+		{name: "jool", backend: "Jool", cidr: "64:ff9b::/96", expected: lazyjack.JoolNAT64Backend},
+		{
+			name:        "jool with bad prefix",
+			backend:     "jool",
+			cidr:        "fd00:10:64:ff9b::/80",
+			expectedErr: "DNS64 CIDR \"fd00:10:64:ff9b::/80\" must have a /32, /40, /48, /56, /64, or /96 prefix for the jool NAT64 backend",
+		},
+		{
+			name:        "unknown",
+			backend:     "nat46",
+			expectedErr: "unsupported NAT64 backend \"nat46\" (use tayga or jool)",
+		},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{
+			DNS64: lazyjack.DNS64Config{CIDR: tc.cidr},
+			NAT64: lazyjack.NAT64Config{Backend: tc.backend},
+		}
+		err := lazyjack.ValidateNAT64Backend(c)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected backend to be valid: %s", tc.name, err.Error())
+			} else if c.NAT64.Backend != tc.expected {
+				t.Errorf("FAILED: [%s] Expected backend %q, got %q", tc.name, tc.expected, c.NAT64.Backend)
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected error %q", tc.name, tc.expectedErr)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedErr, err.Error())
+		}
+	}
+}
+
+func TestBuildJoolArgs(t *testing.T) {
+	c := HelperJoolConfig()
+	actual := strings.Join(lazyjack.BuildJoolInstanceAddArgs(c), " ")
+	expected := "instance add lazyjack --netfilter --pool6 fd00:10:64:ff9b::/96"
+	if actual != expected {
+		t.Fatalf("FAILED: Building Jool instance args. Expected %q, got %q", expected, actual)
+	}
+	actual = strings.Join(lazyjack.BuildJoolPool4AddArgs("udp", c), " ")
+	expected = "--instance lazyjack pool4 add --udp 172.18.0.128/25"
+	if actual != expected {
+		t.Fatalf("FAILED: Building Jool pool4 args. Expected %q, got %q", expected, actual)
+	}
+	actual = strings.Join(lazyjack.BuildJoolInstanceRemoveArgs(), " ")
+	expected = "instance remove lazyjack"
+	if actual != expected {
+		t.Fatalf("FAILED: Building Jool remove args. Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestPrepareAndCleanupJoolNAT64(t *testing.T) {
+	cmds := &joolCommands{}
+	lazyjack.RegisterExecCommand(cmds.Exec)
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+
+	c := HelperJoolConfig()
+	err := lazyjack.PrepareJoolNAT64(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to prepare Jool NAT64: %s", err.Error())
+	}
+	expected := "modprobe jool, " +
+		"sysctl -w net.ipv4.conf.all.forwarding=1 net.ipv6.conf.all.forwarding=1, " +
+		"jool instance add lazyjack --netfilter --pool6 fd00:10:64:ff9b::/96, " +
+		"jool --instance lazyjack pool4 add --tcp 172.18.0.128/25, " +
+		"jool --instance lazyjack pool4 add --udp 172.18.0.128/25, " +
+		"jool --instance lazyjack pool4 add --icmp 172.18.0.128/25"
+	if strings.Join(cmds.invoked, ", ") != expected {
+		t.Fatalf("FAILED: Expected commands %q, got %q", expected, strings.Join(cmds.invoked, ", "))
+	}
+
+	// Rerun, with instance existing
+	cmds.invoked = nil
+	cmds.instanceExists = true
+	err = lazyjack.PrepareJoolNAT64(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to prepare Jool NAT64 again: %s", err.Error())
+	}
+	if len(cmds.invoked) != 2 {
+		t.Fatalf("FAILED: Expected instance to not be recreated, got %q", strings.Join(cmds.invoked, ", "))
+	}
+
+	cmds.invoked = nil
+	err = lazyjack.CleanupJoolNAT64(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to clean up Jool NAT64: %s", err.Error())
+	}
+	if strings.Join(cmds.invoked, ", ") != "jool instance remove lazyjack" {
+		t.Fatalf("FAILED: Expected Jool instance to be removed, got %q", strings.Join(cmds.invoked, ", "))
+	}
+
+	cmds.instanceExists = false
+	err = lazyjack.CleanupJoolNAT64(c)
+	if err == nil || !strings.HasPrefix(err.Error(), "skipping") {
+		t.Fatalf("FAILED: Expected to skip cleanup, when no instance, got %v", err)
+	}
+}
+
+func TestFailedPrepareJoolNAT64(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		failCommand string
+		expectedErr string
+	}{
+		{
+			name:        "no module",
+			failCommand: "modprobe",
+			expectedErr: "unable to load jool kernel module: mock failure of modprobe",
+		},
+		{
+			name:        "no forwarding",
+			failCommand: "sysctl",
+			expectedErr: "unable to enable forwarding for Jool NAT64: mock failure of sysctl",
+		},
+		{
+			name:        "instance add",
+			failCommand: "jool instance add",
+			expectedErr: "unable to create Jool instance \"lazyjack\": mock failure of jool",
+		},
+		{
+			name:        "pool4 add",
+			failCommand: "jool --instance lazyjack pool4 add --udp",
+			expectedErr: "unable to add 172.18.0.128/25 to Jool pool4 for udp: mock failure of jool",
+		},
+	}
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+	for _, tc := range testCases {
+		cmds := &joolCommands{failCommand: tc.failCommand}
+		lazyjack.RegisterExecCommand(cmds.Exec)
+		err := lazyjack.PrepareJoolNAT64(HelperJoolConfig())
+		if err == nil {
+			t.Errorf("FAILED: [%s] Expected error %q", tc.name, tc.expectedErr)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedErr, err.Error())
+		}
+	}
+}
+
+func TestNoDNS64RouteOnJoolNode(t *testing.T) {
+	mock := &mockNetLink{}
+	c := HelperJoolConfig()
+	c.General.NetMgr = lazyjack.NetMgr{Server: mock}
+	node := &lazyjack.Node{Name: "master", ID: 2, IsNAT64Server: true, IsDNS64Server: true}
+	err := lazyjack.CreateRouteToNAT64ServerForDNS64Subnet(node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected no error on Jool node: %s", err.Error())
+	}
+	if len(mock.routes) != 0 {
+		t.Fatalf("FAILED: Expected no route on Jool node, got %v", mock.routes)
+	}
+	err = lazyjack.RemoveRouteForDNS64(node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected no error removing route on Jool node: %s", err.Error())
+	}
+}
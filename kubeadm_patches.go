@@ -0,0 +1,531 @@
+package lazyjack
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"text/template"
+
+	"github.com/golang/glog"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	// StrategicPatchType merges maps, and merges lists of maps by name
+	StrategicPatchType = "strategic"
+	// MergePatchType uses JSON merge patch (RFC 7386) semantics
+	MergePatchType = "merge"
+	// JSON6902PatchType uses a list of JSON patch (RFC 6902) operations
+	JSON6902PatchType = "json6902"
+	// DefaultPatchType used, when the patch type is not specified
+	DefaultPatchType = StrategicPatchType
+)
+
+// KubeAdmPatchKinds are the kubeadm.conf documents that can be patched.
+// MasterConfiguration is only used by older versions of KubeAdm.
+var KubeAdmPatchKinds = []string{
+	"InitConfiguration",
+	"ClusterConfiguration",
+	"KubeletConfiguration",
+	"KubeProxyConfiguration",
+	"MasterConfiguration",
+}
+
+var templateKindRE = regexp.MustCompile(`(?m)^kind: (\w+)\s*$`)
+
+// KubeAdmPatch defines a patch to apply to one document (by kind) in the
+// generated kubeadm.conf file.
+type KubeAdmPatch struct {
+	Kind  string `yaml:"kind"`
+	Type  string `yaml:"type"`
+	Patch string `yaml:"patch"`
+}
+
+// PatchType returns the type of patch, using the default, if not specified.
+func (p KubeAdmPatch) PatchType() string {
+	if p.Type == "" {
+		return DefaultPatchType
+	}
+	return p.Type
+}
+
+// KubeAdmConfig defines settings for customizing the kubeadm.conf file.
+type KubeAdmConfig struct {
+	Patches []KubeAdmPatch `yaml:"patches"`
+}
+
+// jsonPatchOp is one operation of a JSON6902 patch.
+type jsonPatchOp struct {
+	Op    string    `yaml:"op"`
+	Path  string    `yaml:"path"`
+	From  string    `yaml:"from"`
+	Value yaml.Node `yaml:"value"`
+}
+
+// parseKubeAdmPatch parses the patch contents. For merge types, this is a
+// YAML (or JSON) mapping, and for JSON6902, a list of operations.
+func parseKubeAdmPatch(p KubeAdmPatch) (*yaml.Node, []jsonPatchOp, error) {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(p.Patch), &doc)
+	if err != nil {
+		return nil, nil, fmt.Errorf("unable to parse %s patch for %s: %v", p.PatchType(), p.Kind, err)
+	}
+	if doc.Kind != yaml.DocumentNode || len(doc.Content) == 0 {
+		return nil, nil, fmt.Errorf("%s patch for %s is empty", p.PatchType(), p.Kind)
+	}
+	root := useBlockStyle(doc.Content[0])
+	switch p.PatchType() {
+	case StrategicPatchType, MergePatchType:
+		if root.Kind != yaml.MappingNode {
+			return nil, nil, fmt.Errorf("%s patch for %s must be a mapping", p.PatchType(), p.Kind)
+		}
+		return root, nil, nil
+	case JSON6902PatchType:
+		var ops []jsonPatchOp
+		err = root.Decode(&ops)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%s patch for %s must be a list of operations: %v", p.PatchType(), p.Kind, err)
+		}
+		for _, op := range ops {
+			switch op.Op {
+			case "add", "replace", "test":
+				if op.Value.Kind == 0 {
+					return nil, nil, fmt.Errorf("%s patch for %s is missing value for %q operation", p.PatchType(), p.Kind, op.Op)
+				}
+			case "remove":
+			case "move", "copy":
+				if op.From == "" {
+					return nil, nil, fmt.Errorf("%s patch for %s is missing from for %q operation", p.PatchType(), p.Kind, op.Op)
+				}
+			default:
+				return nil, nil, fmt.Errorf("%s patch for %s has unknown operation %q", p.PatchType(), p.Kind, op.Op)
+			}
+			if _, err := splitJSONPointer(op.Path); err != nil {
+				return nil, nil, fmt.Errorf("%s patch for %s: %v", p.PatchType(), p.Kind, err)
+			}
+		}
+		return nil, ops, nil
+	default:
+		return nil, nil, fmt.Errorf("unknown patch type %q for %s (use %s, %s, or %s)", p.Type, p.Kind, StrategicPatchType, MergePatchType, JSON6902PatchType)
+	}
+}
+
+// useBlockStyle changes flow style (e.g. JSON) lists and mappings, and
+// quoted keys in the patch, so that they match the kubeadm.conf layout.
+func useBlockStyle(n *yaml.Node) *yaml.Node {
+	n.Style &^= yaml.FlowStyle
+	for i, child := range n.Content {
+		if n.Kind == yaml.MappingNode && i%2 == 0 {
+			child.Style = 0
+		}
+		useBlockStyle(child)
+	}
+	return n
+}
+
+// templateKinds finds the document kinds in the kubeadm.conf template.
+func templateKinds(t *template.Template) map[string]bool {
+	kinds := map[string]bool{}
+	if t.Tree == nil {
+		return kinds
+	}
+	for _, match := range templateKindRE.FindAllStringSubmatch(t.Tree.Root.String(), -1) {
+		kinds[match[1]] = true
+	}
+	return kinds
+}
+
+// ValidateKubeAdmPatches ensures that each patch identifies a supported
+// document kind and can be parsed. If the kubeadm configuration API version
+// is known, the kubeadm.conf template for it must have the document kind.
+func ValidateKubeAdmPatches(c *Config) error {
+	var kinds map[string]bool
+	if len(c.KubeAdm.Patches) > 0 && c.General.KubeAdmAPIVersion != "" {
+		t, err := KubeAdmTemplateFor(c.General.KubeAdmAPIVersion)
+		if err != nil {
+			return err
+		}
+		kinds = templateKinds(t)
+	}
+	for i, p := range c.KubeAdm.Patches {
+		if p.Kind == "" {
+			return fmt.Errorf("missing kind for kubeadm patch #%d", i+1)
+		}
+		supported := false
+		for _, kind := range KubeAdmPatchKinds {
+			supported = supported || p.Kind == kind
+		}
+		if !supported {
+			return fmt.Errorf("unsupported kind %q for kubeadm patch #%d (use %s)", p.Kind, i+1, strings.Join(KubeAdmPatchKinds, ", "))
+		}
+		if kinds != nil && !kinds[p.Kind] {
+			return fmt.Errorf("no %s document in kubeadm.conf for API version %s, for kubeadm patch #%d", p.Kind, c.General.KubeAdmAPIVersion, i+1)
+		}
+		_, _, err := parseKubeAdmPatch(p)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ApplyKubeAdmPatches applies the patches, in order, to the documents in
+// the kubeadm.conf contents, with matching kind. If there are no patches, the
+// contents are returned unaltered.
+func ApplyKubeAdmPatches(contents []byte, patches []KubeAdmPatch) ([]byte, error) {
+	if len(patches) == 0 {
+		return contents, nil
+	}
+	var docs []*yaml.Node
+	decoder := yaml.NewDecoder(bytes.NewReader(contents))
+	for {
+		doc := &yaml.Node{}
+		err := decoder.Decode(doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("unable to parse kubeadm.conf contents: %v", err)
+		}
+		docs = append(docs, doc)
+	}
+
+	for _, p := range patches {
+		root := findKubeAdmDocument(docs, p.Kind)
+		if root == nil {
+			return nil, fmt.Errorf("no %s document in kubeadm.conf to patch", p.Kind)
+		}
+		patch, ops, err := parseKubeAdmPatch(p)
+		if err != nil {
+			return nil, err
+		}
+		if patch != nil {
+			mergeYAMLNodes(root, patch, p.PatchType() == StrategicPatchType)
+		} else {
+			for _, op := range ops {
+				err = applyJSONPatchOp(root, op)
+				if err != nil {
+					return nil, fmt.Errorf("unable to apply patch to %s: %v", p.Kind, err)
+				}
+			}
+		}
+		glog.V(4).Infof("Applied %s patch to %s", p.PatchType(), p.Kind)
+	}
+
+	out := new(bytes.Buffer)
+	encoder := yaml.NewEncoder(out)
+	encoder.SetIndent(2)
+	for _, doc := range docs {
+		err := encoder.Encode(doc)
+		if err != nil {
+			return nil, fmt.Errorf("unable to build patched kubeadm.conf contents: %v", err)
+		}
+	}
+	err := encoder.Close()
+	if err != nil {
+		return nil, fmt.Errorf("unable to build patched kubeadm.conf contents: %v", err)
+	}
+	return out.Bytes(), nil
+}
+
+// findKubeAdmDocument finds the top level mapping of the document with the
+// kind specified.
+func findKubeAdmDocument(docs []*yaml.Node, kind string) *yaml.Node {
+	for _, doc := range docs {
+		if len(doc.Content) == 0 || doc.Content[0].Kind != yaml.MappingNode {
+			continue
+		}
+		root := doc.Content[0]
+		i := FindMappingKey(root, "kind")
+		if i >= 0 && root.Content[i+1].Value == kind {
+			return root
+		}
+	}
+	return nil
+}
+
+func isNullNode(n *yaml.Node) bool {
+	return n.Kind == yaml.ScalarNode && n.ShortTag() == "!!null"
+}
+
+// mergeYAMLNodes merges the patch into the target, returning the result.
+// Mappings are merged recursively, with null values deleting keys. Other
+// values replace the target, except that for strategic merges, lists of
+// mappings with names are merged by name.
+func mergeYAMLNodes(target, patch *yaml.Node, strategic bool) *yaml.Node {
+	if target == nil || target.Kind != patch.Kind {
+		return stripNullValues(patch)
+	}
+	switch patch.Kind {
+	case yaml.MappingNode:
+		for i := 0; i+1 < len(patch.Content); i += 2 {
+			key, value := patch.Content[i], patch.Content[i+1]
+			if isNullNode(value) {
+				RemoveMappingKey(target, key.Value)
+				continue
+			}
+			j := FindMappingKey(target, key.Value)
+			if j < 0 {
+				target.Content = append(target.Content, key, stripNullValues(value))
+				continue
+			}
+			target.Content[j+1] = mergeYAMLNodes(target.Content[j+1], value, strategic)
+		}
+		return target
+	case yaml.SequenceNode:
+		if !strategic || !isNamedList(target) || !isNamedList(patch) {
+			return stripNullValues(patch)
+		}
+		for _, item := range patch.Content {
+			name := item.Content[FindMappingKey(item, "name")+1].Value
+			found := false
+			for k, existing := range target.Content {
+				if existing.Content[FindMappingKey(existing, "name")+1].Value == name {
+					target.Content[k] = mergeYAMLNodes(existing, item, strategic)
+					found = true
+					break
+				}
+			}
+			if !found {
+				target.Content = append(target.Content, stripNullValues(item))
+			}
+		}
+		return target
+	default:
+		return patch
+	}
+}
+
+// stripNullValues removes keys with null values from mappings in the
+// patch, as they have nothing to delete, when added to the target.
+func stripNullValues(n *yaml.Node) *yaml.Node {
+	if n.Kind == yaml.MappingNode {
+		content := n.Content[:0]
+		for i := 0; i+1 < len(n.Content); i += 2 {
+			if !isNullNode(n.Content[i+1]) {
+				content = append(content, n.Content[i], stripNullValues(n.Content[i+1]))
+			}
+		}
+		n.Content = content
+	} else if n.Kind == yaml.SequenceNode {
+		for i, item := range n.Content {
+			n.Content[i] = stripNullValues(item)
+		}
+	}
+	return n
+}
+
+// isNamedList indicates if the node is a list of mappings, each having a
+// name, which is used as the merge key for strategic merges.
+func isNamedList(n *yaml.Node) bool {
+	for _, item := range n.Content {
+		if item.Kind != yaml.MappingNode || FindMappingKey(item, "name") < 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// splitJSONPointer breaks a JSON pointer (RFC 6901) into reference tokens.
+// The empty pointer refers to the whole document, and has no tokens.
+func splitJSONPointer(path string) ([]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil, fmt.Errorf("invalid path %q", path)
+	}
+	tokens := strings.Split(path[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.Replace(strings.Replace(token, "~1", "/", -1), "~0", "~", -1)
+	}
+	return tokens, nil
+}
+
+// sequenceIndex converts a reference token to an index into the list. For
+// inserts, the index may be one past the end (or "-").
+func sequenceIndex(n *yaml.Node, token string, insert bool) (int, error) {
+	max := len(n.Content) - 1
+	if insert {
+		max++
+		if token == "-" {
+			return max, nil
+		}
+	}
+	i, err := strconv.Atoi(token)
+	if err != nil || i < 0 || i > max {
+		return -1, fmt.Errorf("invalid list index %q", token)
+	}
+	return i, nil
+}
+
+// lookupJSONPointer finds the node referenced by the tokens.
+func lookupJSONPointer(root *yaml.Node, tokens []string) (*yaml.Node, error) {
+	n := root
+	for _, token := range tokens {
+		switch n.Kind {
+		case yaml.MappingNode:
+			i := FindMappingKey(n, token)
+			if i < 0 {
+				return nil, fmt.Errorf("key %q not found", token)
+			}
+			n = n.Content[i+1]
+		case yaml.SequenceNode:
+			i, err := sequenceIndex(n, token, false)
+			if err != nil {
+				return nil, err
+			}
+			n = n.Content[i]
+		default:
+			return nil, fmt.Errorf("unable to locate %q in scalar value", token)
+		}
+	}
+	return n, nil
+}
+
+// addJSONPointer adds (or replaces, for mappings) the value at the location
+// referenced by the path. For the whole document, the value replaces the
+// contents.
+func addJSONPointer(root *yaml.Node, path string, value *yaml.Node) error {
+	tokens, err := splitJSONPointer(path)
+	if err != nil {
+		return err
+	}
+	if len(tokens) == 0 {
+		if value.Kind != yaml.MappingNode {
+			return fmt.Errorf("value for the whole document must be a mapping")
+		}
+		*root = *value
+		return nil
+	}
+	last := len(tokens) - 1
+	parent, err := lookupJSONPointer(root, tokens[:last])
+	if err != nil {
+		return err
+	}
+	switch parent.Kind {
+	case yaml.MappingNode:
+		i := FindMappingKey(parent, tokens[last])
+		if i >= 0 {
+			parent.Content[i+1] = value
+		} else {
+			key := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: tokens[last]}
+			parent.Content = append(parent.Content, key, value)
+		}
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(parent, tokens[last], true)
+		if err != nil {
+			return err
+		}
+		parent.Content = append(parent.Content, nil)
+		copy(parent.Content[i+1:], parent.Content[i:])
+		parent.Content[i] = value
+	default:
+		return fmt.Errorf("unable to add to scalar value at %q", path)
+	}
+	return nil
+}
+
+// removeJSONPointer deletes the value at the location referenced by the
+// path, returning the removed value. The whole document cannot be removed.
+func removeJSONPointer(root *yaml.Node, path string) (*yaml.Node, error) {
+	tokens, err := splitJSONPointer(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, fmt.Errorf("unable to remove the whole document")
+	}
+	last := len(tokens) - 1
+	parent, err := lookupJSONPointer(root, tokens[:last])
+	if err != nil {
+		return nil, err
+	}
+	var removed *yaml.Node
+	switch parent.Kind {
+	case yaml.MappingNode:
+		i := FindMappingKey(parent, tokens[last])
+		if i < 0 {
+			return nil, fmt.Errorf("key %q not found", tokens[last])
+		}
+		removed = parent.Content[i+1]
+		RemoveMappingKey(parent, tokens[last])
+	case yaml.SequenceNode:
+		i, err := sequenceIndex(parent, tokens[last], false)
+		if err != nil {
+			return nil, err
+		}
+		removed = parent.Content[i]
+		parent.Content = append(parent.Content[:i], parent.Content[i+1:]...)
+	default:
+		return nil, fmt.Errorf("unable to remove from scalar value at %q", path)
+	}
+	return removed, nil
+}
+
+// copyYAMLNode makes a deep copy of the node.
+func copyYAMLNode(n *yaml.Node) *yaml.Node {
+	c := *n
+	c.Content = make([]*yaml.Node, len(n.Content))
+	for i, child := range n.Content {
+		c.Content[i] = copyYAMLNode(child)
+	}
+	return &c
+}
+
+// applyJSONPatchOp performs one JSON6902 operation on the document.
+func applyJSONPatchOp(root *yaml.Node, op jsonPatchOp) error {
+	switch op.Op {
+	case "add":
+		return addJSONPointer(root, op.Path, &op.Value)
+	case "remove":
+		_, err := removeJSONPointer(root, op.Path)
+		return err
+	case "replace":
+		if op.Path != "" {
+			_, err := removeJSONPointer(root, op.Path)
+			if err != nil {
+				return err
+			}
+		}
+		return addJSONPointer(root, op.Path, &op.Value)
+	case "move":
+		value, err := removeJSONPointer(root, op.From)
+		if err != nil {
+			return err
+		}
+		return addJSONPointer(root, op.Path, value)
+	case "copy":
+		tokens, err := splitJSONPointer(op.From)
+		if err != nil {
+			return err
+		}
+		value, err := lookupJSONPointer(root, tokens)
+		if err != nil {
+			return err
+		}
+		return addJSONPointer(root, op.Path, copyYAMLNode(value))
+	case "test":
+		tokens, err := splitJSONPointer(op.Path)
+		if err != nil {
+			return err
+		}
+		value, err := lookupJSONPointer(root, tokens)
+		if err != nil {
+			return err
+		}
+		var actual, expected interface{}
+		if err = value.Decode(&actual); err == nil {
+			err = op.Value.Decode(&expected)
+		}
+		if err != nil || !reflect.DeepEqual(actual, expected) {
+			return fmt.Errorf("test of %q failed", op.Path)
+		}
+		return nil
+	}
+	return fmt.Errorf("unknown operation %q", op.Op)
+}
@@ -0,0 +1,423 @@
+package lazyjack_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+const kubeAdmPatchBase = `# base config
+apiVersion: kubeadm.k8s.io/v1beta3
+kind: ClusterConfiguration
+apiServer:
+  extraVolumes:
+  - name: audit
+    hostPath: /var/log/audit
+  - name: policy
+    hostPath: /etc/policy
+imageRepository: registry.k8s.io
+networking:
+  dnsDomain: cluster.local
+  # podSubnet: "fd00:40::/72"
+  serviceSubnet: "fd00:30::/110"
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+cgroupDriver: systemd
+clusterDNS:
+- "fd00:30::a"
+maxPods: 110
+`
+
+func TestApplyKubeAdmPatches(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		patches  []lazyjack.KubeAdmPatch
+		expected string
+	}{
+		{
+			name: "strategic merge",
+			patches: []lazyjack.KubeAdmPatch{
+				{
+					Kind:  "KubeletConfiguration",
+					Patch: "cgroupDriver: cgroupfs\nmaxPods: 250\nfailSwapOn: false\n",
+				},
+				{
+					Kind:  "ClusterConfiguration",
+					Type:  "strategic",
+					Patch: "apiServer:\n  extraVolumes:\n  - name: policy\n    readOnly: true\n  - name: certs\n    hostPath: /etc/certs\n",
+				},
+			},
+			expected: `# base config
+apiVersion: kubeadm.k8s.io/v1beta3
+kind: ClusterConfiguration
+apiServer:
+  extraVolumes:
+    - name: audit
+      hostPath: /var/log/audit
+    - name: policy
+      hostPath: /etc/policy
+      readOnly: true
+    - name: certs
+      hostPath: /etc/certs
+imageRepository: registry.k8s.io
+networking:
+  dnsDomain: cluster.local
+  # podSubnet: "fd00:40::/72"
+  serviceSubnet: "fd00:30::/110"
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+cgroupDriver: cgroupfs
+clusterDNS:
+  - "fd00:30::a"
+maxPods: 250
+failSwapOn: false
+`,
+		},
+		{
+			name: "merge replaces lists and deletes nulls",
+			patches: []lazyjack.KubeAdmPatch{
+				{
+					Kind:  "ClusterConfiguration",
+					Type:  "merge",
+					Patch: `{"apiServer": {"extraVolumes": [{"name": "certs", "hostPath": "/etc/certs"}]}, "imageRepository": null, "dns": {"imageTag": "v1.9.3", "imageRepository": null}}`,
+				},
+			},
+			expected: `# base config
+apiVersion: kubeadm.k8s.io/v1beta3
+kind: ClusterConfiguration
+apiServer:
+  extraVolumes:
+    - name: "certs"
+      hostPath: "/etc/certs"
+networking:
+  dnsDomain: cluster.local
+  # podSubnet: "fd00:40::/72"
+  serviceSubnet: "fd00:30::/110"
+dns:
+  imageTag: "v1.9.3"
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+cgroupDriver: systemd
+clusterDNS:
+  - "fd00:30::a"
+maxPods: 110
+`,
+		},
+		{
+			name: "json6902",
+			patches: []lazyjack.KubeAdmPatch{
+				{
+					Kind: "KubeletConfiguration",
+					Type: "json6902",
+					Patch: `- op: test
+  path: /cgroupDriver
+  value: systemd
+- op: add
+  path: /clusterDNS/-
+  value: "10.96.0.10"
+- op: replace
+  path: /maxPods
+  value: 64
+- op: copy
+  from: /cgroupDriver
+  path: /cgroup~1driver
+- op: remove
+  path: /cgroupDriver
+`,
+				},
+				{
+					Kind:  "ClusterConfiguration",
+					Type:  "json6902",
+					Patch: `[{"op": "move", "from": "/apiServer/extraVolumes/1", "path": "/apiServer/extraVolumes/0"}]`,
+				},
+			},
+			expected: `# base config
+apiVersion: kubeadm.k8s.io/v1beta3
+kind: ClusterConfiguration
+apiServer:
+  extraVolumes:
+    - name: policy
+      hostPath: /etc/policy
+    - name: audit
+      hostPath: /var/log/audit
+imageRepository: registry.k8s.io
+networking:
+  dnsDomain: cluster.local
+  # podSubnet: "fd00:40::/72"
+  serviceSubnet: "fd00:30::/110"
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+clusterDNS:
+  - "fd00:30::a"
+  - "10.96.0.10"
+maxPods: 64
+cgroup/driver: systemd
+`,
+		},
+		{
+			name: "json6902 whole document",
+			patches: []lazyjack.KubeAdmPatch{
+				{
+					Kind: "KubeletConfiguration",
+					Type: "json6902",
+					Patch: `- op: replace
+  path: ""
+  value:
+    apiVersion: kubelet.config.k8s.io/v1beta1
+    kind: KubeletConfiguration
+    maxPods: 32
+`,
+				},
+			},
+			expected: `# base config
+apiVersion: kubeadm.k8s.io/v1beta3
+kind: ClusterConfiguration
+apiServer:
+  extraVolumes:
+    - name: audit
+      hostPath: /var/log/audit
+    - name: policy
+      hostPath: /etc/policy
+imageRepository: registry.k8s.io
+networking:
+  dnsDomain: cluster.local
+  # podSubnet: "fd00:40::/72"
+  serviceSubnet: "fd00:30::/110"
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+maxPods: 32
+`,
+		},
+		{
+			name:     "no patches",
+			patches:  nil,
+			expected: kubeAdmPatchBase,
+		},
+	}
+	for _, tc := range testCases {
+		actual, err := lazyjack.ApplyKubeAdmPatches([]byte(kubeAdmPatchBase), tc.patches)
+		if err != nil {
+			t.Errorf("FAILED: [%s] Expected to be able to apply patches: %s", tc.name, err.Error())
+			continue
+		}
+		if string(actual) != tc.expected {
+			t.Errorf("FAILED: [%s] Patched contents wrong\nExpected:\n%s\n  Actual:\n%s\n", tc.name, tc.expected, string(actual))
+		}
+	}
+}
+
+func TestFailedApplyKubeAdmPatches(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		patch    lazyjack.KubeAdmPatch
+		expected string
+	}{
+		{
+			name:     "no such document",
+			patch:    lazyjack.KubeAdmPatch{Kind: "JoinConfiguration", Patch: "caCertPath: /etc/ca.crt"},
+			expected: "no JoinConfiguration document in kubeadm.conf to patch",
+		},
+		{
+			name:     "merge patch not a mapping",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "merge", Patch: "- maxPods"},
+			expected: "merge patch for KubeletConfiguration must be a mapping",
+		},
+		{
+			name:     "missing key",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: remove\n  path: /address\n"},
+			expected: "unable to apply patch to KubeletConfiguration: key \"address\" not found",
+		},
+		{
+			name:     "bad index",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: replace\n  path: /clusterDNS/3\n  value: \"::1\"\n"},
+			expected: "unable to apply patch to KubeletConfiguration: invalid list index \"3\"",
+		},
+		{
+			name:     "test fails",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: test\n  path: /maxPods\n  value: 200\n"},
+			expected: "unable to apply patch to KubeletConfiguration: test of \"/maxPods\" failed",
+		},
+		{
+			name:     "remove whole document",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: remove\n  path: \"\"\n"},
+			expected: "unable to apply patch to KubeletConfiguration: unable to remove the whole document",
+		},
+		{
+			name:     "whole document not a mapping",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: replace\n  path: \"\"\n  value: [64]\n"},
+			expected: "unable to apply patch to KubeletConfiguration: value for the whole document must be a mapping",
+		},
+	}
+	for _, tc := range testCases {
+		_, err := lazyjack.ApplyKubeAdmPatches([]byte(kubeAdmPatchBase), []lazyjack.KubeAdmPatch{tc.patch})
+		if err == nil {
+			t.Errorf("FAILED: [%s] Expected patch to fail", tc.name)
+		} else if err.Error() != tc.expected {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expected, err.Error())
+		}
+	}
+}
+
+func TestValidateKubeAdmPatches(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		patch    lazyjack.KubeAdmPatch
+		expected string
+	}{
+		{
+			name:     "valid",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Patch: "maxPods: 64"},
+			expected: "",
+		},
+		{
+			name:     "missing kind",
+			patch:    lazyjack.KubeAdmPatch{Patch: "maxPods: 64"},
+			expected: "missing kind for kubeadm patch #1",
+		},
+		{
+			name:     "unsupported kind",
+			patch:    lazyjack.KubeAdmPatch{Kind: "JoinConfiguration", Patch: "caCertPath: /etc/ca.crt"},
+			expected: "unsupported kind \"JoinConfiguration\" for kubeadm patch #1 (use InitConfiguration, ClusterConfiguration, KubeletConfiguration, KubeProxyConfiguration, MasterConfiguration)",
+		},
+		{
+			name:     "unknown type",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "kustomize", Patch: "maxPods: 64"},
+			expected: "unknown patch type \"kustomize\" for KubeletConfiguration (use strategic, merge, or json6902)",
+		},
+		{
+			name:     "empty patch",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration"},
+			expected: "strategic patch for KubeletConfiguration is empty",
+		},
+		{
+			name:     "malformed patch",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Patch: "maxPods: [64"},
+			expected: "unable to parse strategic patch for KubeletConfiguration: yaml: line 1: did not find expected ',' or ']'",
+		},
+		{
+			name:     "unknown operation",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: append\n  path: /clusterDNS\n"},
+			expected: "json6902 patch for KubeletConfiguration has unknown operation \"append\"",
+		},
+		{
+			name:     "missing value",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: add\n  path: /maxPods\n"},
+			expected: "json6902 patch for KubeletConfiguration is missing value for \"add\" operation",
+		},
+		{
+			name:     "bad path",
+			patch:    lazyjack.KubeAdmPatch{Kind: "KubeletConfiguration", Type: "json6902", Patch: "- op: remove\n  path: maxPods\n"},
+			expected: "json6902 patch for KubeletConfiguration: invalid path \"maxPods\"",
+		},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{
+			KubeAdm: lazyjack.KubeAdmConfig{
+				Patches: []lazyjack.KubeAdmPatch{tc.patch},
+			},
+		}
+		err := lazyjack.ValidateKubeAdmPatches(c)
+		if tc.expected == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected patch to be valid: %s", tc.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected patch to be invalid", tc.name)
+		} else if err.Error() != tc.expected {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expected, err.Error())
+		}
+	}
+}
+
+func TestValidateKubeAdmPatchesForAPIVersion(t *testing.T) {
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			KubeAdmAPIVersion: "v1beta3",
+		},
+		KubeAdm: lazyjack.KubeAdmConfig{
+			Patches: []lazyjack.KubeAdmPatch{
+				{Kind: "KubeProxyConfiguration", Patch: "mode: ipvs"},
+			},
+		},
+	}
+	err := lazyjack.ValidateKubeAdmPatches(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected patch to be valid for template: %s", err.Error())
+	}
+
+	// Older template has no kube-proxy document
+	c.General.KubeAdmAPIVersion = "v1alpha1"
+	err = lazyjack.ValidateKubeAdmPatches(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected patch to be invalid for template")
+	}
+	expected := "no KubeProxyConfiguration document in kubeadm.conf for API version v1alpha1, for kubeadm patch #1"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+
+	c.General.KubeAdmAPIVersion = "v9"
+	err = lazyjack.ValidateKubeAdmPatches(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected patch to be invalid for unknown API version")
+	}
+}
+
+func TestCreateKubeAdmConfFileWithPatches(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Token:             "56cdce.7b18ad347f3de81c",
+			WorkArea:          basePath,
+			KubeAdmAPIVersion: "v1beta3",
+		},
+		Service: lazyjack.ServiceNetwork{
+			CIDR: "fd00:30::/110",
+		},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{
+					Prefix: "fd00:100::",
+				},
+			},
+		},
+		KubeAdm: lazyjack.KubeAdmConfig{
+			Patches: []lazyjack.KubeAdmPatch{
+				{Kind: "ClusterConfiguration", Patch: "imageRepository: registry.example.com"},
+			},
+		},
+	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
+
+	err := lazyjack.CreateKubeAdmConfigFile(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create KubeAdm config file: %s", err.Error())
+	}
+	contents, err := lazyjack.GetFileContents(filepath.Join(basePath, lazyjack.KubeAdmConfFile))
+	if err != nil {
+		t.Fatalf("FAILED: Unable to read kubeadm.conf: %s", err.Error())
+	}
+	if !strings.Contains(string(contents), "imageRepository: registry.example.com") {
+		t.Fatalf("FAILED: Expected patched image repository in kubeadm.conf:\n%s", contents)
+	}
+
+	c.KubeAdm.Patches[0].Kind = "MasterConfiguration"
+	err = lazyjack.CreateKubeAdmConfigFile(n, c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure to patch non-existent document")
+	}
+}
@@ -0,0 +1,422 @@
+package lazyjack
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+const (
+	// DefaultKubeAdmAPIVersion used when the KubeAdm version is not known
+	DefaultKubeAdmAPIVersion = "v1beta1"
+)
+
+// kubeAdmTemplates holds the kubeadm.conf content templates, keyed by the
+// kubeadm configuration API version.
+var kubeAdmTemplates = map[string]*template.Template{
+	"v1alpha1": Template_v1_10,
+	"v1alpha2": Template_v1_11,
+	"v1alpha3": Template_v1_12,
+	"v1beta1":  Template_v1_13,
+	"v1beta2":  Template_v1beta2,
+	"v1beta3":  Template_v1beta3,
+	"v1beta4":  Template_v1beta4,
+}
+
+// RegisterKubeAdmTemplate adds (or replaces) the template used to build the
+// kubeadm.conf contents for a kubeadm configuration API version.
+func RegisterKubeAdmTemplate(apiVersion string, t *template.Template) {
+	kubeAdmTemplates[apiVersion] = t
+}
+
+// KubeAdmTemplateFor obtains the template for the kubeadm configuration API
+// version.
+func KubeAdmTemplateFor(apiVersion string) (*template.Template, error) {
+	t, ok := kubeAdmTemplates[apiVersion]
+	if !ok {
+		return nil, fmt.Errorf("no kubeadm.conf template for API version %q", apiVersion)
+	}
+	return t, nil
+}
+
+// parseMajorMinor splits a major.minor version into numbers.
+func parseMajorMinor(version string) (int, int, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) != 2 {
+		return 0, 0, fmt.Errorf("invalid version %q", version)
+	}
+	major, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", version)
+	}
+	minor, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, fmt.Errorf("invalid version %q", version)
+	}
+	return major, minor, nil
+}
+
+// KubeAdmAPIVersionFor determines the kubeadm configuration API version to
+// use for the KubeAdm major.minor version provided. Versions newer than
+// known use the latest API. If the version cannot be parsed, or is older than
+// V1.10, the default (or oldest) API version is returned, with an indication
+// that the version is not supported.
+func KubeAdmAPIVersionFor(version string) (string, bool) {
+	major, minor, err := parseMajorMinor(version)
+	if err != nil {
+		return DefaultKubeAdmAPIVersion, false
+	}
+	switch {
+	case major > 1:
+		return "v1beta4", true
+	case major < 1, minor < 10:
+		return "v1alpha1", false
+	case minor == 10:
+		return "v1alpha1", true
+	case minor == 11:
+		return "v1alpha2", true
+	case minor == 12:
+		return "v1alpha3", true
+	case minor <= 14:
+		return "v1beta1", true
+	case minor <= 21:
+		return "v1beta2", true
+	case minor <= 30:
+		return "v1beta3", true
+	default:
+		return "v1beta4", true
+	}
+}
+
+// NeedsDualStackFeatureGate indicates if the IPv6DualStack feature gate must
+// be enabled for the KubeAdm major.minor version provided. Dual-stack was
+// alpha (off by default) in V1.16 - V1.20.
+func NeedsDualStackFeatureGate(version string) bool {
+	major, minor, err := parseMajorMinor(version)
+	if err != nil {
+		return false
+	}
+	return major == 1 && minor >= 16 && minor <= 20
+}
+
+// Template_v1beta2 kubeadm.conf content template for Kubernetes V1.15 - V1.21
+var Template_v1beta2 = template.Must(template.New("v1beta2").Parse(`# v1beta2 based config (V1.15 - V1.21)
+apiVersion: kubeadm.k8s.io/v1beta2
+bootstrapTokens:
+- groups:
+  - system:bootstrappers:kubeadm:default-node-token
+  token: {{.AuthToken}}
+  ttl: 24h0m0s
+  usages:
+  - signing
+  - authentication
+kind: InitConfiguration
+localAPIEndpoint:
+  advertiseAddress: "{{.AdvertiseAddress}}"
+  bindPort: 6443
+nodeRegistration:
+  criSocket: {{.CRISocket}}
+{{- if .DualStack}}
+  kubeletExtraArgs:
+    node-ip: "{{.NodeIPs}}"
+{{- end}}
+  name: {{.KubeMasterName}}
+  taints:
+  - effect: NoSchedule
+    key: node-role.kubernetes.io/master
+---
+apiServer:
+  timeoutForControlPlane: 4m0s
+apiVersion: kubeadm.k8s.io/v1beta2
+certificatesDir: /etc/kubernetes/pki
+clusterName: kubernetes
+{{- if .DualStack}}
+controllerManager:
+  extraArgs:
+    node-cidr-mask-size-ipv4: "{{.NodeCIDRMaskSizeV4}}"
+    node-cidr-mask-size-ipv6: "{{.NodeCIDRMaskSizeV6}}"
+{{- else}}
+controllerManager: {}
+{{- end}}
+dns:
+  type: {{.TypeDNS}}
+etcd:
+  local:
+    dataDir: /var/lib/etcd
+{{- if .DualStackFeatureGate}}
+featureGates:
+  IPv6DualStack: true
+{{- end}}
+imageRepository: k8s.gcr.io
+kind: ClusterConfiguration
+{{.K8sVersion}}
+networking:
+  dnsDomain: cluster.local
+{{- if .DualStack}}
+  podSubnet: "{{.PodSubnets}}"
+{{- else}}
+  # podSubnet: "{{.PodNetworkCIDR}}"
+{{- end}}
+  serviceSubnet: "{{.ServiceSubnets}}"
+scheduler: {}
+---
+apiVersion: kubeproxy.config.k8s.io/v1alpha1
+bindAddress: "{{.BindAddress}}"
+clientConnection:
+  kubeconfig: /var/lib/kube-proxy/kubeconfig.conf
+{{- if .DualStack}}
+clusterCIDR: "{{.PodSubnets}}"
+{{- else}}
+# clusterCIDR: ""
+{{- end}}
+{{- if .DualStackFeatureGate}}
+featureGates:
+  IPv6DualStack: true
+{{- end}}
+healthzBindAddress: 0.0.0.0:10256
+kind: KubeProxyConfiguration
+metricsBindAddress: 127.0.0.1:10249
+mode: ""
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+    cacheTTL: 2m0s
+    enabled: true
+  x509:
+    clientCAFile: /etc/kubernetes/pki/ca.crt
+authorization:
+  mode: Webhook
+  webhook:
+    cacheAuthorizedTTL: 5m0s
+    cacheUnauthorizedTTL: 30s
+cgroupDriver: {{.CgroupDriver}}
+clusterDNS:
+- "{{.DNS_ServiceIP}}"
+clusterDomain: cluster.local
+{{- if .DualStackFeatureGate}}
+featureGates:
+  IPv6DualStack: true
+{{- end}}
+healthzBindAddress: 127.0.0.1
+healthzPort: 10248
+kind: KubeletConfiguration
+maxPods: 110
+resolvConf: /etc/resolv.conf
+rotateCertificates: true
+staticPodPath: /etc/kubernetes/manifests
+`))
+
+// Template_v1beta3 kubeadm.conf content template for Kubernetes V1.22 - V1.30
+var Template_v1beta3 = template.Must(template.New("v1beta3").Parse(`# v1beta3 based config (V1.22 - V1.30)
+apiVersion: kubeadm.k8s.io/v1beta3
+bootstrapTokens:
+- groups:
+  - system:bootstrappers:kubeadm:default-node-token
+  token: {{.AuthToken}}
+  ttl: 24h0m0s
+  usages:
+  - signing
+  - authentication
+kind: InitConfiguration
+localAPIEndpoint:
+  advertiseAddress: "{{.AdvertiseAddress}}"
+  bindPort: 6443
+nodeRegistration:
+  criSocket: unix://{{.CRISocket}}
+  imagePullPolicy: IfNotPresent
+{{- if .DualStack}}
+  kubeletExtraArgs:
+    node-ip: "{{.NodeIPs}}"
+{{- end}}
+  name: {{.KubeMasterName}}
+  taints:
+  - effect: NoSchedule
+    key: node-role.kubernetes.io/control-plane
+---
+apiServer:
+  timeoutForControlPlane: 4m0s
+apiVersion: kubeadm.k8s.io/v1beta3
+certificatesDir: /etc/kubernetes/pki
+clusterName: kubernetes
+{{- if .DualStack}}
+controllerManager:
+  extraArgs:
+    node-cidr-mask-size-ipv4: "{{.NodeCIDRMaskSizeV4}}"
+    node-cidr-mask-size-ipv6: "{{.NodeCIDRMaskSizeV6}}"
+{{- else}}
+controllerManager: {}
+{{- end}}
+dns: {}
+etcd:
+  local:
+    dataDir: /var/lib/etcd
+imageRepository: registry.k8s.io
+kind: ClusterConfiguration
+{{.K8sVersion}}
+networking:
+  dnsDomain: cluster.local
+{{- if .DualStack}}
+  podSubnet: "{{.PodSubnets}}"
+{{- else}}
+  # podSubnet: "{{.PodNetworkCIDR}}"
+{{- end}}
+  serviceSubnet: "{{.ServiceSubnets}}"
+scheduler: {}
+---
+apiVersion: kubeproxy.config.k8s.io/v1alpha1
+bindAddress: "{{.BindAddress}}"
+clientConnection:
+  kubeconfig: /var/lib/kube-proxy/kubeconfig.conf
+{{- if .DualStack}}
+clusterCIDR: "{{.PodSubnets}}"
+{{- else}}
+# clusterCIDR: ""
+{{- end}}
+healthzBindAddress: 0.0.0.0:10256
+kind: KubeProxyConfiguration
+metricsBindAddress: 127.0.0.1:10249
+mode: ""
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+    cacheTTL: 2m0s
+    enabled: true
+  x509:
+    clientCAFile: /etc/kubernetes/pki/ca.crt
+authorization:
+  mode: Webhook
+  webhook:
+    cacheAuthorizedTTL: 5m0s
+    cacheUnauthorizedTTL: 30s
+cgroupDriver: {{.CgroupDriver}}
+clusterDNS:
+- "{{.DNS_ServiceIP}}"
+clusterDomain: cluster.local
+healthzBindAddress: 127.0.0.1
+healthzPort: 10248
+kind: KubeletConfiguration
+maxPods: 110
+resolvConf: /etc/resolv.conf
+rotateCertificates: true
+staticPodPath: /etc/kubernetes/manifests
+`))
+
+// Template_v1beta4 kubeadm.conf content template for Kubernetes V1.31 and newer
+var Template_v1beta4 = template.Must(template.New("v1beta4").Parse(`# v1beta4 based config (V1.31+)
+apiVersion: kubeadm.k8s.io/v1beta4
+bootstrapTokens:
+- groups:
+  - system:bootstrappers:kubeadm:default-node-token
+  token: {{.AuthToken}}
+  ttl: 24h0m0s
+  usages:
+  - signing
+  - authentication
+kind: InitConfiguration
+localAPIEndpoint:
+  advertiseAddress: "{{.AdvertiseAddress}}"
+  bindPort: 6443
+nodeRegistration:
+  criSocket: unix://{{.CRISocket}}
+  imagePullPolicy: IfNotPresent
+  imagePullSerial: true
+{{- if .DualStack}}
+  kubeletExtraArgs:
+  - name: node-ip
+    value: "{{.NodeIPs}}"
+{{- end}}
+  name: {{.KubeMasterName}}
+  taints:
+  - effect: NoSchedule
+    key: node-role.kubernetes.io/control-plane
+timeouts:
+  controlPlaneComponentHealthCheck: 4m0s
+  discovery: 5m0s
+  etcdAPICall: 2m0s
+  kubeletHealthCheck: 4m0s
+  kubernetesAPICall: 1m0s
+  tlsBootstrap: 5m0s
+  upgradeManifests: 5m0s
+---
+apiServer: {}
+apiVersion: kubeadm.k8s.io/v1beta4
+caCertificateValidityPeriod: 87600h0m0s
+certificateValidityPeriod: 8760h0m0s
+certificatesDir: /etc/kubernetes/pki
+clusterName: kubernetes
+{{- if .DualStack}}
+controllerManager:
+  extraArgs:
+  - name: node-cidr-mask-size-ipv4
+    value: "{{.NodeCIDRMaskSizeV4}}"
+  - name: node-cidr-mask-size-ipv6
+    value: "{{.NodeCIDRMaskSizeV6}}"
+{{- else}}
+controllerManager: {}
+{{- end}}
+dns: {}
+encryptionAlgorithm: RSA-2048
+etcd:
+  local:
+    dataDir: /var/lib/etcd
+imageRepository: registry.k8s.io
+kind: ClusterConfiguration
+{{.K8sVersion}}
+networking:
+  dnsDomain: cluster.local
+{{- if .DualStack}}
+  podSubnet: "{{.PodSubnets}}"
+{{- else}}
+  # podSubnet: "{{.PodNetworkCIDR}}"
+{{- end}}
+  serviceSubnet: "{{.ServiceSubnets}}"
+proxy: {}
+scheduler: {}
+---
+apiVersion: kubeproxy.config.k8s.io/v1alpha1
+bindAddress: "{{.BindAddress}}"
+clientConnection:
+  kubeconfig: /var/lib/kube-proxy/kubeconfig.conf
+{{- if .DualStack}}
+clusterCIDR: "{{.PodSubnets}}"
+{{- else}}
+# clusterCIDR: ""
+{{- end}}
+healthzBindAddress: 0.0.0.0:10256
+kind: KubeProxyConfiguration
+metricsBindAddress: 127.0.0.1:10249
+mode: ""
+---
+apiVersion: kubelet.config.k8s.io/v1beta1
+authentication:
+  anonymous:
+    enabled: false
+  webhook:
+    cacheTTL: 2m0s
+    enabled: true
+  x509:
+    clientCAFile: /etc/kubernetes/pki/ca.crt
+authorization:
+  mode: Webhook
+  webhook:
+    cacheAuthorizedTTL: 5m0s
+    cacheUnauthorizedTTL: 30s
+cgroupDriver: {{.CgroupDriver}}
+clusterDNS:
+- "{{.DNS_ServiceIP}}"
+clusterDomain: cluster.local
+healthzBindAddress: 127.0.0.1
+healthzPort: 10248
+kind: KubeletConfiguration
+maxPods: 110
+resolvConf: /etc/resolv.conf
+rotateCertificates: true
+staticPodPath: /etc/kubernetes/manifests
+`))
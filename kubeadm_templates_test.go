@@ -0,0 +1,211 @@
+package lazyjack_test
+
+import (
+	"flag"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"text/template"
+
+	"github.com/pmichali/lazyjack"
+)
+
+var updateGolden = flag.Bool("update", false, "update golden files for kubeadm.conf contents")
+
+func TestKubeAdmAPIVersionFor(t *testing.T) {
+	var testCases = []struct {
+		name      string
+		version   string
+		expected  string
+		supported bool
+	}{
+		{name: "older than supported", version: "1.9", expected: "v1alpha1", supported: false},
+		{name: "v1.10", version: "1.10", expected: "v1alpha1", supported: true},
+		{name: "v1.11", version: "1.11", expected: "v1alpha2", supported: true},
+		{name: "v1.12", version: "1.12", expected: "v1alpha3", supported: true},
+		{name: "v1.13", version: "1.13", expected: "v1beta1", supported: true},
+		{name: "v1.14", version: "1.14", expected: "v1beta1", supported: true},
+		{name: "v1.15", version: "1.15", expected: "v1beta2", supported: true},
+		{name: "v1.21", version: "1.21", expected: "v1beta2", supported: true},
+		{name: "v1.22", version: "1.22", expected: "v1beta3", supported: true},
+		{name: "v1.30", version: "1.30", expected: "v1beta3", supported: true},
+		{name: "v1.31", version: "1.31", expected: "v1beta4", supported: true},
+		{name: "newer than known", version: "1.99", expected: "v1beta4", supported: true},
+		{name: "next major", version: "2.0", expected: "v1beta4", supported: true},
+		{name: "not specified", version: "", expected: lazyjack.DefaultKubeAdmAPIVersion, supported: false},
+		{name: "malformed", version: "1.x", expected: lazyjack.DefaultKubeAdmAPIVersion, supported: false},
+	}
+	for _, tc := range testCases {
+		actual, supported := lazyjack.KubeAdmAPIVersionFor(tc.version)
+		if actual != tc.expected {
+			t.Errorf("FAILED: [%s] Expected API version %q, got %q", tc.name, tc.expected, actual)
+		}
+		if supported != tc.supported {
+			t.Errorf("FAILED: [%s] Expected supported to be %v", tc.name, tc.supported)
+		}
+	}
+}
+
+func TestNeedsDualStackFeatureGate(t *testing.T) {
+	for version, expected := range map[string]bool{"1.15": false, "1.16": true, "1.20": true, "1.21": false, "1.28": false, "": false} {
+		if lazyjack.NeedsDualStackFeatureGate(version) != expected {
+			t.Errorf("FAILED: Expected feature gate needed for %q to be %v", version, expected)
+		}
+	}
+}
+
+func TestKubeAdmTemplateFor(t *testing.T) {
+	for _, apiVersion := range []string{"v1alpha1", "v1alpha2", "v1alpha3", "v1beta1", "v1beta2", "v1beta3", "v1beta4"} {
+		_, err := lazyjack.KubeAdmTemplateFor(apiVersion)
+		if err != nil {
+			t.Errorf("FAILED: Expected template for API version %s: %s", apiVersion, err.Error())
+		}
+	}
+	_, err := lazyjack.KubeAdmTemplateFor("v2")
+	if err == nil {
+		t.Fatalf("FAILED: Expected no template for unknown API version")
+	}
+	expected := "no kubeadm.conf template for API version \"v2\""
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestRegisterKubeAdmTemplate(t *testing.T) {
+	lazyjack.RegisterKubeAdmTemplate("v9test", template.Must(template.New("test").Parse("name: {{.KubeMasterName}}\n")))
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			KubeAdmAPIVersion: "v9test",
+		},
+	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create contents from registered template: %s", err.Error())
+	}
+	expected := "name: my-master\n"
+	if string(contents) != expected {
+		t.Fatalf("FAILED: Expected contents from registered template %q, got %q", expected, contents)
+	}
+
+	c.General.KubeAdmAPIVersion = "v9unknown"
+	contents, err = lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure for unknown API version, got %q", contents)
+	}
+	if !strings.HasPrefix(err.Error(), "unable to create kubeadm.conf contents: ") {
+		t.Fatalf("FAILED: Expected error for unknown API version, got %q", err.Error())
+	}
+
+	// File is not created, when the contents cannot be built
+	c.General.WorkArea = TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(c.General.WorkArea, t)
+	defer HelperCleanupArea(c.General.WorkArea, t)
+	err = lazyjack.CreateKubeAdmConfigFile(n, c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected kubeadm.conf creation to fail for unknown API version")
+	}
+	if _, err = os.Stat(filepath.Join(c.General.WorkArea, lazyjack.KubeAdmConfFile)); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected no kubeadm.conf file to be created, got %v", err)
+	}
+}
+
+func TestKubeAdmConfigContentsGolden(t *testing.T) {
+	var testCases = []struct {
+		name       string
+		version    string
+		k8sVersion string
+		dualStack  bool
+		socket     string
+	}{
+		{name: "v1alpha1", version: "1.10", k8sVersion: "v1.10.3"},
+		{name: "v1alpha2", version: "1.11", k8sVersion: "v1.11.2"},
+		{name: "v1alpha3", version: "1.12", k8sVersion: "v1.12.1"},
+		{name: "v1beta1", version: "1.13", k8sVersion: "v1.13.0"},
+		{name: "v1beta2", version: "1.18", k8sVersion: "v1.18.6"},
+		{name: "v1beta3", version: "1.28", k8sVersion: "v1.28.2"},
+		{name: "v1beta4", version: "1.31", k8sVersion: "v1.31.0"},
+		{name: "v1beta2-dual-stack", version: "1.18", k8sVersion: "v1.18.6", dualStack: true},
+		{name: "v1beta3-dual-stack", version: "1.28", k8sVersion: "v1.28.2", dualStack: true},
+		{name: "v1beta4-dual-stack", version: "1.31", k8sVersion: "v1.31.0", dualStack: true},
+		{name: "v1beta4-runtime-socket", version: "1.31", k8sVersion: "v1.31.0", socket: "unix:///run/k3s/containerd/containerd.sock"},
+	}
+	for _, tc := range testCases {
+		apiVersion, _ := lazyjack.KubeAdmAPIVersionFor(tc.version)
+		c := &lazyjack.Config{
+			General: lazyjack.GeneralSettings{
+				Token:             "56cdce.7b18ad347f3de81c",
+				KubeAdmVersion:    tc.version,
+				KubeAdmAPIVersion: apiVersion,
+				K8sVersion:        tc.k8sVersion,
+			},
+			Pod: lazyjack.PodNetwork{
+				CIDR: "fd00:40::/72",
+				Info: [2]lazyjack.NetInfo{
+					{
+						Mode: lazyjack.IPv6NetMode,
+					},
+				},
+			},
+			Service: lazyjack.ServiceNetwork{
+				CIDR: "fd00:30::/110",
+				Info: lazyjack.NetInfo{
+					Mode:   lazyjack.IPv6NetMode,
+					Prefix: "fd00:30::",
+				},
+			},
+			Mgmt: lazyjack.ManagementNetwork{
+				Info: [2]lazyjack.NetInfo{
+					{
+						Prefix: "fd00:100::",
+						Mode:   lazyjack.IPv6NetMode,
+					},
+				},
+			},
+		}
+		if tc.dualStack {
+			c.General.Mode = lazyjack.DualStackNetMode
+			c.Pod.CIDR2 = "10.244.0.0/16"
+			c.Pod.Info[0].Size = 80
+			c.Pod.Info[1] = lazyjack.NetInfo{Mode: lazyjack.IPv4NetMode, Size: 24}
+			c.Service.CIDR2 = "10.96.0.0/12"
+			c.Mgmt.Info[1] = lazyjack.NetInfo{Prefix: "10.192.0.", Mode: lazyjack.IPv4NetMode}
+		}
+		if tc.socket != "" {
+			c.General.RuntimeSocket = tc.socket
+			err := lazyjack.ValidateRuntime(c)
+			if err != nil {
+				t.Fatalf("FAILED: [%s] Expected runtime socket to be valid: %s", tc.name, err.Error())
+			}
+		}
+		n := &lazyjack.Node{
+			Name: "my-master",
+			ID:   10,
+		}
+		actual, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+		if err != nil {
+			t.Fatalf("FAILED: [%s] Expected to create kubeadm.conf contents: %s", tc.name, err.Error())
+		}
+
+		golden := filepath.Join("testdata", "kubeadm", tc.name+".golden")
+		if *updateGolden {
+			err := ioutil.WriteFile(golden, actual, 0644)
+			if err != nil {
+				t.Fatalf("FAILED: [%s] Unable to update golden file: %s", tc.name, err.Error())
+			}
+		}
+		expected, err := ioutil.ReadFile(golden)
+		if err != nil {
+			t.Fatalf("FAILED: [%s] Unable to read golden file: %s", tc.name, err.Error())
+		}
+		if string(actual) != string(expected) {
+			t.Errorf("FAILED: [%s] kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", tc.name, expected, actual)
+		}
+	}
+}
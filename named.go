@@ -0,0 +1,219 @@
+package lazyjack
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"regexp"
+	"strings"
+)
+
+const (
+	// DNS64ConfigDir is where the DNS64 volume is mounted in the bind9 container
+	DNS64ConfigDir = "/etc/bind/"
+	// DNS64ZoneFilePrefix is the prefix for local zone files in the DNS64 volume
+	DNS64ZoneFilePrefix = "db."
+	// DNS64ZoneTTL is the time to live for local zone records
+	DNS64ZoneTTL = 300
+)
+
+var zoneNameRE = regexp.MustCompile(`^([a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9_])?\.)*[a-zA-Z0-9_]([a-zA-Z0-9_-]*[a-zA-Z0-9_])?$`)
+
+// DNS64Record is a static resource record in a local zone. The name is
+// relative to the zone, and the type is A, AAAA (the default), or CNAME.
+type DNS64Record struct {
+	Name  string `yaml:"name"`
+	Type  string `yaml:"type"`
+	Value string `yaml:"value"`
+}
+
+// DNS64Zone is a static zone, served by the DNS64 server, instead of being
+// forwarded.
+type DNS64Zone struct {
+	Name    string        `yaml:"name"`
+	Records []DNS64Record `yaml:"records"`
+}
+
+// NamedForwarders provides the list of remote DNS servers, starting with
+// the primary remote server. IPv4 servers are reached via NAT64, so they
+// are encoded using the DNS64 prefix.
+func NamedForwarders(c *Config) []string {
+	var forwarders []string
+	seen := map[string]bool{}
+	for _, server := range append([]string{c.DNS64.RemoteV4Server}, c.DNS64.RemoteServers...) {
+		if server == "" || seen[server] {
+			continue
+		}
+		seen[server] = true
+		if ip := net.ParseIP(server); ip != nil && ip.To4() == nil {
+			forwarders = append(forwarders, server)
+		} else {
+			forwarders = append(forwarders, c.DNS64.CIDRPrefix+server)
+		}
+	}
+	return forwarders
+}
+
+// validateACL checks the entries of an address match list, which can be
+// IP addresses, CIDRs, or one of the builtin ACLs, optionally negated.
+func validateACL(name string, acl []string) error {
+	for _, entry := range acl {
+		e := strings.TrimPrefix(entry, "!")
+		switch e {
+		case "any", "none", "localhost", "localnets":
+			continue
+		}
+		if net.ParseIP(e) != nil {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(e); err == nil {
+			continue
+		}
+		return fmt.Errorf("invalid DNS64 %s entry %q", name, entry)
+	}
+	return nil
+}
+
+// validateZone checks the local zone name and records.
+func validateZone(z DNS64Zone) error {
+	if !zoneNameRE.MatchString(z.Name) {
+		return fmt.Errorf("invalid DNS64 local zone name %q", z.Name)
+	}
+	for i, r := range z.Records {
+		if r.Name != "@" && !zoneNameRE.MatchString(r.Name) {
+			return fmt.Errorf("invalid name %q for record in DNS64 local zone %q", r.Name, z.Name)
+		}
+		if r.Type == "" {
+			r.Type = "AAAA"
+		}
+		r.Type = strings.ToUpper(r.Type)
+		z.Records[i].Type = r.Type
+		ip := net.ParseIP(r.Value)
+		switch r.Type {
+		case "A":
+			if ip == nil || ip.To4() == nil {
+				return fmt.Errorf("invalid IPv4 address %q for %s record in DNS64 local zone %q", r.Value, r.Name, z.Name)
+			}
+		case "AAAA":
+			if ip == nil || ip.To4() != nil {
+				return fmt.Errorf("invalid IPv6 address %q for %s record in DNS64 local zone %q", r.Value, r.Name, z.Name)
+			}
+		case "CNAME":
+			if !zoneNameRE.MatchString(strings.TrimSuffix(r.Value, ".")) {
+				return fmt.Errorf("invalid target %q for %s record in DNS64 local zone %q", r.Value, r.Name, z.Name)
+			}
+		default:
+			return fmt.Errorf("unsupported record type %q in DNS64 local zone %q (use A, AAAA, or CNAME)", r.Type, z.Name)
+		}
+	}
+	return nil
+}
+
+// ValidateNamedOptions checks the remote servers, ACLs, local zones, and
+// options used to build the bind9 configuration. These settings are not
+// supported by the builtin DNS64 server.
+func ValidateNamedOptions(c *Config) error {
+	d := &c.DNS64
+	custom := len(d.RemoteServers) > 0 || len(d.Exclude) > 0 || len(d.Clients) > 0 || len(d.Mapped) > 0 ||
+		len(d.LocalZones) > 0 || d.TopologyZone != "" || d.DNSSECValidation != "" || d.Recursion != ""
+	if custom && d.Backend == BuiltinDNS64Backend {
+		return fmt.Errorf("DNS64 remote servers, ACLs, local zones, and options are only supported with the %s backend", Bind9DNS64Backend)
+	}
+
+	for _, server := range d.RemoteServers {
+		if net.ParseIP(server) == nil {
+			return fmt.Errorf("invalid DNS64 remote server %q", server)
+		}
+	}
+	if err := validateACL("exclude", d.Exclude); err != nil {
+		return err
+	}
+	if err := validateACL("clients", d.Clients); err != nil {
+		return err
+	}
+	if err := validateACL("mapped", d.Mapped); err != nil {
+		return err
+	}
+
+	zones := map[string]bool{}
+	for _, z := range d.LocalZones {
+		if err := validateZone(z); err != nil {
+			return err
+		}
+		if zones[z.Name] {
+			return fmt.Errorf("duplicate DNS64 local zone %q", z.Name)
+		}
+		zones[z.Name] = true
+	}
+	if d.TopologyZone != "" {
+		if !zoneNameRE.MatchString(d.TopologyZone) {
+			return fmt.Errorf("invalid DNS64 topology zone name %q", d.TopologyZone)
+		}
+		if zones[d.TopologyZone] {
+			return fmt.Errorf("DNS64 topology zone %q is also a local zone", d.TopologyZone)
+		}
+	}
+
+	d.DNSSECValidation = strings.ToLower(d.DNSSECValidation)
+	switch d.DNSSECValidation {
+	case "", "auto", "yes", "no":
+	default:
+		return fmt.Errorf("unsupported DNS64 dnssec_validation %q (use auto, yes, or no)", d.DNSSECValidation)
+	}
+	d.Recursion = strings.ToLower(d.Recursion)
+	switch d.Recursion {
+	case "", "yes", "no":
+	default:
+		return fmt.Errorf("unsupported DNS64 recursion %q (use yes or no)", d.Recursion)
+	}
+	return nil
+}
+
+// NamedLocalZones provides the local zones to be served by the DNS64
+// server, including a zone with the management IPs of the nodes in the
+// topology, when requested.
+func NamedLocalZones(c *Config) []DNS64Zone {
+	zones := c.DNS64.LocalZones
+	if c.DNS64.TopologyZone == "" {
+		return zones
+	}
+	topology := DNS64Zone{Name: c.DNS64.TopologyZone}
+	for _, node := range BuildNodeInfo(c) {
+		r := DNS64Record{Name: node.Name, Type: "AAAA", Value: node.IP}
+		if ip := net.ParseIP(node.IP); ip != nil && ip.To4() != nil {
+			r.Type = "A"
+		}
+		topology.Records = append(topology.Records, r)
+	}
+	return append(append([]DNS64Zone{}, zones...), topology)
+}
+
+// ZoneFileName provides the name of the file holding the zone's records.
+func ZoneFileName(zone string) string {
+	return DNS64ZoneFilePrefix + zone
+}
+
+// writeACL adds an address match list statement, if there are entries.
+func writeACL(contents *bytes.Buffer, name string, acl []string) {
+	if len(acl) == 0 {
+		return
+	}
+	fmt.Fprintf(contents, "        %s { %s; };\n", name, strings.Join(acl, "; "))
+}
+
+// CreateZoneContents builds the contents of the file with the records for
+// a local zone. The DNS64 server is the name server for the zone.
+func CreateZoneContents(z DNS64Zone, c *Config) *bytes.Buffer {
+	contents := bytes.NewBufferString(fmt.Sprintf("$TTL %d\n", DNS64ZoneTTL))
+	fmt.Fprintf(contents, "@ IN SOA ns.%s. hostmaster.%s. ( 1 3600 600 86400 %d )\n", z.Name, z.Name, DNS64ZoneTTL)
+	fmt.Fprintf(contents, "@ IN NS ns.%s.\n", z.Name)
+	fmt.Fprintf(contents, "ns IN AAAA %s\n", c.DNS64.ServerIP)
+	for _, r := range z.Records {
+		rType := strings.ToUpper(r.Type)
+		if rType == "" {
+			rType = "AAAA"
+		}
+		fmt.Fprintf(contents, "%s IN %s %s\n", r.Name, rType, r.Value)
+	}
+	return contents
+}
@@ -0,0 +1,163 @@
+package lazyjack_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func TestNamedForwarders(t *testing.T) {
+	c := &lazyjack.Config{
+		DNS64: lazyjack.DNS64Config{
+			CIDRPrefix:     "fd00:10:64:ff9b::",
+			RemoteV4Server: "8.8.8.8",
+			RemoteServers:  []string{"8.8.8.8", "1.1.1.1", "2606:4700:4700::1111"},
+		},
+	}
+	actual := strings.Join(lazyjack.NamedForwarders(c), " ")
+	expected := "fd00:10:64:ff9b::8.8.8.8 fd00:10:64:ff9b::1.1.1.1 2606:4700:4700::1111"
+	if actual != expected {
+		t.Fatalf("FAILED: Expected forwarders %q, got %q", expected, actual)
+	}
+}
+
+func TestValidateNamedOptions(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		dns64       lazyjack.DNS64Config
+		expectedErr string
+	}{
+		{
+			name:  "defaults",
+			dns64: lazyjack.DNS64Config{},
+		},
+		{
+			name: "all options",
+			dns64: lazyjack.DNS64Config{
+				RemoteServers: []string{"8.8.4.4", "2001:4860:4860::8888"},
+				Exclude:       []string{"64:ff9b::/96"},
+				Clients:       []string{"localnets", "fd00:10::100"},
+				Mapped:        []string{"!10.0.0.0/8", "any"},
+				LocalZones: []lazyjack.DNS64Zone{
+					{
+						Name: "example.test",
+						Records: []lazyjack.DNS64Record{
+							{Name: "@", Type: "aaaa", Value: "fd00:10::50"},
+							{Name: "legacy", Type: "A", Value: "10.1.1.1"},
+							{Name: "www", Type: "CNAME", Value: "example.test."},
+						},
+					},
+				},
+				TopologyZone:     "lab.test",
+				DNSSECValidation: "Auto",
+				Recursion:        "no",
+			},
+		},
+		{
+			name:        "builtin backend",
+			dns64:       lazyjack.DNS64Config{Backend: lazyjack.BuiltinDNS64Backend, TopologyZone: "lab.test"},
+			expectedErr: "DNS64 remote servers, ACLs, local zones, and options are only supported with the bind9 backend",
+		},
+		{
+			name:        "bad remote server",
+			dns64:       lazyjack.DNS64Config{RemoteServers: []string{"dns.example.com"}},
+			expectedErr: "invalid DNS64 remote server \"dns.example.com\"",
+		},
+		{
+			name:        "bad ACL entry",
+			dns64:       lazyjack.DNS64Config{Clients: []string{"10.0.0.0/33"}},
+			expectedErr: "invalid DNS64 clients entry \"10.0.0.0/33\"",
+		},
+		{
+			name:        "bad zone name",
+			dns64:       lazyjack.DNS64Config{LocalZones: []lazyjack.DNS64Zone{{Name: "bad zone"}}},
+			expectedErr: "invalid DNS64 local zone name \"bad zone\"",
+		},
+		{
+			name: "duplicate zone",
+			dns64: lazyjack.DNS64Config{
+				LocalZones: []lazyjack.DNS64Zone{{Name: "example.test"}, {Name: "example.test"}},
+			},
+			expectedErr: "duplicate DNS64 local zone \"example.test\"",
+		},
+		{
+			name: "topology zone conflict",
+			dns64: lazyjack.DNS64Config{
+				LocalZones:   []lazyjack.DNS64Zone{{Name: "lab.test"}},
+				TopologyZone: "lab.test",
+			},
+			expectedErr: "DNS64 topology zone \"lab.test\" is also a local zone",
+		},
+		{
+			name: "wrong address family",
+			dns64: lazyjack.DNS64Config{
+				LocalZones: []lazyjack.DNS64Zone{
+					{Name: "example.test", Records: []lazyjack.DNS64Record{{Name: "host", Value: "10.1.1.1"}}},
+				},
+			},
+			expectedErr: "invalid IPv6 address \"10.1.1.1\" for host record in DNS64 local zone \"example.test\"",
+		},
+		{
+			name: "unknown record type",
+			dns64: lazyjack.DNS64Config{
+				LocalZones: []lazyjack.DNS64Zone{
+					{Name: "example.test", Records: []lazyjack.DNS64Record{{Name: "host", Type: "MX", Value: "mail"}}},
+				},
+			},
+			expectedErr: "unsupported record type \"MX\" in DNS64 local zone \"example.test\" (use A, AAAA, or CNAME)",
+		},
+		{
+			name:        "bad dnssec setting",
+			dns64:       lazyjack.DNS64Config{DNSSECValidation: "maybe"},
+			expectedErr: "unsupported DNS64 dnssec_validation \"maybe\" (use auto, yes, or no)",
+		},
+		{
+			name:        "bad recursion setting",
+			dns64:       lazyjack.DNS64Config{Recursion: "true"},
+			expectedErr: "unsupported DNS64 recursion \"true\" (use yes or no)",
+		},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{DNS64: tc.dns64}
+		err := lazyjack.ValidateNamedOptions(c)
+		if tc.expectedErr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected options to be valid: %s", tc.name, err.Error())
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected error %q", tc.name, tc.expectedErr)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedErr, err.Error())
+		}
+	}
+}
+
+func TestNamedLocalZonesFromTopology(t *testing.T) {
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"minion": {ID: 3},
+			"master": {ID: 2},
+		},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{{Prefix: "10.192.0."}},
+		},
+		DNS64: lazyjack.DNS64Config{
+			ServerIP:     "fd00:10::100",
+			LocalZones:   []lazyjack.DNS64Zone{{Name: "example.test"}},
+			TopologyZone: "lab.test",
+		},
+	}
+	zones := lazyjack.NamedLocalZones(c)
+	if len(zones) != 2 || zones[0].Name != "example.test" || zones[1].Name != "lab.test" {
+		t.Fatalf("FAILED: Expected local and topology zones, got %+v", zones)
+	}
+	actual := lazyjack.CreateZoneContents(zones[1], c).String()
+	expected := "master IN A 10.192.0.2\nminion IN A 10.192.0.3\n"
+	if !strings.HasSuffix(actual, expected) {
+		t.Fatalf("FAILED: Expected topology zone records %q, got %q", expected, actual)
+	}
+	if len(c.DNS64.LocalZones) != 1 {
+		t.Fatalf("FAILED: Expected configured local zones to be unchanged, got %+v", c.DNS64.LocalZones)
+	}
+}
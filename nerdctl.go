@@ -0,0 +1,196 @@
+package lazyjack
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// DefaultNerdctlCommand command used for containerd (nerdctl is a Docker
+// compatible CLI for containerd)
+const DefaultNerdctlCommand = "nerdctl"
+
+// Nerdctl represents a concrete hypervisor implementation, which uses
+// containerd, instead of dockerd.
+type Nerdctl struct {
+	Command string
+}
+
+// BuildNerdctlResourceStateArgs constructs the args to obtain resource
+// state. Unlike docker, nerdctl's inspect only handles containers (and
+// images), so networks and volumes are inspected separately.
+func BuildNerdctlResourceStateArgs(resource string) [][]string {
+	return [][]string{
+		{"inspect", resource},
+		{"network", "inspect", resource},
+		{"volume", "inspect", resource},
+	}
+}
+
+// ResourceState method obtains the state of the resource, which can be
+// not present, existing, or running (for container resources).
+func (n *Nerdctl) ResourceState(r string) string {
+	for _, args := range BuildNerdctlResourceStateArgs(r) {
+		output, err := n.DoCommand("Resource State", args)
+		if err != nil {
+			continue
+		}
+		if strings.Contains(output, "\"Running\": true") {
+			glog.V(4).Infof("Resource %q is running", r)
+			return ResourceRunning
+		}
+		glog.V(4).Infof("Resource %q exists", r)
+		return ResourceExists
+	}
+	glog.V(4).Infof("No %q resource", r)
+	return ResourceNotPresent
+}
+
+// DoCommand performs a nerdctl command, collecting and returning output.
+func (n *Nerdctl) DoCommand(name string, args []string) (string, error) {
+	return n.DoCommandWithInput(name, args, "")
+}
+
+// DoCommandWithInput performs a nerdctl command, providing the input (if
+// any) on stdin, and collecting and returning output.
+func (n *Nerdctl) DoCommandWithInput(name string, args []string, input string) (string, error) {
+	glog.V(4).Infof("Invoking: %s %s", n.Command, strings.Join(args, " "))
+	c := exec.Command(n.Command, args...)
+	if input != "" {
+		c.Stdin = strings.NewReader(input)
+	}
+	output, err := c.Output()
+	if err != nil {
+		return "", newCommandError(err, "%s failed for %q: %v (%s)", n.Command, name, err, output)
+	}
+	glog.V(4).Infof("Nerdctl %q operation successful", name)
+	return string(output), nil
+}
+
+// GetInterfaceConfig performs nerdctl command to obtain an interface's
+// IP addresses.
+func (n *Nerdctl) GetInterfaceConfig(name, ifName string) (string, error) {
+	args := BuildGetInterfaceArgs(name, ifName)
+	return n.DoCommand("Get I/F config", args)
+}
+
+// DeleteV4Address performs nerdctl command to remove the IPv4 address from
+// the container's eth0 interface.
+func (n *Nerdctl) DeleteV4Address(container, ip string) error {
+	args := BuildV4AddrDelArgs(container, ip)
+	_, err := n.DoCommand("Delete IPv4 addr", args)
+	return err
+}
+
+// AddV6Route performs nerdctl command to add an IPv6 route.
+func (n *Nerdctl) AddV6Route(container, dest, via string) error {
+	args := BuildAddRouteArgs(container, dest, via)
+	_, err := n.DoCommand("Add IPv6 route", args)
+	return classifyCommandError(err, ErrAlreadyExists)
+}
+
+// DeleteContainer performs nerdctl command to remove a container.
+func (n *Nerdctl) DeleteContainer(name string) error {
+	args := BuildDeleteContainerArgs(name)
+	_, err := n.DoCommand("Delete container", args)
+	return classifyCommandError(err, ErrNotFound)
+}
+
+// RunContainer performs nerdctl command to run a container. The arguments
+// are the same as for docker.
+func (n *Nerdctl) RunContainer(name string, args []string) error {
+	_, err := n.DoCommand("Run container", args)
+	return err
+}
+
+// BuildNerdctlCreateNetArgsFor constructs arguments to create a network,
+// with IPv6 and IPv4 subnets.
+func BuildNerdctlCreateNetArgsFor(name, cidr, v4cidr, gwPrefix string) []string {
+	return []string{
+		"network", "create", "--ipv6",
+		fmt.Sprintf("--subnet=%s", cidr),
+		fmt.Sprintf("--subnet=%s", v4cidr),
+		fmt.Sprintf("--gateway=%s1", gwPrefix),
+		name,
+	}
+}
+
+// CreateNetwork performs nerdctl command to create a network.
+func (n *Nerdctl) CreateNetwork(name, cidr, v4cidr, gw string) error {
+	args := BuildNerdctlCreateNetArgsFor(name, cidr, v4cidr, gw)
+	_, err := n.DoCommand("Create network", args)
+	return err
+}
+
+// DeleteNetwork performs nerdctl command to delete a network.
+func (n *Nerdctl) DeleteNetwork(name string) error {
+	args := BuildDeleteNetArgsFor(name)
+	_, err := n.DoCommand("Delete network", args)
+	return classifyCommandError(err, ErrNotFound)
+}
+
+// CreateVolume creates a new volume
+func (n *Nerdctl) CreateVolume(name string) error {
+	args := BuildCreateVolumeArgs(name)
+	_, err := n.DoCommand("Volume create", args)
+	return err
+}
+
+// BuildNerdctlInspectVolumeArgs constructs arguments to inspect a volume.
+func BuildNerdctlInspectVolumeArgs(name string) []string {
+	return []string{"volume", "inspect", name}
+}
+
+// DeleteVolume deletes a volume. Unlike docker, nerdctl fails when the
+// volume does not exist, so existence is checked first, so that no error
+// occurs, if volume doesn't exist.
+func (n *Nerdctl) DeleteVolume(name string) error {
+	_, err := n.DoCommand("Volume inspect", BuildNerdctlInspectVolumeArgs(name))
+	if err != nil {
+		glog.V(4).Infof("No %q volume to delete", name)
+		return nil
+	}
+	args := BuildDeleteVolumeArgs(name)
+	_, err = n.DoCommand("Volume delete", args)
+	return err
+}
+
+// GetVolumeMountPoint obtains the mount point so that files can be deposited from host.
+func (n *Nerdctl) GetVolumeMountPoint(name string) (string, error) {
+	args := BuildInspectVolumeArgs(name)
+	mountPoint, err := n.DoCommand("Volume inspect", args)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(mountPoint, "\"\n"), nil
+}
+
+// PullImage performs nerdctl command to pull the image from the registry.
+func (n *Nerdctl) PullImage(image string) error {
+	args := BuildPullImageArgs(image)
+	_, err := n.DoCommand("Pull image", args)
+	return err
+}
+
+// LoadImage performs nerdctl command to load an image from a tarball.
+func (n *Nerdctl) LoadImage(tarball string) error {
+	args := BuildLoadImageArgs(tarball)
+	_, err := n.DoCommand("Load image", args)
+	return err
+}
+
+// Login performs nerdctl command to log in to the registry, with the
+// password provided on stdin.
+func (n *Nerdctl) Login(server, username, password string) error {
+	args := BuildLoginArgs(server, username)
+	_, err := n.DoCommandWithInput("Registry login", args, password)
+	return err
+}
+
+// ContainerLogs performs nerdctl command to obtain the most recent log
+// lines from the container.
+func (n *Nerdctl) ContainerLogs(name string) (string, error) {
+	return containerLogs(n.Command, name)
+}
@@ -0,0 +1,153 @@
+package lazyjack_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func TestNerdctlResourceState(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		resource string
+		cmd      string
+		expected string
+	}{
+		{
+			name:     "resource running",
+			resource: "\"Running\": true", // Bogus name so that output has expected string when doing echo
+			cmd:      "echo",
+			expected: lazyjack.ResourceRunning,
+		},
+		{
+			name:     "resource exists",
+			resource: "support_net",
+			cmd:      "echo",
+			expected: lazyjack.ResourceExists,
+		},
+		{
+			name:     "resource doesn't exists",
+			resource: "no-such-resource",
+			cmd:      "false",
+			expected: lazyjack.ResourceNotPresent,
+		},
+	}
+	for _, tc := range testCases {
+		n := lazyjack.Nerdctl{Command: tc.cmd}
+		actual := n.ResourceState(tc.resource)
+		if actual != tc.expected {
+			t.Fatalf("FAILED: [%s] resource state mismatch. Expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestBuildNerdctlResourceStateArgs(t *testing.T) {
+	var actual []string
+	for _, args := range lazyjack.BuildNerdctlResourceStateArgs("bind9") {
+		actual = append(actual, strings.Join(args, " "))
+	}
+	expected := "inspect bind9,network inspect bind9,volume inspect bind9"
+	if strings.Join(actual, ",") != expected {
+		t.Fatalf("FAILED: Building resource state args. Expected %q, got %q", expected, strings.Join(actual, ","))
+	}
+}
+
+func TestBuildNerdctlCreateNetArgs(t *testing.T) {
+	list := lazyjack.BuildNerdctlCreateNetArgsFor("test_net", "fd00:10::/64", "172.18.0.0/16", "fd00:10::")
+	actual := strings.Join(list, " ")
+	expected := "network create --ipv6 --subnet=fd00:10::/64 --subnet=172.18.0.0/16 --gateway=fd00:10::1 test_net"
+	if actual != expected {
+		t.Fatalf("FAILED: Building support net create args. Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestNerdctlOperations(t *testing.T) {
+	n := lazyjack.Nerdctl{Command: "echo"}
+	err := n.CreateNetwork("my-network", "2001:db8::/64", "10.20.0.0/16", "2001:db8::")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create network")
+	}
+	err = n.DeleteNetwork("my-network")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete network")
+	}
+	err = n.RunContainer("my-container", []string{"arg1", "arg2"})
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to run container")
+	}
+	err = n.DeleteContainer("my-container")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete container")
+	}
+	err = n.DeleteV4Address("my-container", "192.168.0.5/24")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete V4 IP")
+	}
+	err = n.AddV6Route("my-container", "2001:db8::/64", "2001:db8::200")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to add route")
+	}
+	err = n.CreateVolume("my-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create volume")
+	}
+	err = n.DeleteVolume("my-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete volume")
+	}
+	actual, err := n.GetInterfaceConfig("my-container", "eth0")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to get interface config")
+	}
+	expected := "exec my-container ip addr list eth0\n"
+	if actual != expected {
+		t.Fatalf("FAILED: Get I/F config. Expected %q, got %q", expected, actual)
+	}
+	actual, err = n.GetVolumeMountPoint("my-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to get volume mount point")
+	}
+	expected = "volume inspect -f \"{{json .Mountpoint}}\" my-volume"
+	if actual != expected {
+		t.Fatalf("FAILED: Get volume mount point. Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestNerdctlDeleteMissingVolume(t *testing.T) {
+	n := lazyjack.Nerdctl{Command: "false"}
+	err := n.DeleteVolume("no-such-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected no error deleting non-existent volume: %s", err.Error())
+	}
+}
+
+func TestFailedNerdctlCommand(t *testing.T) {
+	n := lazyjack.Nerdctl{Command: "false"}
+	err := n.CreateNetwork("my-network", "2001:db8::/64", "10.20.0.0/16", "2001:db8::")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure creating network")
+	}
+	expected := "false failed for \"Create network\": exit status 1 ()"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestNerdctlImageCommands(t *testing.T) {
+	n := lazyjack.Nerdctl{Command: "false"}
+	err := n.PullImage("diverdane/bind9:latest")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure pulling image")
+	}
+	if !strings.Contains(err.Error(), "Pull image") {
+		t.Fatalf("FAILED: Expected pull image failure, got %q", err.Error())
+	}
+	n.Command = "echo"
+	if err = n.LoadImage("/tmp/lazyjack/bind9.tar"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to load image: %s", err.Error())
+	}
+	if err = n.Login("", "jack", "secret"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to log in to registry: %s", err.Error())
+	}
+}
@@ -0,0 +1,450 @@
+package lazyjack
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// NetplanPersistentNet renders a netplan YAML file
+	NetplanPersistentNet = "netplan"
+	// NetworkdPersistentNet renders a systemd-networkd .network file
+	NetworkdPersistentNet = "networkd"
+	// IfupdownPersistentNet renders an ifupdown interfaces file
+	IfupdownPersistentNet = "ifupdown"
+
+	// NetplanArea where netplan files are located (relative to /etc)
+	NetplanArea = "netplan"
+	// NetworkdArea where systemd-networkd files are located (relative to /etc)
+	NetworkdArea = "systemd/network"
+	// IfupdownArea where ifupdown interface files are located (relative to /etc)
+	IfupdownArea = "network/interfaces.d"
+	// IfupdownInterfacesFile is the main ifupdown interfaces file (relative to /etc)
+	IfupdownInterfacesFile = "network/interfaces"
+	// NetworkdDropInFile is the drop-in, for the .network file that
+	// configures the interface
+	NetworkdDropInFile = "lazyjack.conf"
+)
+
+// networkdUnitAreas are the areas, other than /etc, with .network files,
+// in priority order.
+var networkdUnitAreas = []string{"/run/systemd/network", "/usr/lib/systemd/network", "/lib/systemd/network"}
+
+// ValidatePersistentNet ensures that the format for persistent network
+// config, if specified, is supported.
+func ValidatePersistentNet(c *Config) error {
+	c.General.PersistentNet = strings.ToLower(c.General.PersistentNet)
+	switch c.General.PersistentNet {
+	case "", NetplanPersistentNet, NetworkdPersistentNet, IfupdownPersistentNet:
+		return nil
+	default:
+		return fmt.Errorf("unsupported persistent network config %q (use %s, %s, or %s)",
+			c.General.PersistentNet, NetplanPersistentNet, NetworkdPersistentNet, IfupdownPersistentNet)
+	}
+}
+
+// PersistentRoute is a static route, via one or more gateways, on the
+// management interface. Multiple gateways use ECMP or primary/backup
+// routing.
+type PersistentRoute struct {
+	Dest string
+	GWs  []string
+	ECMP bool
+}
+
+// Metric provides the metric for the route via the gateway at the index.
+// As with the routes added by netlink, backup routes use higher metrics.
+func (r PersistentRoute) Metric(index int) int {
+	if r.ECMP {
+		return PrimaryRouteMetric
+	}
+	return PrimaryRouteMetric + index
+}
+
+// PersistentNetConfig has the settings for the management interface, which
+// are made by prepare, so that they can be restored on boot.
+type PersistentNetConfig struct {
+	Interface string
+	Addresses []string
+	MTU       int
+	Routes    []PersistentRoute
+}
+
+// BuildPersistentNetConfig collects the management address(es), MTU, and
+// static routes for the node. Routes that use the support network are not
+// included, as the network is created by prepare.
+func BuildPersistentNetConfig(node *Node, c *Config) (*PersistentNetConfig, error) {
+	p := &PersistentNetConfig{Interface: node.Interface, MTU: c.Pod.MTU}
+	for _, r := range ManagementInterfaceResources(node, c) {
+		if addr, ok := r.(AddressResource); ok {
+			p.Addresses = append(p.Addresses, addr.IP)
+		}
+	}
+	if c.General.Mode != IPv6NetMode {
+		return p, nil
+	}
+	var routes []RouteResource
+	route, err := RouteToNAT64ServerForDNS64Subnet(node, c)
+	if err != nil {
+		return nil, err
+	}
+	if route != nil {
+		routes = append(routes, *route)
+	}
+	others, err := RoutesToSupportNetworkForOtherNodes(node, c)
+	if err != nil {
+		return nil, err
+	}
+	for _, r := range others {
+		routes = append(routes, r.(RouteResource))
+	}
+	for _, r := range routes {
+		if r.SupportNetCIDR != "" {
+			glog.V(4).Infof("Skipping - persistent route to %s, as it uses the support network", r.Dest)
+			continue
+		}
+		p.Routes = append(p.Routes, PersistentRoute{
+			Dest: r.Dest,
+			GWs:  r.GWs,
+			ECMP: len(r.GWs) > 1 && r.Routing == ECMPRouting,
+		})
+	}
+	return p, nil
+}
+
+// CreateNetplanContents builds a netplan YAML file for the interface. The
+// settings are merged with those from other netplan files. Empty lists are
+// omitted, as netplan rejects them, and an interface with no settings is an
+// empty mapping.
+func CreateNetplanContents(p *PersistentNetConfig) *bytes.Buffer {
+	contents := bytes.NewBufferString("# Generated by lazyjack\n")
+	contents.WriteString("network:\n")
+	contents.WriteString("  version: 2\n")
+	contents.WriteString("  ethernets:\n")
+	if p.MTU == 0 && len(p.Addresses) == 0 && len(p.Routes) == 0 {
+		fmt.Fprintf(contents, "    %s: {}\n", p.Interface)
+		return contents
+	}
+	fmt.Fprintf(contents, "    %s:\n", p.Interface)
+	if p.MTU != 0 {
+		fmt.Fprintf(contents, "      mtu: %d\n", p.MTU)
+	}
+	if len(p.Addresses) > 0 {
+		contents.WriteString("      addresses:\n")
+		for _, addr := range p.Addresses {
+			fmt.Fprintf(contents, "        - %q\n", addr)
+		}
+	}
+	if len(p.Routes) > 0 {
+		contents.WriteString("      routes:\n")
+		for _, r := range p.Routes {
+			for i, gw := range r.GWs {
+				fmt.Fprintf(contents, "        - to: %q\n", r.Dest)
+				fmt.Fprintf(contents, "          via: %q\n", gw)
+				fmt.Fprintf(contents, "          metric: %d\n", r.Metric(i))
+			}
+		}
+	}
+	return contents
+}
+
+// CreateNetworkdContents builds a systemd-networkd .network file for the
+// interface.
+func CreateNetworkdContents(p *PersistentNetConfig) *bytes.Buffer {
+	contents := bytes.NewBufferString("# Generated by lazyjack\n")
+	fmt.Fprintf(contents, "[Match]\nName=%s\n", p.Interface)
+	writeNetworkdSettings(p, contents)
+	return contents
+}
+
+// CreateNetworkdDropInContents builds a drop-in for the .network file that
+// configures the interface. The addresses and routes are added to those
+// from the .network file (e.g. DHCP), which remain.
+func CreateNetworkdDropInContents(p *PersistentNetConfig) *bytes.Buffer {
+	contents := bytes.NewBufferString("# Generated by lazyjack\n")
+	writeNetworkdSettings(p, contents)
+	return contents
+}
+
+// writeNetworkdSettings writes the link, address, and route sections.
+func writeNetworkdSettings(p *PersistentNetConfig, contents *bytes.Buffer) {
+	if p.MTU != 0 {
+		fmt.Fprintf(contents, "\n[Link]\nMTUBytes=%d\n", p.MTU)
+	}
+	contents.WriteString("\n[Network]\n")
+	for _, addr := range p.Addresses {
+		fmt.Fprintf(contents, "Address=%s\n", addr)
+	}
+	for _, r := range p.Routes {
+		for i, gw := range r.GWs {
+			fmt.Fprintf(contents, "\n[Route]\nDestination=%s\nGateway=%s\nMetric=%d\n", r.Dest, gw, r.Metric(i))
+		}
+	}
+}
+
+// networkdUnitMatches checks if the [Match] section of the .network file
+// matches the interface by name. Each Name= is a list of globs, which is
+// inverted, if prefixed by "!". A section with no settings matches all
+// interfaces, and one that only matches on other settings (e.g. MAC
+// address) is not considered a match.
+func networkdUnitMatches(contents []byte, intf string) bool {
+	inMatch := false
+	settings := 0
+	var names []string
+	for _, line := range strings.Split(string(contents), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			inMatch = line == "[Match]"
+			continue
+		}
+		if !inMatch {
+			continue
+		}
+		settings++
+		if strings.HasPrefix(line, "Name=") {
+			names = append(names, strings.TrimPrefix(line, "Name="))
+		}
+	}
+	if settings == 0 {
+		return true
+	}
+	if len(names) == 0 {
+		return false
+	}
+	for _, list := range names {
+		invert := strings.HasPrefix(list, "!")
+		found := false
+		for _, glob := range strings.Fields(strings.TrimPrefix(list, "!")) {
+			if ok, _ := filepath.Match(glob, intf); ok {
+				found = true
+				break
+			}
+		}
+		if found == invert {
+			return false
+		}
+	}
+	return true
+}
+
+// FindNetworkdUnit provides the name of the .network file that
+// systemd-networkd uses for the interface (the first matching file, in
+// lexical order, with files in /etc overriding those with the same name in
+// other areas), or "" if none match. Files created by lazyjack are ignored.
+func FindNetworkdUnit(intf string, c *Config) string {
+	areas := []string{filepath.Join(c.General.EtcArea, NetworkdArea)}
+	for _, area := range networkdUnitAreas {
+		areas = append(areas, RootPath(area, c))
+	}
+	units := map[string]string{}
+	var names []string
+	for _, area := range areas {
+		infos, err := FS().ReadDir(area)
+		if err != nil {
+			continue
+		}
+		for _, info := range infos {
+			name := info.Name()
+			if info.IsDir() || !strings.HasSuffix(name, ".network") || strings.Contains(name, "lazyjack") {
+				continue
+			}
+			if _, ok := units[name]; !ok {
+				units[name] = filepath.Join(area, name)
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		contents, err := FS().ReadFile(units[name])
+		if err == nil && networkdUnitMatches(contents, intf) {
+			glog.V(4).Infof("Using networkd unit %s for interface %q", units[name], intf)
+			return name
+		}
+	}
+	return ""
+}
+
+// networkdDropIn checks if the networkd config should be a drop-in (for
+// an existing .network file that configures the interface), and provides
+// the drop-in path.
+func networkdDropIn(node *Node, c *Config) (string, bool) {
+	unit := FindNetworkdUnit(node.Interface, c)
+	if unit == "" {
+		return "", false
+	}
+	return filepath.Join(c.General.EtcArea, NetworkdArea, unit+".d", NetworkdDropInFile), true
+}
+
+// FindIfupdownStanza provides the ifupdown interfaces file that already
+// defines the interface (other than the files created by lazyjack), or ""
+// if none do.
+func FindIfupdownStanza(intf string, c *Config) string {
+	files := []string{filepath.Join(c.General.EtcArea, IfupdownInterfacesFile)}
+	area := filepath.Join(c.General.EtcArea, IfupdownArea)
+	if infos, err := FS().ReadDir(area); err == nil {
+		for _, info := range infos {
+			if !info.IsDir() && !strings.Contains(info.Name(), "lazyjack") {
+				files = append(files, filepath.Join(area, info.Name()))
+			}
+		}
+	}
+	for _, file := range files {
+		contents, err := FS().ReadFile(file)
+		if err != nil {
+			continue
+		}
+		for _, line := range strings.Split(string(contents), "\n") {
+			fields := strings.Fields(line)
+			if len(fields) >= 2 && fields[0] == "iface" && fields[1] == intf {
+				glog.V(4).Infof("Interface %q is defined in %s", intf, file)
+				return file
+			}
+		}
+	}
+	return ""
+}
+
+// CreateIfupdownContents builds an ifupdown interfaces file, with a static
+// stanza for each address family. The MTU and routes are on the first
+// stanza. With no addresses, a manual stanza holds the MTU and routes.
+func CreateIfupdownContents(p *PersistentNetConfig) *bytes.Buffer {
+	contents := bytes.NewBufferString("# Generated by lazyjack\n")
+	fmt.Fprintf(contents, "auto %s\n", p.Interface)
+	addresses := p.Addresses
+	if len(addresses) == 0 {
+		addresses = []string{""}
+	}
+	for i, addr := range addresses {
+		if addr == "" {
+			fmt.Fprintf(contents, "\niface %s inet6 manual\n", p.Interface)
+		} else {
+			family := "inet6"
+			if ip, _, err := net.ParseCIDR(addr); err == nil && ip.To4() != nil {
+				family = "inet"
+			}
+			fmt.Fprintf(contents, "\niface %s %s static\n", p.Interface, family)
+			fmt.Fprintf(contents, "    address %s\n", addr)
+		}
+		if i != 0 {
+			continue
+		}
+		if p.MTU != 0 {
+			fmt.Fprintf(contents, "    mtu %d\n", p.MTU)
+		}
+		for _, r := range p.Routes {
+			if r.ECMP {
+				var nexthops []string
+				for _, gw := range r.GWs {
+					nexthops = append(nexthops, fmt.Sprintf("nexthop via %s dev %s", gw, p.Interface))
+				}
+				fmt.Fprintf(contents, "    up ip route replace %s %s\n", r.Dest, strings.Join(nexthops, " "))
+				fmt.Fprintf(contents, "    down ip route del %s || true\n", r.Dest)
+				continue
+			}
+			for j, gw := range r.GWs {
+				fmt.Fprintf(contents, "    up ip route replace %s via %s dev %s metric %d\n", r.Dest, gw, p.Interface, r.Metric(j))
+				fmt.Fprintf(contents, "    down ip route del %s via %s dev %s metric %d || true\n", r.Dest, gw, p.Interface, r.Metric(j))
+			}
+		}
+	}
+	return contents
+}
+
+// PersistentNetFile provides the path of the persistent network config
+// file for the interface, based on the format configured.
+func PersistentNetFile(node *Node, c *Config) string {
+	switch c.General.PersistentNet {
+	case NetplanPersistentNet:
+		return filepath.Join(c.General.EtcArea, NetplanArea, "60-lazyjack.yaml")
+	case NetworkdPersistentNet:
+		if dropIn, ok := networkdDropIn(node, c); ok {
+			return dropIn
+		}
+		return filepath.Join(c.General.EtcArea, NetworkdArea, fmt.Sprintf("10-lazyjack-%s.network", node.Interface))
+	case IfupdownPersistentNet:
+		return filepath.Join(c.General.EtcArea, IfupdownArea, fmt.Sprintf("lazyjack-%s", node.Interface))
+	}
+	return ""
+}
+
+// PersistentNetResource provides the persistent network config file for
+// the node, or nil, if persistent network config is not enabled. For
+// ifupdown, the interface must not already be defined, as the stanzas
+// would conflict.
+func PersistentNetResource(node *Node, c *Config) (*FileResource, error) {
+	if c.General.PersistentNet == "" {
+		return nil, nil
+	}
+	p, err := BuildPersistentNetConfig(node, c)
+	if err != nil {
+		return nil, err
+	}
+	file := &FileResource{Path: PersistentNetFile(node, c), Mode: 0644}
+	switch c.General.PersistentNet {
+	case NetplanPersistentNet:
+		file.Contents = CreateNetplanContents(p).Bytes()
+		file.Mode = 0600 // netplan warns, if others can read the file
+	case NetworkdPersistentNet:
+		if _, ok := networkdDropIn(node, c); ok {
+			file.Contents = CreateNetworkdDropInContents(p).Bytes()
+		} else {
+			file.Contents = CreateNetworkdContents(p).Bytes()
+		}
+	case IfupdownPersistentNet:
+		if existing := FindIfupdownStanza(node.Interface, c); existing != "" {
+			return nil, fmt.Errorf("interface %q is already defined in %s - remove it, or use %s or %s persistent network config",
+				node.Interface, existing, NetplanPersistentNet, NetworkdPersistentNet)
+		}
+		file.Contents = CreateIfupdownContents(p).Bytes()
+	}
+	return file, nil
+}
+
+// CreatePersistentNetConfig creates the config file, so that the settings
+// for the management interface remain, after a reboot. The file is not
+// applied, as prepare has already made the settings.
+func CreatePersistentNetConfig(node *Node, c *Config) error {
+	file, err := PersistentNetResource(node, c)
+	if err != nil || file == nil {
+		return err
+	}
+	err = Reconcile(file)
+	if err != nil {
+		return fmt.Errorf("unable to create persistent network config file (%s): %v", file.Path, err)
+	}
+	glog.V(1).Infof("Created %s persistent network config", c.General.PersistentNet)
+	return nil
+}
+
+// RemovePersistentNetConfig removes the config file for the management
+// interface, if persistent network config is enabled.
+func RemovePersistentNetConfig(node *Node, c *Config) error {
+	if c.General.PersistentNet == "" {
+		return nil
+	}
+	glog.V(1).Info("Cleaning persistent network config")
+	file := PersistentNetFile(node, c)
+	err := FS().Remove(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return notFoundErrorf("no persistent network config file to remove")
+		}
+		return fmt.Errorf("unable to remove persistent network config file (%s): %v", file, err)
+	}
+	if filepath.Base(file) == NetworkdDropInFile {
+		FS().Remove(filepath.Dir(file)) // Drop-in area, if not used by others
+	}
+	glog.V(4).Info("Removed persistent network config file")
+	return nil
+}
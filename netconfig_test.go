@@ -0,0 +1,370 @@
+package lazyjack_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func HelperPersistentNetConfig() *lazyjack.PersistentNetConfig {
+	return &lazyjack.PersistentNetConfig{
+		Interface: "eth1",
+		Addresses: []string{"fd00:100::4/64", "10.192.0.4/16"},
+		MTU:       9000,
+		Routes: []lazyjack.PersistentRoute{
+			{Dest: "fd00:10:64:ff9b::/96", GWs: []string{"fd00:100::2", "fd00:100::3"}, ECMP: true},
+			{Dest: "fd00:10::100/128", GWs: []string{"fd00:100::2", "fd00:100::3"}},
+		},
+	}
+}
+
+func TestValidatePersistentNet(t *testing.T) {
+	c := &lazyjack.Config{General: lazyjack.GeneralSettings{PersistentNet: "NetPlan"}}
+	err := lazyjack.ValidatePersistentNet(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected netplan to be valid: %s", err.Error())
+	}
+	if c.General.PersistentNet != lazyjack.NetplanPersistentNet {
+		t.Fatalf("FAILED: Expected setting to be normalized, got %q", c.General.PersistentNet)
+	}
+
+	c.General.PersistentNet = "nmcli"
+	err = lazyjack.ValidatePersistentNet(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected unsupported format to fail")
+	}
+	expected := `unsupported persistent network config "nmcli" (use netplan, networkd, or ifupdown)`
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestCreateNetplanContents(t *testing.T) {
+	expected := `# Generated by lazyjack
+network:
+  version: 2
+  ethernets:
+    eth1:
+      mtu: 9000
+      addresses:
+        - "fd00:100::4/64"
+        - "10.192.0.4/16"
+      routes:
+        - to: "fd00:10:64:ff9b::/96"
+          via: "fd00:100::2"
+          metric: 1024
+        - to: "fd00:10:64:ff9b::/96"
+          via: "fd00:100::3"
+          metric: 1024
+        - to: "fd00:10::100/128"
+          via: "fd00:100::2"
+          metric: 1024
+        - to: "fd00:10::100/128"
+          via: "fd00:100::3"
+          metric: 1025
+`
+	actual := lazyjack.CreateNetplanContents(HelperPersistentNetConfig())
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Netplan contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+}
+
+func TestCreateNetplanContentsNoAddresses(t *testing.T) {
+	p := &lazyjack.PersistentNetConfig{Interface: "eth1", MTU: 9000}
+	expected := `# Generated by lazyjack
+network:
+  version: 2
+  ethernets:
+    eth1:
+      mtu: 9000
+`
+	actual := lazyjack.CreateNetplanContents(p)
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Netplan contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+
+	p.MTU = 0
+	expected = `# Generated by lazyjack
+network:
+  version: 2
+  ethernets:
+    eth1: {}
+`
+	actual = lazyjack.CreateNetplanContents(p)
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Netplan contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+}
+
+func TestCreateNetworkdContents(t *testing.T) {
+	p := HelperPersistentNetConfig()
+	p.Routes = p.Routes[1:]
+	expected := `# Generated by lazyjack
+[Match]
+Name=eth1
+
+[Link]
+MTUBytes=9000
+
+[Network]
+Address=fd00:100::4/64
+Address=10.192.0.4/16
+
+[Route]
+Destination=fd00:10::100/128
+Gateway=fd00:100::2
+Metric=1024
+
+[Route]
+Destination=fd00:10::100/128
+Gateway=fd00:100::3
+Metric=1025
+`
+	actual := lazyjack.CreateNetworkdContents(p)
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Networkd contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+}
+
+func TestCreateIfupdownContents(t *testing.T) {
+	expected := `# Generated by lazyjack
+auto eth1
+
+iface eth1 inet6 static
+    address fd00:100::4/64
+    mtu 9000
+    up ip route replace fd00:10:64:ff9b::/96 nexthop via fd00:100::2 dev eth1 nexthop via fd00:100::3 dev eth1
+    down ip route del fd00:10:64:ff9b::/96 || true
+    up ip route replace fd00:10::100/128 via fd00:100::2 dev eth1 metric 1024
+    down ip route del fd00:10::100/128 via fd00:100::2 dev eth1 metric 1024 || true
+    up ip route replace fd00:10::100/128 via fd00:100::3 dev eth1 metric 1025
+    down ip route del fd00:10::100/128 via fd00:100::3 dev eth1 metric 1025 || true
+
+iface eth1 inet static
+    address 10.192.0.4/16
+`
+	actual := lazyjack.CreateIfupdownContents(HelperPersistentNetConfig())
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Ifupdown contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+}
+
+func TestCreateIfupdownContentsNoAddresses(t *testing.T) {
+	p := HelperPersistentNetConfig()
+	p.Addresses = nil
+	p.Routes = p.Routes[1:]
+	expected := `# Generated by lazyjack
+auto eth1
+
+iface eth1 inet6 manual
+    mtu 9000
+    up ip route replace fd00:10::100/128 via fd00:100::2 dev eth1 metric 1024
+    down ip route del fd00:10::100/128 via fd00:100::2 dev eth1 metric 1024 || true
+    up ip route replace fd00:10::100/128 via fd00:100::3 dev eth1 metric 1025
+    down ip route del fd00:10::100/128 via fd00:100::3 dev eth1 metric 1025 || true
+`
+	actual := lazyjack.CreateIfupdownContents(p)
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Ifupdown contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+}
+
+func TestIfupdownExistingStanza(t *testing.T) {
+	etcArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(filepath.Join(etcArea, lazyjack.IfupdownArea), t)
+	defer HelperCleanupArea(etcArea, t)
+
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	c.Mgmt.Info[0] = lazyjack.NetInfo{Prefix: "fd00:100::", Size: 64, Mode: lazyjack.IPv6NetMode}
+	c.General.EtcArea = etcArea
+	c.General.PersistentNet = lazyjack.IfupdownPersistentNet
+	lazyjack.ValidateServerNodes(c)
+	node := c.Topology["minion"]
+	node.Interface = "eth1"
+
+	// Other interfaces, and the file from a previous run, are ignored
+	interfaces := filepath.Join(etcArea, lazyjack.IfupdownInterfacesFile)
+	err := ioutil.WriteFile(interfaces, []byte("source /etc/network/interfaces.d/*\n\nauto lo\niface lo inet loopback\n\niface eth10 inet dhcp\n"), 0644)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create interfaces file for test")
+	}
+	err = lazyjack.CreatePersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create persistent network config: %s", err.Error())
+	}
+	err = lazyjack.CreatePersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to recreate persistent network config: %s", err.Error())
+	}
+	if _, err := os.Stat(lazyjack.PersistentNetFile(&node, c)); err != nil {
+		t.Fatalf("FAILED: Expected persistent network config file: %s", err.Error())
+	}
+
+	other := filepath.Join(etcArea, lazyjack.IfupdownArea, "eth1")
+	err = ioutil.WriteFile(other, []byte("allow-hotplug eth1\niface eth1 inet dhcp\n"), 0644)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create interfaces file for test")
+	}
+	if lazyjack.FindIfupdownStanza("eth1", c) != other {
+		t.Fatalf("FAILED: Expected to find stanza for interface in %s", other)
+	}
+	err = lazyjack.CreatePersistentNetConfig(&node, c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected persistent network config to fail, when interface is already defined")
+	}
+	expected := fmt.Sprintf("interface \"eth1\" is already defined in %s - remove it, or use netplan or networkd persistent network config", other)
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestBuildPersistentNetConfig(t *testing.T) {
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	c.Mgmt.Info[0] = lazyjack.NetInfo{Prefix: "fd00:100::", Size: 64, Mode: lazyjack.IPv6NetMode}
+	c.Pod.MTU = 9000
+	lazyjack.ValidateServerNodes(c)
+
+	node := c.Topology["minion"]
+	node.Interface = "eth1"
+	p, err := lazyjack.BuildPersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to build persistent network config: %s", err.Error())
+	}
+	if len(p.Addresses) != 1 || p.Addresses[0] != "fd00:100::4/64" || p.MTU != 9000 {
+		t.Fatalf("FAILED: Unexpected interface settings %+v", p)
+	}
+	if len(p.Routes) != 5 {
+		t.Fatalf("FAILED: Expected route to DNS64 network and four support network routes, got %+v", p.Routes)
+	}
+	if !p.Routes[0].ECMP || p.Routes[0].Dest != "fd00:10:64:ff9b::/96" || len(p.Routes[0].GWs) != 2 {
+		t.Fatalf("FAILED: Expected ECMP route to DNS64 network, got %+v", p.Routes[0])
+	}
+
+	// Route on NAT64 server uses the support network, so is not persisted
+	node = c.Topology["master"]
+	node.Interface = "eth1"
+	p, err = lazyjack.BuildPersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to build persistent network config: %s", err.Error())
+	}
+	if len(p.Routes) != 2 {
+		t.Fatalf("FAILED: Expected only routes to other server's support network IPs, got %+v", p.Routes)
+	}
+}
+
+func TestCreateAndRemovePersistentNetConfig(t *testing.T) {
+	etcArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(etcArea, t)
+	defer HelperCleanupArea(etcArea, t)
+
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	c.Mgmt.Info[0] = lazyjack.NetInfo{Prefix: "fd00:100::", Size: 64, Mode: lazyjack.IPv6NetMode}
+	c.General.EtcArea = etcArea
+	c.General.PersistentNet = lazyjack.NetworkdPersistentNet
+	lazyjack.ValidateServerNodes(c)
+	node := c.Topology["minion"]
+	node.Interface = "eth1"
+
+	err := lazyjack.CreatePersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create persistent network config: %s", err.Error())
+	}
+	file := filepath.Join(etcArea, lazyjack.NetworkdArea, "10-lazyjack-eth1.network")
+	if file != lazyjack.PersistentNetFile(&node, c) {
+		t.Fatalf("FAILED: Expected file %s, got %s", file, lazyjack.PersistentNetFile(&node, c))
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to read persistent network config: %s", err.Error())
+	}
+	p, _ := lazyjack.BuildPersistentNetConfig(&node, c)
+	if string(contents) != lazyjack.CreateNetworkdContents(p).String() {
+		t.Fatalf("FAILED: Unexpected persistent network config:\n%s", string(contents))
+	}
+
+	err = lazyjack.RemovePersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to remove persistent network config: %s", err.Error())
+	}
+	err = lazyjack.RemovePersistentNetConfig(&node, c)
+	if !lazyjack.IsSkipped(err) {
+		t.Fatalf("FAILED: Expected removal to be skipped, when no file, got %v", err)
+	}
+
+	c.General.PersistentNet = ""
+	err = lazyjack.CreatePersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected nothing to be done, when not enabled: %s", err.Error())
+	}
+	if _, err := os.Stat(file); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected no persistent network config, when not enabled")
+	}
+}
+
+func TestNetworkdDropInForExistingUnit(t *testing.T) {
+	root := TempFileName(os.TempDir(), "-root")
+	unitArea := filepath.Join(root, "/etc", lazyjack.NetworkdArea)
+	libArea := filepath.Join(root, "/usr/lib/systemd/network")
+	HelperSetupArea(unitArea, t)
+	HelperSetupArea(libArea, t)
+	defer HelperCleanupArea(root, t)
+
+	units := map[string]string{
+		filepath.Join(libArea, "05-other.network"):         "[Match]\nName=eth0 eth2\n\n[Network]\nDHCP=yes\n",
+		filepath.Join(libArea, "10-netplan-eth1.network"):  "[Match]\nName=eth1\n",
+		filepath.Join(unitArea, "10-netplan-eth1.network"): "[Match]\nName=eth*\n\n[Network]\nDHCP=yes\n",
+		filepath.Join(unitArea, "20-mac.network"):          "[Match]\nMACAddress=02:00:00:00:00:01\n",
+	}
+	for file, contents := range units {
+		err := ioutil.WriteFile(file, []byte(contents), 0644)
+		if err != nil {
+			t.Fatalf("ERROR: Unable to create %s for test", file)
+		}
+	}
+
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	c.Mgmt.Info[0] = lazyjack.NetInfo{Prefix: "fd00:100::", Size: 64, Mode: lazyjack.IPv6NetMode}
+	c.General.ImageRoot = root
+	c.General.EtcArea = filepath.Join(root, "/etc")
+	c.General.PersistentNet = lazyjack.NetworkdPersistentNet
+	lazyjack.ValidateServerNodes(c)
+	node := c.Topology["minion"]
+	node.Interface = "eth1"
+
+	file := filepath.Join(unitArea, "10-netplan-eth1.network.d", lazyjack.NetworkdDropInFile)
+	if lazyjack.PersistentNetFile(&node, c) != file {
+		t.Fatalf("FAILED: Expected drop-in %s, got %s", file, lazyjack.PersistentNetFile(&node, c))
+	}
+	err := lazyjack.CreatePersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create persistent network config: %s", err.Error())
+	}
+	contents, err := ioutil.ReadFile(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to read drop-in: %s", err.Error())
+	}
+	p, _ := lazyjack.BuildPersistentNetConfig(&node, c)
+	if string(contents) != lazyjack.CreateNetworkdDropInContents(p).String() || strings.Contains(string(contents), "[Match]") {
+		t.Fatalf("FAILED: Unexpected drop-in contents:\n%s", string(contents))
+	}
+
+	err = lazyjack.RemovePersistentNetConfig(&node, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to remove drop-in: %s", err.Error())
+	}
+	if _, err := os.Stat(filepath.Dir(file)); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected drop-in area to be removed")
+	}
+
+	// No unit for the interface, so a .network file is created
+	node.Interface = "ens3"
+	expected := filepath.Join(unitArea, "10-lazyjack-ens3.network")
+	if lazyjack.PersistentNetFile(&node, c) != expected {
+		t.Fatalf("FAILED: Expected %s, got %s", expected, lazyjack.PersistentNetFile(&node, c))
+	}
+}
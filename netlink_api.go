@@ -12,13 +12,20 @@ type NetLinkAPI interface {
 	AddrDel(netlink.Link, *netlink.Addr) error
 	AddrList(netlink.Link, int) ([]netlink.Addr, error)
 	AddrReplace(netlink.Link, *netlink.Addr) error
+	LinkAdd(link netlink.Link) error
 	LinkByName(name string) (netlink.Link, error)
 	LinkList() ([]netlink.Link, error)
 	ParseAddr(string) (*netlink.Addr, error)
 	ParseIPNet(s string) (*net.IPNet, error)
 	RouteAdd(route *netlink.Route) error
 	RouteDel(route *netlink.Route) error
+	RouteList(link netlink.Link, family int) ([]netlink.Route, error)
+	RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error)
+	RouteReplace(route *netlink.Route) error
 	LinkSetDown(link netlink.Link) error
 	LinkDel(link netlink.Link) error
 	LinkSetMTU(link netlink.Link, mtu int) error
+	LinkSetUp(link netlink.Link) error
+	LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error
+	SetPromiscOn(link netlink.Link) error
 }
@@ -28,6 +28,11 @@ func (n *NetLink) AddrReplace(link netlink.Link, addr *netlink.Addr) error {
 	return n.h.AddrReplace(link, addr)
 }
 
+// LinkAdd creates a link
+func (n *NetLink) LinkAdd(link netlink.Link) error {
+	return n.h.LinkAdd(link)
+}
+
 // LinkByName finds a link by name
 func (n *NetLink) LinkByName(name string) (netlink.Link, error) {
 	return n.h.LinkByName(name)
@@ -58,6 +63,22 @@ func (n *NetLink) RouteDel(route *netlink.Route) error {
 	return n.h.RouteDel(route)
 }
 
+// RouteList lists the routes for a link (or all links, if nil)
+func (n *NetLink) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	return n.h.RouteList(link, family)
+}
+
+// RouteListFiltered lists the routes that match the fields of the filter
+// selected by the mask
+func (n *NetLink) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	return n.h.RouteListFiltered(family, filter, filterMask)
+}
+
+// RouteReplace adds a route, or replaces an existing route
+func (n *NetLink) RouteReplace(route *netlink.Route) error {
+	return n.h.RouteReplace(route)
+}
+
 // LinkSetDown brings down an interface
 func (n *NetLink) LinkSetDown(link netlink.Link) error {
 	return n.h.LinkSetDown(link)
@@ -71,3 +92,18 @@ func (n *NetLink) LinkDel(link netlink.Link) error {
 func (n *NetLink) LinkSetMTU(link netlink.Link, mtu int) error {
 	return n.h.LinkSetMTU(link, mtu)
 }
+
+// LinkSetUp brings up an interface
+func (n *NetLink) LinkSetUp(link netlink.Link) error {
+	return n.h.LinkSetUp(link)
+}
+
+// LinkSetHardwareAddr sets the MAC address of an interface
+func (n *NetLink) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error {
+	return n.h.LinkSetHardwareAddr(link, hwaddr)
+}
+
+// SetPromiscOn enables promiscuous mode on an interface
+func (n *NetLink) SetPromiscOn(link netlink.Link) error {
+	return n.h.SetPromiscOn(link)
+}
@@ -1,6 +1,7 @@
 package lazyjack
 
 import (
+	"errors"
 	"fmt"
 	"net"
 
@@ -49,6 +50,19 @@ func (n NetMgr) AddressExistsOnLink(addr *netlink.Addr, link netlink.Link) bool
 	return false
 }
 
+// AddressExists method checks if the IP address is on the interface.
+func (n NetMgr) AddressExists(ip, intf string) (bool, error) {
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return false, fmt.Errorf("unable to find interface %q", intf)
+	}
+	addr, err := n.Server.ParseAddr(ip)
+	if err != nil {
+		return false, fmt.Errorf("malformed address %q", ip)
+	}
+	return n.AddressExistsOnLink(addr, link), nil
+}
+
 // RemoveAddressFromLink method removes an IP addres from an interface.
 func (n NetMgr) RemoveAddressFromLink(ip, intf string) error {
 	link, err := n.Server.LinkByName(intf)
@@ -60,7 +74,7 @@ func (n NetMgr) RemoveAddressFromLink(ip, intf string) error {
 		return fmt.Errorf("malformed address to delete %q", ip)
 	}
 	if !n.AddressExistsOnLink(addr, link) {
-		return fmt.Errorf("skipping - address %q does not exist on interface %q", ip, intf)
+		return notFoundErrorf("skipping - address %q does not exist on interface %q", ip, intf)
 	}
 
 	err = n.Server.AddrDel(link, addr)
@@ -95,7 +109,8 @@ func (n NetMgr) FindLinkIndexForCIDR(cidr string) (int, error) {
 }
 
 // BuildRoute creates a route to the destination, using the provided
-// gateway.
+// gateway. The primary route metric is used, as for the routes via multiple
+// gateways, and the persisted routes.
 func BuildRoute(destStr, gwStr string, index int) (*netlink.Route, error) {
 	_, cidr, err := net.ParseCIDR(destStr)
 	if err != nil {
@@ -105,10 +120,177 @@ func BuildRoute(destStr, gwStr string, index int) (*netlink.Route, error) {
 	if gw == nil {
 		return nil, fmt.Errorf("unable to parse gateway IP %q", gwStr)
 	}
-	route := &netlink.Route{Dst: cidr, Gw: gw, LinkIndex: index}
+	route := &netlink.Route{Dst: cidr, Gw: gw, LinkIndex: index, Priority: PrimaryRouteMetric}
 	return route, nil
 }
 
+// routeFamily provides the netlink family for the route's destination.
+func routeFamily(route *netlink.Route) int {
+	if route.Dst != nil && route.Dst.IP.To4() != nil {
+		return nl.FAMILY_V4
+	}
+	return nl.FAMILY_V6
+}
+
+// sameGateways checks if the installed route has the same gateway(s) as
+// the desired route, including all the next hops for multipath routes.
+func sameGateways(want, have *netlink.Route) bool {
+	if len(want.MultiPath) != len(have.MultiPath) {
+		return false
+	}
+	if len(want.MultiPath) == 0 {
+		return want.Gw.Equal(have.Gw)
+	}
+	for _, w := range want.MultiPath {
+		found := false
+		for _, h := range have.MultiPath {
+			if w.Gw.Equal(h.Gw) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+// routesMatching provides the installed routes to the destination, that
+// use the link and gateway, when specified (non-zero index, and non-nil
+// gateway).
+func (n NetMgr) routesMatching(dst *net.IPNet, gw net.IP, index int) ([]netlink.Route, error) {
+	filter := &netlink.Route{Dst: dst, Gw: gw, LinkIndex: index}
+	mask := uint64(netlink.RT_FILTER_DST)
+	if gw != nil {
+		mask |= netlink.RT_FILTER_GW
+	}
+	if index != 0 {
+		mask |= netlink.RT_FILTER_OIF
+	}
+	routes, err := n.Server.RouteListFiltered(routeFamily(filter), filter, mask)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list routes to %s: %v", dst, err)
+	}
+	glog.V(4).Infof("Found %d installed route(s) to %s (gateway %v, link index %d)", len(routes), dst, gw, index)
+	return routes, nil
+}
+
+// routeInfo provides the destination and gateway(s) of the route.
+func routeInfo(r netlink.Route) RouteInfo {
+	info := RouteInfo{Dest: r.Dst.String()}
+	if r.Gw != nil {
+		info.GWs = append(info.GWs, r.Gw.String())
+	}
+	for _, hop := range r.MultiPath {
+		info.GWs = append(info.GWs, hop.Gw.String())
+	}
+	return info
+}
+
+// RoutesInstalled method checks if all of the routes are in the routing
+// table, with the same destination, link (if specified), and gateway(s).
+func (n NetMgr) RoutesInstalled(routes []*netlink.Route) (bool, error) {
+	for _, want := range routes {
+		installed, err := n.routesMatching(want.Dst, nil, want.LinkIndex)
+		if err != nil {
+			return false, err
+		}
+		found := false
+		for i := range installed {
+			if sameGateways(want, &installed[i]) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// ListRoutesUsingInterfaceName method provides the routes, with a
+// destination and gateway, that use the local interface (for all IP
+// families).
+func (n NetMgr) ListRoutesUsingInterfaceName(intf string) ([]RouteInfo, error) {
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find interface %q", intf)
+	}
+	installed, err := n.Server.RouteList(link, nl.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list routes for interface %q: %v", intf, err)
+	}
+	var routes []RouteInfo
+	for _, r := range installed {
+		if r.Dst == nil {
+			continue
+		}
+		if info := routeInfo(r); len(info.GWs) > 0 {
+			routes = append(routes, info)
+		}
+	}
+	return routes, nil
+}
+
+// ListRoutesMatching method provides the installed routes to the
+// destination, that use the local interface. If a gateway is specified,
+// only routes via that gateway are provided.
+func (n NetMgr) ListRoutesMatching(dest, gw, intf string) ([]RouteInfo, error) {
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find interface %q", intf)
+	}
+	_, cidr, err := net.ParseCIDR(dest)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse destination CIDR %q: %v", dest, err)
+	}
+	var gwIP net.IP
+	if gw != "" {
+		if gwIP = net.ParseIP(gw); gwIP == nil {
+			return nil, fmt.Errorf("unable to parse gateway IP %q", gw)
+		}
+	}
+	installed, err := n.routesMatching(cidr, gwIP, link.Attrs().Index)
+	if err != nil {
+		return nil, err
+	}
+	var routes []RouteInfo
+	for _, r := range installed {
+		routes = append(routes, routeInfo(r))
+	}
+	return routes, nil
+}
+
+// RouteExistsUsingSupportNetInterface method checks if the route to the
+// destination, that uses the support network CIDR, is installed.
+func (n NetMgr) RouteExistsUsingSupportNetInterface(dest, gw, supportNetCIDR string) (bool, error) {
+	index, err := n.FindLinkIndexForCIDR(supportNetCIDR)
+	if err != nil {
+		return false, err
+	}
+	route, err := BuildRoute(dest, gw, index)
+	if err != nil {
+		return false, err
+	}
+	return n.RoutesInstalled([]*netlink.Route{route})
+}
+
+// RoutesExist method checks if the route(s) to the destination, via the
+// gateway(s), that use the local interface, are installed.
+func (n NetMgr) RoutesExist(dest string, gws []string, intf, routing string) (bool, error) {
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return false, fmt.Errorf("unable to find interface %q", intf)
+	}
+	routes, err := BuildRoutesForGateways(dest, gws, link.Attrs().Index, routing)
+	if err != nil {
+		return false, err
+	}
+	return n.RoutesInstalled(routes)
+}
+
 // AddRouteUsingSupportNetInterface method adds a route to the destination
 // using the gateway and support network CIDR.
 func (n NetMgr) AddRouteUsingSupportNetInterface(dest, gw, supportNetCIDR string) error {
@@ -121,7 +303,7 @@ func (n NetMgr) AddRouteUsingSupportNetInterface(dest, gw, supportNetCIDR string
 	if err != nil {
 		return err
 	}
-	return n.Server.RouteAdd(route)
+	return classifyNetlinkError(n.Server.RouteAdd(route))
 }
 
 // DeleteRouteUsingSupportNetInterface method removes the route to the
@@ -136,7 +318,7 @@ func (n NetMgr) DeleteRouteUsingSupportNetInterface(dest, gw, supportNetCIDR str
 	if err != nil {
 		return err
 	}
-	return n.Server.RouteDel(route)
+	return n.deleteRoute(route)
 }
 
 // AddRouteUsingInterfaceName method adds a route to the destination,
@@ -152,7 +334,7 @@ func (n NetMgr) AddRouteUsingInterfaceName(dest, gw, intf string) error {
 	if err != nil {
 		return err
 	}
-	return n.Server.RouteAdd(route)
+	return classifyNetlinkError(n.Server.RouteAdd(route))
 }
 
 // DeleteRouteUsingInterfaceName method removes the route to the destination
@@ -161,14 +343,158 @@ func (n NetMgr) DeleteRouteUsingInterfaceName(dest, gw, intf string) error {
 	glog.V(4).Infof("Deleting route for %s via %s using interface %s", dest, gw, intf)
 	link, err := n.Server.LinkByName(intf)
 	if err != nil {
-		return fmt.Errorf("skipping - Unable to find interface %q to delete route", intf)
+		return notFoundErrorf("skipping - Unable to find interface %q to delete route", intf)
 	}
 	index := link.Attrs().Index
 	route, err := BuildRoute(dest, gw, index)
 	if err != nil {
 		return err
 	}
-	return n.Server.RouteDel(route)
+	return n.deleteRoute(route)
+}
+
+// BuildRoutesForGateways creates the route(s) to the destination, using
+// the provided gateways. For ECMP routing, a single multipath route is
+// created. Otherwise, there is a route for each gateway, with the first
+// being the primary, and the others being backups, with higher metrics.
+func BuildRoutesForGateways(destStr string, gwStrs []string, index int, routing string) ([]*netlink.Route, error) {
+	_, cidr, err := net.ParseCIDR(destStr)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse destination CIDR %q: %v", destStr, err)
+	}
+	var routes []*netlink.Route
+	var nexthops []*netlink.NexthopInfo
+	for i, gwStr := range gwStrs {
+		gw := net.ParseIP(gwStr)
+		if gw == nil {
+			return nil, fmt.Errorf("unable to parse gateway IP %q", gwStr)
+		}
+		if routing == ECMPRouting {
+			nexthops = append(nexthops, &netlink.NexthopInfo{LinkIndex: index, Gw: gw})
+		} else {
+			routes = append(routes, &netlink.Route{Dst: cidr, Gw: gw, LinkIndex: index, Priority: PrimaryRouteMetric + i})
+		}
+	}
+	if routing == ECMPRouting {
+		routes = append(routes, &netlink.Route{Dst: cidr, MultiPath: nexthops, Priority: PrimaryRouteMetric})
+	}
+	return routes, nil
+}
+
+// AddRoutesUsingInterfaceName method adds route(s) to the destination, via
+// multiple gateways, using the local interface. If all routes already
+// exist, an ErrAlreadyExists error is returned.
+func (n NetMgr) AddRoutesUsingInterfaceName(dest string, gws []string, intf, routing string) error {
+	glog.V(4).Infof("Adding %s route(s) for %s via %v using interface %s", routing, dest, gws, intf)
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return fmt.Errorf("unable to find interface %q", intf)
+	}
+	routes, err := BuildRoutesForGateways(dest, gws, link.Attrs().Index, routing)
+	if err != nil {
+		return err
+	}
+	var exists error
+	added := 0
+	for _, route := range routes {
+		err = classifyNetlinkError(n.Server.RouteAdd(route))
+		if err == nil {
+			added++
+		} else if errors.Is(err, ErrAlreadyExists) {
+			exists = err
+		} else {
+			return err
+		}
+	}
+	if added == 0 {
+		return exists
+	}
+	return nil
+}
+
+// DeleteRoutesUsingInterfaceName method removes the route(s) to the
+// destination, via multiple gateways, that use the local interface.
+func (n NetMgr) DeleteRoutesUsingInterfaceName(dest string, gws []string, intf, routing string) error {
+	glog.V(4).Infof("Deleting %s route(s) for %s via %v using interface %s", routing, dest, gws, intf)
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return notFoundErrorf("skipping - Unable to find interface %q to delete route", intf)
+	}
+	routes, err := BuildRoutesForGateways(dest, gws, link.Attrs().Index, routing)
+	if err != nil {
+		return err
+	}
+	var failed error
+	for _, route := range routes {
+		if err = n.deleteRoute(route); err != nil && failed == nil {
+			failed = err
+		}
+	}
+	return failed
+}
+
+// deleteRoute removes the installed route(s) with the destination, link,
+// and gateway(s) of the route, as they are listed, so that the metric and
+// next hops need not match. If none are listed, the route is deleted as
+// is, and netlink reports whether it exists.
+func (n NetMgr) deleteRoute(want *netlink.Route) error {
+	installed, err := n.routesMatching(want.Dst, want.Gw, want.LinkIndex)
+	if err != nil {
+		return err
+	}
+	deleted := 0
+	for i := range installed {
+		have := &installed[i]
+		if !sameGateways(want, have) {
+			continue
+		}
+		glog.V(4).Infof("Deleting installed route %s", have)
+		if err = classifyNetlinkError(n.Server.RouteDel(have)); err != nil {
+			return err
+		}
+		deleted++
+	}
+	if deleted == 0 {
+		return classifyNetlinkError(n.Server.RouteDel(want))
+	}
+	return nil
+}
+
+// ReplaceRouteUsingInterfaceName method adds a route to the destination,
+// using the local interface, replacing any installed route to the
+// destination with the same metric (e.g. via a stale gateway).
+func (n NetMgr) ReplaceRouteUsingInterfaceName(dest, gw, intf string) error {
+	glog.V(4).Infof("Replacing route for %s via %s using interface %s", dest, gw, intf)
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return fmt.Errorf("unable to find interface %q", intf)
+	}
+	route, err := BuildRoute(dest, gw, link.Attrs().Index)
+	if err != nil {
+		return err
+	}
+	return n.Server.RouteReplace(route)
+}
+
+// ReplaceRoutesUsingInterfaceName method adds route(s) to the destination,
+// via multiple gateways, using the local interface, replacing any installed
+// routes to the destination with the same metrics.
+func (n NetMgr) ReplaceRoutesUsingInterfaceName(dest string, gws []string, intf, routing string) error {
+	glog.V(4).Infof("Replacing %s route(s) for %s via %v using interface %s", routing, dest, gws, intf)
+	link, err := n.Server.LinkByName(intf)
+	if err != nil {
+		return fmt.Errorf("unable to find interface %q", intf)
+	}
+	routes, err := BuildRoutesForGateways(dest, gws, link.Attrs().Index, routing)
+	if err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if err = n.Server.RouteReplace(route); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
 // BringLinkDown method shuts down the link specified.
@@ -201,6 +527,15 @@ func (n NetMgr) DeleteLink(name string) error {
 	return nil
 }
 
+// LinkMTU method obtains the MTU of the link.
+func (n NetMgr) LinkMTU(name string) (int, error) {
+	link, err := n.Server.LinkByName(name)
+	if err != nil {
+		return 0, fmt.Errorf("unable to find interface %q", name)
+	}
+	return link.Attrs().MTU, nil
+}
+
 // SetLinkMTU method sets the MTU on the link.
 func (n NetMgr) SetLinkMTU(name string, mtu int) error {
 	glog.V(4).Infof("Setting MTU to %d on interface %q", mtu, name)
@@ -235,3 +570,107 @@ func (n NetMgr) RemoveBridge(name string) error {
 	}
 	return fmt.Errorf("unable to bring link down (%v), nor remove link (%v)", err, err2)
 }
+
+// EnsureBridge method creates the bridge, if it does not exist, and makes
+// sure that it has the MTU (if non-zero), the MAC address (if specified),
+// promiscuous mode (if enabled), and is up.
+func (n NetMgr) EnsureBridge(name string, mtu int, mac string, promisc bool) error {
+	var hwAddr net.HardwareAddr
+	var err error
+	if mac != "" {
+		hwAddr, err = net.ParseMAC(mac)
+		if err != nil {
+			return fmt.Errorf("invalid MAC address %q for bridge %q: %v", mac, name, err)
+		}
+	}
+	link, err := n.Server.LinkByName(name)
+	if _, ok := err.(netlink.LinkNotFoundError); ok {
+		attrs := netlink.NewLinkAttrs()
+		attrs.Name = name
+		attrs.MTU = mtu
+		attrs.HardwareAddr = hwAddr
+		err = n.Server.LinkAdd(&netlink.Bridge{LinkAttrs: attrs})
+		if err != nil {
+			return fmt.Errorf("unable to create bridge %q: %v", name, err)
+		}
+		glog.V(1).Infof("Created bridge %q", name)
+		link, err = n.Server.LinkByName(name)
+	}
+	if err != nil {
+		return fmt.Errorf("unable to find interface %q", name)
+	}
+	if link.Type() != "bridge" {
+		return fmt.Errorf("interface %q exists, but is not a bridge (%s)", name, link.Type())
+	}
+	if mtu != 0 && link.Attrs().MTU != mtu {
+		err = n.Server.LinkSetMTU(link, mtu)
+		if err != nil {
+			return fmt.Errorf("unable to set MTU on bridge %q: %v", name, err)
+		}
+	}
+	if hwAddr != nil && link.Attrs().HardwareAddr.String() != hwAddr.String() {
+		err = n.Server.LinkSetHardwareAddr(link, hwAddr)
+		if err != nil {
+			return fmt.Errorf("unable to set MAC address on bridge %q: %v", name, err)
+		}
+	}
+	if promisc && link.Attrs().Promisc == 0 {
+		err = n.Server.SetPromiscOn(link)
+		if err != nil {
+			return fmt.Errorf("unable to set promiscuous mode on bridge %q: %v", name, err)
+		}
+	}
+	err = n.Server.LinkSetUp(link)
+	if err != nil {
+		return fmt.Errorf("unable to bring up bridge %q: %v", name, err)
+	}
+	glog.V(4).Infof("Bridge %q is up", name)
+	return nil
+}
+
+// LinkAddresses method provides the IP addresses (with prefix length) on
+// the link, for all IP families.
+func (n NetMgr) LinkAddresses(name string) ([]string, error) {
+	link, err := n.Server.LinkByName(name)
+	if err != nil {
+		return nil, fmt.Errorf("unable to find interface %q", name)
+	}
+	addrs, err := n.Server.AddrList(link, nl.FAMILY_ALL)
+	if err != nil {
+		return nil, fmt.Errorf("unable to list addresses on interface %q: %v", name, err)
+	}
+	var ips []string
+	for _, addr := range addrs {
+		ips = append(ips, addr.IPNet.String())
+	}
+	return ips, nil
+}
+
+// DeleteVethsOnBridge method removes any veth interfaces that are still
+// attached to the bridge (e.g. from pods that were not torn down), and
+// provides the number removed. Removing the bridge end of the veth pair,
+// removes the pod end as well.
+func (n NetMgr) DeleteVethsOnBridge(name string) (int, error) {
+	bridge, err := n.Server.LinkByName(name)
+	if err != nil {
+		glog.V(4).Infof("Skipping - no bridge %q with veths to remove", name)
+		return 0, nil
+	}
+	links, err := n.Server.LinkList()
+	if err != nil {
+		return 0, fmt.Errorf("unable to list interfaces: %v", err)
+	}
+	removed := 0
+	for _, link := range links {
+		if link.Type() != "veth" || link.Attrs().MasterIndex != bridge.Attrs().Index {
+			continue
+		}
+		err = n.Server.LinkDel(link)
+		if err != nil {
+			return removed, fmt.Errorf("unable to delete veth %q on bridge %q: %v", link.Attrs().Name, name, err)
+		}
+		glog.V(4).Infof("Deleted veth %q on bridge %q", link.Attrs().Name, name)
+		removed++
+	}
+	return removed, nil
+}
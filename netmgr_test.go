@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"net"
 	"strconv"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/pmichali/lazyjack"
@@ -23,10 +25,18 @@ type mockNetLink struct {
 	simRouteExists   bool
 	simRouteDelFail  bool
 	simNoRoute       bool
+	simRouteListFail bool
+	simRouteReplFail bool
 	simSetDownFail   bool
 	simLinkDelFail   bool
 	simSetMTUFail    bool
+	simNoLink        bool
+	simLinkAddFail   bool
+	simSetUpFail     bool
 	callCount        int
+	routes           []*netlink.Route
+	links            []netlink.Link
+	linkAddrs        map[int][]netlink.Addr
 }
 
 func (m *mockNetLink) ResetCallCount() {
@@ -75,6 +85,12 @@ func (m *mockNetLink) AddrList(link netlink.Link, family int) ([]netlink.Addr, e
 		addr, _ = netlink.ParseAddr(fmt.Sprintf("2001:db8:20::%x/64", link.Attrs().Index))
 		addrList = append(addrList, *addr)
 	}
+	// Addresses that were added to the link
+	for _, a := range m.linkAddrs[link.Attrs().Index] {
+		if family == nl.FAMILY_ALL || (family == nl.FAMILY_V4) == (a.IP.To4() != nil) {
+			addrList = append(addrList, a)
+		}
+	}
 	return addrList, nil
 }
 
@@ -86,6 +102,23 @@ func (m *mockNetLink) AddrReplace(link netlink.Link, addr *netlink.Addr) error {
 		return fmt.Errorf("mock failure to replace second address")
 	}
 	m.Called()
+	if addr != nil {
+		if m.linkAddrs == nil {
+			m.linkAddrs = map[int][]netlink.Addr{}
+		}
+		index := link.Attrs().Index
+		m.linkAddrs[index] = append(m.linkAddrs[index], *addr)
+	}
+	return nil
+}
+
+func (m *mockNetLink) LinkAdd(link netlink.Link) error {
+	if m.simLinkAddFail {
+		return fmt.Errorf("mock failure to add link")
+	}
+	m.Called()
+	m.links = append(m.links, link)
+	m.simNoLink = false
 	return nil
 }
 
@@ -93,10 +126,25 @@ func (m *mockNetLink) LinkByName(name string) (netlink.Link, error) {
 	if m.simLookupFail {
 		return nil, fmt.Errorf("mock failure to find link")
 	}
+	for _, link := range m.links {
+		if link.Attrs().Name == name {
+			return link, nil
+		}
+	}
+	if m.simNoLink {
+		return nil, netlink.LinkNotFoundError{}
+	}
 	// Calc index based on interface name, using last digit * 16.
-	// For example "eth2" -> 2*16 = 0x20.
-	link := &netlink.Device{}
+	// For example "eth2" -> 2*16 = 0x20. Names starting with "br" are
+	// bridges.
 	idx, _ := strconv.Atoi(name[len(name)-1:])
+	if strings.HasPrefix(name, "br") {
+		bridge := &netlink.Bridge{}
+		bridge.Name = name
+		bridge.Index = idx * 16
+		return bridge, nil
+	}
+	link := &netlink.Device{}
 	link.Index = idx * 16
 	return link, nil
 }
@@ -111,7 +159,7 @@ func (m *mockNetLink) LinkList() ([]netlink.Link, error) {
 	linkA.Index = 0x20
 	linkB := &netlink.Device{}
 	linkB.Index = 0x30
-	return []netlink.Link{linkA, linkB}, nil
+	return append([]netlink.Link{linkA, linkB}, m.links...), nil
 }
 
 func (m *mockNetLink) ParseAddr(s string) (*netlink.Addr, error) {
@@ -130,9 +178,15 @@ func (m *mockNetLink) RouteAdd(route *netlink.Route) error {
 		return fmt.Errorf("mock failure adding route")
 	}
 	if m.simRouteExists {
-		return fmt.Errorf("file exists")
+		return syscall.EEXIST
+	}
+	for _, r := range m.routes {
+		if r.Dst != nil && route.Dst != nil && r.Dst.String() == route.Dst.String() && r.Gw.Equal(route.Gw) && len(route.MultiPath) == 0 {
+			return syscall.EEXIST
+		}
 	}
 	m.Called()
+	m.routes = append(m.routes, route)
 	return nil
 }
 
@@ -141,9 +195,74 @@ func (m *mockNetLink) RouteDel(route *netlink.Route) error {
 		return fmt.Errorf("mock failure deleting route")
 	}
 	if m.simNoRoute {
-		return fmt.Errorf("no such process")
+		return syscall.ESRCH
+	}
+	m.Called()
+	for i, r := range m.routes {
+		if r.Dst != nil && route.Dst != nil && r.Dst.String() == route.Dst.String() && r.Gw.Equal(route.Gw) {
+			m.routes = append(m.routes[:i], m.routes[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (m *mockNetLink) RouteList(link netlink.Link, family int) ([]netlink.Route, error) {
+	var routes []netlink.Route
+	for _, r := range m.routes {
+		routes = append(routes, *r)
+	}
+	return routes, nil
+}
+
+func (m *mockNetLink) RouteListFiltered(family int, filter *netlink.Route, filterMask uint64) ([]netlink.Route, error) {
+	if m.simRouteListFail {
+		return nil, fmt.Errorf("mock failure listing routes")
+	}
+	var routes []netlink.Route
+	for _, r := range m.routes {
+		switch {
+		case filterMask&netlink.RT_FILTER_DST != 0 && (r.Dst == nil || r.Dst.String() != filter.Dst.String()):
+			continue
+		case filterMask&netlink.RT_FILTER_GW != 0 && !r.Gw.Equal(filter.Gw):
+			continue
+		case filterMask&netlink.RT_FILTER_OIF != 0 && r.LinkIndex != filter.LinkIndex:
+			continue
+		}
+		routes = append(routes, *r)
+	}
+	return routes, nil
+}
+
+func (m *mockNetLink) RouteReplace(route *netlink.Route) error {
+	if m.simRouteReplFail {
+		return fmt.Errorf("mock failure replacing route")
 	}
 	m.Called()
+	for i, r := range m.routes {
+		if r.Dst != nil && route.Dst != nil && r.Dst.String() == route.Dst.String() && r.Priority == route.Priority {
+			m.routes[i] = route
+			return nil
+		}
+	}
+	m.routes = append(m.routes, route)
+	return nil
+}
+
+func (m *mockNetLink) LinkSetUp(link netlink.Link) error {
+	if m.simSetUpFail {
+		return fmt.Errorf("mock failure set link up")
+	}
+	return nil
+}
+
+func (m *mockNetLink) LinkSetHardwareAddr(link netlink.Link, hwaddr net.HardwareAddr) error {
+	link.Attrs().HardwareAddr = hwaddr
+	return nil
+}
+
+func (m *mockNetLink) SetPromiscOn(link netlink.Link) error {
+	link.Attrs().Promisc = 1
 	return nil
 }
 
@@ -158,6 +277,12 @@ func (m *mockNetLink) LinkDel(link netlink.Link) error {
 	if m.simLinkDelFail {
 		return fmt.Errorf("mock failure link delete")
 	}
+	for i, l := range m.links {
+		if l == link {
+			m.links = append(m.links[:i], m.links[i+1:]...)
+			break
+		}
+	}
 	return nil
 }
 
@@ -381,6 +506,9 @@ func TestBuildRoute(t *testing.T) {
 	if r.LinkIndex != expectedIdx {
 		t.Errorf("FAILED: Route gateway wrong. Expected %d, got %d", expectedIdx, r.LinkIndex)
 	}
+	if r.Priority != lazyjack.PrimaryRouteMetric {
+		t.Errorf("FAILED: Route metric wrong. Expected %d, got %d", lazyjack.PrimaryRouteMetric, r.Priority)
+	}
 }
 
 func TestFailedParseCIDRBuildRoute(t *testing.T) {
@@ -752,3 +880,219 @@ func TestFailedAllRemoveBridge(t *testing.T) {
 		t.Fatalf("FAILED: Expected msg to start with %q, got %q", expected, err.Error())
 	}
 }
+
+func TestBuildRoutesForGateways(t *testing.T) {
+	gws := []string{"fd00:100::2", "fd00:100::3"}
+	routes, err := lazyjack.BuildRoutesForGateways("fd00:10:64:ff9b::/96", gws, 5, lazyjack.ECMPRouting)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to build ECMP route: %s", err.Error())
+	}
+	if len(routes) != 1 || len(routes[0].MultiPath) != 2 {
+		t.Fatalf("FAILED: Expected one route with two next hops, got %v", routes)
+	}
+	if routes[0].Priority != lazyjack.PrimaryRouteMetric {
+		t.Errorf("FAILED: Expected multipath route with metric %d, got %d", lazyjack.PrimaryRouteMetric, routes[0].Priority)
+	}
+	for i, nh := range routes[0].MultiPath {
+		if nh.Gw.String() != gws[i] || nh.LinkIndex != 5 {
+			t.Errorf("FAILED: Expected next hop %s on link 5, got %s on link %d", gws[i], nh.Gw.String(), nh.LinkIndex)
+		}
+	}
+
+	routes, err = lazyjack.BuildRoutesForGateways("fd00:10:64:ff9b::/96", gws, 5, lazyjack.PrimaryBackupRouting)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to build primary/backup routes: %s", err.Error())
+	}
+	if len(routes) != 2 {
+		t.Fatalf("FAILED: Expected two routes, got %v", routes)
+	}
+	if routes[0].Gw.String() != gws[0] || routes[0].Priority != lazyjack.PrimaryRouteMetric {
+		t.Errorf("FAILED: Expected primary route via %s, with metric %d, got %v", gws[0], lazyjack.PrimaryRouteMetric, routes[0])
+	}
+	if routes[1].Gw.String() != gws[1] || routes[1].Priority <= routes[0].Priority {
+		t.Errorf("FAILED: Expected backup route via %s, with higher metric, got %v", gws[1], routes[1])
+	}
+
+	_, err = lazyjack.BuildRoutesForGateways("fd00:10:64:ff9b::/96", []string{"bad-ip"}, 5, lazyjack.ECMPRouting)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure with bad gateway")
+	}
+}
+
+func TestAddRoutesUsingInterfaceName(t *testing.T) {
+	nm := lazyjack.NetMgr{Server: &mockNetLink{}}
+	err := nm.AddRoutesUsingInterfaceName("fd00:10:64:ff9b::/96", []string{"fd00:100::2", "fd00:100::3"}, "eth1", lazyjack.PrimaryBackupRouting)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add routes: %s", err.Error())
+	}
+	if nm.Server.(*mockNetLink).CallCount() != 2 {
+		t.Fatalf("FAILED: Expected two routes to be added")
+	}
+
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simRouteExists: true}}
+	err = nm.AddRoutesUsingInterfaceName("fd00:10:64:ff9b::/96", []string{"fd00:100::2", "fd00:100::3"}, "eth1", lazyjack.ECMPRouting)
+	if err == nil || err.Error() != "file exists" {
+		t.Fatalf("FAILED: Expected route to exist, got %v", err)
+	}
+
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simRouteDelFail: true}}
+	err = nm.DeleteRoutesUsingInterfaceName("fd00:10:64:ff9b::/96", []string{"fd00:100::2", "fd00:100::3"}, "eth1", lazyjack.PrimaryBackupRouting)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure deleting routes")
+	}
+}
+
+func TestListRoutesUsingInterfaceName(t *testing.T) {
+	nl := &mockNetLink{}
+	nm := lazyjack.NetMgr{Server: nl}
+	err := nm.AddRouteUsingInterfaceName("fd00:40:0:0:20::/80", "fd00:100::20", "eth1")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add route: %s", err.Error())
+	}
+	err = nm.AddRoutesUsingInterfaceName("fd00:10:64:ff9b::/96", []string{"fd00:100::2", "fd00:100::3"}, "eth1", lazyjack.ECMPRouting)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add multipath route: %s", err.Error())
+	}
+	routes, err := nm.ListRoutesUsingInterfaceName("eth1")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to list routes: %s", err.Error())
+	}
+	var actual []string
+	for _, r := range routes {
+		actual = append(actual, r.Dest+" via "+strings.Join(r.GWs, ","))
+	}
+	expected := "fd00:40:0:0:20::/80 via fd00:100::20, fd00:10:64:ff9b::/96 via fd00:100::2,fd00:100::3"
+	if strings.Join(actual, ", ") != expected {
+		t.Fatalf("FAILED: Expected routes %q, got %q", expected, strings.Join(actual, ", "))
+	}
+
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simLookupFail: true}}
+	_, err = nm.ListRoutesUsingInterfaceName("eth1")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure for unknown interface")
+	}
+}
+
+func TestListRoutesMatching(t *testing.T) {
+	nl := &mockNetLink{}
+	nm := lazyjack.NetMgr{Server: nl}
+	err := nm.AddRoutesUsingInterfaceName("fd00:10::/64", []string{"fd00:100::2", "fd00:100::3"}, "eth1", lazyjack.PrimaryBackupRouting)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add routes: %s", err.Error())
+	}
+	err = nm.AddRouteUsingInterfaceName("fd00:10::/64", "fd00:200::2", "eth2")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add route on other interface: %s", err.Error())
+	}
+	routes, err := nm.ListRoutesMatching("fd00:10::/64", "", "eth1")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to list routes: %s", err.Error())
+	}
+	if len(routes) != 2 {
+		t.Fatalf("FAILED: Expected primary and backup routes on interface, got %+v", routes)
+	}
+	routes, err = nm.ListRoutesMatching("fd00:10::/64", "fd00:100::3", "eth1")
+	if err != nil || len(routes) != 1 || routes[0].GWs[0] != "fd00:100::3" {
+		t.Fatalf("FAILED: Expected only route via gateway, got %+v (%v)", routes, err)
+	}
+	routes, err = nm.ListRoutesMatching("fd00:20::/64", "", "eth1")
+	if err != nil || len(routes) != 0 {
+		t.Fatalf("FAILED: Expected no routes to other destination, got %+v (%v)", routes, err)
+	}
+
+	_, err = nm.ListRoutesMatching("fd00:10::/64", "bad-gw", "eth1")
+	expected := "unable to parse gateway IP \"bad-gw\""
+	if err == nil || err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %v", expected, err)
+	}
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simRouteListFail: true}}
+	_, err = nm.ListRoutesMatching("fd00:10::/64", "", "eth1")
+	expected = "unable to list routes to fd00:10::/64: mock failure listing routes"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestReplaceRoutesUsingInterfaceName(t *testing.T) {
+	nl := &mockNetLink{}
+	nm := lazyjack.NetMgr{Server: nl}
+	err := nm.AddRouteUsingInterfaceName("fd00:40:0:0:20::/80", "fd00:100::99", "eth1")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add route: %s", err.Error())
+	}
+	err = nm.ReplaceRouteUsingInterfaceName("fd00:40:0:0:20::/80", "fd00:100::20", "eth1")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to replace route: %s", err.Error())
+	}
+	routes, _ := nm.ListRoutesMatching("fd00:40:0:0:20::/80", "", "eth1")
+	if len(routes) != 1 || routes[0].GWs[0] != "fd00:100::20" {
+		t.Fatalf("FAILED: Expected route via new gateway only, got %+v", routes)
+	}
+
+	gws := []string{"fd00:100::2", "fd00:100::3"}
+	err = nm.ReplaceRoutesUsingInterfaceName("fd00:10::/64", gws, "eth1", lazyjack.PrimaryBackupRouting)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to replace routes: %s", err.Error())
+	}
+	present, _ := nm.RoutesExist("fd00:10::/64", gws, "eth1", lazyjack.PrimaryBackupRouting)
+	if !present {
+		t.Fatalf("FAILED: Expected primary and backup routes to be installed")
+	}
+
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simRouteReplFail: true}}
+	err = nm.ReplaceRoutesUsingInterfaceName("fd00:10::/64", gws, "eth1", lazyjack.ECMPRouting)
+	expected := "mock failure replacing route"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %v", expected, err)
+	}
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simLookupFail: true}}
+	err = nm.ReplaceRouteUsingInterfaceName("fd00:10::/64", gws[0], "eth1")
+	expected = "unable to find interface \"eth1\""
+	if err == nil || err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %v", expected, err)
+	}
+}
+
+func TestDeleteInstalledRouteWithMetric(t *testing.T) {
+	nl := &mockNetLink{}
+	nm := lazyjack.NetMgr{Server: nl}
+	// Backup route, installed with a higher metric
+	err := nm.AddRoutesUsingInterfaceName("fd00:10::/64", []string{"fd00:100::2", "fd00:100::3"}, "eth1", lazyjack.PrimaryBackupRouting)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add routes: %s", err.Error())
+	}
+	err = nm.DeleteRouteUsingInterfaceName("fd00:10::/64", "fd00:100::3", "eth1")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to delete route: %s", err.Error())
+	}
+	routes, _ := nm.ListRoutesMatching("fd00:10::/64", "", "eth1")
+	if len(routes) != 1 || routes[0].GWs[0] != "fd00:100::2" {
+		t.Fatalf("FAILED: Expected only primary route to remain, got %+v", routes)
+	}
+}
+
+func TestEnsureBridge(t *testing.T) {
+	nm := lazyjack.NetMgr{Server: &mockNetLink{}}
+	err := nm.EnsureBridge("br0", 1500, "", false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected existing bridge to be ok: %s", err.Error())
+	}
+
+	err = nm.EnsureBridge("eth1", 1500, "", false)
+	expected := "interface \"eth1\" exists, but is not a bridge (device)"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %v", expected, err)
+	}
+
+	err = nm.EnsureBridge("br0", 1500, "not-a-mac", false)
+	if err == nil || !strings.HasPrefix(err.Error(), "invalid MAC address \"not-a-mac\" for bridge \"br0\"") {
+		t.Fatalf("FAILED: Expected invalid MAC address error, got %v", err)
+	}
+
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simSetUpFail: true}}
+	err = nm.EnsureBridge("br0", 0, "", false)
+	expected = "unable to bring up bridge \"br0\": mock failure set link up"
+	if err == nil || err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %v", expected, err)
+	}
+}
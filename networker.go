@@ -7,17 +7,37 @@ import (
 // Networker interface describes the API for networking operations
 type Networker interface {
 	AddAddressToLink(ip, intf string) error
+	AddressExists(ip, intf string) (bool, error)
 	RemoveAddressFromLink(ip, intf string) error
+	RouteExistsUsingSupportNetInterface(dest, gw, supportNetCIDR string) (bool, error)
+	RoutesExist(dest string, gws []string, intf, routing string) (bool, error)
 	AddRouteUsingSupportNetInterface(dest, gw, supportNetCIDR string) error
 	DeleteRouteUsingSupportNetInterface(dest, gw, supportNetCIDR string) error
 	AddRouteUsingInterfaceName(dest, gw, intf string) error
 	DeleteRouteUsingInterfaceName(dest, gw, intf string) error
+	AddRoutesUsingInterfaceName(dest string, gws []string, intf, routing string) error
+	DeleteRoutesUsingInterfaceName(dest string, gws []string, intf, routing string) error
+	ListRoutesUsingInterfaceName(intf string) ([]RouteInfo, error)
+	ListRoutesMatching(dest, gw, intf string) ([]RouteInfo, error)
+	ReplaceRouteUsingInterfaceName(dest, gw, intf string) error
+	ReplaceRoutesUsingInterfaceName(dest string, gws []string, intf, routing string) error
 	BringLinkDown(name string) error
 	DeleteLink(name string) error
 	RemoveBridge(name string) error
+	EnsureBridge(name string, mtu int, mac string, promisc bool) error
+	LinkAddresses(name string) ([]string, error)
+	DeleteVethsOnBridge(name string) (int, error)
+	LinkMTU(name string) (int, error)
 	SetLinkMTU(name string, mtu int) error
 }
 
+// RouteInfo describes an installed route, with the gateway(s) for each of
+// the next hops.
+type RouteInfo struct {
+	Dest string
+	GWs  []string
+}
+
 // BuildNodeCIDR helper constructs a node CIDR. The network portion
 // of the CIDR (the prefix), has the node added as the last part of
 // the final address. For example, fd00:20::/64 -> fd00:20::3/64
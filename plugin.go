@@ -1,8 +1,10 @@
 package lazyjack
 
 import (
+	"errors"
 	"fmt"
 	"io"
+	"sort"
 	"strings"
 
 	"github.com/golang/glog"
@@ -12,6 +14,7 @@ import (
 type PluginAPI interface {
 	WriteConfigContents(node *Node, w io.Writer) error
 	Setup(n *Node) error
+	Verify(n *Node) error
 	Cleanup(n *Node) error
 }
 
@@ -105,51 +108,82 @@ func WriteConfigForIPAM(c *Config, node *Node, cw *ConfigWriter) {
 }
 
 // DoRouteOpsOnNodes builds static routes between minion and master node
-// for a CNI plugin, so that pods can communicate across nodes.
+// for a CNI plugin, so that pods can communicate across nodes. For add, the
+// route is observed first, and only created, if missing. Routes that
+// already exist (or do not exist, for delete) are skipped, and the other
+// nodes are still processed. If every route was skipped, the skip error is
+// returned.
 func DoRouteOpsOnNodes(node *Node, c *Config, op string) error {
-	if node.IsMaster || node.IsMinion {
-		myID := node.ID
-		for _, pInfo := range c.Pod.Info {
-			if pInfo.Prefix == "" {
-				continue
+	var skipped error
+	done := 0
+	for _, route := range PodNetworkRoutes(node, c) {
+		var err error
+		if op == "add" {
+			present, observeErr := route.Observe()
+			if observeErr != nil || !present {
+				err = route.Create()
 			}
-			// User may have specified pod and management families in a different order for dual-stack
-			// Select the corresponding management info to match pod info.
-			mInfo := c.Mgmt.Info[0]
-			if pInfo.Mode != mInfo.Mode {
-				mInfo = c.Mgmt.Info[1]
+			if observeErr == nil && present || errors.Is(err, ErrAlreadyExists) {
+				skipped = existsErrorf("skipping - %s %s as already exists", op, route)
+				glog.V(1).Info(skipped.Error())
+				continue
 			}
-			for _, n := range c.Topology {
-				if n.ID == myID {
-					continue
-				}
-				if n.IsMaster || n.IsMinion {
-					prefix, suffix := BuildPodSubnetPrefix(pInfo.Mode, pInfo.Prefix, pInfo.Size, n.ID)
-					dest := fmt.Sprintf("%s%s/%d", prefix, suffix, pInfo.Size)
-					gw := BuildGWIP(mInfo.Prefix, n.ID)
-					var err error
-					if op == "add" {
-						err = c.General.NetMgr.AddRouteUsingInterfaceName(dest, gw, node.Interface)
-						if err != nil && err.Error() == "file exists" {
-							return fmt.Errorf("skipping - %s route to %s via %s as already exists", op, dest, gw)
-						}
-					} else {
-						err = c.General.NetMgr.DeleteRouteUsingInterfaceName(dest, gw, node.Interface)
-						if err != nil && err.Error() == "no such process" {
-							return fmt.Errorf("skipping - %s route from %s via %s as non-existent", op, dest, gw)
-						}
-					}
-					if err != nil {
-						return fmt.Errorf("unable to %s pod network route for %s to %s: %v", op, dest, n.Name, err)
-					}
-					glog.V(1).Infof("Did pod network %s route for %s to %s", op, dest, n.Name)
-				}
+		} else {
+			err = route.Delete()
+			if errors.Is(err, ErrNotFound) {
+				skipped = notFoundErrorf("skipping - %s %s as non-existent", op, route)
+				glog.V(1).Info(skipped.Error())
+				continue
 			}
 		}
+		if err != nil {
+			return fmt.Errorf("unable to %s pod network %s: %v", op, route, err)
+		}
+		done++
+		glog.V(1).Infof("Did pod network %s of %s", op, route)
+	}
+	if done == 0 {
+		return skipped
 	}
 	return nil
 }
 
+// PodNetworkRoutes provides the static routes from the node to the pod
+// network(s) on each of the other nodes. The management network family
+// for the gateway is selected to match the pod network family, as they
+// may be specified in a different order, for dual-stack.
+func PodNetworkRoutes(node *Node, c *Config) []Resource {
+	var routes []Resource
+	if !node.IsMaster && !node.IsMinion {
+		return routes
+	}
+	for _, pInfo := range c.Pod.Info {
+		if pInfo.Prefix == "" {
+			continue
+		}
+		mInfo := c.Mgmt.Info[0]
+		if pInfo.Mode != mInfo.Mode {
+			mInfo = c.Mgmt.Info[1]
+		}
+		for _, n := range c.Topology {
+			if n.ID == node.ID || (!n.IsMaster && !n.IsMinion) {
+				continue
+			}
+			prefix, suffix := BuildPodSubnetPrefix(pInfo.Mode, pInfo.Prefix, pInfo.Size, n.ID)
+			routes = append(routes, RouteResource{
+				NetMgr:    c.General.NetMgr,
+				Dest:      fmt.Sprintf("%s%s/%d", prefix, suffix, pInfo.Size),
+				GWs:       []string{BuildGWIP(mInfo.Prefix, n.ID)},
+				Interface: node.Interface,
+			})
+		}
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		return routes[i].(RouteResource).Dest < routes[j].(RouteResource).Dest
+	})
+	return routes
+}
+
 // CreateRoutesForPodNetwork establishes static routes between a node
 // and all other nodes as part of the "up" operation.
 func CreateRoutesForPodNetwork(node *Node, c *Config) error {
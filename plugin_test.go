@@ -2,6 +2,7 @@ package lazyjack_test
 
 import (
 	"bytes"
+	"errors"
 	"testing"
 
 	"github.com/pmichali/lazyjack"
@@ -172,7 +173,7 @@ func TestFailedDoRouteOpsOnNodesAdd(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected to not be able to create route")
 	}
-	expected := "unable to add pod network route for fd00:40:0:0:20::/80 to minion1: mock failure adding route"
+	expected := "unable to add pod network route to fd00:40:0:0:20::/80 via fd00:100::20: mock failure adding route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
 	}
@@ -333,7 +334,7 @@ func TestFailedDoRouteOpsOnNodesDelete(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected not to be able to delete route on node")
 	}
-	expected := "unable to delete pod network route for fd00:40:0:0:20::/80 to minion1: mock failure deleting route"
+	expected := "unable to delete pod network route to fd00:40:0:0:20::/80 via fd00:100::20: mock failure deleting route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
 	}
@@ -386,7 +387,7 @@ func TestFailedNoRouteDoRouteOpsOnNodesDelete(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected not to be able to delete route on node")
 	}
-	expected := "skipping - delete route from fd00:40:0:0:10::/80 via fd00:100::10 as non-existent"
+	expected := "skipping - delete route to fd00:40:0:0:10::/80 via fd00:100::10 as non-existent"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
 	}
@@ -594,3 +595,66 @@ func TestIPAM_ContentsForDualStack(t *testing.T) {
 		t.Fatalf("FAILED: CNI config contents for dual-stack IPAM wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
 	}
 }
+
+func TestDoRouteOpsOnNodesContinuesPastExisting(t *testing.T) {
+	nl := &mockNetLink{}
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"master": {
+				IsMaster: true,
+				Name:     "master",
+				ID:       0x10,
+			},
+			"minion1": {
+				IsMinion: true,
+				Name:     "minion1",
+				ID:       0x20,
+			},
+		},
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{
+					Prefix: "fd00:40:0:0:",
+					Mode:   lazyjack.IPv6NetMode,
+					Size:   80,
+				},
+			},
+		},
+		General: lazyjack.GeneralSettings{
+			NetMgr: lazyjack.NetMgr{Server: nl},
+		},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{
+					Prefix: "fd00:100::",
+					Mode:   lazyjack.IPv6NetMode,
+				},
+			},
+		},
+	}
+	n := &lazyjack.Node{
+		Name:      "master",
+		Interface: "eth1",
+		IsMaster:  true,
+		ID:        0x10,
+	}
+	err := lazyjack.DoRouteOpsOnNodes(n, c, "add")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to add route on node: %s", err.Error())
+	}
+
+	// Node added, so only the route for the new node is missing
+	c.Topology["minion2"] = lazyjack.Node{IsMinion: true, Name: "minion2", ID: 0x30}
+	err = lazyjack.DoRouteOpsOnNodes(n, c, "add")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add route for new node, past existing route: %s", err.Error())
+	}
+	if nl.CallCount() != 2 {
+		t.Fatalf("FAILED: Expected to add routes for each node once, added %d", nl.CallCount())
+	}
+
+	err = lazyjack.DoRouteOpsOnNodes(n, c, "add")
+	if !errors.Is(err, lazyjack.ErrAlreadyExists) {
+		t.Fatalf("FAILED: Expected skip, when all routes exist, got %v", err)
+	}
+}
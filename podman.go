@@ -0,0 +1,186 @@
+package lazyjack
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// DefaultPodmanCommand command used for podman
+const DefaultPodmanCommand = "podman"
+
+// Podman represents a concrete hypervisor implementation, which uses
+// podman, instead of docker. Must be run as root, so that the support
+// network and containers are visible to the host.
+type Podman struct {
+	Command string
+}
+
+// ResourceState method obtains the state of the resource, which can be
+// not present, existing, or running (for container resources). Podman's
+// inspect will look for containers, networks, and volumes.
+func (p *Podman) ResourceState(r string) string {
+	args := BuildResourceStateArgs(r)
+	output, err := p.DoCommand("Resource State", args)
+	if err != nil {
+		glog.V(4).Infof("No %q resource", r)
+		return ResourceNotPresent
+	}
+	if strings.Contains(output, "\"Running\": true") {
+		glog.V(4).Infof("Resource %q is running", r)
+		return ResourceRunning
+	}
+	glog.V(4).Infof("Resource %q exists", r)
+	return ResourceExists
+}
+
+// DoCommand performs a podman command, collecting and returning output.
+func (p *Podman) DoCommand(name string, args []string) (string, error) {
+	return p.DoCommandWithInput(name, args, "")
+}
+
+// DoCommandWithInput performs a podman command, providing the input (if
+// any) on stdin, and collecting and returning output.
+func (p *Podman) DoCommandWithInput(name string, args []string, input string) (string, error) {
+	glog.V(4).Infof("Invoking: podman %s", strings.Join(args, " "))
+	cmd := args[0]
+	c := exec.Command(p.Command, args...)
+	if input != "" {
+		c.Stdin = strings.NewReader(input)
+	}
+	output, err := c.Output()
+	if err != nil {
+		return "", newCommandError(err, "podman %q failed for %q: %v (%s)", cmd, name, err, output)
+	}
+	glog.V(4).Infof("Podman %q operation successful", name)
+	return string(output), nil
+}
+
+// GetInterfaceConfig performs podman command to obtain an interface's
+// IP addresses.
+func (p *Podman) GetInterfaceConfig(name, ifName string) (string, error) {
+	args := BuildGetInterfaceArgs(name, ifName)
+	return p.DoCommand("Get I/F config", args)
+}
+
+// DeleteV4Address performs podman command to remove the IPv4 address from
+// the container's eth0 interface.
+func (p *Podman) DeleteV4Address(container, ip string) error {
+	args := BuildV4AddrDelArgs(container, ip)
+	_, err := p.DoCommand("Delete IPv4 addr", args)
+	return err
+}
+
+// AddV6Route performs podman command to add an IPv6 route.
+func (p *Podman) AddV6Route(container, dest, via string) error {
+	args := BuildAddRouteArgs(container, dest, via)
+	_, err := p.DoCommand("Add IPv6 route", args)
+	return classifyCommandError(err, ErrAlreadyExists)
+}
+
+// DeleteContainer performs podman command to remove a container.
+func (p *Podman) DeleteContainer(name string) error {
+	args := BuildDeleteContainerArgs(name)
+	_, err := p.DoCommand("Delete container", args)
+	return classifyCommandError(err, ErrNotFound)
+}
+
+// RunContainer performs podman command to run a container. The arguments
+// are the same as for docker.
+func (p *Podman) RunContainer(name string, args []string) error {
+	_, err := p.DoCommand("Run container", args)
+	return err
+}
+
+// BuildPodmanCreateNetArgsFor constructs arguments to create a podman
+// network. Podman pairs each gateway with the subnet before it, so the
+// gateway must follow the IPv6 subnet.
+func BuildPodmanCreateNetArgsFor(name, cidr, v4cidr, gwPrefix string) []string {
+	return []string{
+		"network", "create", "--ipv6",
+		fmt.Sprintf("--subnet=%s", cidr),
+		fmt.Sprintf("--gateway=%s1", gwPrefix),
+		fmt.Sprintf("--subnet=%s", v4cidr),
+		name,
+	}
+}
+
+// CreateNetwork performs podman command to create a network.
+func (p *Podman) CreateNetwork(name, cidr, v4cidr, gw string) error {
+	args := BuildPodmanCreateNetArgsFor(name, cidr, v4cidr, gw)
+	_, err := p.DoCommand("Create network", args)
+	return err
+}
+
+// DeleteNetwork performs podman command to delete a network.
+func (p *Podman) DeleteNetwork(name string) error {
+	args := BuildDeleteNetArgsFor(name)
+	_, err := p.DoCommand("Delete network", args)
+	return classifyCommandError(err, ErrNotFound)
+}
+
+// CreateVolume creates a new podman volume
+func (p *Podman) CreateVolume(name string) error {
+	args := BuildCreateVolumeArgs(name)
+	_, err := p.DoCommand("Volume create", args)
+	return err
+}
+
+// BuildVolumeExistsArgs constructs arguments to check if a volume exists.
+func BuildVolumeExistsArgs(name string) []string {
+	return []string{"volume", "exists", name}
+}
+
+// DeleteVolume deletes a podman volume. Podman fails when removing a
+// non-existent volume, so existence is checked first, so that no error
+// occurs, if volume doesn't exist.
+func (p *Podman) DeleteVolume(name string) error {
+	_, err := p.DoCommand("Volume exists", BuildVolumeExistsArgs(name))
+	if err != nil {
+		glog.V(4).Infof("No %q volume to delete", name)
+		return nil
+	}
+	args := BuildDeleteVolumeArgs(name)
+	_, err = p.DoCommand("Volume delete", args)
+	return err
+}
+
+// GetVolumeMountPoint obtains the mount point so that files can be deposited from host.
+func (p *Podman) GetVolumeMountPoint(name string) (string, error) {
+	args := BuildInspectVolumeArgs(name)
+	mountPoint, err := p.DoCommand("Volume inspect", args)
+	if err != nil {
+		return "", err
+	}
+	return strings.Trim(mountPoint, "\"\n"), nil
+}
+
+// PullImage performs podman command to pull the image from the registry.
+func (p *Podman) PullImage(image string) error {
+	args := BuildPullImageArgs(image)
+	_, err := p.DoCommand("Pull image", args)
+	return err
+}
+
+// LoadImage performs podman command to load an image from a tarball.
+func (p *Podman) LoadImage(tarball string) error {
+	args := BuildLoadImageArgs(tarball)
+	_, err := p.DoCommand("Load image", args)
+	return err
+}
+
+// Login performs podman command to log in to the registry, with the
+// password provided on stdin.
+func (p *Podman) Login(server, username, password string) error {
+	args := BuildLoginArgs(server, username)
+	_, err := p.DoCommandWithInput("Registry login", args, password)
+	return err
+}
+
+// ContainerLogs performs podman command to obtain the most recent log
+// lines from the container.
+func (p *Podman) ContainerLogs(name string) (string, error) {
+	return containerLogs(p.Command, name)
+}
@@ -0,0 +1,129 @@
+package lazyjack_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func TestPodmanResourceState(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		resource string
+		cmd      string
+		expected string
+	}{
+		{
+			name:     "resource running",
+			resource: "\"Running\": true", // Bogus name so that output has expected string when doing echo
+			cmd:      "echo",
+			expected: lazyjack.ResourceRunning,
+		},
+		{
+			name:     "resource exists",
+			resource: "support_net",
+			cmd:      "echo",
+			expected: lazyjack.ResourceExists,
+		},
+		{
+			name:     "resource doesn't exists",
+			resource: "no-such-resource",
+			cmd:      "false",
+			expected: lazyjack.ResourceNotPresent,
+		},
+	}
+	for _, tc := range testCases {
+		p := lazyjack.Podman{Command: tc.cmd}
+		actual := p.ResourceState(tc.resource)
+		if actual != tc.expected {
+			t.Fatalf("FAILED: [%s] resource state mismatch. Expected %q, got %q", tc.name, tc.expected, actual)
+		}
+	}
+}
+
+func TestBuildPodmanCreateNetArgs(t *testing.T) {
+	list := lazyjack.BuildPodmanCreateNetArgsFor("test_net", "fd00:10::/64", "172.18.0.0/16", "fd00:10::")
+	actual := strings.Join(list, " ")
+	expected := "network create --ipv6 --subnet=fd00:10::/64 --gateway=fd00:10::1 --subnet=172.18.0.0/16 test_net"
+	if actual != expected {
+		t.Fatalf("FAILED: Building support net create args. Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestPodmanOperations(t *testing.T) {
+	p := lazyjack.Podman{Command: "echo"}
+	err := p.CreateNetwork("my-network", "2001:db8::/64", "10.20.0.0/16", "2001:db8::")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create network")
+	}
+	err = p.DeleteNetwork("my-network")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete network")
+	}
+	err = p.RunContainer("my-container", []string{"arg1", "arg2"})
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to run container")
+	}
+	err = p.DeleteContainer("my-container")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete container")
+	}
+	err = p.DeleteV4Address("my-container", "192.168.0.5/24")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete V4 IP")
+	}
+	err = p.AddV6Route("my-container", "2001:db8::/64", "2001:db8::200")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to add route")
+	}
+	err = p.CreateVolume("my-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create volume")
+	}
+	err = p.DeleteVolume("my-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to delete volume")
+	}
+	actual, err := p.GetInterfaceConfig("my-container", "eth0")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to get interface config")
+	}
+	expected := "exec my-container ip addr list eth0\n"
+	if actual != expected {
+		t.Fatalf("FAILED: Get I/F config. Expected %q, got %q", expected, actual)
+	}
+}
+
+func TestPodmanDeleteMissingVolume(t *testing.T) {
+	p := lazyjack.Podman{Command: "false"}
+	err := p.DeleteVolume("no-such-volume")
+	if err != nil {
+		t.Fatalf("FAILED: Expected no error deleting non-existent volume: %s", err.Error())
+	}
+}
+
+func TestFailedPodmanCommand(t *testing.T) {
+	p := lazyjack.Podman{Command: "false"}
+	err := p.CreateNetwork("my-network", "2001:db8::/64", "10.20.0.0/16", "2001:db8::")
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure creating network")
+	}
+	expected := "podman \"network\" failed for \"Create network\": exit status 1 ()"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestPodmanImageCommands(t *testing.T) {
+	p := lazyjack.Podman{Command: "echo"}
+	if err := p.PullImage("docker.io/diverdane/bind9:latest"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to pull image: %s", err.Error())
+	}
+	if err := p.LoadImage("/tmp/lazyjack/bind9.tar"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to load image: %s", err.Error())
+	}
+	if err := p.Login("registry.example.com", "jack", "secret"); err != nil {
+		t.Fatalf("FAILED: Expected to be able to log in to registry: %s", err.Error())
+	}
+}
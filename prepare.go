@@ -2,9 +2,8 @@ package lazyjack
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
-	"io/ioutil"
-	"os"
 	"path/filepath"
 	"regexp"
 	"sort"
@@ -14,8 +13,9 @@ import (
 )
 
 // CreateKubeletDropInContents constructs the contents of the kubelet
-// drop-in file to support IPv6.
-func CreateKubeletDropInContents(c *Config) *bytes.Buffer {
+// drop-in file to support IPv6. For dual-stack, the node IPs for both
+// IP families are specified.
+func CreateKubeletDropInContents(n *Node, c *Config) *bytes.Buffer {
 	devicePart := "a"
 	if c.Service.Info.Mode == "ipv4" {
 		devicePart = "10"
@@ -23,20 +23,21 @@ func CreateKubeletDropInContents(c *Config) *bytes.Buffer {
 	contents := bytes.NewBufferString("[Service]\n")
 	// Assumption is that kube-dns will be at address 10 (0xa) in service network
 	fmt.Fprintf(contents, "Environment=\"KUBELET_DNS_ARGS=--cluster-dns=%s%s --cluster-domain=cluster.local\"\n", c.Service.Info.Prefix, devicePart)
+	if c.General.Mode == DualStackNetMode {
+		fmt.Fprintf(contents, "Environment=\"KUBELET_EXTRA_ARGS=--node-ip=%s\"\n", strings.Join(CalcNodeIPs(n, c), ","))
+	}
 	return contents
 }
 
 // CreateKubeletDropInFile creates a config file to override the kubelet
 // configuration, so that the correct address is used for DNS resolution.
-func CreateKubeletDropInFile(c *Config) error {
-	contents := CreateKubeletDropInContents(c)
-
-	err := os.MkdirAll(c.General.SystemdArea, 0755)
-	if err != nil {
-		return fmt.Errorf("unable to create area for kubelet drop-in file: %v", err)
+func CreateKubeletDropInFile(n *Node, c *Config) error {
+	dropIn := FileResource{
+		Path:     filepath.Join(c.General.SystemdArea, KubeletDropInFile),
+		Contents: CreateKubeletDropInContents(n, c).Bytes(),
+		Mode:     0755,
 	}
-	dropIn := filepath.Join(c.General.SystemdArea, KubeletDropInFile)
-	err = ioutil.WriteFile(dropIn, contents.Bytes(), 0755)
+	err := Reconcile(dropIn)
 	if err == nil {
 		glog.V(1).Infof("Created kubelet drop-in file")
 	}
@@ -48,11 +49,7 @@ func CollectKubeAdmConfigInfo(n *Node, c *Config) KubeAdmConfigInfo {
 
 	serviceMode := c.Service.Info.Mode
 
-	prefix := c.Mgmt.Info[0].Prefix
-	if c.Mgmt.Info[0].Mode != serviceMode {
-		prefix = c.Mgmt.Info[1].Prefix
-	}
-	info.AdvertiseAddress = fmt.Sprintf("%s%d", prefix, n.ID)
+	info.AdvertiseAddress = CalcNodeIPs(n, c)[0]
 
 	if c.General.Insecure {
 		info.AuthToken = DefaultToken
@@ -86,38 +83,88 @@ func CollectKubeAdmConfigInfo(n *Node, c *Config) KubeAdmConfigInfo {
 	info.ServiceSubnet = c.Service.CIDR
 	info.UseCoreDNS = false // hard-coded default
 	info.TypeDNS = "CoreDNS"  // for 1.13
+	info.CRISocket = CRISocketFor(c)
+	info.CgroupDriver = CgroupDriverFor(c)
+
+	info.ServiceSubnets = c.Service.CIDR
+	if c.General.Mode == DualStackNetMode {
+		info.DualStack = true
+		info.DualStackFeatureGate = NeedsDualStackFeatureGate(c.General.KubeAdmVersion)
+		info.NodeIPs = strings.Join(CalcNodeIPs(n, c), ",")
+		primary, secondary := c.Pod.Info[0], c.Pod.Info[1]
+		pods := []string{c.Pod.CIDR, c.Pod.CIDR2}
+		if primary.Mode != serviceMode {
+			primary, secondary = secondary, primary
+			pods[0], pods[1] = pods[1], pods[0]
+		}
+		info.PodSubnets = strings.Join(pods, ",")
+		if primary.Mode == IPv4NetMode {
+			info.NodeCIDRMaskSizeV4, info.NodeCIDRMaskSizeV6 = primary.Size, secondary.Size
+		} else {
+			info.NodeCIDRMaskSizeV4, info.NodeCIDRMaskSizeV6 = secondary.Size, primary.Size
+		}
+		if c.Service.CIDR2 != "" {
+			info.ServiceSubnets = fmt.Sprintf("%s,%s", c.Service.CIDR, c.Service.CIDR2)
+		}
+	}
 	return info
 }
 
-func CreateKubeAdmConfigContents(n *Node, c *Config) []byte {
-	t := Template_v1_13 // or newer
-	switch c.General.KubeAdmVersion {
-	case "1.10":
-		t = Template_v1_10
-	case "1.11":
-		t = Template_v1_11
-	case "1.12":
-		t = Template_v1_12
+// CalcNodeIPs determines the management network IP(s) for the node, with
+// the IP for the service network's family first. For dual-stack, there is
+// an IP for each family.
+func CalcNodeIPs(n *Node, c *Config) []string {
+	serviceMode := c.Service.Info.Mode
+	primary, secondary := c.Mgmt.Info[0], c.Mgmt.Info[1]
+	if primary.Mode != serviceMode {
+		primary, secondary = secondary, primary
+	}
+	ips := []string{fmt.Sprintf("%s%d", primary.Prefix, n.ID)}
+	if c.General.Mode == DualStackNetMode {
+		ips = append(ips, fmt.Sprintf("%s%d", secondary.Prefix, n.ID))
+	}
+	return ips
+}
+
+// CreateKubeAdmConfigContents builds the kubeadm.conf contents, using the
+// template registered for the kubeadm configuration API version. If the API
+// version was not determined during validation, it is derived from the
+// KubeAdm version. An error is returned, if there is no template for the
+// API version, or the template cannot be applied.
+func CreateKubeAdmConfigContents(n *Node, c *Config) ([]byte, error) {
+	apiVersion := c.General.KubeAdmAPIVersion
+	if apiVersion == "" {
+		apiVersion, _ = KubeAdmAPIVersionFor(c.General.KubeAdmVersion)
+	}
+	t, err := KubeAdmTemplateFor(apiVersion)
+	if err != nil {
+		return nil, fmt.Errorf("unable to create %s contents: %v", KubeAdmConfFile, err)
 	}
 	info := CollectKubeAdmConfigInfo(n, c)
 	contents := new(bytes.Buffer)
-	err := t.Execute(contents, info)
+	err = t.Execute(contents, info)
 	if err != nil {
-		glog.Errorf("Unable to create kubeadm.conf contents: %s", err.Error())
-		contents.Reset()
+		return nil, fmt.Errorf("unable to create %s contents: %v", KubeAdmConfFile, err)
 	}
-	return contents.Bytes()
+	return contents.Bytes(), nil
 }
 
 // CreateKubeAdmConfigFile constructs the KubeAdm config file during the
 // "prepare" step. This file can be modified, before using it in the "up"
-// step.
+// step. Any user supplied patches are applied to the generated contents.
 func CreateKubeAdmConfigFile(node *Node, c *Config) error {
-	contents := CreateKubeAdmConfigContents(node, c)
+	contents, err := CreateKubeAdmConfigContents(node, c)
+	if err != nil {
+		return err
+	}
+	contents, err = ApplyKubeAdmPatches(contents, c.KubeAdm.Patches)
+	if err != nil {
+		return err
+	}
 
 	file := filepath.Join(c.General.WorkArea, KubeAdmConfFile)
 	backup := fmt.Sprintf("%s.bak", file)
-	err := SaveFileContents(contents, file, backup)
+	err = SaveFileContents(contents, file, backup)
 	if err == nil {
 		glog.V(1).Infof("Created %s file", KubeAdmConfFile)
 	}
@@ -214,7 +261,7 @@ func AddHostEntries(c *Config) error {
 		return err
 	}
 	contents = UpdateHostsInfo(contents, nodes)
-	err = SaveFileContents(contents, file, backup)
+	err = Reconcile(FileResource{Path: file, Backup: backup, Contents: contents})
 	if err != nil {
 		return err
 	}
@@ -226,23 +273,38 @@ func AddHostEntries(c *Config) error {
 // based on the service network mode. For IPv6 mode, the DNS64 IP is used, otherwise
 // the node's IP is used.
 func CalcNameServer(n *Node, c *Config) string {
-	var nameserver string
+	return CalcNameServers(n, c)[0]
+}
+
+// CalcNameServers determines the IPs to use for the name servers in
+// /etc/resolv.conf. For IPv6 mode, the IPs of all the DNS64 servers are
+// used (the node's own server first), otherwise the node's IP is used.
+func CalcNameServers(n *Node, c *Config) []string {
 	if c.General.Mode == IPv6NetMode {
-		nameserver = c.DNS64.ServerIP
-	} else {
-		entry := 0
-		if c.General.Mode == DualStackNetMode && c.Mgmt.Info[entry].Mode != c.Service.Info.Mode {
-			entry = 1
+		return DNS64ServerIPs(n, c)
+	}
+	entry := 0
+	if c.General.Mode == DualStackNetMode && c.Mgmt.Info[entry].Mode != c.Service.Info.Mode {
+		entry = 1
+	}
+	return []string{fmt.Sprintf("%s%d", c.Mgmt.Info[entry].Prefix, n.ID)}
+}
+
+// matchingNameServer indicates if the line is for one of the name servers.
+func matchingNameServer(line []byte, ns []string) bool {
+	for _, server := range ns {
+		if bytes.Contains(line, []byte(server)) {
+			return true
 		}
-		nameserver = fmt.Sprintf("%s%d", c.Mgmt.Info[entry].Prefix, n.ID)
 	}
-	return nameserver
+	return false
 }
 
 // UpdateResolvConfInfo updates the nameservers to use the ones
-// defined for the cluster. Old entries are commented out, and new
-// ones tagged, allowing later restoration, during cleanup.
-func UpdateResolvConfInfo(contents []byte, ns string) []byte {
+// defined for the cluster, in the order provided. Old entries are
+// commented out, and new ones tagged, allowing later restoration,
+// during cleanup.
+func UpdateResolvConfInfo(contents []byte, ns ...string) []byte {
 
 	glog.V(4).Infof("Updating %s", EtcResolvConfFile)
 	lines := bytes.Split(bytes.TrimRight(contents, "\n"), []byte("\n"))
@@ -254,20 +316,31 @@ func UpdateResolvConfInfo(contents []byte, ns string) []byte {
 			continue // prepare was previousy run, filter out additions
 		}
 		if bytes.HasPrefix(line, []byte("nameserver")) {
-			matches := bytes.Contains(line, []byte(ns))
-			if first && !matches {
-				output.WriteString(fmt.Sprintf("nameserver %s  #[+]\n", ns))
-			} else if !first && matches {
-				output.WriteString("#[-] ")
-			} // else first and matches, or not first an not matches -> keep line
 			if first {
+				// Keep the existing entry, if it is for the first name server
+				added := ns
+				if bytes.Contains(line, []byte(ns[0])) {
+					output.WriteString(fmt.Sprintf("%s\n", line))
+					added = ns[1:]
+				}
+				for _, server := range added {
+					output.WriteString(fmt.Sprintf("nameserver %s  #[+]\n", server))
+				}
 				first = false
+				if len(added) < len(ns) {
+					continue
+				}
+			}
+			if matchingNameServer(line, ns) {
+				output.WriteString("#[-] ")
 			}
 		}
 		output.WriteString(fmt.Sprintf("%s\n", line))
 	}
 	if first {
-		output.WriteString(fmt.Sprintf("nameserver %s  #[+]\n", ns))
+		for _, server := range ns {
+			output.WriteString(fmt.Sprintf("nameserver %s  #[+]\n", server))
+		}
 	}
 	return output.Bytes()
 }
@@ -282,9 +355,9 @@ func AddResolvConfEntry(n *Node, c *Config) error {
 	if err != nil {
 		return err
 	}
-	nameserver := CalcNameServer(n, c)
-	contents = UpdateResolvConfInfo(contents, nameserver)
-	err = SaveFileContents(contents, file, backup)
+	nameservers := CalcNameServers(n, c)
+	contents = UpdateResolvConfInfo(contents, nameservers...)
+	err = Reconcile(FileResource{Path: file, Backup: backup, Contents: contents})
 	if err != nil {
 		return err
 	}
@@ -293,99 +366,106 @@ func AddResolvConfEntry(n *Node, c *Config) error {
 }
 
 // FindHostIPForNAT64 determines the management IP for the node containing
-// the NAT64 server.
+// the NAT64 server. If there are multiple NAT64 nodes, the one with the
+// lowest node ID (the primary) is used.
 func FindHostIPForNAT64(c *Config) (string, bool) {
-	for _, node := range c.Topology {
-		if node.IsNAT64Server {
-			return fmt.Sprintf("%s%x", c.Mgmt.Info[0].Prefix, node.ID), true
+	ips := FindHostIPsForNAT64(c)
+	if len(ips) == 0 {
+		return "", false
+	}
+	return ips[0], true
+}
+
+// RouteToNAT64ServerForDNS64Subnet provides the route for the DNS64
+// network that points to the NAT64 server(s). On the NAT64 node, the route
+// is via the support network, and on other nodes, it is via the NAT64
+// node(s) management IP. Returns nil, if no route is needed (Jool).
+func RouteToNAT64ServerForDNS64Subnet(node *Node, c *Config) (*RouteResource, error) {
+	route := &RouteResource{NetMgr: c.General.NetMgr, Dest: c.DNS64.CIDR, Routing: c.NAT64.Routing}
+	if node.IsNAT64Server && UsingJool(c) {
+		glog.V(1).Infof("Skipping - route to %s not needed, as Jool translates on this node", route.Dest)
+		return nil, nil
+	} else if node.IsNAT64Server {
+		route.GWs = []string{c.NAT64.ServerIP}
+		route.SupportNetCIDR = c.Support.V4CIDR
+	} else {
+		route.GWs = FindHostIPsForNAT64(c)
+		route.Interface = node.Interface
+		if len(route.GWs) == 0 {
+			return nil, fmt.Errorf("unable to find node with NAT64 server configured")
 		}
 	}
-	return "", false
+	return route, nil
 }
 
 // CreateRouteToNAT64ServerForDNS64Subnet creates a route for the DNS64
 // network that points to the NAT64 server for proper routing of external
 // addresses.
-func CreateRouteToNAT64ServerForDNS64Subnet(node *Node, c *Config) (err error) {
-	var gw string
-	var ok bool
-	dest := c.DNS64.CIDR
-	if node.IsNAT64Server {
-		gw = c.NAT64.ServerIP
-		err = c.General.NetMgr.AddRouteUsingSupportNetInterface(dest, gw, c.Support.V4CIDR)
-	} else {
-		gw, ok = FindHostIPForNAT64(c)
-		if !ok {
-			return fmt.Errorf("unable to find node with NAT64 server configured")
-		}
-		err = c.General.NetMgr.AddRouteUsingInterfaceName(dest, gw, node.Interface)
+func CreateRouteToNAT64ServerForDNS64Subnet(node *Node, c *Config) error {
+	route, err := RouteToNAT64ServerForDNS64Subnet(node, c)
+	if err != nil || route == nil {
+		return err
 	}
+	return Reconcile(route)
+}
+
+// RoutesToSupportNetworkForOtherNodes provides the route(s) that a node
+// needs, to get to the support network, so that the DNS64 and NAT64
+// server(s) can be accessed.
+func RoutesToSupportNetworkForOtherNodes(node *Node, c *Config) ([]Resource, error) {
+	routes, err := SupportNetworkRoutes(node, c)
 	if err != nil {
-		if err.Error() == "file exists" {
-			glog.V(1).Infof("Skipping - add route to %s via %s as already exists", dest, gw)
-			err = nil
-		}
-	} else {
-		glog.V(1).Infof("Added route to %s via %s", dest, gw)
-	}
-	return err
+		return nil, err
+	}
+	var resources []Resource
+	for _, r := range routes {
+		resources = append(resources, RouteResource{
+			NetMgr:    c.General.NetMgr,
+			Dest:      r.Dest,
+			GWs:       []string{r.GW},
+			Interface: node.Interface,
+		})
+	}
+	return resources, nil
 }
 
-// CreateRouteToSupportNetworkForOtherNodes creates a route on a node, to
-// get to the support netork, so that the DNS64 and NAT64 server can be
+// CreateRouteToSupportNetworkForOtherNodes creates route(s) on a node, to
+// get to the support netork, so that the DNS64 and NAT64 server(s) can be
 // accessed.
-func CreateRouteToSupportNetworkForOtherNodes(node *Node, c *Config) (err error) {
-	if !node.IsNAT64Server && !node.IsDNS64Server {
-		dest := c.Support.CIDR
-		gw, ok := FindHostIPForNAT64(c)
-		if !ok {
-			return fmt.Errorf("unable to find node with NAT64 server configured")
-		}
-		err = c.General.NetMgr.AddRouteUsingInterfaceName(dest, gw, node.Interface)
-		if err != nil {
-			if err.Error() == "file exists" {
-				glog.V(1).Infof("Skipping - add route to %s via %s as already exists", dest, gw)
-				err = nil
-			}
-		} else {
-			glog.V(1).Infof("Added route to %s via %s", dest, gw)
-		}
+func CreateRouteToSupportNetworkForOtherNodes(node *Node, c *Config) error {
+	routes, err := RoutesToSupportNetworkForOtherNodes(node, c)
+	if err != nil {
+		return err
 	}
-	return err
+	return Reconcile(routes...)
 }
 
-// ConfigureManagementInterface adds and address and sets the MTU for
-// the interface used for the pod and management networks.
-func ConfigureManagementInterface(node *Node, c *Config) error {
-	glog.V(1).Infof("Configuring management interface %s", node.Interface)
-	mgmtIP := BuildNodeCIDR(c.Mgmt.Info[0], node.ID)
-	err := c.General.NetMgr.AddAddressToLink(mgmtIP, node.Interface)
-	if err != nil {
-		return err
-	} else {
-		glog.V(4).Infof("Added %s to %s", mgmtIP, node.Interface)
+// ManagementInterfaceResources provides the address(es) and MTU for the
+// interface used for the pod and management networks.
+func ManagementInterfaceResources(node *Node, c *Config) []Resource {
+	resources := []Resource{
+		AddressResource{NetMgr: c.General.NetMgr, IP: BuildNodeCIDR(c.Mgmt.Info[0], node.ID), Interface: node.Interface},
 	}
 	if c.General.Mode == DualStackNetMode {
-		mgmtIP = BuildNodeCIDR(c.Mgmt.Info[1], node.ID)
-		err = c.General.NetMgr.AddAddressToLink(mgmtIP, node.Interface)
-		if err != nil {
-			return err
-		} else {
-			glog.V(4).Infof("Added %s to %s", mgmtIP, node.Interface)
-		}
+		resources = append(resources,
+			AddressResource{NetMgr: c.General.NetMgr, IP: BuildNodeCIDR(c.Mgmt.Info[1], node.ID), Interface: node.Interface})
 	}
-	err = c.General.NetMgr.SetLinkMTU(node.Interface, c.Pod.MTU)
-	if err == nil {
-		glog.V(4).Infof("Set MTU on %s to %d", node.Interface, c.Pod.MTU)
-	}
-	return err
+	return append(resources, MTUResource{NetMgr: c.General.NetMgr, Interface: node.Interface, MTU: c.Pod.MTU})
+}
+
+// ConfigureManagementInterface adds and address and sets the MTU for
+// the interface used for the pod and management networks. Only the
+// settings that are missing are applied.
+func ConfigureManagementInterface(node *Node, c *Config) error {
+	glog.V(1).Infof("Configuring management interface %s", node.Interface)
+	return Reconcile(ManagementInterfaceResources(node, c)...)
 }
 
 // PrepareClusterNode performs steps on the node to prepare for bringing
 // up the cluster. Includes adding the management IP, updating hosts and
 // resolv.conf entries, creating a kubelet drop-in file, creating the
-// KubeAdm configuration file (on master), and creating routes to servers
-// and the support network.
+// KubeAdm configuration file (on master), creating routes to servers
+// and the support network, and (optionally) persisting the network config.
 func PrepareClusterNode(node *Node, c *Config) error {
 	glog.V(1).Info("Preparing general settings")
 
@@ -406,7 +486,7 @@ func PrepareClusterNode(node *Node, c *Config) error {
 		return err
 	}
 
-	err = CreateKubeletDropInFile(c)
+	err = CreateKubeletDropInFile(node, c)
 	if err != nil {
 		return err
 	}
@@ -429,6 +509,11 @@ func PrepareClusterNode(node *Node, c *Config) error {
 			return err
 		}
 	}
+
+	err = CreatePersistentNetConfig(node, c)
+	if err != nil {
+		return err
+	}
 	glog.Info("Prepared general settings")
 	return nil
 }
@@ -449,27 +534,48 @@ func CreateNamedConfContents(c *Config) *bytes.Buffer {
 };
 `
 	contents := bytes.NewBufferString(header)
-	fmt.Fprintf(contents, "        %s%s;\n", c.DNS64.CIDRPrefix, c.DNS64.RemoteV4Server)
+	for _, forwarder := range NamedForwarders(c) {
+		fmt.Fprintf(contents, "        %s;\n", forwarder)
+	}
 	fmt.Fprintf(contents, middle)
+	if c.DNS64.DNSSECValidation != "" {
+		fmt.Fprintf(contents, "    dnssec-validation %s;\n", c.DNS64.DNSSECValidation)
+	}
+	if c.DNS64.Recursion != "" {
+		fmt.Fprintf(contents, "    recursion %s;\n", c.DNS64.Recursion)
+	}
 	fmt.Fprintf(contents, "    dns64 %s {\n", c.DNS64.CIDR)
-	if !c.DNS64.AllowAAAAUse {
+	writeACL(contents, "clients", c.DNS64.Clients)
+	writeACL(contents, "mapped", c.DNS64.Mapped)
+	if len(c.DNS64.Exclude) > 0 {
+		writeACL(contents, "exclude", c.DNS64.Exclude)
+	} else if !c.DNS64.AllowAAAAUse {
 		fmt.Fprintf(contents, "        exclude { any; };\n")
 	}
 	fmt.Fprintf(contents, trailer)
+	for _, z := range NamedLocalZones(c) {
+		fmt.Fprintf(contents, "zone %q {\n    type master;\n    file \"%s%s\";\n};\n", z.Name, DNS64ConfigDir, ZoneFileName(z.Name))
+	}
 	return contents
 }
 
 // CreateSupportNetwork creates the network used by the DNS64 and NAT64
 // servers.
 func CreateSupportNetwork(c *Config) (err error) {
-	if c.General.Hyper.ResourceState(SupportNetName) == ResourceExists {
-		err = fmt.Errorf("skipping - support network already exists")
-		glog.V(1).Infof(err.Error())
+	network := NetworkResource{
+		Hyper:    c.General.Hyper,
+		Name:     SupportNetName,
+		CIDR:     c.Support.CIDR,
+		V4CIDR:   c.Support.V4CIDR,
+		GWPrefix: c.Support.Info.Prefix,
+	}
+	present, err := reconcileResource(network)
+	if err != nil {
 		return err
 	}
-
-	err = c.General.Hyper.CreateNetwork(SupportNetName, c.Support.CIDR, c.Support.V4CIDR, c.Support.Info.Prefix)
-	if err != nil {
+	if present {
+		err = existsErrorf("skipping - support network already exists")
+		glog.V(1).Infof(err.Error())
 		return err
 	}
 	glog.Info("Prepared support network")
@@ -496,10 +602,17 @@ func CreateConfigForDNS64(c *Config) error {
 
 	contents := CreateNamedConfContents(c)
 	conf := filepath.Join(mountPoint, DNS64NamedConf)
-	err = ioutil.WriteFile(conf, contents.Bytes(), 0755)
+	err = FS().WriteFile(conf, contents.Bytes(), 0755)
 	if err != nil {
 		return fmt.Errorf("unable to create named.conf for DNS64: %v", err)
 	}
+	for _, z := range NamedLocalZones(c) {
+		zone := filepath.Join(mountPoint, ZoneFileName(z.Name))
+		err = FS().WriteFile(zone, CreateZoneContents(z, c).Bytes(), 0755)
+		if err != nil {
+			return fmt.Errorf("unable to create zone file for DNS64 local zone %q: %v", z.Name, err)
+		}
+	}
 
 	glog.V(1).Infof("Created DNS64 config file")
 	return nil
@@ -522,31 +635,32 @@ func ParseIPv4Address(ifConfig string) string {
 func EnsureDNS64Server(c *Config) (err error) {
 	glog.V(1).Info("Preparing DNS64")
 
-	state := c.General.Hyper.ResourceState(DNS64Name)
-	if state == ResourceRunning {
-		err = fmt.Errorf("skipping - DNS64 container (%s) already running", DNS64Name)
-		glog.V(1).Info(err.Error())
-		return err
-	}
-	if state == ResourceExists {
-		err = c.General.Hyper.DeleteContainer(DNS64Name)
+	container := ContainerResource{Hyper: c.General.Hyper, Role: "DNS64", Name: DNS64Name, Run: func() error {
+		err := CreateConfigForDNS64(c)
 		if err != nil {
-			return fmt.Errorf("unable to remove existing (non-running) DNS64 container: %v", err)
+			return err
 		}
-	}
 
-	err = CreateConfigForDNS64(c)
+		err = EnsureImage(DNS64Name, c.Images.DNS64, DefaultDNS64Image, c)
+		if err != nil {
+			return err
+		}
+
+		// Run DNS64 (bind9) container
+		args := BuildRunArgsForDNS64(c)
+		return c.General.Hyper.RunContainer("DNS64 container", args)
+	}}
+	present, err := reconcileResource(container)
 	if err != nil {
 		return err
 	}
-
-	// Run DNS64 (bind9) container
-	args := BuildRunArgsForDNS64(c)
-	err = c.General.Hyper.RunContainer("DNS64 container", args)
-	if err == nil {
-		glog.V(1).Infof("DNS64 container (%s) started", DNS64Name)
+	if present {
+		err = existsErrorf("skipping - DNS64 container (%s) already running", DNS64Name)
+		glog.V(1).Info(err.Error())
+		return err
 	}
-	return err
+	glog.V(1).Infof("DNS64 container (%s) started", DNS64Name)
+	return nil
 }
 
 // RemoveIPv4AddressOnDNS64Server removes IPv4 address in container,
@@ -560,7 +674,7 @@ func RemoveIPv4AddressOnDNS64Server(c *Config) (err error) {
 
 	v4Addr := ParseIPv4Address(ifConfig)
 	if v4Addr == "" {
-		return fmt.Errorf("unable to find IPv4 address on eth0 of DNS64 container")
+		return notFoundErrorf("unable to find IPv4 address on eth0 of DNS64 container")
 	}
 	glog.V(4).Infof("Have IPv4 address (%s) for DNS64 container", v4Addr)
 
@@ -576,8 +690,8 @@ func RemoveIPv4AddressOnDNS64Server(c *Config) (err error) {
 func AddRouteForDNS64Network(c *Config) error {
 	err := c.General.Hyper.AddV6Route(DNS64Name, c.DNS64.CIDR, c.NAT64.ServerIP)
 	if err != nil {
-		if strings.Contains(err.Error(), "exit status 2") {
-			err = fmt.Errorf("skipping - add route to %s via %s as already exists", c.DNS64.CIDR, c.NAT64.ServerIP)
+		if errors.Is(err, ErrAlreadyExists) {
+			err = existsErrorf("skipping - add route to %s via %s as already exists", c.DNS64.CIDR, c.NAT64.ServerIP)
 			glog.V(1).Infof(err.Error())
 		}
 		return err
@@ -587,22 +701,30 @@ func AddRouteForDNS64Network(c *Config) error {
 }
 
 // PrepareDNS64Server starts up the bind9 DNS64 server. Will use
-// existing container, if running. Will remove IPv4 address in the
-// container and add a route to the container.
+// existing container, if running. Waits for the container to run, and
+// then will remove IPv4 address in the container and add a route to
+// the container.
 func PrepareDNS64Server(c *Config) error {
 	err := EnsureDNS64Server(c)
-	if err != nil && !strings.HasPrefix(err.Error(), "skipping") {
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return err
+	}
+	err = WaitForContainer(DNS64Name, c)
+	if err != nil {
 		return err
 	}
 
 	err = RemoveIPv4AddressOnDNS64Server(c)
-	if err != nil && !strings.HasPrefix(err.Error(), "unable to find IPv4 address") {
+	if err != nil && !errors.Is(err, ErrNotFound) {
 		return err
 	}
 
-	err = AddRouteForDNS64Network(c)
-	if err != nil && !strings.HasPrefix(err.Error(), "skipping") {
-		return err
+	// With Jool, the container's default route, via the host, is used
+	if !UsingJool(c) {
+		err = AddRouteForDNS64Network(c)
+		if err != nil && !errors.Is(err, ErrAlreadyExists) {
+			return err
+		}
 	}
 	glog.Info("Prepared DNS64 container")
 	return nil
@@ -613,25 +735,25 @@ func PrepareDNS64Server(c *Config) error {
 // is deleted first.
 func EnsureNAT64Server(c *Config) (err error) {
 	glog.V(1).Info("Preparing NAT64")
-	state := c.General.Hyper.ResourceState(NAT64Name)
-	if state == ResourceRunning {
-		err = fmt.Errorf("skipping - NAT64 container (%s) already running", NAT64Name)
-		glog.V(1).Info(err.Error())
-		return err
-	}
-	if state == ResourceExists {
-		err = c.General.Hyper.DeleteContainer(NAT64Name)
+	container := ContainerResource{Hyper: c.General.Hyper, Role: "NAT64", Name: NAT64Name, Run: func() error {
+		err := EnsureImage(NAT64Name, c.Images.NAT64, DefaultNAT64Image, c)
 		if err != nil {
-			return fmt.Errorf("unable to remove existing (non-running) NAT64 container: %v", err)
+			return err
 		}
-	}
 
-	// Run NAT64 (tayga) container
-	args := BuildRunArgsForNAT64(c)
-	err = c.General.Hyper.RunContainer("NAT64 container", args)
+		// Run NAT64 (tayga) container
+		args := BuildRunArgsForNAT64(c)
+		return c.General.Hyper.RunContainer("NAT64 container", args)
+	}}
+	present, err := reconcileResource(container)
 	if err != nil {
 		return err
 	}
+	if present {
+		err = existsErrorf("skipping - NAT64 container (%s) already running", NAT64Name)
+		glog.V(1).Info(err.Error())
+		return err
+	}
 	glog.V(1).Infof("NAT64 container (%s) started", NAT64Name)
 	return nil
 }
@@ -641,8 +763,8 @@ func EnsureNAT64Server(c *Config) (err error) {
 func EnsureRouteToNAT64(c *Config) error {
 	err := c.General.NetMgr.AddRouteUsingSupportNetInterface(c.NAT64.V4MappingCIDR, c.NAT64.V4MappingIP, c.Support.V4CIDR)
 	if err != nil {
-		if err.Error() == "file exists" {
-			err = fmt.Errorf("skipping - add route to %s via %s as already exists", c.NAT64.V4MappingCIDR, c.NAT64.V4MappingIP)
+		if errors.Is(err, ErrAlreadyExists) {
+			err = existsErrorf("skipping - add route to %s via %s as already exists", c.NAT64.V4MappingCIDR, c.NAT64.V4MappingIP)
 			glog.V(1).Infof(err.Error())
 		}
 		return err
@@ -651,16 +773,21 @@ func EnsureRouteToNAT64(c *Config) error {
 	return nil
 }
 
-// PrepareNAT64Server starts up the Tayga NAT64 server.
+// PrepareNAT64Server starts up the Tayga NAT64 server, and waits for it
+// to run.
 // NOTE: Will use existing container, if running
 func PrepareNAT64Server(c *Config) error {
 	err := EnsureNAT64Server(c)
-	if err != nil && !strings.HasPrefix(err.Error(), "skipping") {
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
+		return err
+	}
+	err = WaitForContainer(NAT64Name, c)
+	if err != nil {
 		return err
 	}
 
 	err = EnsureRouteToNAT64(c)
-	if err != nil && !strings.HasPrefix(err.Error(), "skipping") {
+	if err != nil && !errors.Is(err, ErrAlreadyExists) {
 		return err
 	}
 	glog.Info("Prepared NAT64 container")
@@ -670,7 +797,8 @@ func PrepareNAT64Server(c *Config) error {
 // Prepare gets ready to start up the cluster. The support network
 // is created (if not on the NAT64/DNS64 node), the NAT64 and DNS64
 // servers are started, and the node is configured for running the
-// cluster.
+// cluster. Lastly, the DNS64 and NAT64 servers are checked to make sure
+// that they are handling traffic.
 func Prepare(name string, c *Config) error {
 	node := c.Topology[name]
 	glog.Infof("Preparing %q", name)
@@ -680,19 +808,30 @@ func Prepare(name string, c *Config) error {
 
 	if c.General.Mode == IPv6NetMode {
 		if node.IsDNS64Server || node.IsNAT64Server {
+			UseServerIPsForNode(&node, c)
 			// TODO: Verify that node has default IPv4 route
 			err = CreateSupportNetwork(c)
-			if err != nil && !strings.HasPrefix(err.Error(), "skipping") {
+			if err != nil && !errors.Is(err, ErrAlreadyExists) {
 				return err
 			}
 		}
-		if node.IsDNS64Server {
+		if node.IsDNS64Server && c.DNS64.Backend == BuiltinDNS64Backend {
+			err = PrepareBuiltinDNS64Server(name, c)
+			if err != nil {
+				return err
+			}
+		} else if node.IsDNS64Server {
 			err = PrepareDNS64Server(c)
 			if err != nil {
 				return err
 			}
 		}
-		if node.IsNAT64Server {
+		if node.IsNAT64Server && UsingJool(c) {
+			err = PrepareJoolNAT64(c)
+			if err != nil {
+				return err
+			}
+		} else if node.IsNAT64Server {
 			err = PrepareNAT64Server(c)
 			if err != nil {
 				return err
@@ -700,11 +839,21 @@ func Prepare(name string, c *Config) error {
 		}
 	}
 	if node.IsMaster || node.IsMinion {
+		err = CheckRuntimeSocket(c)
+		if err != nil {
+			return err
+		}
 		err = PrepareClusterNode(&node, c)
 		if err != nil {
 			return err
 		}
 	}
+	if c.General.Mode == IPv6NetMode && (node.IsDNS64Server || node.IsNAT64Server) {
+		err = CheckServerHealth(&node, c)
+		if err != nil {
+			return err
+		}
+	}
 	glog.Infof("Prepared node %q", name)
 	return nil
 }
@@ -2,6 +2,7 @@ package lazyjack_test
 
 import (
 	"bytes"
+	"errors"
 	"io/ioutil"
 	"os"
 	"path/filepath"
@@ -21,11 +22,15 @@ func TestKubeletDropInContents(t *testing.T) {
 			},
 		},
 	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
 
 	expected := `[Service]
 Environment="KUBELET_DNS_ARGS=--cluster-dns=2001:db8::a --cluster-domain=cluster.local"
 `
-	actual := lazyjack.CreateKubeletDropInContents(c)
+	actual := lazyjack.CreateKubeletDropInContents(n, c)
 	if actual.String() != expected {
 		t.Fatalf("Kubelet drop-in contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual.String())
 	}
@@ -41,11 +46,55 @@ func TestKubeletDropInContentsV4(t *testing.T) {
 			},
 		},
 	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
 
 	expected := `[Service]
 Environment="KUBELET_DNS_ARGS=--cluster-dns=10.96.0.10 --cluster-domain=cluster.local"
 `
-	actual := lazyjack.CreateKubeletDropInContents(c)
+	actual := lazyjack.CreateKubeletDropInContents(n, c)
+	if actual.String() != expected {
+		t.Fatalf("Kubelet drop-in contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual.String())
+	}
+}
+
+func TestKubeletDropInContentsDualStack(t *testing.T) {
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Mode: lazyjack.DualStackNetMode,
+		},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{
+					Prefix: "10.192.0.",
+					Mode:   lazyjack.IPv4NetMode,
+				},
+				{
+					Prefix: "fd00:20::",
+					Mode:   lazyjack.IPv6NetMode,
+				},
+			},
+		},
+		Service: lazyjack.ServiceNetwork{
+			CIDR: "fd00:30::/110",
+			Info: lazyjack.NetInfo{
+				Mode:   lazyjack.IPv6NetMode,
+				Prefix: "fd00:30::",
+			},
+		},
+	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
+
+	expected := `[Service]
+Environment="KUBELET_DNS_ARGS=--cluster-dns=fd00:30::a --cluster-domain=cluster.local"
+Environment="KUBELET_EXTRA_ARGS=--node-ip=fd00:20::10,10.192.0.10"
+`
+	actual := lazyjack.CreateKubeletDropInContents(n, c)
 	if actual.String() != expected {
 		t.Fatalf("Kubelet drop-in contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual.String())
 	}
@@ -60,8 +109,12 @@ func TestCreateKubeletDropInFile(t *testing.T) {
 		Service: lazyjack.ServiceNetwork{CIDR: "2001:db8::/110"},
 		General: lazyjack.GeneralSettings{SystemdArea: basePath},
 	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
 
-	err := lazyjack.CreateKubeletDropInFile(c)
+	err := lazyjack.CreateKubeletDropInFile(n, c)
 	if err != nil {
 		t.Fatalf("FAILURE: Expected to be able to create drop-in file: %s", err.Error())
 	}
@@ -77,8 +130,12 @@ func TestFailureToCreateKubeletDropInFile(t *testing.T) {
 		Service: lazyjack.ServiceNetwork{CIDR: "2001:db8::/110"},
 		General: lazyjack.GeneralSettings{SystemdArea: filepath.Join(basePath, "subdir")},
 	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
 
-	err := lazyjack.CreateKubeletDropInFile(c)
+	err := lazyjack.CreateKubeletDropInFile(n, c)
 	if err == nil {
 		t.Fatalf("FAILURE: Expected not to be able to create area for drop-in file")
 	}
@@ -140,6 +197,63 @@ func TestNamedConfContentsAllowingAAAA(t *testing.T) {
 	}
 }
 
+func TestNamedConfContentsWithOptions(t *testing.T) {
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"master": {ID: 2},
+			"minion": {ID: 3},
+		},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{{Prefix: "fd00:100::"}},
+		},
+		DNS64: lazyjack.DNS64Config{
+			CIDR:             "fd00:10:64:ff9b::/96",
+			CIDRPrefix:       "fd00:10:64:ff9b::",
+			RemoteV4Server:   "8.8.8.8",
+			RemoteServers:    []string{"8.8.4.4", "8.8.8.8", "2001:4860:4860::8888"},
+			Clients:          []string{"fd00:10::/64", "fd00:100::/64"},
+			Mapped:           []string{"!10.0.0.0/8", "any"},
+			Exclude:          []string{"64:ff9b::/96", "::ffff:0:0/96"},
+			LocalZones:       []lazyjack.DNS64Zone{{Name: "example.test"}},
+			TopologyZone:     "lab.test",
+			DNSSECValidation: "no",
+			Recursion:        "yes",
+		},
+	}
+
+	expected := `options {
+    directory "/var/bind";
+    allow-query { any; };
+    forwarders {
+        fd00:10:64:ff9b::8.8.8.8;
+        fd00:10:64:ff9b::8.8.4.4;
+        2001:4860:4860::8888;
+    };
+    auth-nxdomain no;    # conform to RFC1035
+    listen-on-v6 { any; };
+    dnssec-validation no;
+    recursion yes;
+    dns64 fd00:10:64:ff9b::/96 {
+        clients { fd00:10::/64; fd00:100::/64; };
+        mapped { !10.0.0.0/8; any; };
+        exclude { 64:ff9b::/96; ::ffff:0:0/96; };
+    };
+};
+zone "example.test" {
+    type master;
+    file "/etc/bind/db.example.test";
+};
+zone "lab.test" {
+    type master;
+    file "/etc/bind/db.lab.test";
+};
+`
+	actual := lazyjack.CreateNamedConfContents(c)
+	if actual.String() != expected {
+		t.Fatalf("DNS64 named.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual.String())
+	}
+}
+
 func TestCreateSupportNetwork(t *testing.T) {
 	c := &lazyjack.Config{
 		General: lazyjack.GeneralSettings{
@@ -208,6 +322,29 @@ func TestSkippingCreateSupportNetwork(t *testing.T) {
 	}
 }
 
+func TestSkippingCreateSupportNetworkCreatedElsewhere(t *testing.T) {
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Hyper: &MockHypervisor{simNotExists: true, simCreateNetExists: true},
+		},
+		Support: lazyjack.SupportNetwork{
+			Info: lazyjack.NetInfo{
+				Prefix: "2001:db8:10::",
+			},
+			CIDR:   "2001:db8:10::/64",
+			V4CIDR: "172.20.0.0/16",
+		},
+	}
+	err := lazyjack.CreateSupportNetwork(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected support network created elsewhere to be skipped")
+	}
+	expected := "skipping - support network already exists"
+	if err.Error() != expected || !errors.Is(err, lazyjack.ErrAlreadyExists) {
+		t.Fatalf("FAILED: Expected skip msg %q, got %q", expected, err.Error())
+	}
+}
+
 func TestCreateConfigForDNS64(t *testing.T) {
 	volumeMountPoint := TempFileName(os.TempDir(), "-dns64")
 	HelperSetupArea(volumeMountPoint, t)
@@ -234,6 +371,53 @@ func TestCreateConfigForDNS64(t *testing.T) {
 	}
 }
 
+func TestCreateConfigForDNS64WithLocalZones(t *testing.T) {
+	volumeMountPoint := TempFileName(os.TempDir(), "-dns64")
+	HelperSetupArea(volumeMountPoint, t)
+	defer HelperCleanupArea(volumeMountPoint, t)
+
+	c := &lazyjack.Config{
+		DNS64: lazyjack.DNS64Config{
+			CIDR:           "fd00:10:64:ff9b::/96",
+			CIDRPrefix:     "fd00:10:64:ff9b::",
+			RemoteV4Server: "8.8.8.8",
+			ServerIP:       "fd00:10::100",
+			LocalZones: []lazyjack.DNS64Zone{
+				{
+					Name: "example.test",
+					Records: []lazyjack.DNS64Record{
+						{Name: "registry", Value: "fd00:10::50"},
+						{Name: "www", Type: "CNAME", Value: "registry"},
+					},
+				},
+			},
+		},
+		General: lazyjack.GeneralSettings{
+			Hyper: &MockHypervisor{mountPoint: volumeMountPoint},
+		},
+	}
+
+	err := lazyjack.CreateConfigForDNS64(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to create DNS64 config files: %s", err.Error())
+	}
+	zone := filepath.Join(volumeMountPoint, "db.example.test")
+	actual, err := ioutil.ReadFile(zone)
+	if err != nil {
+		t.Fatalf("FAILED: Zone file %q was not created: %s", zone, err.Error())
+	}
+	expected := `$TTL 300
+@ IN SOA ns.example.test. hostmaster.example.test. ( 1 3600 600 86400 300 )
+@ IN NS ns.example.test.
+ns IN AAAA fd00:10::100
+registry IN AAAA fd00:10::50
+www IN CNAME registry
+`
+	if string(actual) != expected {
+		t.Fatalf("FAILED: Zone file contents wrong\nExpected: %s\n  Actual: %s\n", expected, string(actual))
+	}
+}
+
 func TestFailedDeleteVolumeCreateConfigForDNS64(t *testing.T) {
 	volumeMountPoint := TempFileName(os.TempDir(), "-dns64")
 	HelperSetupArea(volumeMountPoint, t)
@@ -816,6 +1000,60 @@ nameserver 8.8.8.8
 
 }
 
+func TestUpdateResolvConfInfoMultipleServers(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		input    []byte
+		expected string
+	}{
+		{
+			name: "prepend all",
+			input: bytes.NewBufferString(`search example.com
+nameserver 8.8.8.8
+nameserver fd00:10::3:100
+`).Bytes(),
+			expected: `search example.com
+nameserver fd00:10::100  #[+]
+nameserver fd00:10::3:100  #[+]
+nameserver 8.8.8.8
+#[-] nameserver fd00:10::3:100
+`,
+		},
+		{
+			name: "already have first",
+			input: bytes.NewBufferString(`search example.com
+nameserver fd00:10::100
+nameserver 8.8.8.8
+`).Bytes(),
+			expected: `search example.com
+nameserver fd00:10::100
+nameserver fd00:10::3:100  #[+]
+nameserver 8.8.8.8
+`,
+		},
+		{
+			name: "rerun",
+			input: bytes.NewBufferString(`search example.com
+nameserver fd00:10::100  #[+]
+nameserver fd00:10::3:100  #[+]
+nameserver 8.8.8.8
+`).Bytes(),
+			expected: `search example.com
+nameserver fd00:10::100  #[+]
+nameserver fd00:10::3:100  #[+]
+nameserver 8.8.8.8
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		actual := lazyjack.UpdateResolvConfInfo(tc.input, "fd00:10::100", "fd00:10::3:100")
+		if string(actual) != tc.expected {
+			t.Errorf("FAILED: [%s] mismatch.\nExpected:\n%s\nActual:\n%s\n", tc.name, tc.expected, string(actual))
+		}
+	}
+}
+
 func TestAddResolvConfEntry(t *testing.T) {
 	basePath := TempFileName(os.TempDir(), "-area")
 	HelperSetupArea(basePath, t)
@@ -1082,7 +1320,11 @@ tokenTTL: 0s
 nodeName: my-master
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -1142,7 +1384,11 @@ tokenTTL: 0s
 nodeName: my-master
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -1327,7 +1573,11 @@ nodeRegistration:
   name: my-master
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -1512,7 +1762,11 @@ nodeRegistration:
   name: my-master
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -1598,7 +1852,11 @@ networking:
   serviceSubnet: "fd00:30::/110"
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -1683,7 +1941,11 @@ networking:
   serviceSubnet: "fd00:30::/110"
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -1883,7 +2145,11 @@ streamingConnectionIdleTimeout: 4h0m0s
 syncFrequency: 1m0s
 volumeStatsAggPeriod: 1m0s
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -2083,7 +2349,11 @@ streamingConnectionIdleTimeout: 4h0m0s
 syncFrequency: 1m0s
 volumeStatsAggPeriod: 1m0s
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -2269,7 +2539,11 @@ nodeRegistration:
   name: my-master
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -2356,7 +2630,11 @@ networking:
   serviceSubnet: "fd00:30::/110"
 unifiedControlPlaneImage: ""
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -2557,7 +2835,11 @@ streamingConnectionIdleTimeout: 4h0m0s
 syncFrequency: 1m0s
 volumeStatsAggPeriod: 1m0s
 `
-	actual := string(lazyjack.CreateKubeAdmConfigContents(n, c))
+	contents, err := lazyjack.CreateKubeAdmConfigContents(n, c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create kubeadm.conf contents: %s", err.Error())
+	}
+	actual := string(contents)
 	if actual != expected {
 		t.Fatalf("FAILED: kubeadm.conf contents wrong\nExpected: %s\n  Actual: %s\n", expected, actual)
 	}
@@ -3837,6 +4119,9 @@ func TestPrepare(t *testing.T) {
 	HelperSetupArea(systemdArea, t)
 	defer HelperCleanupArea(systemdArea, t)
 
+	socket := HelperRuntimeSocket(workArea, t)
+	defer socket.Close()
+
 	nm := lazyjack.NetMgr{Server: &mockNetLink{}}
 	c := &lazyjack.Config{
 		Topology: map[string]lazyjack.Node{
@@ -3853,10 +4138,11 @@ func TestPrepare(t *testing.T) {
 			Hyper: &MockHypervisor{
 				simNotExists: true,
 			},
-			WorkArea:    workArea,
-			EtcArea:     etcArea,
-			SystemdArea: systemdArea,
-			NetMgr:      nm,
+			WorkArea:      workArea,
+			EtcArea:       etcArea,
+			SystemdArea:   systemdArea,
+			NetMgr:        nm,
+			RuntimeSocket: socket.Addr().String(),
 		},
 		Mgmt: lazyjack.ManagementNetwork{
 			Info: [2]lazyjack.NetInfo{
@@ -3973,6 +4259,79 @@ func TestFailPrepDNS64Prepare(t *testing.T) {
 	}
 }
 
+func TestFailPrepDNS64RunNotFoundPrepare(t *testing.T) {
+	workArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(workArea, t)
+	defer HelperCleanupArea(workArea, t)
+
+	volumeMountPoint := TempFileName(os.TempDir(), "-dns64")
+	HelperSetupArea(volumeMountPoint, t)
+	defer HelperCleanupArea(volumeMountPoint, t)
+
+	// Docker command, where the containers do not exist, and the run fails
+	// for a missing image (which must not be treated as a skip).
+	script := filepath.Join(workArea, "docker")
+	contents := `#!/bin/sh
+case "$1 $2" in
+"inspect bind9"|"inspect tayga")
+    echo "Error: No such object: $2" >&2
+    exit 1
+    ;;
+"volume inspect")
+    echo '"` + volumeMountPoint + `"'
+    ;;
+run*)
+    echo "docker: Error response from daemon: manifest for diverdane/bind9:latest not found" >&2
+    exit 125
+    ;;
+esac
+exit 0
+`
+	err := ioutil.WriteFile(script, []byte(contents), 0755)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create docker script: %s", err.Error())
+	}
+
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"master": {
+				ID:            10,
+				IsNAT64Server: true,
+				IsDNS64Server: true,
+			},
+		},
+		General: lazyjack.GeneralSettings{
+			Mode:     lazyjack.IPv6NetMode,
+			Hyper:    &lazyjack.Docker{Command: script},
+			WorkArea: workArea,
+		},
+		DNS64: lazyjack.DNS64Config{
+			CIDR:           "fd00:10:64:ff9b::/96",
+			CIDRPrefix:     "fd00:10:64:ff9b::",
+			RemoteV4Server: "8.8.8.8",
+		},
+		NAT64: lazyjack.NAT64Config{ServerIP: "fd00:10::200"},
+		Support: lazyjack.SupportNetwork{
+			Info: lazyjack.NetInfo{
+				Prefix: "2001:db8:10::",
+			},
+			CIDR:   "2001:db8:10::/64",
+			V4CIDR: "172.20.0.0/16",
+		},
+	}
+	err = lazyjack.Prepare("master", c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected to fail run of DNS64 service")
+	}
+	if lazyjack.IsSkipped(err) {
+		t.Fatalf("FAILED: Expected run failure to not be skipped, got %q", err.Error())
+	}
+	expected := "exit status 125"
+	if !strings.Contains(err.Error(), expected) {
+		t.Fatalf("FAILED: Expected msg to contain %q, got %q", expected, err.Error())
+	}
+}
+
 func TestFailPrepNAT64Prepare(t *testing.T) {
 	workArea := TempFileName(os.TempDir(), "-area")
 	HelperSetupArea(workArea, t)
@@ -4043,6 +4402,9 @@ func TestFailClusterNodePrepare(t *testing.T) {
 	HelperSetupArea(systemdArea, t)
 	defer HelperCleanupArea(systemdArea, t)
 
+	socket := HelperRuntimeSocket(workArea, t)
+	defer socket.Close()
+
 	nm := lazyjack.NetMgr{Server: &mockNetLink{}}
 	c := &lazyjack.Config{
 		Topology: map[string]lazyjack.Node{
@@ -4059,10 +4421,11 @@ func TestFailClusterNodePrepare(t *testing.T) {
 			Hyper: &MockHypervisor{
 				simNotExists: true,
 			},
-			WorkArea:    workArea,
-			EtcArea:     etcArea,
-			SystemdArea: systemdArea,
-			NetMgr:      nm,
+			WorkArea:      workArea,
+			EtcArea:       etcArea,
+			SystemdArea:   systemdArea,
+			NetMgr:        nm,
+			RuntimeSocket: socket.Addr().String(),
 		},
 		Mgmt: lazyjack.ManagementNetwork{
 			Info: [2]lazyjack.NetInfo{
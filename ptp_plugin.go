@@ -42,6 +42,11 @@ func (p PointToPointPlugin) Setup(n *Node) error {
 	return nil
 }
 
+// Verify does nothing, as the PTP plugin has no shared interface to check.
+func (p PointToPointPlugin) Verify(n *Node) error {
+	return nil
+}
+
 // Cleanup performs PTP plugin actions to clean up for a node. Includes
 // deleting routes between nodes.
 func (p PointToPointPlugin) Cleanup(n *Node) error {
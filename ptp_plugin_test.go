@@ -103,7 +103,7 @@ func TestFailedPointToPointPluginCleanup(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected to not be able to remove route")
 	}
-	expected := "unable to remove routes for PTP plugin: unable to delete pod network route for fd00:40:0:0:20::/80 to minion1: mock failure deleting route"
+	expected := "unable to remove routes for PTP plugin: unable to delete pod network route to fd00:40:0:0:20::/80 via fd00:100::20: mock failure deleting route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg to start with %q, got %q", expected, err.Error())
 	}
@@ -203,7 +203,7 @@ func TestFailedPointToPointPluginSetup(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected to not be able to create route")
 	}
-	expected := "unable to add pod network route for fd00:40:30:20:1000::/72 to minion1: mock failure adding route"
+	expected := "unable to add pod network route to fd00:40:30:20:1000::/72 via fd00:100::10: mock failure adding route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
 	}
@@ -0,0 +1,333 @@
+package lazyjack
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Resource is an item of host state (address, route, MTU, file, container,
+// network, or volume) that is managed by lazyjack. The current state can be
+// observed, so that only the missing resources are created.
+type Resource interface {
+	String() string
+	Observe() (bool, error)
+	Create() error
+	Delete() error
+}
+
+// Reconcile observes each resource, in order, and creates the ones that
+// are missing. If the state cannot be observed, creation is attempted, so
+// that any failure is reported by the create. A resource that appears
+// during creation is treated as present.
+func Reconcile(resources ...Resource) error {
+	for _, r := range resources {
+		if _, err := reconcileResource(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// reconcileResource observes the resource, and creates it, if missing,
+// indicating if the resource was already present, so that the caller can
+// report the step as skipped.
+func reconcileResource(r Resource) (bool, error) {
+	present, err := r.Observe()
+	if err != nil {
+		glog.V(4).Infof("Unable to observe %s: %v", r, err)
+	} else if present {
+		glog.V(1).Infof("Skipping - %s already exists", r)
+		return true, nil
+	}
+	err = r.Create()
+	if errors.Is(err, ErrAlreadyExists) {
+		glog.V(1).Infof("Skipping - %s already exists", r)
+		return true, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	glog.V(1).Infof("Created %s", r)
+	return false, nil
+}
+
+// RemoveResources deletes the resources that are present, in reverse
+// order, so that resources are removed before the ones they depend on.
+// All the resources are processed, and the first failure is reported.
+func RemoveResources(resources ...Resource) error {
+	var failed error
+	for i := len(resources) - 1; i >= 0; i-- {
+		r := resources[i]
+		present, err := r.Observe()
+		if err == nil && !present {
+			glog.V(1).Infof("Skipping - no %s to remove", r)
+			continue
+		}
+		err = r.Delete()
+		if errors.Is(err, ErrNotFound) {
+			glog.V(1).Infof("Skipping - no %s to remove", r)
+			continue
+		}
+		if err != nil {
+			if failed == nil {
+				failed = err
+			}
+			continue
+		}
+		glog.V(1).Infof("Removed %s", r)
+	}
+	return failed
+}
+
+// AddressResource is an IP address on an interface.
+type AddressResource struct {
+	NetMgr    Networker
+	IP        string
+	Interface string
+}
+
+func (r AddressResource) String() string {
+	return fmt.Sprintf("address %s on %s", r.IP, r.Interface)
+}
+
+// Observe checks if the address is on the interface.
+func (r AddressResource) Observe() (bool, error) {
+	return r.NetMgr.AddressExists(r.IP, r.Interface)
+}
+
+// Create adds the address to the interface.
+func (r AddressResource) Create() error {
+	return r.NetMgr.AddAddressToLink(r.IP, r.Interface)
+}
+
+// Delete removes the address from the interface.
+func (r AddressResource) Delete() error {
+	return r.NetMgr.RemoveAddressFromLink(r.IP, r.Interface)
+}
+
+// MTUResource is the MTU setting for an interface.
+type MTUResource struct {
+	NetMgr    Networker
+	Interface string
+	MTU       int
+}
+
+func (r MTUResource) String() string {
+	return fmt.Sprintf("MTU %d on %s", r.MTU, r.Interface)
+}
+
+// Observe checks if the interface has the MTU.
+func (r MTUResource) Observe() (bool, error) {
+	mtu, err := r.NetMgr.LinkMTU(r.Interface)
+	return err == nil && mtu == r.MTU, err
+}
+
+// Create sets the MTU on the interface.
+func (r MTUResource) Create() error {
+	return r.NetMgr.SetLinkMTU(r.Interface, r.MTU)
+}
+
+// Delete does nothing, as the MTU is left as is.
+func (r MTUResource) Delete() error {
+	return nil
+}
+
+// RouteResource is the route(s) to a destination, via one or more
+// gateways. The interface is either specified by name, or found using the
+// support network CIDR (with a single gateway).
+type RouteResource struct {
+	NetMgr         Networker
+	Dest           string
+	GWs            []string
+	Interface      string
+	SupportNetCIDR string
+	Routing        string
+}
+
+func (r RouteResource) String() string {
+	return fmt.Sprintf("route to %s via %s", r.Dest, strings.Join(r.GWs, ", "))
+}
+
+// Observe checks if the route(s) are installed.
+func (r RouteResource) Observe() (bool, error) {
+	if r.SupportNetCIDR != "" {
+		return r.NetMgr.RouteExistsUsingSupportNetInterface(r.Dest, r.GWs[0], r.SupportNetCIDR)
+	}
+	return r.NetMgr.RoutesExist(r.Dest, r.GWs, r.Interface, r.Routing)
+}
+
+// Create adds the route(s). If there are already routes to the destination
+// on the interface (via other gateways), they are replaced.
+func (r RouteResource) Create() error {
+	if r.SupportNetCIDR != "" {
+		return r.NetMgr.AddRouteUsingSupportNetInterface(r.Dest, r.GWs[0], r.SupportNetCIDR)
+	}
+	installed, err := r.NetMgr.ListRoutesMatching(r.Dest, "", r.Interface)
+	if err != nil {
+		return err
+	}
+	if len(installed) > 0 {
+		glog.V(1).Infof("Replacing %s, as installed via %v", r, installed)
+		if len(r.GWs) > 1 {
+			return r.NetMgr.ReplaceRoutesUsingInterfaceName(r.Dest, r.GWs, r.Interface, r.Routing)
+		}
+		return r.NetMgr.ReplaceRouteUsingInterfaceName(r.Dest, r.GWs[0], r.Interface)
+	}
+	switch {
+	case len(r.GWs) > 1:
+		return r.NetMgr.AddRoutesUsingInterfaceName(r.Dest, r.GWs, r.Interface, r.Routing)
+	default:
+		return r.NetMgr.AddRouteUsingInterfaceName(r.Dest, r.GWs[0], r.Interface)
+	}
+}
+
+// Delete removes the route(s).
+func (r RouteResource) Delete() error {
+	switch {
+	case r.SupportNetCIDR != "":
+		return r.NetMgr.DeleteRouteUsingSupportNetInterface(r.Dest, r.GWs[0], r.SupportNetCIDR)
+	case len(r.GWs) > 1:
+		return r.NetMgr.DeleteRoutesUsingInterfaceName(r.Dest, r.GWs, r.Interface, r.Routing)
+	default:
+		return r.NetMgr.DeleteRouteUsingInterfaceName(r.Dest, r.GWs[0], r.Interface)
+	}
+}
+
+// FileResource is a file with the desired contents. If a backup is
+// specified, the existing file is saved, before being replaced.
+type FileResource struct {
+	Path     string
+	Backup   string
+	Contents []byte
+	Mode     os.FileMode
+}
+
+func (r FileResource) String() string {
+	return fmt.Sprintf("file %s", r.Path)
+}
+
+// Observe checks if the file has the desired contents.
+func (r FileResource) Observe() (bool, error) {
+	contents, err := FS().ReadFile(r.Path)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(contents, r.Contents), nil
+}
+
+// Create writes the file, creating the area for the file, if needed.
+func (r FileResource) Create() error {
+	err := FS().MkdirAll(filepath.Dir(r.Path), 0755)
+	if err != nil {
+		return fmt.Errorf("unable to create area for %s: %v", r.Path, err)
+	}
+	if r.Backup != "" {
+		return SaveFileContents(r.Contents, r.Path, r.Backup)
+	}
+	return FS().WriteFile(r.Path, r.Contents, r.Mode)
+}
+
+// Delete removes the file.
+func (r FileResource) Delete() error {
+	err := FS().Remove(r.Path)
+	if os.IsNotExist(err) {
+		return notFoundErrorf("skipping - no %s to remove", r.Path)
+	}
+	return err
+}
+
+// ContainerResource is a running container, for a role (e.g. DNS64). The
+// run function starts the container.
+type ContainerResource struct {
+	Hyper Hypervisor
+	Role  string
+	Name  string
+	Run   func() error
+}
+
+func (r ContainerResource) String() string {
+	return fmt.Sprintf("%s container (%s)", r.Role, r.Name)
+}
+
+// Observe checks if the container is running.
+func (r ContainerResource) Observe() (bool, error) {
+	return r.Hyper.ResourceState(r.Name) == ResourceRunning, nil
+}
+
+// Create runs the container, removing any existing (non-running) one.
+func (r ContainerResource) Create() error {
+	if r.Hyper.ResourceState(r.Name) == ResourceExists {
+		err := r.Hyper.DeleteContainer(r.Name)
+		if err != nil {
+			return fmt.Errorf("unable to remove existing (non-running) %s container: %v", r.Role, err)
+		}
+	}
+	return r.Run()
+}
+
+// Delete removes the container.
+func (r ContainerResource) Delete() error {
+	return r.Hyper.DeleteContainer(r.Name)
+}
+
+// NetworkResource is a container network, with IPv6 and IPv4 subnets.
+type NetworkResource struct {
+	Hyper    Hypervisor
+	Name     string
+	CIDR     string
+	V4CIDR   string
+	GWPrefix string
+}
+
+func (r NetworkResource) String() string {
+	return fmt.Sprintf("%s network", r.Name)
+}
+
+// Observe checks if the network exists.
+func (r NetworkResource) Observe() (bool, error) {
+	return r.Hyper.ResourceState(r.Name) != ResourceNotPresent, nil
+}
+
+// Create creates the network.
+func (r NetworkResource) Create() error {
+	return r.Hyper.CreateNetwork(r.Name, r.CIDR, r.V4CIDR, r.GWPrefix)
+}
+
+// Delete removes the network.
+func (r NetworkResource) Delete() error {
+	return r.Hyper.DeleteNetwork(r.Name)
+}
+
+// VolumeResource is a container volume.
+type VolumeResource struct {
+	Hyper Hypervisor
+	Name  string
+}
+
+func (r VolumeResource) String() string {
+	return fmt.Sprintf("%s volume", r.Name)
+}
+
+// Observe checks if the volume exists.
+func (r VolumeResource) Observe() (bool, error) {
+	return r.Hyper.ResourceState(r.Name) != ResourceNotPresent, nil
+}
+
+// Create creates the volume.
+func (r VolumeResource) Create() error {
+	return r.Hyper.CreateVolume(r.Name)
+}
+
+// Delete removes the volume.
+func (r VolumeResource) Delete() error {
+	return r.Hyper.DeleteVolume(r.Name)
+}
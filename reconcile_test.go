@@ -0,0 +1,217 @@
+package lazyjack_test
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+// mockResource records the operations performed on a resource.
+type mockResource struct {
+	name       string
+	present    bool
+	observeErr error
+	createErr  error
+	deleteErr  error
+	ops        *[]string
+}
+
+func (m *mockResource) String() string {
+	return m.name
+}
+
+func (m *mockResource) Observe() (bool, error) {
+	return m.present, m.observeErr
+}
+
+func (m *mockResource) Create() error {
+	*m.ops = append(*m.ops, "create "+m.name)
+	return m.createErr
+}
+
+func (m *mockResource) Delete() error {
+	*m.ops = append(*m.ops, "delete "+m.name)
+	return m.deleteErr
+}
+
+func TestReconcile(t *testing.T) {
+	ops := []string{}
+	err := lazyjack.Reconcile(
+		&mockResource{name: "a", present: true, ops: &ops},
+		&mockResource{name: "b", ops: &ops},
+		&mockResource{name: "c", observeErr: fmt.Errorf("mock observe failure"), ops: &ops},
+		&mockResource{name: "d", createErr: lazyjack.ErrAlreadyExists, ops: &ops},
+	)
+	if err != nil {
+		t.Fatalf("FAILED: Expected reconcile to succeed: %s", err.Error())
+	}
+	expected := "create b, create c, create d"
+	if strings.Join(ops, ", ") != expected {
+		t.Fatalf("FAILED: Expected operations %q, got %q", expected, strings.Join(ops, ", "))
+	}
+}
+
+func TestFailedReconcile(t *testing.T) {
+	ops := []string{}
+	err := lazyjack.Reconcile(
+		&mockResource{name: "a", createErr: fmt.Errorf("mock create failure"), ops: &ops},
+		&mockResource{name: "b", ops: &ops},
+	)
+	if err == nil {
+		t.Fatalf("FAILED: Expected reconcile to fail")
+	}
+	expected := "mock create failure"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+	if strings.Join(ops, ", ") != "create a" {
+		t.Fatalf("FAILED: Expected to stop after failure, got %q", strings.Join(ops, ", "))
+	}
+}
+
+func TestRemoveResources(t *testing.T) {
+	ops := []string{}
+	err := lazyjack.RemoveResources(
+		&mockResource{name: "a", present: true, ops: &ops},
+		&mockResource{name: "b", present: true, deleteErr: fmt.Errorf("mock delete failure"), ops: &ops},
+		&mockResource{name: "c", present: true, deleteErr: lazyjack.ErrNotFound, ops: &ops},
+		&mockResource{name: "d", ops: &ops},
+		&mockResource{name: "e", present: true, deleteErr: fmt.Errorf("mock later failure"), ops: &ops},
+	)
+	if err == nil {
+		t.Fatalf("FAILED: Expected remove to report failure")
+	}
+	expected := "mock later failure"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+	expected = "delete e, delete c, delete b, delete a"
+	if strings.Join(ops, ", ") != expected {
+		t.Fatalf("FAILED: Expected operations %q, got %q", expected, strings.Join(ops, ", "))
+	}
+}
+
+func TestFileResource(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	file := lazyjack.FileResource{
+		Path:     basePath + "/sub/area/file.conf",
+		Contents: []byte("desired\n"),
+		Mode:     0640,
+	}
+	present, err := file.Observe()
+	if err != nil || present {
+		t.Fatalf("FAILED: Expected missing file to not be present (%v)", err)
+	}
+	err = lazyjack.Reconcile(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create file: %s", err.Error())
+	}
+	present, err = file.Observe()
+	if err != nil || !present {
+		t.Fatalf("FAILED: Expected created file to be present (%v)", err)
+	}
+
+	err = ioutil.WriteFile(file.Path, []byte("modified\n"), 0640)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to modify file for test: %s", err.Error())
+	}
+	present, _ = file.Observe()
+	if present {
+		t.Fatalf("FAILED: Expected file with different contents to not be present")
+	}
+
+	// A file that was changed is left alone
+	err = lazyjack.RemoveResources(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected remove to skip modified file: %s", err.Error())
+	}
+	if _, err = os.Stat(file.Path); err != nil {
+		t.Fatalf("FAILED: Expected modified file to be kept: %s", err.Error())
+	}
+
+	err = lazyjack.Reconcile(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to restore file: %s", err.Error())
+	}
+	err = lazyjack.RemoveResources(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to remove file: %s", err.Error())
+	}
+	err = file.Delete()
+	if !errors.Is(err, lazyjack.ErrNotFound) {
+		t.Fatalf("FAILED: Expected not found error for removed file, got %v", err)
+	}
+}
+
+func TestRoutesExist(t *testing.T) {
+	nm := lazyjack.NetMgr{Server: &mockNetLink{}}
+	gws := []string{"2001:db8:30::1", "2001:db8:30::2"}
+	present, err := nm.RoutesExist("fd00:10:64:ff9b::/96", gws, "eth3", lazyjack.ECMPRouting)
+	if err != nil || present {
+		t.Fatalf("FAILED: Expected routes to not be present (%v)", err)
+	}
+	route := lazyjack.RouteResource{
+		NetMgr:    nm,
+		Dest:      "fd00:10:64:ff9b::/96",
+		GWs:       gws,
+		Interface: "eth3",
+		Routing:   lazyjack.ECMPRouting,
+	}
+	err = lazyjack.Reconcile(route)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to add routes: %s", err.Error())
+	}
+	present, err = nm.RoutesExist("fd00:10:64:ff9b::/96", gws, "eth3", lazyjack.ECMPRouting)
+	if err != nil || !present {
+		t.Fatalf("FAILED: Expected routes to be present (%v)", err)
+	}
+	present, _ = nm.RoutesExist("fd00:10:64:ff9b::/96", gws[:1], "eth3", lazyjack.ECMPRouting)
+	if present {
+		t.Fatalf("FAILED: Expected route with different gateways to not be present")
+	}
+}
+
+func TestReconcileReplacesStaleRoute(t *testing.T) {
+	nl := &mockNetLink{}
+	nm := lazyjack.NetMgr{Server: nl}
+	err := nm.AddRouteUsingInterfaceName("fd00:40:0:0:20::/80", "fd00:100::99", "eth1")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to add route for test: %s", err.Error())
+	}
+	route := lazyjack.RouteResource{
+		NetMgr:    nm,
+		Dest:      "fd00:40:0:0:20::/80",
+		GWs:       []string{"fd00:100::20"},
+		Interface: "eth1",
+	}
+	err = lazyjack.Reconcile(route)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to replace route: %s", err.Error())
+	}
+	routes, _ := nm.ListRoutesMatching(route.Dest, "", "eth1")
+	if len(routes) != 1 || routes[0].GWs[0] != "fd00:100::20" {
+		t.Fatalf("FAILED: Expected route via new gateway only, got %+v", routes)
+	}
+}
+
+func TestClassifiedNetlinkErrors(t *testing.T) {
+	nm := lazyjack.NetMgr{Server: &mockNetLink{simRouteExists: true}}
+	err := nm.AddRouteUsingInterfaceName("2001:db8:30::2/64", "2001:db8:30::1", "eth3")
+	if !errors.Is(err, lazyjack.ErrAlreadyExists) {
+		t.Fatalf("FAILED: Expected existing route error, got %v", err)
+	}
+
+	nm = lazyjack.NetMgr{Server: &mockNetLink{simNoRoute: true}}
+	err = nm.DeleteRouteUsingInterfaceName("2001:db8:30::2/64", "2001:db8:30::1", "eth3")
+	if !errors.Is(err, lazyjack.ErrNotFound) {
+		t.Fatalf("FAILED: Expected missing route error, got %v", err)
+	}
+}
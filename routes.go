@@ -0,0 +1,294 @@
+package lazyjack
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// RoutesServiceFile name of the systemd unit that reconciles routes
+	RoutesServiceFile = "lazyjack-routes.service"
+	// RoutesTimerFile name of the systemd timer that runs the routes unit,
+	// on boot and periodically
+	RoutesTimerFile = "lazyjack-routes.timer"
+	// DefaultRoutesInterval is the time between route reconciliations
+	DefaultRoutesInterval = 5 * time.Minute
+	// RoutesBootDelay is the time after boot, before routes are reconciled
+	RoutesBootDelay = 30 * time.Second
+)
+
+// ValidateRoutesInterval ensures that the interval for reconciling routes,
+// if specified, is a positive duration.
+func ValidateRoutesInterval(c *Config) error {
+	if c.General.RoutesInterval == "" {
+		return nil
+	}
+	interval, err := time.ParseDuration(c.General.RoutesInterval)
+	if err != nil || interval < time.Second {
+		return fmt.Errorf("invalid routes-interval %q (use a duration of at least one second, like 5m)", c.General.RoutesInterval)
+	}
+	return nil
+}
+
+// RoutesInterval provides the time between route reconciliations, using
+// the default, if not configured.
+func RoutesInterval(c *Config) time.Duration {
+	interval, err := time.ParseDuration(c.General.RoutesInterval)
+	if err != nil || interval < time.Second {
+		return DefaultRoutesInterval
+	}
+	return interval
+}
+
+// NodeRoutes provides the routes that a master or minion node needs, which
+// are the routes to the DNS64 network and support network (IPv6), and the
+// routes to the pod networks on the other nodes.
+func NodeRoutes(node *Node, c *Config) ([]Resource, error) {
+	var routes []Resource
+	if c.General.Mode == IPv6NetMode {
+		route, err := RouteToNAT64ServerForDNS64Subnet(node, c)
+		if err != nil {
+			return nil, err
+		}
+		if route != nil {
+			routes = append(routes, *route)
+		}
+		others, err := RoutesToSupportNetworkForOtherNodes(node, c)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, others...)
+	}
+	return append(routes, PodNetworkRoutes(node, c)...), nil
+}
+
+// ReconcileRoutes adds any of the node's routes that are missing. All the
+// routes are processed, with the results for each route returned.
+func ReconcileRoutes(name string, c *Config) error {
+	node := c.Topology[name]
+	if !node.IsMaster && !node.IsMinion {
+		return notApplicableErrorf("skipping node %q as role is not master or minion", name)
+	}
+	routes, err := NodeRoutes(&node, c)
+	if err != nil {
+		return err
+	}
+	glog.V(1).Infof("Reconciling %d routes for %q", len(routes), name)
+	results := &MultiError{}
+	for _, route := range routes {
+		err = Reconcile(route)
+		if err != nil {
+			err = fmt.Errorf("unable to add %s: %v", route, err)
+			glog.Warning(err.Error())
+		}
+		results.Add(route.String(), err)
+	}
+	return results.ErrorOrNil()
+}
+
+// podSupernet provides the network that holds the pod subnets for all of
+// the nodes, based on where BuildPodSubnetPrefix places the node ID (a
+// byte, or for IPv6 subnets on a 16 bit boundary, a 16 bit group).
+func podSupernet(pInfo NetInfo) (*net.IPNet, error) {
+	prefix, suffix := BuildPodSubnetPrefix(pInfo.Mode, pInfo.Prefix, pInfo.Size, 0)
+	_, subnet, err := net.ParseCIDR(fmt.Sprintf("%s%s/%d", prefix, suffix, pInfo.Size))
+	if err != nil {
+		return nil, fmt.Errorf("unable to determine pod network for prefix %q: %v", pInfo.Prefix, err)
+	}
+	idBits := 8
+	if pInfo.Mode != IPv4NetMode && pInfo.Size%16 == 0 {
+		idBits = 16
+	}
+	ones, bits := subnet.Mask.Size()
+	mask := net.CIDRMask(ones-idBits, bits)
+	return &net.IPNet{IP: subnet.IP.Mask(mask), Mask: mask}, nil
+}
+
+// routeKey provides a normalized form of the route via the gateway, so
+// that configured and installed routes can be compared.
+func routeKey(dest, gw string) string {
+	if _, cidr, err := net.ParseCIDR(dest); err == nil {
+		dest = cidr.String()
+	}
+	if ip := net.ParseIP(gw); ip != nil {
+		gw = ip.String()
+	}
+	return fmt.Sprintf("%s via %s", dest, gw)
+}
+
+// isPodRoute indicates if the destination is a node's pod subnet, within
+// one of the pod networks.
+func isPodRoute(dest string, pInfos []NetInfo, supernets []*net.IPNet) bool {
+	_, cidr, err := net.ParseCIDR(dest)
+	if err != nil {
+		return false
+	}
+	ones, _ := cidr.Mask.Size()
+	for i, supernet := range supernets {
+		if ones == pInfos[i].Size && supernet.Contains(cidr.IP) {
+			return true
+		}
+	}
+	return false
+}
+
+// SyncPodRoutes makes the installed pod network routes match the nodes in
+// the topology. Routes to the pod subnets of nodes that were added are
+// created, and routes to the pod subnets (or via gateways) of nodes that
+// were removed are deleted. Existing routes are left as is, and all the
+// routes are processed, with the results for each route returned.
+func SyncPodRoutes(name string, c *Config) error {
+	node := c.Topology[name]
+	if !node.IsMaster && !node.IsMinion {
+		return notApplicableErrorf("skipping node %q as role is not master or minion", name)
+	}
+	var pInfos []NetInfo
+	var supernets []*net.IPNet
+	for _, pInfo := range c.Pod.Info {
+		if pInfo.Prefix == "" {
+			continue
+		}
+		supernet, err := podSupernet(pInfo)
+		if err != nil {
+			return err
+		}
+		pInfos = append(pInfos, pInfo)
+		supernets = append(supernets, supernet)
+	}
+	routes := PodNetworkRoutes(&node, c)
+	desired := map[string]bool{}
+	for _, r := range routes {
+		route := r.(RouteResource)
+		desired[routeKey(route.Dest, route.GWs[0])] = true
+	}
+	installed, err := c.General.NetMgr.ListRoutesUsingInterfaceName(node.Interface)
+	if err != nil {
+		return err
+	}
+
+	glog.V(1).Infof("Syncing pod network routes for %q", name)
+	results := &MultiError{}
+	for _, route := range installed {
+		if !isPodRoute(route.Dest, pInfos, supernets) {
+			continue
+		}
+		for _, gw := range route.GWs {
+			if desired[routeKey(route.Dest, gw)] {
+				continue
+			}
+			err = c.General.NetMgr.DeleteRouteUsingInterfaceName(route.Dest, gw, node.Interface)
+			if err != nil && !IsSkipped(err) {
+				err = fmt.Errorf("unable to remove stale pod network route to %s via %s: %v", route.Dest, gw, err)
+				glog.Warning(err.Error())
+			} else if err == nil {
+				glog.Infof("Removed stale pod network route to %s via %s", route.Dest, gw)
+			}
+			results.Add(fmt.Sprintf("remove route to %s via %s", route.Dest, gw), err)
+		}
+	}
+	for _, route := range routes {
+		err = Reconcile(route)
+		if err != nil {
+			err = fmt.Errorf("unable to add %s: %v", route, err)
+			glog.Warning(err.Error())
+		}
+		results.Add(route.String(), err)
+	}
+	glog.Infof("Synced pod network routes for %q", name)
+	return results.ErrorOrNil()
+}
+
+// CreateRoutesServiceContents constructs the contents of the systemd unit
+// file, which reconciles the routes, using the lazyjack executable and
+// config file specified.
+func CreateRoutesServiceContents(exe, host string, c *Config) *bytes.Buffer {
+	contents := bytes.NewBufferString(`[Unit]
+Description=lazyjack route reconciliation
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+`)
+	fmt.Fprintf(contents, "ExecStart=%s --config %s --host %s routes\n", exe, c.General.ConfigFile, host)
+	return contents
+}
+
+// CreateRoutesTimerContents constructs the contents of the systemd timer,
+// which runs the routes unit after boot, and then at the interval.
+func CreateRoutesTimerContents(interval time.Duration) *bytes.Buffer {
+	contents := bytes.NewBufferString(`[Unit]
+Description=Periodic lazyjack route reconciliation
+
+[Timer]
+`)
+	fmt.Fprintf(contents, "OnBootSec=%ds\n", int(RoutesBootDelay.Seconds()))
+	fmt.Fprintf(contents, "OnUnitActiveSec=%ds\n", int(interval.Seconds()))
+	fmt.Fprintf(contents, `
+[Install]
+WantedBy=timers.target
+`)
+	return contents
+}
+
+// InstallRoutesUnit creates the systemd unit and timer, for reconciling
+// routes, and starts the timer.
+func InstallRoutesUnit(host string, c *Config) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("unable to determine lazyjack executable for routes service: %v", err)
+	}
+	files := map[string]*bytes.Buffer{
+		RoutesServiceFile: CreateRoutesServiceContents(exe, host, c),
+		RoutesTimerFile:   CreateRoutesTimerContents(RoutesInterval(c)),
+	}
+	for _, name := range []string{RoutesServiceFile, RoutesTimerFile} {
+		unit := filepath.Join(SystemdUnitArea(c), name)
+		err = FS().WriteFile(unit, files[name].Bytes(), 0644)
+		if err != nil {
+			return fmt.Errorf("unable to create systemd unit %s for routes: %v", unit, err)
+		}
+		glog.V(1).Infof("Created %s", unit)
+	}
+	for _, args := range [][]string{{"daemon-reload"}, {"enable", "--now", RoutesTimerFile}} {
+		_, err = DoExecCommand("systemctl", args)
+		if err != nil {
+			return fmt.Errorf("unable to start routes timer: %v", err)
+		}
+	}
+	glog.Info("Installed routes unit")
+	return nil
+}
+
+// RemoveRoutesUnit stops the routes timer, and removes the systemd unit
+// and timer.
+func RemoveRoutesUnit(c *Config) error {
+	glog.V(1).Info("Removing routes unit")
+	_, err := DoExecCommand("systemctl", []string{"disable", "--now", RoutesTimerFile})
+	if err != nil {
+		glog.V(4).Infof("Unable to stop routes timer: %v", err)
+	}
+	removed := 0
+	for _, name := range []string{RoutesTimerFile, RoutesServiceFile} {
+		unit := filepath.Join(SystemdUnitArea(c), name)
+		err = FS().Remove(unit)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("unable to remove systemd unit %s for routes: %v", unit, err)
+		}
+		if err == nil {
+			removed++
+		}
+	}
+	if removed == 0 {
+		return notFoundErrorf("skipping - no routes unit to remove")
+	}
+	DoExecCommand("systemctl", []string{"daemon-reload"})
+	glog.Info("Removed routes unit")
+	return nil
+}
@@ -0,0 +1,229 @@
+package lazyjack_test
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func TestValidateRoutesInterval(t *testing.T) {
+	var testCases = []struct {
+		name     string
+		interval string
+		expected time.Duration
+		valid    bool
+	}{
+		{name: "default", interval: "", expected: lazyjack.DefaultRoutesInterval, valid: true},
+		{name: "minutes", interval: "10m", expected: 10 * time.Minute, valid: true},
+		{name: "too short", interval: "500ms", valid: false},
+		{name: "not a duration", interval: "often", valid: false},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{General: lazyjack.GeneralSettings{RoutesInterval: tc.interval}}
+		err := lazyjack.ValidateRoutesInterval(c)
+		if tc.valid && err != nil {
+			t.Errorf("FAILED: [%s] Expected interval to be valid: %s", tc.name, err.Error())
+		} else if !tc.valid && err == nil {
+			t.Errorf("FAILED: [%s] Expected interval to be invalid", tc.name)
+		} else if tc.valid && lazyjack.RoutesInterval(c) != tc.expected {
+			t.Errorf("FAILED: [%s] Expected interval %v, got %v", tc.name, tc.expected, lazyjack.RoutesInterval(c))
+		}
+	}
+}
+
+func TestCreateRoutesUnitContents(t *testing.T) {
+	c := &lazyjack.Config{General: lazyjack.GeneralSettings{ConfigFile: "/root/config.yaml"}}
+	expected := `[Unit]
+Description=lazyjack route reconciliation
+Wants=network-online.target
+After=network-online.target
+
+[Service]
+Type=oneshot
+ExecStart=/usr/bin/lazyjack --config /root/config.yaml --host minion1 routes
+`
+	actual := lazyjack.CreateRoutesServiceContents("/usr/bin/lazyjack", "minion1", c)
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Service contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+
+	expected = `[Unit]
+Description=Periodic lazyjack route reconciliation
+
+[Timer]
+OnBootSec=30s
+OnUnitActiveSec=120s
+
+[Install]
+WantedBy=timers.target
+`
+	actual = lazyjack.CreateRoutesTimerContents(2 * time.Minute)
+	if actual.String() != expected {
+		t.Fatalf("FAILED: Timer contents wrong\nExpected:\n%s\n  Actual:\n%s\n", expected, actual.String())
+	}
+}
+
+func TestPodNetworkRoutes(t *testing.T) {
+	c := HelperRunnerConfig("")
+	node := c.Topology["master"]
+	routes := lazyjack.PodNetworkRoutes(&node, c)
+	if len(routes) != 1 {
+		t.Fatalf("FAILED: Expected one route to minion pod network, got %v", routes)
+	}
+	expected := "route to fd00:40:0:020::/80 via fd00:100::20"
+	if routes[0].String() != expected {
+		t.Fatalf("FAILED: Expected %q, got %q", expected, routes[0].String())
+	}
+
+	node = c.Topology["other"]
+	if routes = lazyjack.PodNetworkRoutes(&node, c); len(routes) != 0 {
+		t.Fatalf("FAILED: Expected no routes for node not in cluster, got %v", routes)
+	}
+}
+
+func TestReconcileRoutes(t *testing.T) {
+	nl := &mockNetLink{}
+	c := HelperRunnerConfig("")
+	c.General.NetMgr = lazyjack.NetMgr{Server: nl}
+
+	err := lazyjack.ReconcileRoutes("master", c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to reconcile routes: %s", err.Error())
+	}
+	if nl.CallCount() != 1 {
+		t.Fatalf("FAILED: Expected route to be added, got %d calls", nl.CallCount())
+	}
+	err = lazyjack.ReconcileRoutes("master", c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to reconcile routes again: %s", err.Error())
+	}
+	if nl.CallCount() != 1 {
+		t.Fatalf("FAILED: Expected existing route to be left as is, got %d calls", nl.CallCount())
+	}
+
+	err = lazyjack.ReconcileRoutes("other", c)
+	if !lazyjack.IsSkipped(err) {
+		t.Fatalf("FAILED: Expected node not in cluster to be skipped, got %v", err)
+	}
+	if !errors.Is(err, lazyjack.ErrNotApplicable) || errors.Is(err, lazyjack.ErrNotFound) {
+		t.Fatalf("FAILED: Expected node not in cluster to be not applicable, got %v", err)
+	}
+
+	c.General.NetMgr = lazyjack.NetMgr{Server: &mockNetLink{simRouteAddFail: true}}
+	err = lazyjack.ReconcileRoutes("master", c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure to add route")
+	}
+	expected := "unable to add route to fd00:40:0:020::/80 via fd00:100::20: mock failure adding route"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestInstallAndRemoveRoutesUnit(t *testing.T) {
+	unitArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(unitArea, t)
+	defer HelperCleanupArea(unitArea, t)
+
+	cmds := &joolCommands{}
+	lazyjack.RegisterExecCommand(cmds.Exec)
+	defer lazyjack.RegisterExecCommand(lazyjack.OsExecCommand)
+
+	c := &lazyjack.Config{General: lazyjack.GeneralSettings{
+		SystemdArea:    filepath.Join(unitArea, "kubelet.service.d"),
+		RoutesInterval: "1m",
+	}}
+	err := lazyjack.InstallRoutesUnit("master", c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to install routes unit: %s", err.Error())
+	}
+	timer, err := ioutil.ReadFile(filepath.Join(unitArea, lazyjack.RoutesTimerFile))
+	if err != nil || !strings.Contains(string(timer), "OnUnitActiveSec=60s") {
+		t.Fatalf("FAILED: Expected timer with interval, got %q (%v)", string(timer), err)
+	}
+	if _, err := os.Stat(filepath.Join(unitArea, lazyjack.RoutesServiceFile)); err != nil {
+		t.Fatalf("FAILED: Expected service to be created: %s", err.Error())
+	}
+
+	err = lazyjack.RemoveRoutesUnit(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to remove routes unit: %s", err.Error())
+	}
+	expected := "systemctl daemon-reload, systemctl enable --now lazyjack-routes.timer, " +
+		"systemctl disable --now lazyjack-routes.timer, systemctl daemon-reload"
+	if strings.Join(cmds.invoked, ", ") != expected {
+		t.Fatalf("FAILED: Expected commands %q, got %q", expected, strings.Join(cmds.invoked, ", "))
+	}
+	err = lazyjack.RemoveRoutesUnit(c)
+	if !lazyjack.IsSkipped(err) {
+		t.Fatalf("FAILED: Expected removal to be skipped, when no unit, got %v", err)
+	}
+}
+
+func TestSyncPodRoutes(t *testing.T) {
+	nl := &mockNetLink{}
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"master":  {Name: "master", ID: 0x10, Interface: "eth1", IsMaster: true},
+			"minion1": {Name: "minion1", ID: 0x20, Interface: "eth1", IsMinion: true},
+			"minion3": {Name: "minion3", ID: 0x40, Interface: "eth1", IsMinion: true},
+		},
+		General: lazyjack.GeneralSettings{NetMgr: lazyjack.NetMgr{Server: nl}},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{{Prefix: "fd00:100::", Mode: lazyjack.IPv6NetMode, Size: 64}},
+		},
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{{Prefix: "fd00:40:0:0:", Mode: lazyjack.IPv6NetMode, Size: 80}},
+		},
+	}
+	// Existing routes for minion1, removed minion2, and a non-pod network
+	for _, route := range [][2]string{
+		{"fd00:40:0:0:20::/80", "fd00:100::20"},
+		{"fd00:40:0:0:30::/80", "fd00:100::30"},
+		{"fd00:10::/64", "fd00:100::2"},
+	} {
+		r, err := lazyjack.BuildRoute(route[0], route[1], 0x10)
+		if err != nil {
+			t.Fatalf("ERROR: Unable to build route for test: %s", err.Error())
+		}
+		nl.RouteAdd(r)
+	}
+
+	err := lazyjack.SyncPodRoutes("master", c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to sync routes: %s", err.Error())
+	}
+	routes, _ := c.General.NetMgr.ListRoutesUsingInterfaceName("eth1")
+	var actual []string
+	for _, r := range routes {
+		actual = append(actual, r.Dest+" via "+strings.Join(r.GWs, ","))
+	}
+	expected := "fd00:40:0:0:20::/80 via fd00:100::20, fd00:10::/64 via fd00:100::2, fd00:40:0:0:40::/80 via fd00:100::40"
+	if strings.Join(actual, ", ") != expected {
+		t.Fatalf("FAILED: Expected routes %q, got %q", expected, strings.Join(actual, ", "))
+	}
+
+	// Nothing to do, when in sync
+	nl.ResetCallCount()
+	err = lazyjack.SyncPodRoutes("master", c)
+	if err != nil || nl.CallCount() != 0 {
+		t.Fatalf("FAILED: Expected no changes, when in sync, got %d changes (%v)", nl.CallCount(), err)
+	}
+
+	nl.simRouteDelFail = true
+	delete(c.Topology, "minion3")
+	err = lazyjack.SyncPodRoutes("master", c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failure to remove stale route")
+	}
+	expected = "unable to remove stale pod network route to fd00:40:0:0:40::/80 via fd00:100::40: mock failure deleting route"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
@@ -0,0 +1,315 @@
+package lazyjack
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/golang/glog"
+)
+
+// Logger reports the progress of the commands performed by a Runner. It
+// only gets a line when a command starts, and one with the outcome of the
+// command (with any failed or skipped steps). The details of the
+// operations, within a command, are logged with glog.
+type Logger interface {
+	Infof(format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
+
+type glogLogger struct{}
+
+func (glogLogger) Infof(format string, args ...interface{}) {
+	glog.Infof(format, args...)
+}
+
+func (glogLogger) Warningf(format string, args ...interface{}) {
+	glog.Warningf(format, args...)
+}
+
+// Option customizes a Runner.
+type Option func(*Runner)
+
+// WithNetworker uses the networker for network operations, instead of the
+// one set up, when the config was validated.
+func WithNetworker(n Networker) Option {
+	return func(r *Runner) {
+		r.config.General.NetMgr = n
+	}
+}
+
+// WithHypervisor uses the hypervisor for container operations, instead of
+// the one set up, when the config was validated.
+func WithHypervisor(h Hypervisor) Option {
+	return func(r *Runner) {
+		r.config.General.Hyper = h
+	}
+}
+
+// WithExecCommand uses the function to perform OS commands.
+func WithExecCommand(cmd ExecCommandFuncType) Option {
+	return func(r *Runner) {
+		r.exec = cmd
+	}
+}
+
+// WithFileSystem uses the filesystem for file operations (e.g. a MemFS for
+// a dry run).
+func WithFileSystem(fs FileSystem) Option {
+	return func(r *Runner) {
+		r.fs = fs
+	}
+}
+
+// WithRoot places the files that are created under the root directory,
+// using a RootFS.
+func WithRoot(root string) Option {
+	return WithFileSystem(RootFS{Root: root})
+}
+
+// WithImageRoot makes Prepare and Up apply the file-level changes to the
+// image mounted at the root directory, along with a first boot unit that
+// performs the rest, when the image is booted.
+func WithImageRoot(root string) Option {
+	return func(r *Runner) {
+		r.imageRoot = root
+	}
+}
+
+// WithLogger reports the start and outcome of each command with the
+// logger, instead of glog. The details of the operations are still logged
+// with glog.
+func WithLogger(l Logger) Option {
+	return func(r *Runner) {
+		r.logger = l
+	}
+}
+
+// WithConfigFile specifies the config file that is updated by Init.
+func WithConfigFile(file string) Option {
+	return func(r *Runner) {
+		r.configFile = file
+	}
+}
+
+// Result has the outcome of a command performed by a Runner. Each step has
+// its result, with skipped steps having a SkipError.
+type Result struct {
+	Command  string
+	Host     string
+	Duration time.Duration
+	Steps    []StepResult
+}
+
+// Skipped indicates if the command, or any of its steps, was skipped.
+func (r *Result) Skipped() bool {
+	for _, step := range r.Steps {
+		if IsSkipped(step.Err) {
+			return true
+		}
+	}
+	return false
+}
+
+// Runner performs the lazyjack commands for a host, using a validated
+// configuration. Commands are performed one at a time, as the OS command
+// function and filesystem are shared.
+//
+// Cancellation only takes effect between commands. The context is checked
+// before and after the command is performed, so a canceled command still
+// performs all of its steps (OS commands, netlink calls, and waiting for
+// containers), and then returns the context's error. Only the Docker Engine
+// API calls are aborted, when the context is canceled.
+type Runner struct {
+	host       string
+	config     *Config
+	configFile string
+	imageRoot  string
+	fs         FileSystem
+	exec       ExecCommandFuncType
+	logger     Logger
+}
+
+// runLock serializes the commands from all runners.
+var runLock sync.Mutex
+
+// copyConfig makes a deep copy of the config, including the topology and
+// the lists of settings, with the CNI plugin using the copy. The networker
+// and hypervisor are shared with the original.
+func copyConfig(orig *Config) *Config {
+	c := *orig
+	c.Topology = make(map[string]Node, len(orig.Topology))
+	for name, node := range orig.Topology {
+		c.Topology[name] = node
+	}
+	c.DNS64.RemoteServers = append([]string(nil), orig.DNS64.RemoteServers...)
+	c.DNS64.Exclude = append([]string(nil), orig.DNS64.Exclude...)
+	c.DNS64.Clients = append([]string(nil), orig.DNS64.Clients...)
+	c.DNS64.Mapped = append([]string(nil), orig.DNS64.Mapped...)
+	c.DNS64.LocalZones = nil
+	for _, zone := range orig.DNS64.LocalZones {
+		zone.Records = append([]DNS64Record(nil), zone.Records...)
+		c.DNS64.LocalZones = append(c.DNS64.LocalZones, zone)
+	}
+	c.KubeAdm.Patches = append([]KubeAdmPatch(nil), orig.KubeAdm.Patches...)
+	c.Images.DNS64.ExtraArgs = append([]string(nil), orig.Images.DNS64.ExtraArgs...)
+	c.Images.NAT64.ExtraArgs = append([]string(nil), orig.Images.NAT64.ExtraArgs...)
+	switch c.General.CNIPlugin.(type) {
+	case BridgePlugin:
+		c.General.CNIPlugin = BridgePlugin{&c}
+	case PointToPointPlugin:
+		c.General.CNIPlugin = PointToPointPlugin{&c}
+	}
+	return &c
+}
+
+// NewRunner creates a runner to perform commands on the host, using a deep
+// copy of the config (which must have been validated), customized by the
+// options. The caller's config is not modified, but the networker and
+// hypervisor (unless replaced by an option) are shared with it.
+func NewRunner(host string, c *Config, opts ...Option) (*Runner, error) {
+	if c == nil {
+		return nil, fmt.Errorf("no configuration loaded")
+	}
+	c = copyConfig(c)
+	r := &Runner{host: host, config: c, configFile: c.General.ConfigFile, logger: glogLogger{}}
+	for _, opt := range opts {
+		opt(r)
+	}
+	if err := ValidateHost(host, c); err != nil {
+		return nil, err
+	}
+	if r.imageRoot != "" {
+		runLock.Lock()
+		defer runLock.Unlock()
+		defer r.use()()
+		if err := SetupImageRoot(r.imageRoot, c); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// Config provides the configuration used by the runner.
+func (r *Runner) Config() *Config {
+	return r.config
+}
+
+// use makes the runner's OS command function and filesystem the ones used
+// for operations, returning a function that restores the prior ones.
+func (r *Runner) use() func() {
+	savedExec, savedFS := execCommand, fileSystem
+	if r.exec != nil {
+		execCommand = r.exec
+	}
+	if r.fs != nil {
+		fileSystem = r.fs
+	}
+	return func() {
+		execCommand, fileSystem = savedExec, savedFS
+	}
+}
+
+// run performs the command, if the context has not been canceled. The
+// context is not checked between the steps of the command; it is checked
+// again after the command, and is otherwise only used by the Docker Engine
+// API hypervisor. The returned error is nil, if
+// every unsuccessful step was just skipped.
+func (r *Runner) run(ctx context.Context, command string, op func() error) (*Result, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	runLock.Lock()
+	defer runLock.Unlock()
+
+	defer r.use()()
+	if api, ok := r.config.General.Hyper.(*DockerAPI); ok {
+		r.config.General.Hyper = api.WithContext(ctx)
+		defer func() { r.config.General.Hyper = api }()
+	}
+
+	r.logger.Infof("Performing %q on %q", command, r.host)
+	start := time.Now()
+	err := op()
+	result := &Result{Command: command, Host: r.host, Duration: time.Since(start)}
+	var multi *MultiError
+	if errors.As(err, &multi) {
+		result.Steps = multi.Results
+		if len(multi.Failed()) > 0 {
+			r.logger.Warningf("Command %q on %q failed: %v", command, r.host, err)
+			return result, err
+		}
+	} else {
+		result.Steps = []StepResult{{Step: command, Err: err}}
+		if err != nil && !IsSkipped(err) {
+			r.logger.Warningf("Command %q on %q failed: %v", command, r.host, err)
+			return result, err
+		}
+	}
+	if err != nil {
+		r.logger.Infof("Command %q on %q skipped steps: %v", command, r.host, err)
+	}
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return result, ctxErr
+	}
+	r.logger.Infof("Command %q on %q completed in %v", command, r.host, result.Duration)
+	return result, nil
+}
+
+// Init creates the certificates and token for the cluster, updating the
+// config file.
+func (r *Runner) Init(ctx context.Context) (*Result, error) {
+	return r.run(ctx, "init", func() error {
+		return Initialize(r.host, r.config, r.configFile)
+	})
+}
+
+// Prepare sets up the host (or image) for the cluster.
+func (r *Runner) Prepare(ctx context.Context) (*Result, error) {
+	return r.run(ctx, "prepare", func() error {
+		if r.config.General.ImageRoot != "" {
+			return PrepareImage(r.host, r.config)
+		}
+		return Prepare(r.host, r.config)
+	})
+}
+
+// Up brings up the cluster on the host (or sets up the image to do so).
+func (r *Runner) Up(ctx context.Context) (*Result, error) {
+	return r.run(ctx, "up", func() error {
+		if r.config.General.ImageRoot != "" {
+			return UpImage(r.host, r.config)
+		}
+		return BringUp(r.host, r.config)
+	})
+}
+
+// Down brings down the cluster on the host.
+func (r *Runner) Down(ctx context.Context) (*Result, error) {
+	return r.run(ctx, "down", func() error {
+		return TearDown(r.host, r.config)
+	})
+}
+
+// Routes adds any of the host's routes that are missing.
+func (r *Runner) Routes(ctx context.Context) (*Result, error) {
+	return r.run(ctx, "routes", func() error {
+		return ReconcileRoutes(r.host, r.config)
+	})
+}
+
+// SyncRoutes makes the host's pod network routes match the topology.
+func (r *Runner) SyncRoutes(ctx context.Context) (*Result, error) {
+	return r.run(ctx, "sync-routes", func() error {
+		return SyncPodRoutes(r.host, r.config)
+	})
+}
+
+// Clean reverts the changes made to the host by Prepare.
+func (r *Runner) Clean(ctx context.Context) (*Result, error) {
+	return r.run(ctx, "clean", func() error {
+		return Cleanup(r.host, r.config)
+	})
+}
@@ -0,0 +1,220 @@
+package lazyjack_test
+
+import (
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+// recordingLogger keeps the progress messages from a runner.
+type recordingLogger struct {
+	warnings int
+	infos    int
+}
+
+func (l *recordingLogger) Infof(format string, args ...interface{}) {
+	l.infos++
+}
+
+func (l *recordingLogger) Warningf(format string, args ...interface{}) {
+	l.warnings++
+}
+
+func HelperRunnerConfig(cniArea string) *lazyjack.Config {
+	c := &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"master": {
+				Name:      "master",
+				ID:        0x10,
+				Interface: "eth1",
+				IsMaster:  true,
+			},
+			"minion1": {
+				Name:      "minion1",
+				ID:        0x20,
+				Interface: "eth1",
+				IsMinion:  true,
+			},
+			"other": {
+				Name: "other",
+				ID:   0x30,
+			},
+		},
+		General: lazyjack.GeneralSettings{
+			CNIArea: cniArea,
+			Plugin:  "bridge",
+		},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{
+					Prefix: "fd00:100::",
+				},
+			},
+		},
+		Pod: lazyjack.PodNetwork{
+			Info: [2]lazyjack.NetInfo{
+				{
+					Prefix: "fd00:40:0:0",
+					Size:   80,
+				},
+			},
+		},
+	}
+	c.General.CNIPlugin = lazyjack.BridgePlugin{c}
+	return c
+}
+
+func TestNewRunner(t *testing.T) {
+	c := HelperRunnerConfig("/etc/cni/net.d")
+
+	_, err := lazyjack.NewRunner("unknown", c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected runner to fail for unknown host")
+	}
+
+	nm := lazyjack.NetMgr{Server: &mockNetLink{}}
+	hyper := &MockHypervisor{}
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithNetworker(nm), lazyjack.WithHypervisor(hyper))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	if r.Config().General.Hyper != hyper {
+		t.Fatalf("FAILED: Expected hypervisor option to be used")
+	}
+	if r.Config().General.NetMgr != nm {
+		t.Fatalf("FAILED: Expected networker option to be used")
+	}
+	if c.General.Hyper == hyper || c.General.NetMgr == nm {
+		t.Fatalf("FAILED: Expected options to not change the caller's config")
+	}
+
+	node := r.Config().Topology["master"]
+	node.Interface = "eth2"
+	r.Config().Topology["master"] = node
+	if c.Topology["master"].Interface != "eth1" {
+		t.Fatalf("FAILED: Expected runner's topology to be a copy of the caller's")
+	}
+}
+
+func TestRunnerWithFileSystem(t *testing.T) {
+	fs := lazyjack.NewMemFS()
+	fs.MkdirAll("/etc/cni/net.d", 0755)
+	fs.WriteFile("/etc/cni/net.d/cni.conf", []byte("# empty file"), 0644)
+
+	cmds := &joolCommands{}
+	c := HelperRunnerConfig("/etc/cni/net.d")
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithFileSystem(fs), lazyjack.WithExecCommand(cmds.Exec),
+		lazyjack.WithNetworker(lazyjack.NetMgr{Server: &mockNetLink{}}), lazyjack.WithLogger(&recordingLogger{}))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	_, err = r.Down(context.Background())
+	if err != nil {
+		t.Fatalf("FAILED: Expected down to succeed: %s", err.Error())
+	}
+	if _, err = fs.Stat("/etc/cni/net.d"); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected CNI area to be removed from filesystem, got %v", err)
+	}
+	if lazyjack.FS() != (lazyjack.OsFS{}) {
+		t.Fatalf("FAILED: Expected filesystem to be restored after command")
+	}
+}
+
+func TestRunnerDown(t *testing.T) {
+	cniArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(cniArea, t)
+	defer HelperCleanupArea(cniArea, t)
+
+	cmds := &joolCommands{}
+	logger := &recordingLogger{}
+	c := HelperRunnerConfig(cniArea)
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithExecCommand(cmds.Exec),
+		lazyjack.WithNetworker(lazyjack.NetMgr{Server: &mockNetLink{}}), lazyjack.WithLogger(logger))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	result, err := r.Down(context.Background())
+	if err != nil {
+		t.Fatalf("FAILED: Expected down to succeed: %s", err.Error())
+	}
+	if result.Command != "down" || result.Host != "master" || len(result.Steps) != 1 || result.Steps[0].Err != nil {
+		t.Fatalf("FAILED: Unexpected result %+v", result)
+	}
+	expected := "kubeadm reset -f"
+	if strings.Join(cmds.invoked, ", ") != expected {
+		t.Fatalf("FAILED: Expected commands %q, got %q", expected, strings.Join(cmds.invoked, ", "))
+	}
+	if logger.infos == 0 || logger.warnings != 0 {
+		t.Fatalf("FAILED: Expected only progress messages, got %d info and %d warnings", logger.infos, logger.warnings)
+	}
+}
+
+func TestFailedRunnerDown(t *testing.T) {
+	cniArea := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(cniArea, t)
+	defer HelperCleanupArea(cniArea, t)
+
+	cmds := &joolCommands{failCommand: "kubeadm"}
+	logger := &recordingLogger{}
+	c := HelperRunnerConfig(cniArea)
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithExecCommand(cmds.Exec),
+		lazyjack.WithNetworker(lazyjack.NetMgr{Server: &mockNetLink{}}), lazyjack.WithLogger(logger))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	result, err := r.Down(context.Background())
+	if err == nil {
+		t.Fatalf("FAILED: Expected down to fail")
+	}
+	var results *lazyjack.MultiError
+	if !errors.As(err, &results) {
+		t.Fatalf("FAILED: Expected step results, got %T", err)
+	}
+	failed := results.Failed()
+	if len(failed) != 1 || failed[0].Step != "reset cluster" {
+		t.Fatalf("FAILED: Expected reset step to fail, got %+v", failed)
+	}
+	if len(result.Steps) != 2 || result.Steps[1].Err != nil {
+		t.Fatalf("FAILED: Expected plugin to still be cleaned, got %+v", result.Steps)
+	}
+	if logger.warnings != 1 {
+		t.Fatalf("FAILED: Expected failure to be logged")
+	}
+}
+
+func TestSkippedRunnerUp(t *testing.T) {
+	c := HelperRunnerConfig("")
+	r, err := lazyjack.NewRunner("other", c, lazyjack.WithLogger(&recordingLogger{}))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	result, err := r.Up(context.Background())
+	if err != nil {
+		t.Fatalf("FAILED: Expected up to be skipped, without error: %s", err.Error())
+	}
+	if !result.Skipped() {
+		t.Fatalf("FAILED: Expected result to show up was skipped")
+	}
+}
+
+func TestCanceledRunner(t *testing.T) {
+	cmds := &joolCommands{}
+	c := HelperRunnerConfig("")
+	r, err := lazyjack.NewRunner("master", c, lazyjack.WithExecCommand(cmds.Exec), lazyjack.WithLogger(&recordingLogger{}))
+	if err != nil {
+		t.Fatalf("FAILED: Expected to create runner: %s", err.Error())
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	result, err := r.Down(ctx)
+	if !errors.Is(err, context.Canceled) {
+		t.Fatalf("FAILED: Expected canceled error, got %v", err)
+	}
+	if result != nil || len(cmds.invoked) != 0 {
+		t.Fatalf("FAILED: Expected command to not be performed")
+	}
+}
@@ -0,0 +1,128 @@
+package lazyjack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// DockerRuntime uses Docker, via dockershim (or cri-dockerd for V1.24+)
+	DockerRuntime = "docker"
+	// ContainerdRuntime uses containerd's CRI plugin
+	ContainerdRuntime = "containerd"
+	// CRIORuntime uses CRI-O
+	CRIORuntime = "cri-o"
+
+	// DockerSocket is the Docker daemon's socket
+	DockerSocket = "/var/run/docker.sock"
+	// DockerShimSocket is the CRI socket created by kubelet for Docker (pre V1.24)
+	DockerShimSocket = "/var/run/dockershim.sock"
+	// CRIDockerdSocket is the CRI socket for Docker, using cri-dockerd (V1.24+)
+	CRIDockerdSocket = "/var/run/cri-dockerd.sock"
+	// ContainerdSocket is the containerd CRI socket
+	ContainerdSocket = "/var/run/containerd/containerd.sock"
+	// CRIOSocket is the CRI-O CRI socket
+	CRIOSocket = "/var/run/crio/crio.sock"
+)
+
+// ValidateRuntime ensures that the container runtime, if specified, is
+// supported. The runtime socket, if specified, must be a path, as the
+// kubeadm.conf templates add the unix:// scheme, where needed (a scheme in
+// the config is removed).
+func ValidateRuntime(c *Config) error {
+	socket := strings.TrimPrefix(c.General.RuntimeSocket, "unix://")
+	if socket != "" && !filepath.IsAbs(socket) {
+		return fmt.Errorf("invalid runtime-socket %q (use the path of a unix socket)", c.General.RuntimeSocket)
+	}
+	c.General.RuntimeSocket = socket
+
+	c.General.Runtime = strings.ToLower(c.General.Runtime)
+	switch c.General.Runtime {
+	case "", DockerRuntime, ContainerdRuntime, CRIORuntime:
+		return nil
+	default:
+		return fmt.Errorf("unsupported container runtime %q (use %s, %s, or %s)", c.General.Runtime, DockerRuntime, ContainerdRuntime, CRIORuntime)
+	}
+}
+
+// dockershimRemoved indicates if the KubeAdm version is V1.24 or newer,
+// where Docker requires cri-dockerd.
+func dockershimRemoved(c *Config) bool {
+	major, minor, err := parseMajorMinor(c.General.KubeAdmVersion)
+	if err != nil {
+		return false
+	}
+	return major > 1 || minor >= 24
+}
+
+// RuntimeFor determines the container runtime to use. If not specified,
+// Docker is used for KubeAdm versions before V1.24, and containerd for
+// V1.24 and newer (where dockershim was removed).
+func RuntimeFor(c *Config) string {
+	if c.General.Runtime != "" {
+		return c.General.Runtime
+	}
+	if dockershimRemoved(c) {
+		return ContainerdRuntime
+	}
+	return DockerRuntime
+}
+
+// CRISocketFor determines the CRI socket that kubelet will use, for the
+// container runtime. The socket may be overridden in the config.
+func CRISocketFor(c *Config) string {
+	if c.General.RuntimeSocket != "" {
+		return c.General.RuntimeSocket
+	}
+	switch RuntimeFor(c) {
+	case ContainerdRuntime:
+		return ContainerdSocket
+	case CRIORuntime:
+		return CRIOSocket
+	default:
+		if dockershimRemoved(c) {
+			return CRIDockerdSocket
+		}
+		return DockerShimSocket
+	}
+}
+
+// CgroupDriverFor determines the cgroup driver that kubelet should use, to
+// match the container runtime's default.
+func CgroupDriverFor(c *Config) string {
+	if RuntimeFor(c) == DockerRuntime {
+		return "cgroupfs"
+	}
+	return "systemd"
+}
+
+// RuntimeSocketToCheck determines the socket that must exist, before
+// kubelet is started. For Docker with dockershim, the CRI socket is created
+// by kubelet, so the Docker daemon's socket is checked instead.
+func RuntimeSocketToCheck(c *Config) string {
+	socket := CRISocketFor(c)
+	if socket == DockerShimSocket {
+		return DockerSocket
+	}
+	return socket
+}
+
+// CheckRuntimeSocket is a preflight check that the container runtime is
+// running, by looking for its socket.
+func CheckRuntimeSocket(c *Config) error {
+	runtime := RuntimeFor(c)
+	socket := RuntimeSocketToCheck(c)
+	info, err := os.Stat(socket)
+	if err != nil {
+		return fmt.Errorf("unable to find socket %s for container runtime %s - is it running?", socket, runtime)
+	}
+	if info.Mode()&os.ModeSocket == 0 {
+		return fmt.Errorf("%s for container runtime %s is not a socket", socket, runtime)
+	}
+	glog.V(1).Infof("Container runtime %s is available at %s", runtime, socket)
+	return nil
+}
@@ -0,0 +1,253 @@
+package lazyjack_test
+
+import (
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+// HelperRuntimeSocket creates a listening unix socket in the area, to act
+// as the container runtime's socket.
+func HelperRuntimeSocket(basePath string, t *testing.T) net.Listener {
+	l, err := net.Listen("unix", filepath.Join(basePath, "runtime.sock"))
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create runtime socket for test: %s", err.Error())
+	}
+	return l
+}
+
+func TestValidateRuntime(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		runtime     string
+		expected    string
+		expectedStr string
+	}{
+		{name: "not specified", runtime: "", expected: "", expectedStr: ""},
+		{name: "docker", runtime: "docker", expected: lazyjack.DockerRuntime, expectedStr: ""},
+		{name: "containerd", runtime: "Containerd", expected: lazyjack.ContainerdRuntime, expectedStr: ""},
+		{name: "cri-o", runtime: "CRI-O", expected: lazyjack.CRIORuntime, expectedStr: ""},
+		{name: "unsupported", runtime: "rkt", expected: "", expectedStr: "unsupported container runtime \"rkt\" (use docker, containerd, or cri-o)"},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{
+			General: lazyjack.GeneralSettings{
+				Runtime: tc.runtime,
+			},
+		}
+		err := lazyjack.ValidateRuntime(c)
+		if tc.expectedStr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected runtime to be valid: %s", tc.name, err.Error())
+			} else if c.General.Runtime != tc.expected {
+				t.Errorf("FAILED: [%s] Expected runtime %q, got %q", tc.name, tc.expected, c.General.Runtime)
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected runtime to be invalid", tc.name)
+		} else if err.Error() != tc.expectedStr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedStr, err.Error())
+		}
+	}
+}
+
+func TestValidateRuntimeSocket(t *testing.T) {
+	var testCases = []struct {
+		name        string
+		socket      string
+		expected    string
+		expectedStr string
+	}{
+		{name: "not specified", socket: "", expected: ""},
+		{name: "path", socket: "/run/k3s/containerd/containerd.sock", expected: "/run/k3s/containerd/containerd.sock"},
+		{name: "unix scheme", socket: "unix:///run/k3s/containerd/containerd.sock", expected: "/run/k3s/containerd/containerd.sock"},
+		{name: "other scheme", socket: "tcp://10.0.0.1:2375", expectedStr: "invalid runtime-socket \"tcp://10.0.0.1:2375\" (use the path of a unix socket)"},
+		{name: "relative path", socket: "containerd.sock", expectedStr: "invalid runtime-socket \"containerd.sock\" (use the path of a unix socket)"},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{
+			General: lazyjack.GeneralSettings{
+				RuntimeSocket: tc.socket,
+			},
+		}
+		err := lazyjack.ValidateRuntime(c)
+		if tc.expectedStr == "" {
+			if err != nil {
+				t.Errorf("FAILED: [%s] Expected runtime socket to be valid: %s", tc.name, err.Error())
+			} else if c.General.RuntimeSocket != tc.expected {
+				t.Errorf("FAILED: [%s] Expected runtime socket %q, got %q", tc.name, tc.expected, c.General.RuntimeSocket)
+			}
+		} else if err == nil {
+			t.Errorf("FAILED: [%s] Expected runtime socket to be invalid", tc.name)
+		} else if err.Error() != tc.expectedStr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedStr, err.Error())
+		}
+	}
+}
+
+func TestRuntimeSettings(t *testing.T) {
+	var testCases = []struct {
+		name           string
+		runtime        string
+		version        string
+		socket         string
+		expRuntime     string
+		expCRISocket   string
+		expCheckSocket string
+		expCgroup      string
+	}{
+		{
+			name:           "default for older",
+			version:        "1.13",
+			expRuntime:     lazyjack.DockerRuntime,
+			expCRISocket:   lazyjack.DockerShimSocket,
+			expCheckSocket: lazyjack.DockerSocket,
+			expCgroup:      "cgroupfs",
+		},
+		{
+			name:           "default for newer",
+			version:        "1.28",
+			expRuntime:     lazyjack.ContainerdRuntime,
+			expCRISocket:   lazyjack.ContainerdSocket,
+			expCheckSocket: lazyjack.ContainerdSocket,
+			expCgroup:      "systemd",
+		},
+		{
+			name:           "docker without dockershim",
+			runtime:        lazyjack.DockerRuntime,
+			version:        "1.24",
+			expRuntime:     lazyjack.DockerRuntime,
+			expCRISocket:   lazyjack.CRIDockerdSocket,
+			expCheckSocket: lazyjack.CRIDockerdSocket,
+			expCgroup:      "cgroupfs",
+		},
+		{
+			name:           "cri-o",
+			runtime:        lazyjack.CRIORuntime,
+			version:        "1.18",
+			expRuntime:     lazyjack.CRIORuntime,
+			expCRISocket:   lazyjack.CRIOSocket,
+			expCheckSocket: lazyjack.CRIOSocket,
+			expCgroup:      "systemd",
+		},
+		{
+			name:           "socket override",
+			runtime:        lazyjack.ContainerdRuntime,
+			version:        "1.28",
+			socket:         "/run/k3s/containerd/containerd.sock",
+			expRuntime:     lazyjack.ContainerdRuntime,
+			expCRISocket:   "/run/k3s/containerd/containerd.sock",
+			expCheckSocket: "/run/k3s/containerd/containerd.sock",
+			expCgroup:      "systemd",
+		},
+	}
+	for _, tc := range testCases {
+		c := &lazyjack.Config{
+			General: lazyjack.GeneralSettings{
+				Runtime:        tc.runtime,
+				RuntimeSocket:  tc.socket,
+				KubeAdmVersion: tc.version,
+			},
+		}
+		if actual := lazyjack.RuntimeFor(c); actual != tc.expRuntime {
+			t.Errorf("FAILED: [%s] Expected runtime %q, got %q", tc.name, tc.expRuntime, actual)
+		}
+		if actual := lazyjack.CRISocketFor(c); actual != tc.expCRISocket {
+			t.Errorf("FAILED: [%s] Expected CRI socket %q, got %q", tc.name, tc.expCRISocket, actual)
+		}
+		if actual := lazyjack.RuntimeSocketToCheck(c); actual != tc.expCheckSocket {
+			t.Errorf("FAILED: [%s] Expected socket to check %q, got %q", tc.name, tc.expCheckSocket, actual)
+		}
+		if actual := lazyjack.CgroupDriverFor(c); actual != tc.expCgroup {
+			t.Errorf("FAILED: [%s] Expected cgroup driver %q, got %q", tc.name, tc.expCgroup, actual)
+		}
+	}
+}
+
+func TestCheckRuntimeSocket(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	socket := HelperRuntimeSocket(basePath, t)
+	defer socket.Close()
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Runtime:       lazyjack.ContainerdRuntime,
+			RuntimeSocket: socket.Addr().String(),
+		},
+	}
+	err := lazyjack.CheckRuntimeSocket(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected runtime socket to be found: %s", err.Error())
+	}
+}
+
+func TestFailedCheckRuntimeSocket(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	missing := filepath.Join(basePath, "missing.sock")
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Runtime:       lazyjack.CRIORuntime,
+			RuntimeSocket: missing,
+		},
+	}
+	err := lazyjack.CheckRuntimeSocket(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected runtime socket to be missing")
+	}
+	expected := "unable to find socket " + missing + " for container runtime cri-o - is it running?"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+
+	notSocket := filepath.Join(basePath, "file.sock")
+	err = ioutil.WriteFile(notSocket, []byte(""), 0600)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create file for test")
+	}
+	c.General.RuntimeSocket = notSocket
+	err = lazyjack.CheckRuntimeSocket(c)
+	if err == nil {
+		t.Fatalf("FAILED: Expected file to not be a socket")
+	}
+	expected = notSocket + " for container runtime cri-o is not a socket"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestKubeAdmConfigContentsRuntime(t *testing.T) {
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Runtime:           lazyjack.CRIORuntime,
+			KubeAdmVersion:    "1.18",
+			KubeAdmAPIVersion: "v1beta2",
+		},
+		Service: lazyjack.ServiceNetwork{
+			CIDR: "fd00:30::/110",
+			Info: lazyjack.NetInfo{
+				Mode:   lazyjack.IPv6NetMode,
+				Prefix: "fd00:30::",
+			},
+		},
+	}
+	n := &lazyjack.Node{
+		Name: "my-master",
+		ID:   10,
+	}
+	info := lazyjack.CollectKubeAdmConfigInfo(n, c)
+	if info.CRISocket != lazyjack.CRIOSocket {
+		t.Errorf("FAILED: Expected CRI socket %q, got %q", lazyjack.CRIOSocket, info.CRISocket)
+	}
+	if info.CgroupDriver != "systemd" {
+		t.Errorf("FAILED: Expected cgroup driver %q, got %q", "systemd", info.CgroupDriver)
+	}
+}
@@ -0,0 +1,210 @@
+package lazyjack
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/golang/glog"
+	"gopkg.in/yaml.v2"
+)
+
+// Secrets holds the sensitive values that KubeAdm needs for nodes to join
+// the cluster, and the password for the private registry. They are kept
+// out of the main config file.
+type Secrets struct {
+	Token            string `yaml:"token"`
+	TokenCertHash    string `yaml:"token-cert-hash"`
+	RegistryPassword string `yaml:"registry-password"`
+}
+
+// ParseSecrets parses the YAML contents of a secrets file (or the output of
+// a secrets command).
+func ParseSecrets(contents []byte) (*Secrets, error) {
+	var s Secrets
+	err := yaml.Unmarshal(contents, &s)
+	if err != nil {
+		return nil, fmt.Errorf("unable to parse secrets: %v", err)
+	}
+	return &s, nil
+}
+
+// CreateSecretsContents builds the contents for the secrets file.
+func CreateSecretsContents(token, hash string) []byte {
+	return []byte(fmt.Sprintf("# Generated by lazyjack init - keep private\ntoken: %q\ntoken-cert-hash: %q\n", token, hash))
+}
+
+// LoadSecretsFile reads the secrets from the file specified. A warning is
+// logged, if the file can be accessed by group or other users.
+func LoadSecretsFile(file string) (*Secrets, error) {
+	glog.V(4).Infof("Reading secrets from %s", file)
+	info, err := FS().Stat(file)
+	if err != nil {
+		return nil, fmt.Errorf("unable to access secrets file %s: %v", file, err)
+	}
+	if info.Mode().Perm()&0077 != 0 {
+		glog.Warningf("Secrets file %s has permissions %#o - should be %#o", file, info.Mode().Perm(), SecretsFileMode)
+	}
+	contents, err := GetFileContents(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseSecrets(contents)
+}
+
+// RunSecretsCommand invokes an external command (using the shell) that
+// outputs the secrets as YAML.
+func RunSecretsCommand(command string) (*Secrets, error) {
+	glog.V(4).Infof("Obtaining secrets from command %q", command)
+	output, err := DoExecCommand("sh", []string{"-c", command})
+	if err != nil {
+		return nil, fmt.Errorf("unable to obtain secrets from command: %v", err)
+	}
+	return ParseSecrets([]byte(output))
+}
+
+// mergeSecrets overrides the token, hash, and registry password with any
+// values provided.
+func mergeSecrets(c *Config, s *Secrets, source string) {
+	if s.Token != "" {
+		c.General.Token = s.Token
+		glog.V(4).Infof("Using token from %s", source)
+	}
+	if s.TokenCertHash != "" {
+		c.General.TokenCertHash = s.TokenCertHash
+		glog.V(4).Infof("Using token certificate hash from %s", source)
+	}
+	if s.RegistryPassword != "" {
+		c.Images.Registry.Password = s.RegistryPassword
+		glog.V(4).Infof("Using registry password from %s", source)
+	}
+}
+
+// LoadSecrets populates the token, token certificate hash, and registry
+// password. Values in the config file itself (legacy) are overridden by
+// the secrets file, then the secrets command, and finally, the environment
+// variables. If no secrets file is specified, the default one next to the
+// config file is used, when present. A missing secrets file is otherwise
+// ignored, only when ignoreMissing is set (e.g. during init). The registry
+// password is never accepted from the config file.
+func LoadSecrets(c *Config, ignoreMissing bool) error {
+	if c.Images.Registry.Password != "" {
+		return fmt.Errorf("registry password must not be in config file - use the secrets file, secrets command, or %s", RegistryPasswordEnvVar)
+	}
+	if c.General.Token != "" || c.General.TokenCertHash != "" {
+		glog.Warningf("Token info in config file is deprecated - rerun init to move to a %s file", DefaultSecretsFile)
+	}
+	if c.General.SecretsFile != "" || c.General.ConfigFile != "" {
+		file, err := SecretsFileFor(c, c.General.ConfigFile)
+		if err != nil {
+			return err
+		}
+		_, err = FS().Stat(file)
+		if (ignoreMissing || c.General.SecretsFile == "") && os.IsNotExist(err) {
+			glog.V(4).Infof("No secrets file %s yet - ignoring", file)
+		} else {
+			s, err := LoadSecretsFile(file)
+			if err != nil {
+				return err
+			}
+			mergeSecrets(c, s, file)
+		}
+	}
+	if c.General.SecretsCommand != "" {
+		s, err := RunSecretsCommand(c.General.SecretsCommand)
+		if err != nil {
+			return err
+		}
+		mergeSecrets(c, s, "secrets command")
+	}
+	env := &Secrets{
+		Token:            os.Getenv(TokenEnvVar),
+		TokenCertHash:    os.Getenv(TokenCertHashEnvVar),
+		RegistryPassword: os.Getenv(RegistryPasswordEnvVar),
+	}
+	mergeSecrets(c, env, "environment")
+	return nil
+}
+
+// SecretsFileFor determines the secrets file to use. If not specified in
+// the config, the default file next to the config file is used. A relative
+// secrets file is relative to the config file's directory, rather than the
+// working directory (which is / for a systemd unit).
+func SecretsFileFor(c *Config, configFile string) (string, error) {
+	file := c.General.SecretsFile
+	if file == "" {
+		file = DefaultSecretsFile
+	}
+	if !filepath.IsAbs(file) {
+		file = filepath.Join(filepath.Dir(configFile), file)
+	}
+	abs, err := filepath.Abs(file)
+	if err != nil {
+		return "", fmt.Errorf("unable to determine path for secrets file %s: %v", file, err)
+	}
+	return abs, nil
+}
+
+// SaveSecretsFile writes the token and hash to the secrets file, with
+// permissions restricting access to the owner. A registry password in an
+// existing secrets file is kept.
+func SaveSecretsFile(file, token, hash string) error {
+	glog.V(1).Infof("Saving secrets to %s", file)
+	contents := CreateSecretsContents(token, hash)
+	if _, err := FS().Stat(file); err == nil {
+		existing, err := LoadSecretsFile(file)
+		if err != nil {
+			return err
+		}
+		if existing.RegistryPassword != "" {
+			contents = append(contents, fmt.Sprintf("registry-password: %q\n", existing.RegistryPassword)...)
+		}
+	}
+	tmp := fmt.Sprintf("%s.tmp", file)
+	err := FS().WriteFile(tmp, contents, SecretsFileMode)
+	if err != nil {
+		return fmt.Errorf("unable to save secrets file %s: %v", file, err)
+	}
+	// File may have existed with other permissions
+	err = FS().Chmod(tmp, SecretsFileMode)
+	if err == nil {
+		err = FS().Rename(tmp, file)
+	}
+	if err != nil {
+		FS().Remove(tmp)
+		return fmt.Errorf("unable to save secrets file %s: %v", file, err)
+	}
+	err = ChownToInvokingUser(file)
+	if err != nil {
+		return err
+	}
+	glog.Infof("Saved secrets to %s", file)
+	return nil
+}
+
+// ChownToInvokingUser gives ownership of the file to the user that invoked
+// the app using sudo, so that the user can still manage the file, without
+// opening up permissions to everyone. No action is taken, if not run with
+// sudo.
+func ChownToInvokingUser(name string) error {
+	uidStr := os.Getenv("SUDO_UID")
+	gidStr := os.Getenv("SUDO_GID")
+	if uidStr == "" || gidStr == "" {
+		return nil
+	}
+	uid, err := strconv.Atoi(uidStr)
+	if err != nil {
+		return fmt.Errorf("invalid SUDO_UID %q: %v", uidStr, err)
+	}
+	gid, err := strconv.Atoi(gidStr)
+	if err != nil {
+		return fmt.Errorf("invalid SUDO_GID %q: %v", gidStr, err)
+	}
+	err = FS().Chown(name, uid, gid)
+	if err != nil {
+		return fmt.Errorf("unable to change ownership of %q: %v", name, err)
+	}
+	glog.V(4).Infof("Changed ownership of %q to %d:%d", name, uid, gid)
+	return nil
+}
@@ -0,0 +1,355 @@
+package lazyjack_test
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+func TestParseSecrets(t *testing.T) {
+	contents := lazyjack.CreateSecretsContents("1a46e0.4623b882f4f887a2", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef")
+	s, err := lazyjack.ParseSecrets(contents)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to parse secrets: %s", err.Error())
+	}
+	if s.Token != "1a46e0.4623b882f4f887a2" {
+		t.Errorf("FAILED: Expected token %q, got %q", "1a46e0.4623b882f4f887a2", s.Token)
+	}
+	if s.TokenCertHash != "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef" {
+		t.Errorf("FAILED: Expected hash %q, got %q", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef", s.TokenCertHash)
+	}
+
+	_, err = lazyjack.ParseSecrets([]byte("token: [bad"))
+	if err == nil {
+		t.Fatalf("FAILED: Expected to not be able to parse malformed secrets")
+	}
+}
+
+func TestSaveSecretsFile(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	file := filepath.Join(basePath, lazyjack.DefaultSecretsFile)
+	// Existing file, with open permissions, should be locked down
+	err := ioutil.WriteFile(file, []byte("token: \"old\"\n"), 0666)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create secrets file for test")
+	}
+	err = lazyjack.SaveSecretsFile(file, "1a46e0.4623b882f4f887a2", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to save secrets file: %s", err.Error())
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("FAILED: Unable to access secrets file: %s", err.Error())
+	}
+	if info.Mode().Perm() != lazyjack.SecretsFileMode {
+		t.Fatalf("FAILED: Expected permissions %#o, got %#o", lazyjack.SecretsFileMode, info.Mode().Perm())
+	}
+	s, err := lazyjack.LoadSecretsFile(file)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load secrets file: %s", err.Error())
+	}
+	if s.Token != "1a46e0.4623b882f4f887a2" {
+		t.Fatalf("FAILED: Expected updated token, got %q", s.Token)
+	}
+}
+
+func TestFailedSaveSecretsFile(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	defer HelperCleanupArea(basePath, t)
+
+	// Area does not exist
+	file := filepath.Join(basePath, lazyjack.DefaultSecretsFile)
+	err := lazyjack.SaveSecretsFile(file, "1a46e0.4623b882f4f887a2", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef")
+	if err == nil {
+		t.Fatalf("FAILED: Expected to not be able to save secrets file in non-existent area")
+	}
+}
+
+func TestSecretsFileFor(t *testing.T) {
+	c := &lazyjack.Config{}
+	actual, err := lazyjack.SecretsFileFor(c, "/etc/lazyjack/config.yaml")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to determine secrets file: %s", err.Error())
+	}
+	expected := "/etc/lazyjack/secrets.yaml"
+	if actual != expected {
+		t.Fatalf("FAILED: Expected default secrets file %q, got %q", expected, actual)
+	}
+
+	c.General.SecretsFile = "/root/private/lazyjack.yaml"
+	actual, err = lazyjack.SecretsFileFor(c, "/etc/lazyjack/config.yaml")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to determine secrets file: %s", err.Error())
+	}
+	if actual != c.General.SecretsFile {
+		t.Fatalf("FAILED: Expected configured secrets file %q, got %q", c.General.SecretsFile, actual)
+	}
+
+	c.General.SecretsFile = "private/secrets.yaml"
+	actual, err = lazyjack.SecretsFileFor(c, "/etc/lazyjack/config.yaml")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to determine secrets file: %s", err.Error())
+	}
+	expected = "/etc/lazyjack/private/secrets.yaml"
+	if actual != expected {
+		t.Fatalf("FAILED: Expected relative secrets file %q, got %q", expected, actual)
+	}
+}
+
+func TestLoadSecrets(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	file := filepath.Join(basePath, lazyjack.DefaultSecretsFile)
+	err := lazyjack.SaveSecretsFile(file, "1a46e0.4623b882f4f887a2", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create secrets file for test")
+	}
+
+	// File overrides (legacy) config values
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			Token:       "b362b2.665c96095a76fb5c",
+			SecretsFile: file,
+		},
+	}
+	err = lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load secrets: %s", err.Error())
+	}
+	if c.General.Token != "1a46e0.4623b882f4f887a2" {
+		t.Errorf("FAILED: Expected token from file, got %q", c.General.Token)
+	}
+	if c.General.TokenCertHash != "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef" {
+		t.Errorf("FAILED: Expected hash from file, got %q", c.General.TokenCertHash)
+	}
+
+	// Environment overrides file
+	os.Setenv(lazyjack.TokenEnvVar, "7aee33.05f81856d78346bd")
+	defer os.Unsetenv(lazyjack.TokenEnvVar)
+	err = lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load secrets: %s", err.Error())
+	}
+	if c.General.Token != "7aee33.05f81856d78346bd" {
+		t.Errorf("FAILED: Expected token from environment, got %q", c.General.Token)
+	}
+	if c.General.TokenCertHash != "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef" {
+		t.Errorf("FAILED: Expected hash from file, got %q", c.General.TokenCertHash)
+	}
+}
+
+func TestLoadSecretsRelativeToConfigFile(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	file := filepath.Join(basePath, lazyjack.DefaultSecretsFile)
+	err := lazyjack.SaveSecretsFile(file, "1a46e0.4623b882f4f887a2", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create secrets file for test")
+	}
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			ConfigFile:  filepath.Join(basePath, "config.yaml"),
+			SecretsFile: lazyjack.DefaultSecretsFile,
+		},
+	}
+	err = lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to load secrets file next to config file: %s", err.Error())
+	}
+	if c.General.Token != "1a46e0.4623b882f4f887a2" {
+		t.Errorf("FAILED: Expected token from file, got %q", c.General.Token)
+	}
+}
+
+func TestLoadSecretsDefaultFile(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			ConfigFile: filepath.Join(basePath, "config.yaml"),
+		},
+	}
+	err := lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected missing default secrets file to be ignored: %s", err.Error())
+	}
+
+	file := filepath.Join(basePath, lazyjack.DefaultSecretsFile)
+	err = lazyjack.SaveSecretsFile(file, "1a46e0.4623b882f4f887a2", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef")
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create secrets file for test")
+	}
+	err = lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to load default secrets file: %s", err.Error())
+	}
+	if c.General.Token != "1a46e0.4623b882f4f887a2" {
+		t.Errorf("FAILED: Expected token from default file, got %q", c.General.Token)
+	}
+}
+
+func TestLoadSecretsRegistryPassword(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	// Rejected in config file
+	c := &lazyjack.Config{
+		Images: lazyjack.ImagesConfig{
+			Registry: lazyjack.RegistryConfig{Username: "jack", Password: "secret"},
+		},
+	}
+	err := lazyjack.LoadSecrets(c, false)
+	if err == nil {
+		t.Fatalf("FAILED: Expected registry password in config file to be rejected")
+	}
+	expected := "registry password must not be in config file - use the secrets file, secrets command, or LAZYJACK_REGISTRY_PASSWORD"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+
+	// From secrets file, which is kept, when init saves the file again
+	file := filepath.Join(basePath, lazyjack.DefaultSecretsFile)
+	err = ioutil.WriteFile(file, []byte("token: \"old\"\nregistry-password: \"from-file\"\n"), lazyjack.SecretsFileMode)
+	if err != nil {
+		t.Fatalf("ERROR: Unable to create secrets file for test")
+	}
+	err = lazyjack.SaveSecretsFile(file, "1a46e0.4623b882f4f887a2", "05b24bf01253ff487504eeb264d4b018529e0430b9d9637cff374c39b740e7ef")
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to save secrets file: %s", err.Error())
+	}
+	c = &lazyjack.Config{
+		General: lazyjack.GeneralSettings{SecretsFile: file},
+		Images: lazyjack.ImagesConfig{
+			Registry: lazyjack.RegistryConfig{Username: "jack"},
+		},
+	}
+	err = lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load secrets: %s", err.Error())
+	}
+	if c.General.Token != "1a46e0.4623b882f4f887a2" {
+		t.Errorf("FAILED: Expected updated token from file, got %q", c.General.Token)
+	}
+	if c.Images.Registry.Password != "from-file" {
+		t.Errorf("FAILED: Expected registry password from file, got %q", c.Images.Registry.Password)
+	}
+
+	// Environment overrides file
+	os.Setenv(lazyjack.RegistryPasswordEnvVar, "from-env")
+	defer os.Unsetenv(lazyjack.RegistryPasswordEnvVar)
+	c.Images.Registry.Password = ""
+	err = lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load secrets: %s", err.Error())
+	}
+	if c.Images.Registry.Password != "from-env" {
+		t.Errorf("FAILED: Expected registry password from environment, got %q", c.Images.Registry.Password)
+	}
+}
+
+func TestLoadSecretsMissingFile(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	defer HelperCleanupArea(basePath, t)
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			SecretsFile: filepath.Join(basePath, lazyjack.DefaultSecretsFile),
+		},
+	}
+	err := lazyjack.LoadSecrets(c, true)
+	if err != nil {
+		t.Fatalf("FAILED: Expected missing secrets file to be ignored: %s", err.Error())
+	}
+	err = lazyjack.LoadSecrets(c, false)
+	if err == nil {
+		t.Fatalf("FAILED: Expected missing secrets file to be reported")
+	}
+}
+
+// HelperSecretsExecCommand mocks the secrets command
+func HelperSecretsExecCommand(cmd string, args []string) (string, error) {
+	if cmd == "sh" && len(args) == 2 && args[0] == "-c" {
+		if args[1] == "vault-read lazyjack" {
+			return "token: \"7aee33.05f81856d78346bd\"\ntoken-cert-hash: \"35f932d559ec963388046a690cdeaaced2408a16a2d3da529622c9dfb790fbe4\"\nregistry-password: \"from-vault\"\n", nil
+		}
+		return "", fmt.Errorf("mock failure")
+	}
+	return "", fmt.Errorf("Test setup error - expected to be mocking secrets command only")
+}
+
+func TestLoadSecretsFromCommand(t *testing.T) {
+	lazyjack.RegisterExecCommand(HelperSecretsExecCommand)
+
+	c := &lazyjack.Config{
+		General: lazyjack.GeneralSettings{
+			SecretsCommand: "vault-read lazyjack",
+		},
+	}
+	err := lazyjack.LoadSecrets(c, false)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to load secrets from command: %s", err.Error())
+	}
+	if c.General.Token != "7aee33.05f81856d78346bd" {
+		t.Errorf("FAILED: Expected token from command, got %q", c.General.Token)
+	}
+	if c.General.TokenCertHash != "35f932d559ec963388046a690cdeaaced2408a16a2d3da529622c9dfb790fbe4" {
+		t.Errorf("FAILED: Expected hash from command, got %q", c.General.TokenCertHash)
+	}
+	if c.Images.Registry.Password != "from-vault" {
+		t.Errorf("FAILED: Expected registry password from command, got %q", c.Images.Registry.Password)
+	}
+
+	c.Images.Registry.Password = ""
+	c.General.SecretsCommand = "bogus"
+	err = lazyjack.LoadSecrets(c, false)
+	if err == nil {
+		t.Fatalf("FAILED: Expected failing secrets command to be reported")
+	}
+	expected := "unable to obtain secrets from command: mock failure"
+	if err.Error() != expected {
+		t.Fatalf("FAILED: Expected error %q, got %q", expected, err.Error())
+	}
+}
+
+func TestChownToInvokingUser(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	// Not invoked via sudo, so nothing is done
+	err := lazyjack.ChownToInvokingUser(filepath.Join(basePath, "no-such-file"))
+	if err != nil {
+		t.Fatalf("FAILED: Expected no action, when not using sudo: %s", err.Error())
+	}
+
+	os.Setenv("SUDO_UID", strconv.Itoa(os.Getuid()))
+	os.Setenv("SUDO_GID", strconv.Itoa(os.Getgid()))
+	defer os.Unsetenv("SUDO_UID")
+	defer os.Unsetenv("SUDO_GID")
+	err = lazyjack.ChownToInvokingUser(basePath)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to change ownership: %s", err.Error())
+	}
+
+	os.Setenv("SUDO_UID", "bogus")
+	err = lazyjack.ChownToInvokingUser(basePath)
+	if err == nil {
+		t.Fatalf("FAILED: Expected invalid SUDO_UID to be reported")
+	}
+}
@@ -0,0 +1,193 @@
+package lazyjack
+
+import (
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+const (
+	// ECMPRouting spreads traffic across all the NAT64 nodes
+	ECMPRouting = "ecmp"
+	// PrimaryBackupRouting uses the first NAT64 node, with the others as backups
+	PrimaryBackupRouting = "primary-backup"
+	// DefaultNAT64Routing used, when there are multiple NAT64 nodes
+	DefaultNAT64Routing = ECMPRouting
+	// PrimaryRouteMetric is the metric for the primary route, with backup
+	// routes using higher metrics
+	PrimaryRouteMetric = 1024
+)
+
+// ServerNodes provides the nodes running the DNS64 and NAT64 servers,
+// ordered by node ID, so that the primary node is predictable.
+func ServerNodes(c *Config) []Node {
+	var servers []Node
+	for name, node := range c.Topology {
+		if node.IsDNS64Server || node.IsNAT64Server {
+			if node.Name == "" {
+				node.Name = name
+			}
+			servers = append(servers, node)
+		}
+	}
+	sort.Slice(servers, func(i, j int) bool {
+		if servers[i].ID != servers[j].ID {
+			return servers[i].ID < servers[j].ID
+		}
+		return servers[i].Name < servers[j].Name
+	})
+	return servers
+}
+
+// NodeMgmtIP provides the management IP for the node.
+func NodeMgmtIP(node Node, c *Config) string {
+	return fmt.Sprintf("%s%x", c.Mgmt.Info[0].Prefix, node.ID)
+}
+
+// ValidateServerNodes checks the DNS64 and NAT64 server IPs for each node
+// running the servers. The IPs default to the ones in the dns64 and nat64
+// sections, and must be unique, when there are multiple server nodes. The
+// routing method for multiple NAT64 nodes is also checked.
+func ValidateServerNodes(c *Config) error {
+	if c.General.Mode != IPv6NetMode {
+		return nil
+	}
+	if c.NAT64.Routing == "" {
+		c.NAT64.Routing = DefaultNAT64Routing
+	}
+	c.NAT64.Routing = strings.ToLower(c.NAT64.Routing)
+	if c.NAT64.Routing != ECMPRouting && c.NAT64.Routing != PrimaryBackupRouting {
+		return fmt.Errorf("unsupported NAT64 routing %q (use %s or %s)", c.NAT64.Routing, ECMPRouting, PrimaryBackupRouting)
+	}
+
+	owners := map[string]string{}
+	for _, node := range ServerNodes(c) {
+		custom := node.DNS64IP != "" || node.NAT64IP != ""
+		if node.DNS64IP == "" {
+			node.DNS64IP = c.DNS64.ServerIP
+		}
+		if node.NAT64IP == "" {
+			node.NAT64IP = c.NAT64.ServerIP
+		}
+		for _, ip := range []string{node.DNS64IP, node.NAT64IP} {
+			if ip == "" {
+				continue
+			}
+			if custom {
+				if err := ValidateSupportNetIP(ip, node.Name, c); err != nil {
+					return err
+				}
+			}
+			if owner, ok := owners[ip]; ok {
+				return fmt.Errorf("server IP %s is used by both %q and %q (specify unique dns64_ip and nat64_ip for each node)", ip, owner, node.Name)
+			}
+			owners[ip] = node.Name
+		}
+		c.Topology[node.Name] = node
+	}
+	return nil
+}
+
+// ValidateSupportNetIP checks that the server IP for the node is within
+// the support network.
+func ValidateSupportNetIP(ip, name string, c *Config) error {
+	_, supportNet, err := net.ParseCIDR(c.Support.CIDR)
+	if err != nil {
+		return fmt.Errorf("support network CIDR (%s) is invalid: %v", c.Support.CIDR, err)
+	}
+	addr := net.ParseIP(ip)
+	if addr == nil || !supportNet.Contains(addr) {
+		return fmt.Errorf("server IP %s for %q is not within support network (%s)", ip, name, c.Support.CIDR)
+	}
+	return nil
+}
+
+// UseServerIPsForNode sets the DNS64 and NAT64 server IPs to the ones for
+// the node, so that the servers on the node are set up with them.
+func UseServerIPsForNode(node *Node, c *Config) {
+	if node.DNS64IP != "" {
+		c.DNS64.ServerIP = node.DNS64IP
+	}
+	if node.NAT64IP != "" {
+		c.NAT64.ServerIP = node.NAT64IP
+	}
+	glog.V(4).Infof("Using DNS64 IP %s and NAT64 IP %s for %q", c.DNS64.ServerIP, c.NAT64.ServerIP, node.Name)
+}
+
+// FindHostIPsForNAT64 provides the management IPs of all the nodes with
+// a NAT64 server, ordered by node ID.
+func FindHostIPsForNAT64(c *Config) []string {
+	var ips []string
+	for _, node := range ServerNodes(c) {
+		if node.IsNAT64Server {
+			ips = append(ips, NodeMgmtIP(node, c))
+		}
+	}
+	return ips
+}
+
+// DNS64ServerIPs provides the IPs of all the DNS64 servers, with the one
+// on the node first (if it has one), followed by the others in node ID
+// order.
+func DNS64ServerIPs(n *Node, c *Config) []string {
+	var ips []string
+	seen := map[string]bool{}
+	add := func(ip string) {
+		if ip != "" && !seen[ip] {
+			seen[ip] = true
+			ips = append(ips, ip)
+		}
+	}
+	if n.IsDNS64Server {
+		add(n.DNS64IP)
+	}
+	for _, node := range ServerNodes(c) {
+		if node.IsDNS64Server {
+			add(node.DNS64IP)
+		}
+	}
+	add(c.DNS64.ServerIP)
+	return ips
+}
+
+// SupportNetRoute is a route to (part of) the support network, via the
+// management IP of a node running the DNS64 and NAT64 servers.
+type SupportNetRoute struct {
+	Dest string
+	GW   string
+}
+
+// SupportNetworkRoutes provides the routes that the node needs, to reach
+// the DNS64 and NAT64 servers. With a single server node, other nodes use
+// a route to the support network via that node. With multiple server
+// nodes, each node's servers are on its own (local) support network, so
+// host routes to the server IPs, via the node hosting them, are used.
+func SupportNetworkRoutes(node *Node, c *Config) ([]SupportNetRoute, error) {
+	servers := ServerNodes(c)
+	if len(servers) <= 1 {
+		if node.IsNAT64Server || node.IsDNS64Server {
+			return nil, nil
+		}
+		gw, ok := FindHostIPForNAT64(c)
+		if !ok {
+			return nil, fmt.Errorf("unable to find node with NAT64 server configured")
+		}
+		return []SupportNetRoute{{Dest: c.Support.CIDR, GW: gw}}, nil
+	}
+	var routes []SupportNetRoute
+	for _, server := range servers {
+		if server.Name == node.Name {
+			continue
+		}
+		gw := NodeMgmtIP(server, c)
+		for _, ip := range []string{server.DNS64IP, server.NAT64IP} {
+			if ip != "" {
+				routes = append(routes, SupportNetRoute{Dest: ip + "/128", GW: gw})
+			}
+		}
+	}
+	return routes, nil
+}
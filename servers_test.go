@@ -0,0 +1,210 @@
+package lazyjack_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/pmichali/lazyjack"
+)
+
+// HelperMultiServerConfig creates a config with two nodes running DNS64
+// and NAT64 servers, and a minion.
+func HelperMultiServerConfig(nm lazyjack.NetMgr) *lazyjack.Config {
+	return &lazyjack.Config{
+		Topology: map[string]lazyjack.Node{
+			"backup": {
+				Name:          "backup",
+				ID:            3,
+				IsDNS64Server: true,
+				IsNAT64Server: true,
+				DNS64IP:       "fd00:10::3:100",
+				NAT64IP:       "fd00:10::3:200",
+			},
+			"master": {
+				Name:          "master",
+				ID:            2,
+				IsMaster:      true,
+				IsDNS64Server: true,
+				IsNAT64Server: true,
+			},
+			"minion": {
+				Name:     "minion",
+				ID:       4,
+				IsMinion: true,
+			},
+		},
+		General: lazyjack.GeneralSettings{Mode: lazyjack.IPv6NetMode, NetMgr: nm},
+		DNS64:   lazyjack.DNS64Config{CIDR: "fd00:10:64:ff9b::/96", ServerIP: "fd00:10::100"},
+		NAT64:   lazyjack.NAT64Config{ServerIP: "fd00:10::200"},
+		Support: lazyjack.SupportNetwork{CIDR: "fd00:10::/64", V4CIDR: "172.18.0.0/16"},
+		Mgmt: lazyjack.ManagementNetwork{
+			Info: [2]lazyjack.NetInfo{{Prefix: "fd00:100::"}},
+		},
+	}
+}
+
+func TestValidateServerNodes(t *testing.T) {
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	err := lazyjack.ValidateServerNodes(c)
+	if err != nil {
+		t.Fatalf("FAILED: Expected server nodes to be valid: %s", err.Error())
+	}
+	master := c.Topology["master"]
+	if master.DNS64IP != "fd00:10::100" || master.NAT64IP != "fd00:10::200" {
+		t.Fatalf("FAILED: Expected default server IPs for master, got %s and %s", master.DNS64IP, master.NAT64IP)
+	}
+	if c.NAT64.Routing != lazyjack.ECMPRouting {
+		t.Fatalf("FAILED: Expected default routing %q, got %q", lazyjack.ECMPRouting, c.NAT64.Routing)
+	}
+
+	var testCases = []struct {
+		name        string
+		update      func(c *lazyjack.Config)
+		expectedErr string
+	}{
+		{
+			name: "duplicate IPs",
+			update: func(c *lazyjack.Config) {
+				n := c.Topology["backup"]
+				n.DNS64IP = ""
+				c.Topology["backup"] = n
+			},
+			expectedErr: "server IP fd00:10::100 is used by both \"master\" and \"backup\" (specify unique dns64_ip and nat64_ip for each node)",
+		},
+		{
+			name: "outside support network",
+			update: func(c *lazyjack.Config) {
+				n := c.Topology["backup"]
+				n.NAT64IP = "fd00:99::200"
+				c.Topology["backup"] = n
+			},
+			expectedErr: "server IP fd00:99::200 for \"backup\" is not within support network (fd00:10::/64)",
+		},
+		{
+			name: "bad routing",
+			update: func(c *lazyjack.Config) {
+				c.NAT64.Routing = "round-robin"
+			},
+			expectedErr: "unsupported NAT64 routing \"round-robin\" (use ecmp or primary-backup)",
+		},
+	}
+	for _, tc := range testCases {
+		c := HelperMultiServerConfig(lazyjack.NetMgr{})
+		tc.update(c)
+		err := lazyjack.ValidateServerNodes(c)
+		if err == nil {
+			t.Errorf("FAILED: [%s] Expected error %q", tc.name, tc.expectedErr)
+		} else if err.Error() != tc.expectedErr {
+			t.Errorf("FAILED: [%s] Expected error %q, got %q", tc.name, tc.expectedErr, err.Error())
+		}
+	}
+}
+
+func TestServerNodesOrder(t *testing.T) {
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	servers := lazyjack.ServerNodes(c)
+	if len(servers) != 2 || servers[0].Name != "master" || servers[1].Name != "backup" {
+		t.Fatalf("FAILED: Expected master and backup server nodes, got %+v", servers)
+	}
+	// Map order is random, so make sure primary is always the same
+	for i := 0; i < 20; i++ {
+		gw, ok := lazyjack.FindHostIPForNAT64(c)
+		if !ok || gw != "fd00:100::2" {
+			t.Fatalf("FAILED: Expected NAT64 host IP fd00:100::2, got %q", gw)
+		}
+	}
+	actual := strings.Join(lazyjack.FindHostIPsForNAT64(c), " ")
+	if actual != "fd00:100::2 fd00:100::3" {
+		t.Fatalf("FAILED: Expected NAT64 host IPs in node ID order, got %q", actual)
+	}
+}
+
+func TestCalcNameServersMultipleDNS64(t *testing.T) {
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	lazyjack.ValidateServerNodes(c)
+
+	minion := c.Topology["minion"]
+	actual := strings.Join(lazyjack.CalcNameServers(&minion, c), " ")
+	if actual != "fd00:10::100 fd00:10::3:100" {
+		t.Fatalf("FAILED: Expected all DNS64 servers for minion, got %q", actual)
+	}
+	backup := c.Topology["backup"]
+	actual = strings.Join(lazyjack.CalcNameServers(&backup, c), " ")
+	if actual != "fd00:10::3:100 fd00:10::100" {
+		t.Fatalf("FAILED: Expected local DNS64 server first for backup, got %q", actual)
+	}
+}
+
+func TestSupportNetworkRoutesMultipleServers(t *testing.T) {
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	lazyjack.ValidateServerNodes(c)
+
+	var testCases = []struct {
+		name     string
+		node     string
+		expected string
+	}{
+		{
+			name:     "minion",
+			node:     "minion",
+			expected: "fd00:10::100/128 via fd00:100::2, fd00:10::200/128 via fd00:100::2, fd00:10::3:100/128 via fd00:100::3, fd00:10::3:200/128 via fd00:100::3",
+		},
+		{
+			name:     "server",
+			node:     "master",
+			expected: "fd00:10::3:100/128 via fd00:100::3, fd00:10::3:200/128 via fd00:100::3",
+		},
+	}
+	for _, tc := range testCases {
+		node := c.Topology[tc.node]
+		routes, err := lazyjack.SupportNetworkRoutes(&node, c)
+		if err != nil {
+			t.Fatalf("FAILED: [%s] Expected to get routes: %s", tc.name, err.Error())
+		}
+		var actual []string
+		for _, r := range routes {
+			actual = append(actual, r.Dest+" via "+r.GW)
+		}
+		if strings.Join(actual, ", ") != tc.expected {
+			t.Errorf("FAILED: [%s] Expected routes %q, got %q", tc.name, tc.expected, strings.Join(actual, ", "))
+		}
+	}
+}
+
+func TestCreateRoutesToMultipleNAT64Servers(t *testing.T) {
+	for _, routing := range []string{lazyjack.ECMPRouting, lazyjack.PrimaryBackupRouting} {
+		mock := &mockNetLink{}
+		c := HelperMultiServerConfig(lazyjack.NetMgr{Server: mock})
+		c.NAT64.Routing = routing
+		lazyjack.ValidateServerNodes(c)
+		minion := c.Topology["minion"]
+		minion.Interface = "eth1"
+
+		err := lazyjack.CreateRouteToNAT64ServerForDNS64Subnet(&minion, c)
+		if err != nil {
+			t.Fatalf("FAILED: [%s] Expected to create routes: %s", routing, err.Error())
+		}
+		if routing == lazyjack.ECMPRouting {
+			if len(mock.routes) != 1 || len(mock.routes[0].MultiPath) != 2 {
+				t.Errorf("FAILED: [%s] Expected one multipath route, got %v", routing, mock.routes)
+			}
+		} else if len(mock.routes) != 2 || mock.routes[0].Gw.String() != "fd00:100::2" {
+			t.Errorf("FAILED: [%s] Expected primary route via fd00:100::2 and a backup, got %v", routing, mock.routes)
+		}
+
+		err = lazyjack.RemoveRouteForDNS64(&minion, c)
+		if err != nil {
+			t.Fatalf("FAILED: [%s] Expected to remove routes: %s", routing, err.Error())
+		}
+	}
+}
+
+func TestUseServerIPsForNode(t *testing.T) {
+	c := HelperMultiServerConfig(lazyjack.NetMgr{})
+	lazyjack.ValidateServerNodes(c)
+	backup := c.Topology["backup"]
+	lazyjack.UseServerIPsForNode(&backup, c)
+	if c.DNS64.ServerIP != "fd00:10::3:100" || c.NAT64.ServerIP != "fd00:10::3:200" {
+		t.Fatalf("FAILED: Expected backup server IPs, got %s and %s", c.DNS64.ServerIP, c.NAT64.ServerIP)
+	}
+}
@@ -1,23 +1,33 @@
 package lazyjack
 
 import (
+	"bytes"
 	"fmt"
-	"io"
 	"os"
 	"path/filepath"
-	"strings"
 
 	"github.com/golang/glog"
 )
 
 // EnsureCNIAreaExists makes sure there is an area for the CNI plugin's
-// config files.
+// config files, and that the only config file is the one for lazyjack. That
+// file is kept, but is not trusted - CreateCNIConfigFile, which must follow,
+// compares the contents and replaces a stale file.
 func EnsureCNIAreaExists(area string) error {
-	err := os.RemoveAll(area)
-	if err != nil {
+	entries, err := FS().ReadDir(area)
+	if err != nil && !os.IsNotExist(err) {
 		return err
 	}
-	err = os.MkdirAll(area, 0755)
+	for _, entry := range entries {
+		if entry.Name() == CNIConfFile && entry.Mode().IsRegular() {
+			continue
+		}
+		err = FS().RemoveAll(filepath.Join(area, entry.Name()))
+		if err != nil {
+			return err
+		}
+	}
+	err = FS().MkdirAll(area, 0755)
 	if err != nil {
 		return err
 	}
@@ -26,23 +36,20 @@ func EnsureCNIAreaExists(area string) error {
 }
 
 // CreateCNIConfigFile creates the config file based on the plugin selected.
-// Default location for file is /etc/cni/net.d/.
+// Default location for file is /etc/cni/net.d/. An existing file is only
+// kept, if it has the same contents.
 func CreateCNIConfigFile(node *Node, c *Config) error {
 	filename := filepath.Join(c.General.CNIArea, CNIConfFile)
-	f, err := os.OpenFile(filename, os.O_CREATE|os.O_WRONLY, 0755)
-	if err != nil {
-		return fmt.Errorf("unable to open CNI config file %q for %s plugin: %v", filename, c.General.Plugin, err)
-	}
-	err = c.General.CNIPlugin.WriteConfigContents(node, f)
+	var contents bytes.Buffer
+	err := c.General.CNIPlugin.WriteConfigContents(node, &contents)
 	if err != nil {
-		f.Close()
 		return fmt.Errorf("unable to create CNI config for %s plugin: %v", c.General.Plugin, err)
 	}
-	err = f.Close()
+	err = Reconcile(FileResource{Path: filename, Contents: contents.Bytes(), Mode: 0755})
 	if err != nil {
-		return fmt.Errorf("error closing CNI config file %q for %s plugin: %v", filename, c.General.Plugin, err)
+		return fmt.Errorf("unable to open CNI config file %q for %s plugin: %v", filename, c.General.Plugin, err)
 	}
-	glog.V(4).Infof("created CNI config file at %q for %s plugin", filename, c.General.Plugin)
+	glog.V(4).Infof("have CNI config file at %q for %s plugin", filename, c.General.Plugin)
 	return nil
 }
 
@@ -114,34 +121,23 @@ func BuildKubeAdmCommand(n, master *Node, c *Config) []string {
 
 // CopyFile copies configuration files to another area. Used for
 // placing needed certificates and keys that were created.
-func CopyFile(name, src, dst string) (err error) {
+func CopyFile(name, src, dst string) error {
 	glog.V(4).Infof("Copying %s/%s to %s/%s", src, name, dst, name)
-	s, err := os.Open(filepath.Join(src, name))
+	source := filepath.Join(src, name)
+	info, err := FS().Stat(source)
 	if err != nil {
 		return fmt.Errorf("unable to open source file %q: %v", name, err)
 	}
-	defer s.Close()
-
-	d, err := os.Create(filepath.Join(dst, name))
-	if err != nil {
-		return fmt.Errorf("unable to open destination file %q: %v", name, err)
-	}
-	defer func() {
-		cerr := d.Close()
-		if err == nil && cerr != nil {
-			err = fmt.Errorf("unable to close destination file %q: %v", name, cerr)
-		}
-	}()
-
-	_, err = io.Copy(d, s)
+	contents, err := FS().ReadFile(source)
 	if err != nil {
-		return fmt.Errorf("unable to copy %q from %q to %q: %v", name, src, dst, err)
+		return fmt.Errorf("unable to open source file %q: %v", name, err)
 	}
-	err = d.Sync()
+	// Keep the source permissions, so that keys stay private
+	err = FS().WriteFile(filepath.Join(dst, name), contents, info.Mode().Perm())
 	if err != nil {
-		return fmt.Errorf("unable to flush data to destination file %q: %v", name, err)
+		return fmt.Errorf("unable to open destination file %q: %v", name, err)
 	}
-	return
+	return nil
 }
 
 // PlaceCertificateAndKeyForCA copies generated files to the Kubernetes area
@@ -149,7 +145,7 @@ func CopyFile(name, src, dst string) (err error) {
 func PlaceCertificateAndKeyForCA(workBase, dst string) error {
 	glog.V(1).Infof("Copying certificate and key to Kuberentes area")
 	src := filepath.Join(workBase, CertArea)
-	err := os.MkdirAll(dst, 0755)
+	err := FS().MkdirAll(dst, 0755)
 	if err != nil {
 		return fmt.Errorf("unable to create area for Kubernetes certificates (%s): %v", dst, err)
 	}
@@ -197,8 +193,10 @@ func StartKubernetes(n *Node, c *Config) error {
 
 // BringUp performs the "up" actions to bring up a cluster. The (bridge)
 // plugin is set up, kubelet server restarted to pickup changes, the
-// cert/key placed (on master), and cluster init/join performed.
-func BringUp(name string, c *Config) {
+// cert/key placed (on master), and cluster init/join performed. The first
+// failure is returned, and a node that is not part of the cluster is
+// skipped.
+func BringUp(name string, c *Config) error {
 	node := c.Topology[name]
 	var asType string
 	switch {
@@ -207,43 +205,50 @@ func BringUp(name string, c *Config) {
 	case node.IsMinion:
 		asType = "minion"
 	default:
-		glog.Infof("Skipping node %q as role is not master or minion", name)
-		return
+		return notApplicableErrorf("skipping node %q as role is not master or minion", name)
 	}
 	glog.V(1).Infof("Bringing up %q as %s", name, asType)
 
 	err := SetupForPlugin(&node, c)
 	if err != nil {
-		if strings.HasPrefix(err.Error(), "skipping -") {
-			glog.Warning(err.Error())
-			// Will keep going...
-		} else {
-			glog.Fatal(err.Error())
-			os.Exit(1) // TODO: Rollback?
+		if !IsSkipped(err) {
+			return err // TODO: Rollback?
+		}
+		glog.Warning(err.Error())
+		// Will keep going...
+	}
+
+	if c.General.PersistRoutes {
+		err = InstallRoutesUnit(name, c)
+		if err != nil {
+			return err
 		}
 	}
 
 	err = RestartKubeletService()
 	if err != nil {
-		glog.Fatalf(err.Error())
-		os.Exit(1) // TODO: Rollback?
+		return err // TODO: Rollback?
 	}
 
 	if node.IsMaster {
 		err = PlaceCertificateAndKeyForCA(c.General.WorkArea, c.General.K8sCertArea)
 		if err != nil {
-			glog.Fatalf(err.Error())
-			os.Exit(1) // TODO: Rollback?
+			return err // TODO: Rollback?
 		}
 	}
 
 	err = StartKubernetes(&node, c)
 	if err != nil {
-		glog.Fatalf(err.Error())
-		os.Exit(1) // TODO: Rollback?
+		return err // TODO: Rollback?
+	}
+
+	err = c.General.CNIPlugin.Verify(&node)
+	if err != nil {
+		return err
 	}
 
 	// FUTURE: update ~/.kube/config (how to know user?)
 
 	glog.Infof("Node %q brought up", name)
+	return nil
 }
@@ -83,6 +83,45 @@ func TestEnsureCNIAreaExists(t *testing.T) {
 	}
 }
 
+func TestEnsureCNIAreaExistsKeepsConfigFile(t *testing.T) {
+	basePath := TempFileName(os.TempDir(), "-area")
+	HelperSetupArea(basePath, t)
+	defer HelperCleanupArea(basePath, t)
+
+	for _, name := range []string{lazyjack.CNIConfFile, "10-other.conf"} {
+		err := ioutil.WriteFile(filepath.Join(basePath, name), []byte("{}"), 0755)
+		if err != nil {
+			t.Fatalf("ERROR: Test setup failure: %s", err.Error())
+		}
+	}
+	err := lazyjack.EnsureCNIAreaExists(basePath)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to use existing CNI area %q: %s", basePath, err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(basePath, lazyjack.CNIConfFile)); err != nil {
+		t.Fatalf("FAILED: Expected lazyjack CNI config file to be kept: %s", err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(basePath, "10-other.conf")); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected other CNI config file to be removed")
+	}
+
+	// Not a config file, so is removed
+	err = os.Remove(filepath.Join(basePath, lazyjack.CNIConfFile))
+	if err == nil {
+		err = os.Mkdir(filepath.Join(basePath, lazyjack.CNIConfFile), 0755)
+	}
+	if err != nil {
+		t.Fatalf("ERROR: Test setup failure: %s", err.Error())
+	}
+	err = lazyjack.EnsureCNIAreaExists(basePath)
+	if err != nil {
+		t.Fatalf("FAILED: Expected to be able to use existing CNI area %q: %s", basePath, err.Error())
+	}
+	if _, err = os.Stat(filepath.Join(basePath, lazyjack.CNIConfFile)); !os.IsNotExist(err) {
+		t.Fatalf("FAILED: Expected directory with CNI config file name to be removed")
+	}
+}
+
 func TestFailingEnsureCNIAreaExists(t *testing.T) {
 	basePath := TempFileName(os.TempDir(), "-area")
 	defer HelperCleanupArea(basePath, t)
@@ -549,7 +588,7 @@ func TestFailedRouteCreateSetupForPlugin(t *testing.T) {
 	if err == nil {
 		t.Fatalf("FAILED: Expected to not be able to create route")
 	}
-	expected := "unable to add pod network route for fd00:40:0:0:20::/80 to minion1: mock failure adding route"
+	expected := "unable to add pod network route to fd00:40:0:0:20::/80 via fd00:100::20: mock failure adding route"
 	if err.Error() != expected {
 		t.Fatalf("FAILED: Expected msg %q, got %q", expected, err.Error())
 	}
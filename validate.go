@@ -17,7 +17,7 @@ func ValidateCommand(command string) (string, error) {
 	if command == "" {
 		return "", fmt.Errorf("missing command")
 	}
-	validCommands := []string{"init", "prepare", "up", "down", "clean", "version"}
+	validCommands := []string{"init", "prepare", "up", "down", "clean", "dns64", "routes", "sync-routes", "version"}
 	for _, c := range validCommands {
 		if strings.EqualFold(c, command) {
 			return c, nil
@@ -104,9 +104,9 @@ func ValidateNodeOpModes(netMode string, node *Node) error {
 
 // ValidateOpModesForAllNodes checks the operation mode for all nodes,
 // and ensures that there is exactly one master node. Note: Side effect
-// is storing node name in node struct for ease of access
+// is storing node name in node struct for ease of access. Multiple nodes
+// can run the DNS64 and NAT64 servers (see ValidateServerNodes).
 //
-// TODO: determine if allow duplicate DNS/NAT nodes
 // TODO: test missing DNS/NAT node
 func ValidateOpModesForAllNodes(c *Config) error {
 	numMasters := 0
@@ -385,6 +385,19 @@ func CalculateDerivedFields(c *Config) error {
 		return fmt.Errorf("invalid service network: %v", err)
 	}
 	glog.V(4).Infof("Service network is using %s", c.Service.Info.Mode)
+	if c.Service.CIDR2 != "" {
+		if c.General.Mode != DualStackNetMode {
+			return fmt.Errorf("see second service network CIDR (%s, %s), when in %s mode", c.Service.CIDR, c.Service.CIDR2, c.General.Mode)
+		}
+		err = ExtractNetInfo(c.Service.CIDR2, &c.Service.Info2, CheckServiceSize)
+		if err != nil {
+			return fmt.Errorf("invalid service network CIDR2: %v", err)
+		}
+		if c.Service.Info2.Mode == c.Service.Info.Mode {
+			return fmt.Errorf("for dual-stack both service networks specified are %s mode - need one of each", c.Service.Info.Mode)
+		}
+		glog.V(4).Infof("Service network is also using %s", c.Service.Info2.Mode)
+	}
 
 	if c.General.Mode == IPv6NetMode {
 		err = ExtractNetInfo(c.Support.CIDR, &c.Support.Info, CheckUnlimitedSize)
@@ -454,7 +467,10 @@ func ValidateDNS64Fields(c *Config) error {
 	if c.DNS64.AllowIPv6Use {
 		c.DNS64.AllowAAAAUse = true
 	}
-	return nil
+	if err := ValidateDNS64Backend(c); err != nil {
+		return err
+	}
+	return ValidateNamedOptions(c)
 }
 
 // ValidateNAT64Fields checks that the subnet for the IPv4 mapping
@@ -464,6 +480,10 @@ func ValidateNAT64Fields(c *Config) error {
 	if c.General.Mode != IPv6NetMode {
 		return nil
 	}
+	err := ValidateNAT64Backend(c)
+	if err != nil {
+		return err
+	}
 	if c.Support.V4CIDR == "" {
 		return fmt.Errorf("missing IPv4 support network CIDR")
 	}
@@ -508,8 +528,9 @@ func ParseVersion(version string) (string, error) {
 }
 
 // ValidateSoftwareVersions checks that the software used is compatible with the
-// Lazyjack tool. As a side effect, the kubeadm version (major.minor) is stored,
-// so that the proper config file can be generated.
+// Lazyjack tool. As a side effect, the kubeadm version (major.minor) and the
+// kubeadm configuration API version are stored, so that the proper config file
+// can be generated.
 //
 // If the user specifies the Kubernetes version to use, this makes sure that it is
 // the same major/minor version as KubeAdm.
@@ -524,13 +545,14 @@ func ValidateSoftwareVersions(c *Config) error {
 	if err != nil {
 		return err
 	}
-	switch version {
-	case "1.10", "1.11", "1.12", "1.13":
-		glog.V(1).Infof("KubeAdm version is %s", version)
-	default:
+	apiVersion, supported := KubeAdmAPIVersionFor(version)
+	if supported {
+		glog.V(1).Infof("KubeAdm version is %s (config API %s)", version, apiVersion)
+	} else {
 		glog.Warningf("WARNING! Kubeadm version %q may not be supported", version)
 	}
 	c.General.KubeAdmVersion = version
+	c.General.KubeAdmAPIVersion = apiVersion
 
 	if c.General.K8sVersion != "" && c.General.K8sVersion != "latest" {
 		k8sVersion, err := ParseVersion(c.General.K8sVersion)
@@ -566,14 +588,15 @@ func SetupHandles(c *Config) error {
 		return fmt.Errorf("internal Error - unable to access networking package: %v", err)
 	}
 	c.General.NetMgr = NetMgr{Server: &NetLink{h: handle}}
-	c.General.Hyper = &Docker{Command: DefaultDockerCommand}
-	return nil
+	c.General.Hyper, err = NewHypervisor(c)
+	return err
 }
 
 // ValidateConfigContents checks contents of the config file.
-// Token and certificate hash validation is ignored during init
-// phase, which will generate these values, or if running in
-// insecure mode. Side effect is that base paths are set up based on
+// The token and certificate hash are loaded from the secrets file,
+// command, or environment. Token and certificate hash validation
+// is ignored during init phase, which will generate these values,
+// or if running in insecure mode. Side effect is that base paths are set up based on
 // defaults (unless overriden by config file). The netlink library
 // handle is set (allowing UTs to override and mock that library).
 // TODO: Validate support net v4 subnet > NAT64 subnet
@@ -592,9 +615,33 @@ func ValidateConfigContents(c *Config, ignoreMissing bool) error {
 		return err
 	}
 
+	err = ValidateRuntime(c)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateHypervisor(c)
+	if err != nil {
+		return err
+	}
+
+	err = ValidatePersistentNet(c)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateBridge(c)
+	if err != nil {
+		return err
+	}
+
 	if c.General.Insecure {
 		ignoreMissing = true // force on
 	}
+	err = LoadSecrets(c, ignoreMissing)
+	if err != nil {
+		return err
+	}
 	err = ValidateToken(c.General.Token, ignoreMissing)
 	if err != nil {
 		return err
@@ -627,11 +674,31 @@ func ValidateConfigContents(c *Config, ignoreMissing bool) error {
 		return err
 	}
 
+	err = ValidateImages(c)
+	if err != nil {
+		return err
+	}
+
 	err = ValidateNAT64Fields(c)
 	if err != nil {
 		return err
 	}
 
+	err = ValidateServerNodes(c)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateHealthChecks(c)
+	if err != nil {
+		return err
+	}
+
+	err = ValidateRoutesInterval(c)
+	if err != nil {
+		return err
+	}
+
 	err = CalculateDerivedFields(c)
 	if err != nil {
 		return err
@@ -642,6 +709,11 @@ func ValidateConfigContents(c *Config, ignoreMissing bool) error {
 		return err
 	}
 
+	err = ValidateKubeAdmPatches(c)
+	if err != nil {
+		return err
+	}
+
 	err = SetupHandles(c)
 	if err != nil {
 		return err
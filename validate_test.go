@@ -34,6 +34,12 @@ func TestValidateCommand(t *testing.T) {
 			expected:    "up",
 			expectedStr: "",
 		},
+		{
+			name:        "DNS64 command",
+			command:     "dns64",
+			expected:    "dns64",
+			expectedStr: "",
+		},
 		{
 			name:        "Mixed case command",
 			command:     "PrEPaRe",
@@ -1298,7 +1304,8 @@ func TestCalculateDerivedFieldsDualStackSuccess(t *testing.T) {
 			CIDR2: "10.192.0.0/16",
 		},
 		Service: lazyjack.ServiceNetwork{
-			CIDR: "fd00:30::/110",
+			CIDR:  "fd00:30::/110",
+			CIDR2: "10.96.0.0/12",
 		},
 		Pod: lazyjack.PodNetwork{
 			CIDR:  "fd00:40::/72",
@@ -1333,6 +1340,10 @@ func TestCalculateDerivedFieldsDualStackSuccess(t *testing.T) {
 	if c.Service.Info.Prefix != expectedServicePrefix {
 		t.Errorf("Derived service prefix is incorrect. Expected %q, got %q", expectedServicePrefix, c.Service.Info.Prefix)
 	}
+	expectedServicePrefix = "10.96.0."
+	if c.Service.Info2.Prefix != expectedServicePrefix {
+		t.Errorf("Derived service prefix2 is incorrect. Expected %q, got %q", expectedServicePrefix, c.Service.Info2.Prefix)
+	}
 	expectedPodPrefix := "fd00:40:0:0:"
 	if c.Pod.Info[0].Prefix != expectedPodPrefix {
 		t.Errorf("Derived pod prefix is incorrect. Expected %q, got %q", expectedPodPrefix, c.Pod.Info[0].Prefix)
@@ -1595,6 +1606,80 @@ func TestFailedServiceCIDRCalculateDerivedFields(t *testing.T) {
 	}
 }
 
+func TestFailedSecondServiceCIDRCalculateDerivedFieldsDualStack(t *testing.T) {
+	c := &lazyjack.Config{
+		Mgmt: lazyjack.ManagementNetwork{
+			CIDR:  "fd00:20::/64",
+			CIDR2: "10.192.0.0/16",
+		},
+		Service: lazyjack.ServiceNetwork{
+			CIDR:  "fd00:30::/110",
+			CIDR2: "10.96.0.0.0/12",
+		},
+		General: lazyjack.GeneralSettings{
+			Mode: lazyjack.DualStackNetMode,
+		},
+	}
+
+	err := lazyjack.CalculateDerivedFields(c)
+	if err == nil {
+		t.Fatalf("Expected failure with invalid second service CIDR")
+	}
+	expectedMsg := "invalid service network CIDR2: invalid CIDR address: 10.96.0.0.0/12"
+	if err.Error() != expectedMsg {
+		t.Fatalf("Expected error message %q, got %q", expectedMsg, err.Error())
+	}
+}
+
+func TestFailedBothV6ServiceCIDRCalculateDerivedFieldsDualStack(t *testing.T) {
+	c := &lazyjack.Config{
+		Mgmt: lazyjack.ManagementNetwork{
+			CIDR:  "fd00:20::/64",
+			CIDR2: "10.192.0.0/16",
+		},
+		Service: lazyjack.ServiceNetwork{
+			CIDR:  "fd00:30::/110",
+			CIDR2: "fd00:31::/110",
+		},
+		General: lazyjack.GeneralSettings{
+			Mode: lazyjack.DualStackNetMode,
+		},
+	}
+
+	err := lazyjack.CalculateDerivedFields(c)
+	if err == nil {
+		t.Fatalf("Expected failure with both service CIDRs IPv6")
+	}
+	expectedMsg := "for dual-stack both service networks specified are ipv6 mode - need one of each"
+	if err.Error() != expectedMsg {
+		t.Fatalf("Expected error message %q, got %q", expectedMsg, err.Error())
+	}
+}
+
+func TestFailedSecondServiceCIDRCalculateDerivedFieldsV6Mode(t *testing.T) {
+	c := &lazyjack.Config{
+		Mgmt: lazyjack.ManagementNetwork{
+			CIDR: "fd00:20::/64",
+		},
+		Service: lazyjack.ServiceNetwork{
+			CIDR:  "fd00:30::/110",
+			CIDR2: "10.96.0.0/12",
+		},
+		General: lazyjack.GeneralSettings{
+			Mode: lazyjack.IPv6NetMode,
+		},
+	}
+
+	err := lazyjack.CalculateDerivedFields(c)
+	if err == nil {
+		t.Fatalf("Expected failure with second service CIDR in IPv6 mode")
+	}
+	expectedMsg := "see second service network CIDR (fd00:30::/110, 10.96.0.0/12), when in ipv6 mode"
+	if err.Error() != expectedMsg {
+		t.Fatalf("Expected error message %q, got %q", expectedMsg, err.Error())
+	}
+}
+
 func TestFailedSupportCIDRCalculateDerivedFields(t *testing.T) {
 	c := &lazyjack.Config{
 		Mgmt: lazyjack.ManagementNetwork{
@@ -2111,6 +2196,8 @@ func TestValidateSoftwareVersions(t *testing.T) {
 				t.Errorf("[%s] Did not expect error, but see %q", tc.name, err.Error())
 			} else if tc.version != c.General.KubeAdmVersion {
 				t.Errorf("[%s] Expected version %q, but got %q", tc.name, tc.version, c.General.KubeAdmVersion)
+			} else if apiVersion, _ := lazyjack.KubeAdmAPIVersionFor(tc.version); apiVersion != c.General.KubeAdmAPIVersion {
+				t.Errorf("[%s] Expected API version %q, but got %q", tc.name, apiVersion, c.General.KubeAdmAPIVersion)
 			}
 		} else {
 			if err == nil {